@@ -0,0 +1,20 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// TrustedProxies are the proxies in front of the gateway, from
+// TRUSTED_PROXIES as comma separated IPs or CIDRs. Only they may set the
+// client IP through X-Forwarded-For or X-Real-IP; unset trusts none, so the
+// client IP is the connecting peer and a header can't spoof it.
+func TrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
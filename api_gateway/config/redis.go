@@ -0,0 +1,43 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/tird4d/go-microservices/api_gateway/logger"
+)
+
+// RedisClient reads the revoked token denylist that auth_service writes
+var RedisClient *redis.Client
+
+// ConnectRedis connects to REDIS_ADDR. An unreachable Redis is logged rather
+// than fatal: token checks then fail over to auth_service, if allowed.
+func ConnectRedis() {
+	addr := os.Getenv("REDIS_ADDR")
+	useTLS, _ := strconv.ParseBool(os.Getenv("REDIS_TLS"))
+
+	opts := &redis.Options{
+		Addr:     addr,
+		DB:       0,
+		Username: os.Getenv("REDIS_USERNAME"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+	}
+	if useTLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	RedisClient = redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := RedisClient.Ping(ctx).Err(); err != nil {
+		logger.Log.Errorw("❌ Failed to connect to Redis", "addr", addr, "tls", useTLS, "error", err)
+		return
+	}
+	logger.Log.Infow("✅ Redis client connected", "addr", addr)
+}
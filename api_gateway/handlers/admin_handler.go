@@ -18,15 +18,25 @@ type AdminHandler struct {
 	UserClient userpb.UserServiceClient
 }
 
+// UsersHandler handles HTTP GET /admin/users?page=2&page_size=10. Passing
+// the next_page_token of a response as page_token continues after it.
 func (a *AdminHandler) UsersHandler(c *gin.Context) {
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	users, err := a.UserClient.GetAllUsers(ctx, &userpb.GetAllUsersRequest{
-		Page:     1,
-		PageSize: 10,
+		Page:      int64(parseIntDefault(c.DefaultQuery("page", "1"), 1)),
+		PageSize:  int64(parseIntDefault(c.DefaultQuery("page_size", "10"), 10)),
+		PageToken: c.Query("page_token"),
 	})
+	if status.Code(err) == codes.InvalidArgument {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": grpcErrorMessage(err),
+			"status":  "error",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "Failed to retrieve users",
@@ -36,12 +46,39 @@ func (a *AdminHandler) UsersHandler(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"users":   users.Users,
-		"message": "Users retrieved successfully",
-		"status":  "success",
+		"users":           users.Users,
+		"total":           users.Total,
+		"next_page_token": users.NextPageToken,
+		"message":         "Users retrieved successfully",
+		"status":          "success",
+	})
+}
+
+// GetUserHandler handles HTTP GET /admin/users/:user_id. The ETag it sets is
+// what UpdateUserHandler and DeleteHandler expect as If-Match.
+func (a *AdminHandler) GetUserHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := a.UserClient.GetUser(ctx, &userpb.GetUserRequest{Id: c.Param("user_id")})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	setETag(c, user.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"id":      user.Id,
+		"name":    user.Name,
+		"email":   user.Email,
+		"role":    user.Role,
+		"locale":  user.Locale,
+		"version": user.Version,
 	})
 }
 
+// UpdateUserHandler changes the fields present in the body. With If-Match it
+// answers 412 instead of overwriting someone else's change.
 func (a *AdminHandler) UpdateUserHandler(c *gin.Context) {
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
@@ -49,9 +86,10 @@ func (a *AdminHandler) UpdateUserHandler(c *gin.Context) {
 
 	userId := c.Param("user_id")
 	var body struct {
-		Name  string `json:"name" binding:"required"`
-		Email string `json:"email"`
-		Role  string `json:"role"`
+		Name   *string `json:"name"`
+		Email  *string `json:"email"`
+		Role   *string `json:"role"`
+		Locale *string `json:"locale"`
 	}
 
 	if err := c.ShouldBindJSON(&body); err != nil {
@@ -59,27 +97,40 @@ func (a *AdminHandler) UpdateUserHandler(c *gin.Context) {
 		return
 	}
 
-	updateRequest := userpb.UpdateUserRequest{Id: userId}
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	updateRequest := userpb.UpdateUserRequest{Id: userId, ExpectedVersion: expectedVersion}
 
-	if _, ok := c.GetPostForm("name"); ok {
-		updateRequest.Name = &wrapperspb.StringValue{Value: body.Name}
+	if body.Name != nil {
+		updateRequest.Name = &wrapperspb.StringValue{Value: *body.Name}
+	}
+	if body.Email != nil {
+		updateRequest.Email = &wrapperspb.StringValue{Value: *body.Email}
 	}
-	if _, ok := c.GetPostForm("email"); ok {
-		updateRequest.Email = &wrapperspb.StringValue{Value: body.Email}
+	if body.Role != nil {
+		updateRequest.Role = &wrapperspb.StringValue{Value: *body.Role}
 	}
-	if _, ok := c.GetPostForm("role"); ok {
-		updateRequest.Role = &wrapperspb.StringValue{Value: body.Role}
+	if body.Locale != nil {
+		updateRequest.Locale = &wrapperspb.StringValue{Value: *body.Locale}
 	}
 
-	updateRequest.Id = userId
-	_, err := a.UserClient.UpdateUser(ctx, &updateRequest)
+	res, err := a.UserClient.UpdateUser(ctx, &updateRequest)
 
 	if err != nil {
 		logger.Log.Infof("Error updating user: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		switch status.Code(err) {
+		case codes.Aborted, codes.NotFound, codes.AlreadyExists, codes.InvalidArgument:
+			c.JSON(conditionalHTTPStatus(err), gin.H{"error": grpcErrorMessage(err)})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		}
 		return
 	}
 
+	setETag(c, res.Version)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User updated successfully",
 		"status":  "success",
@@ -92,13 +143,22 @@ func (a *AdminHandler) DeleteHandler(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	res, err := a.UserClient.DeleteUser(ctx, &userpb.DeleteUserRequest{Id: userId})
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	res, err := a.UserClient.DeleteUser(ctx, &userpb.DeleteUserRequest{Id: userId, ExpectedVersion: expectedVersion})
 
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
+		if status.Code(err) == codes.Aborted {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": grpcErrorMessage(err)})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
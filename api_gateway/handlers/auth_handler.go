@@ -2,19 +2,41 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/tird4d/go-microservices/api_gateway/logger"
+	"github.com/tird4d/go-microservices/api_gateway/middlewares"
+	"github.com/tird4d/go-microservices/auth_service/jwks"
 	authpb "github.com/tird4d/go-microservices/auth_service/proto"
+	cartpb "github.com/tird4d/go-microservices/cart_service/proto"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type GatewayHandler struct {
 	authpb.UnimplementedAuthServiceServer
 	AuthClient authpb.AuthServiceClient
+	CartClient cartpb.CartServiceClient
+	// Verifier reads the user out of the access token a login returns,
+	// without another round trip to auth_service
+	Verifier AccessTokenVerifier
 }
 
+// AccessTokenVerifier returns the claims of a valid access token; it is
+// implemented by middlewares.TokenVerifier.
+type AccessTokenVerifier interface {
+	Verify(ctx context.Context, token string) (*middlewares.TokenClaims, error)
+}
+
+// DeviceIDHeader carries a stable ID of the client app. Refresh tokens are
+// bound to it, or to the User-Agent when it is missing, and only work for the
+// client they were issued to.
+const DeviceIDHeader = "X-Device-ID"
+
 func (h *GatewayHandler) RefreshTokenHandler(c *gin.Context) {
 
 	// Get the old refresh token from the request
@@ -33,9 +55,15 @@ func (h *GatewayHandler) RefreshTokenHandler(c *gin.Context) {
 	defer cancel()
 	res, err := h.AuthClient.ValidateRefreshToken(ctx, &authpb.ValidateRefreshTokenRequest{
 		RefreshToken: body.RefreshToken,
+		Client:       clientInfo(c),
 	})
 
-	if err != nil || res == nil {
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.Aborted, codes.Unavailable:
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	default:
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
 		return
 	}
@@ -64,13 +92,21 @@ func (h *GatewayHandler) LoginHandler(c *gin.Context) {
 	res, err := h.AuthClient.Login(ctx, &authpb.LoginRequest{
 		Email:    body.Email,
 		Password: body.Password,
+		Client:   clientInfo(c),
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// Wrong credentials are 401; a lockout after too many failed
+		// attempts is 429 with Retry-After
+		setRetryAfter(c, err)
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
 		return
 	}
 
+	if anonymousID := c.GetHeader(CartIDHeader); anonymousID != "" {
+		h.mergeAnonymousCart(ctx, res.Token, anonymousID)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"token":         res.Token,
 		"refresh_token": res.RefreshToken,
@@ -93,6 +129,8 @@ func (h *GatewayHandler) LogoutHandler(c *gin.Context) {
 	defer cancel()
 	_, err := h.AuthClient.Logout(ctx, &authpb.LogoutRequest{
 		RefreshToken: body.RefreshToken,
+		// Revoked so it can't be used until it expires
+		AccessToken: c.GetString("access_token"),
 	})
 
 	if err != nil {
@@ -104,3 +142,80 @@ func (h *GatewayHandler) LogoutHandler(c *gin.Context) {
 	})
 
 }
+
+// clientInfo identifies the client of a login or refresh request. The IP
+// comes from a forwarding header only when the router trusts the peer that
+// sent it; see config.TrustedProxies.
+func clientInfo(c *gin.Context) *authpb.ClientInfo {
+	return &authpb.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		DeviceId:  c.GetHeader(DeviceIDHeader),
+		Ip:        c.ClientIP(),
+	}
+}
+
+// jwksMaxAge is how long verifiers may cache the key set. A new key has to be
+// published at least this long before it becomes the active one.
+const jwksMaxAge = 5 * time.Minute
+
+// JWKSHandler handles HTTP GET /.well-known/jwks.json - publishes the keys
+// that verify access tokens
+func (h *GatewayHandler) JWKSHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.AuthClient.GetJWKS(ctx, &authpb.GetJWKSRequest{})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	c.JSON(http.StatusOK, jwks.FromProto(res))
+}
+
+// mergeAnonymousCart moves the cart a shopper filled before logging in into
+// their user cart. Login still succeeds if the merge fails; the anonymous cart
+// stays around until it expires.
+func (h *GatewayHandler) mergeAnonymousCart(ctx context.Context, token, anonymousID string) {
+	if h.CartClient == nil || h.Verifier == nil {
+		return
+	}
+
+	claims, err := h.Verifier.Verify(ctx, token)
+	if err != nil {
+		logger.Log.Warnw("⚠️ Could not resolve user for cart merge", "error", err)
+		return
+	}
+
+	if _, err := h.CartClient.MergeCarts(ctx, &cartpb.MergeCartsRequest{
+		UserId:      claims.UserID,
+		AnonymousId: anonymousID,
+	}); err != nil {
+		logger.Log.Warnw("⚠️ Failed to merge anonymous cart", "user_id", claims.UserID, "error", err)
+	}
+}
+
+// UnlockUserHandler handles HTTP POST /admin/users/:user_id/unlock - lets a
+// user locked out after failed logins try again right away
+func (h *GatewayHandler) UnlockUserHandler(c *gin.Context) {
+	h.unlockLogin(c, &authpb.UnlockLoginRequest{UserId: c.Param("user_id")})
+}
+
+// UnlockIPHandler handles HTTP POST /admin/ips/:ip/unlock - lifts the login
+// lockout of a client IP
+func (h *GatewayHandler) UnlockIPHandler(c *gin.Context) {
+	h.unlockLogin(c, &authpb.UnlockLoginRequest{Ip: c.Param("ip")})
+}
+
+func (h *GatewayHandler) unlockLogin(c *gin.Context, req *authpb.UnlockLoginRequest) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.AuthClient.UnlockLogin(ctx, req); err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "login unlocked successfully"})
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/api_gateway/config"
+	"github.com/tird4d/go-microservices/api_gateway/middlewares"
+	authpb "github.com/tird4d/go-microservices/auth_service/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// fakeAuthClient serves a fixed key set; other methods panic through the nil interface
+type fakeAuthClient struct {
+	authpb.AuthServiceClient
+	refreshReq *authpb.ValidateRefreshTokenRequest
+	refreshErr error
+	loginErr   error
+}
+
+func (f *fakeAuthClient) Login(ctx context.Context, in *authpb.LoginRequest, opts ...grpc.CallOption) (*authpb.LoginResponse, error) {
+	if f.loginErr != nil {
+		return nil, f.loginErr
+	}
+	return &authpb.LoginResponse{Token: "access", RefreshToken: "refresh", Message: "Login successful"}, nil
+}
+
+func (f *fakeAuthClient) ValidateRefreshToken(ctx context.Context, in *authpb.ValidateRefreshTokenRequest, opts ...grpc.CallOption) (*authpb.ValidateRefreshTokenResponse, error) {
+	f.refreshReq = in
+	if f.refreshErr != nil {
+		return nil, f.refreshErr
+	}
+	return &authpb.ValidateRefreshTokenResponse{AccessToken: "access", RefreshToken: "next"}, nil
+}
+
+func (f *fakeAuthClient) GetJWKS(ctx context.Context, in *authpb.GetJWKSRequest, opts ...grpc.CallOption) (*authpb.GetJWKSResponse, error) {
+	return &authpb.GetJWKSResponse{Keys: []*authpb.JsonWebKey{
+		{Kty: "OKP", Kid: "2024-06", Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+	}}, nil
+}
+
+func TestJWKSHandler(t *testing.T) {
+	router := gin.New()
+	handler := &GatewayHandler{AuthClient: &fakeAuthClient{}}
+	router.GET("/.well-known/jwks.json", handler.JWKSHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+	// RSA members are left out of an OKP key
+	assert.JSONEq(t, `{"keys":[{"kty":"OKP","kid":"2024-06","use":"sig","alg":"EdDSA","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}]}`, w.Body.String())
+}
+
+func TestRefreshTokenHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"rotated", nil, http.StatusOK},
+		{"invalid or replayed", status.Error(codes.Unauthenticated, "invalid refresh token"), http.StatusUnauthorized},
+		{"concurrent refresh", status.Error(codes.Aborted, "refresh token is being rotated"), http.StatusConflict},
+		{"user_service down", status.Error(codes.Unavailable, "cannot connect to user service"), http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeAuthClient{refreshErr: tt.err}
+			router := gin.New()
+			router.POST("/refresh", (&GatewayHandler{AuthClient: client}).RefreshTokenHandler)
+
+			req := httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(`{"refresh_token":"old"}`))
+			req.Header.Set("User-Agent", "app/1.0")
+			req.Header.Set(DeviceIDHeader, "device-1")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.want, w.Code)
+			// The token is bound to the client it was issued to
+			require.NotNil(t, client.refreshReq)
+			assert.Equal(t, "app/1.0", client.refreshReq.GetClient().GetUserAgent())
+			assert.Equal(t, "device-1", client.refreshReq.GetClient().GetDeviceId())
+		})
+	}
+}
+
+func TestClientInfo_TrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies string
+		want    string
+	}{
+		{"no proxy trusted", "", "198.51.100.9"},
+		{"untrusted peer", "10.0.0.0/16", "198.51.100.9"},
+		{"trusted ingress", "198.51.100.0/24", "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.proxies)
+			client := &fakeAuthClient{}
+			router := gin.New()
+			require.NoError(t, router.SetTrustedProxies(config.TrustedProxies()))
+			router.POST("/refresh", (&GatewayHandler{AuthClient: client}).RefreshTokenHandler)
+
+			req := httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(`{"refresh_token":"old"}`))
+			req.RemoteAddr = "198.51.100.9:41234"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			req.Header.Set("X-Real-IP", "203.0.113.8")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.want, client.refreshReq.GetClient().GetIp())
+		})
+	}
+}
+
+func TestLoginHandler_LockedOut(t *testing.T) {
+	st, err := status.New(codes.ResourceExhausted, "too many failed login attempts, try again later").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/login", (&GatewayHandler{AuthClient: &fakeAuthClient{loginErr: st.Err()}}).LoginHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"a@example.com","password":"secret123"}`)))
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"too many failed login attempts, try again later"}`, w.Body.String())
+}
+
+func TestLoginHandler_InvalidCredentials(t *testing.T) {
+	router := gin.New()
+	loginErr := status.Error(codes.Unauthenticated, "invalid email or password")
+	router.POST("/login", (&GatewayHandler{AuthClient: &fakeAuthClient{loginErr: loginErr}}).LoginHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"a@example.com","password":"secret123"}`)))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"invalid email or password"}`, w.Body.String())
+}
+
+// fakeVerifier accepts one token
+type fakeVerifier struct {
+	token  string
+	claims *middlewares.TokenClaims
+}
+
+func (f *fakeVerifier) Verify(ctx context.Context, token string) (*middlewares.TokenClaims, error) {
+	if token != f.token {
+		return nil, errors.New("invalid token")
+	}
+	return f.claims, nil
+}
+
+func TestLoginHandler_MergesAnonymousCart(t *testing.T) {
+	carts := &fakeCartClient{}
+	handler := &GatewayHandler{
+		// Validate isn't faked, so a remote lookup of the user would panic
+		AuthClient: &fakeAuthClient{},
+		CartClient: carts,
+		Verifier:   &fakeVerifier{token: "access", claims: &middlewares.TokenClaims{UserID: "u1"}},
+	}
+	router := gin.New()
+	router.POST("/login", handler.LoginHandler)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"a@example.com","password":"secret123"}`))
+	req.Header.Set(CartIDHeader, "anon-1")
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, carts.merged, 1)
+	assert.Equal(t, "u1", carts.merged[0].UserId)
+	assert.Equal(t, "anon-1", carts.merged[0].AnonymousId)
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	cartpb "github.com/tird4d/go-microservices/cart_service/proto"
+	"github.com/tird4d/go-microservices/product_service/money"
+)
+
+// CartIDHeader carries the anonymous cart ID. The gateway hands out a new one
+// on the first anonymous AddItem; clients send it back on later cart requests
+// and on login so the anonymous cart is merged into the user's cart.
+const CartIDHeader = "X-Cart-ID"
+
+type CartHandler struct {
+	CartClient cartpb.CartServiceClient
+}
+
+// cartOwner returns the logged-in user, if OptionalJWTAuthMiddleware found one,
+// and the anonymous cart ID sent by the client
+func cartOwner(c *gin.Context) (userID, anonymousID string) {
+	if raw, exists := c.Get("user_id"); exists {
+		userID, _ = raw.(string)
+	}
+	return userID, c.GetHeader(CartIDHeader)
+}
+
+// GetCartHandler handles HTTP GET /cart - returns the current cart
+func (h *CartHandler) GetCartHandler(c *gin.Context) {
+	userID, anonymousID := cartOwner(c)
+
+	// Nothing identifies a cart yet, so it's necessarily empty
+	if userID == "" && anonymousID == "" {
+		c.JSON(http.StatusOK, cartResponse(&cartpb.Cart{Total: &cartpb.Money{Currency: money.DefaultCurrency}}))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.CartClient.GetCart(ctx, &cartpb.GetCartRequest{
+		UserId:      userID,
+		AnonymousId: anonymousID,
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, cartResponse(res))
+}
+
+// AddItemHandler handles HTTP POST /cart/items - adds a product to the cart.
+// Products with variants need the sku of the chosen variant.
+func (h *CartHandler) AddItemHandler(c *gin.Context) {
+	var body struct {
+		ProductID string `json:"product_id" binding:"required"`
+		SKU       string `json:"sku"`
+		Quantity  int32  `json:"quantity" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, anonymousID := cartOwner(c)
+
+	// First item of an anonymous shopper: start a new anonymous cart
+	if userID == "" && anonymousID == "" {
+		anonymousID = uuid.NewString()
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.CartClient.AddItem(ctx, &cartpb.AddItemRequest{
+		UserId:      userID,
+		AnonymousId: anonymousID,
+		ProductId:   body.ProductID,
+		Sku:         body.SKU,
+		Quantity:    body.Quantity,
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	if res.AnonymousId != "" {
+		c.Header(CartIDHeader, res.AnonymousId)
+	}
+	c.JSON(http.StatusOK, cartResponse(res))
+}
+
+// UpdateQuantityHandler handles HTTP PUT /cart/items/:product_id?sku=... - sets
+// a line's quantity; sku picks the variant line
+func (h *CartHandler) UpdateQuantityHandler(c *gin.Context) {
+	var body struct {
+		Quantity int32 `json:"quantity" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, anonymousID := cartOwner(c)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.CartClient.UpdateQuantity(ctx, &cartpb.UpdateQuantityRequest{
+		UserId:      userID,
+		AnonymousId: anonymousID,
+		ProductId:   c.Param("product_id"),
+		Sku:         c.Query("sku"),
+		Quantity:    body.Quantity,
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, cartResponse(res))
+}
+
+// RemoveItemHandler handles HTTP DELETE /cart/items/:product_id?sku=... - removes a line
+func (h *CartHandler) RemoveItemHandler(c *gin.Context) {
+	userID, anonymousID := cartOwner(c)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.CartClient.RemoveItem(ctx, &cartpb.RemoveItemRequest{
+		UserId:      userID,
+		AnonymousId: anonymousID,
+		ProductId:   c.Param("product_id"),
+		Sku:         c.Query("sku"),
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, cartResponse(res))
+}
+
+// ClearCartHandler handles HTTP DELETE /cart - empties the cart
+func (h *CartHandler) ClearCartHandler(c *gin.Context) {
+	userID, anonymousID := cartOwner(c)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.CartClient.ClearCart(ctx, &cartpb.ClearCartRequest{
+		UserId:      userID,
+		AnonymousId: anonymousID,
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": res.Message})
+}
+
+func cartResponse(cart *cartpb.Cart) gin.H {
+	items := make([]gin.H, len(cart.Items))
+	for i, item := range cart.Items {
+		items[i] = gin.H{
+			"product_id":   item.ProductId,
+			"product_name": item.ProductName,
+			"unit_price":   moneyResponse(item.GetUnitPrice()),
+			"quantity":     item.Quantity,
+			"line_total":   moneyResponse(item.GetLineTotal()),
+			"available":    item.Available,
+		}
+		if item.Sku != "" {
+			items[i]["sku"] = item.Sku
+		}
+	}
+
+	res := gin.H{
+		"items":      items,
+		"total":      moneyResponse(cart.GetTotal()),
+		"item_count": cart.ItemCount,
+	}
+	if cart.AnonymousId != "" {
+		res["cart_id"] = cart.AnonymousId
+	}
+	if cart.ExpiresAt != nil {
+		res["expires_at"] = cart.ExpiresAt.AsTime()
+	}
+
+	return res
+}
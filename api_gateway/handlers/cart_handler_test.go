@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cartpb "github.com/tird4d/go-microservices/cart_service/proto"
+	"google.golang.org/grpc"
+)
+
+// fakeCartClient records AddItem and MergeCarts requests; other methods panic through the nil interface
+type fakeCartClient struct {
+	cartpb.CartServiceClient
+	added  []*cartpb.AddItemRequest
+	merged []*cartpb.MergeCartsRequest
+}
+
+func (f *fakeCartClient) MergeCarts(ctx context.Context, in *cartpb.MergeCartsRequest, opts ...grpc.CallOption) (*cartpb.Cart, error) {
+	f.merged = append(f.merged, in)
+	return &cartpb.Cart{UserId: in.UserId}, nil
+}
+
+func (f *fakeCartClient) AddItem(ctx context.Context, in *cartpb.AddItemRequest, opts ...grpc.CallOption) (*cartpb.Cart, error) {
+	f.added = append(f.added, in)
+	return &cartpb.Cart{
+		UserId:      in.UserId,
+		AnonymousId: in.AnonymousId,
+		Items:       []*cartpb.CartItem{{ProductId: in.ProductId, Quantity: in.Quantity, Available: true}},
+		ItemCount:   in.Quantity,
+	}, nil
+}
+
+func newCartRouter(client cartpb.CartServiceClient, userID string) *gin.Engine {
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if userID != "" {
+			c.Set("user_id", userID)
+		}
+	})
+	handler := &CartHandler{CartClient: client}
+	router.GET("/cart", handler.GetCartHandler)
+	router.POST("/cart/items", handler.AddItemHandler)
+	return router
+}
+
+func TestAddItemHandler_StartsAnonymousCart(t *testing.T) {
+	client := &fakeCartClient{}
+	router := newCartRouter(client, "")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/cart/items", strings.NewReader(`{"product_id":"p1","quantity":2}`))
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, client.added, 1)
+
+	cartID := w.Header().Get(CartIDHeader)
+	_, err := uuid.Parse(cartID)
+	assert.NoError(t, err, "a new anonymous cart ID should be issued")
+	assert.Equal(t, cartID, client.added[0].AnonymousId)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, cartID, body["cart_id"])
+}
+
+func TestAddItemHandler_UsesExistingCartID(t *testing.T) {
+	client := &fakeCartClient{}
+	router := newCartRouter(client, "")
+	cartID := uuid.NewString()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/cart/items", strings.NewReader(`{"product_id":"p1","quantity":1}`))
+	req.Header.Set(CartIDHeader, cartID)
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, cartID, client.added[0].AnonymousId)
+}
+
+func TestAddItemHandler_LoggedInUser(t *testing.T) {
+	client := &fakeCartClient{}
+	router := newCartRouter(client, "user-1")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/cart/items", strings.NewReader(`{"product_id":"p1","quantity":1}`))
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user-1", client.added[0].UserId)
+	assert.Empty(t, client.added[0].AnonymousId, "logged-in users don't get an anonymous cart")
+	assert.Empty(t, w.Header().Get(CartIDHeader))
+}
+
+func TestAddItemHandler_InvalidBody(t *testing.T) {
+	client := &fakeCartClient{}
+	router := newCartRouter(client, "")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/cart/items", strings.NewReader(`{"product_id":"p1","quantity":0}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, client.added)
+}
+
+func TestGetCartHandler_NoCartYet(t *testing.T) {
+	// The fake panics on GetCart, so this also checks the service isn't called
+	router := newCartRouter(&fakeCartClient{}, "")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cart", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"items":[],"total":{"amount":"0.00","currency":"EUR"},"item_count":0}`, w.Body.String())
+}
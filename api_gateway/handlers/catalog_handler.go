@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+)
+
+// catalogMaxAge is how long shoppers' browsers and shared caches may reuse a
+// catalog response before revalidating it
+const catalogMaxAge = 60 * time.Second
+
+// CatalogHandler serves the public, read-only product catalog. Responses
+// leave out what only admins need (stock levels, versions, timestamps) and
+// can be cached; product management stays on ProductHandler.
+type CatalogHandler struct {
+	ProductClient productpb.ProductServiceClient
+}
+
+// ListProductsHandler handles HTTP GET /products?page=1&page_size=10
+func (h *CatalogHandler) ListProductsHandler(c *gin.Context) {
+	page, pageSize := catalogPage(c)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.ProductClient.ListProducts(ctx, &productpb.ListProductsRequest{
+		Page:      page,
+		PageSize:  pageSize,
+		PageToken: c.Query("page_token"),
+	})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	writeCatalog(c, catalogListResponse(res))
+}
+
+// GetProductHandler handles HTTP GET /products/:id. Products sold in sizes,
+// colors etc. come with their variants, which are what goes into the cart.
+func (h *CatalogHandler) GetProductHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.ProductClient.GetProduct(ctx, &productpb.GetProductRequest{Id: c.Param("id")})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	variants, err := h.ProductClient.ListVariants(ctx, &productpb.ListVariantsRequest{ProductId: res.Id})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	body := catalogProduct(res)
+	if len(variants.Variants) > 0 {
+		body["variants"], body["in_stock"] = catalogVariants(res, variants.Variants)
+	}
+	writeCatalog(c, body)
+}
+
+// CategoryHandler handles HTTP GET /products/category/:category
+func (h *CatalogHandler) CategoryHandler(c *gin.Context) {
+	page, pageSize := catalogPage(c)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.ProductClient.GetProductsByCategory(ctx, &productpb.GetProductsByCategoryRequest{
+		Category:  c.Param("category"),
+		Page:      page,
+		PageSize:  pageSize,
+		PageToken: c.Query("page_token"),
+	})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	body := catalogListResponse(res)
+	body["category"] = c.Param("category")
+	writeCatalog(c, body)
+}
+
+// SearchHandler handles HTTP GET /products/search with the same query
+// parameters as ProductHandler.SearchProductsHandler
+func (h *CatalogHandler) SearchHandler(c *gin.Context) {
+	req, err := searchProductsRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.ProductClient.SearchProducts(ctx, req)
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	products := make([]gin.H, len(res.Products))
+	for i, product := range res.Products {
+		products[i] = catalogProduct(product)
+	}
+
+	writeCatalog(c, searchResponse(res, products))
+}
+
+// CategoryTreeHandler handles HTTP GET /categories - the category tree for
+// navigation, with the number of products below each category
+func (h *CatalogHandler) CategoryTreeHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.ProductClient.GetCategoryTree(ctx, &productpb.GetCategoryTreeRequest{})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	writeCatalog(c, gin.H{"categories": catalogCategories(res.Roots)})
+}
+
+// catalogPage reads page and page_size; the product service applies the
+// defaults and the cap
+func catalogPage(c *gin.Context) (int32, int32) {
+	return int32(parseIntDefault(c.DefaultQuery("page", "1"), 1)),
+		int32(parseIntDefault(c.DefaultQuery("page_size", "10"), 10))
+}
+
+// catalogProduct is the shopper's view of a product: whether it can be
+// bought, but not how many are left
+func catalogProduct(res *productpb.Product) gin.H {
+	return gin.H{
+		"id":          res.Id,
+		"name":        res.Name,
+		"description": res.Description,
+		"price":       moneyResponse(res.GetPrice()),
+		"category":    res.Category,
+		"image_url":   res.ImageUrl,
+		"in_stock":    res.Stock > 0,
+	}
+}
+
+// catalogVariants is the shopper's view of a product's variants with the
+// price each one sells at. The product is in stock if any variant is.
+func catalogVariants(product *productpb.Product, variants []*productpb.Variant) ([]gin.H, bool) {
+	inStock := false
+	res := make([]gin.H, len(variants))
+	for i, variant := range variants {
+		price := variant.GetPrice()
+		if price == nil {
+			price = product.GetPrice()
+		}
+		res[i] = gin.H{
+			"sku":        variant.Sku,
+			"attributes": variant.Attributes,
+			"price":      moneyResponse(price),
+			"image_url":  variant.ImageUrl,
+			"in_stock":   variant.Stock > 0,
+		}
+		inStock = inStock || variant.Stock > 0
+	}
+	return res, inStock
+}
+
+// catalogCategories is the shopper's view of a category subtree; a
+// category's product_count includes its subcategories' products
+func catalogCategories(nodes []*productpb.CategoryNode) []gin.H {
+	res := make([]gin.H, len(nodes))
+	for i, node := range nodes {
+		res[i] = gin.H{
+			"slug":          node.Category.Slug,
+			"name":          node.Category.Name,
+			"product_count": node.TotalProductCount,
+			"children":      catalogCategories(node.Children),
+		}
+	}
+	return res
+}
+
+func catalogListResponse(res *productpb.ListProductsResponse) gin.H {
+	products := make([]gin.H, len(res.Products))
+	for i, product := range res.Products {
+		products[i] = catalogProduct(product)
+	}
+
+	body := gin.H{
+		"products":        products,
+		"total":           res.Total,
+		"page":            res.Page,
+		"page_size":       res.PageSize,
+		"next_page_token": res.NextPageToken,
+	}
+	if res.PageSize > 0 {
+		body["total_pages"] = (res.Total + res.PageSize - 1) / res.PageSize
+	}
+	return body
+}
+
+// writeCatalog sends body as a cacheable response. Its ETag is a hash of the
+// body, so a client revalidating with If-None-Match gets a 304 as long as
+// nothing it can see has changed.
+func writeCatalog(c *gin.Context, body gin.H) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode response"})
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := fmt.Sprintf(`W/"%s"`, hex.EncodeToString(sum[:16]))
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(catalogMaxAge.Seconds())))
+	c.Header("ETag", etag)
+
+	if noneMatch(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// noneMatch reports whether an If-None-Match header lists etag, comparing
+// tags weakly as RFC 9110 asks for
+func noneMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
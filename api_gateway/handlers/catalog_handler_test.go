@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+)
+
+func newCatalogRouter(client productpb.ProductServiceClient) *gin.Engine {
+	router := gin.New()
+	handler := &CatalogHandler{ProductClient: client}
+	catalog := router.Group("/products")
+	catalog.GET("", handler.ListProductsHandler)
+	catalog.GET("/search", handler.SearchHandler)
+	catalog.GET("/category/:category", handler.CategoryHandler)
+	catalog.GET("/:id", handler.GetProductHandler)
+	return router
+}
+
+func TestCatalogGetProduct_HidesInternalFields(t *testing.T) {
+	router := newCatalogRouter(&fakeProductClient{version: 3})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/p1", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "p1", body["id"])
+	assert.Equal(t, false, body["in_stock"])
+	for _, field := range []string{"stock", "version", "created_at", "updated_at"} {
+		assert.NotContains(t, body, field)
+	}
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+}
+
+func TestCatalogGetProduct_Variants(t *testing.T) {
+	router := newCatalogRouter(&fakeProductClient{variants: []*productpb.Variant{
+		{Sku: "SHIRT-S", Attributes: map[string]string{"size": "S"}, Stock: 0},
+		{Sku: "SHIRT-M", Attributes: map[string]string{"size": "M"}, Price: &productpb.Money{Amount: 2500, Currency: "EUR"}, Stock: 4},
+	}})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/p1", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		InStock  bool `json:"in_stock"`
+		Variants []map[string]any
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.True(t, body.InStock, "a product is in stock when any variant is")
+	require.Len(t, body.Variants, 2)
+	assert.Equal(t, "SHIRT-S", body.Variants[0]["sku"])
+	assert.Equal(t, false, body.Variants[0]["in_stock"])
+	assert.Equal(t, map[string]any{"amount": "25.00", "currency": "EUR"}, body.Variants[1]["price"])
+	assert.Equal(t, map[string]any{"size": "M"}, body.Variants[1]["attributes"])
+	assert.NotContains(t, body.Variants[1], "stock")
+}
+
+func TestCatalogGetProduct_IfNoneMatch(t *testing.T) {
+	router := newCatalogRouter(&fakeProductClient{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/p1", nil))
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	req := httptest.NewRequest(http.MethodGet, "/products/p1", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	req = httptest.NewRequest(http.MethodGet, "/products/p1", nil)
+	req.Header.Set("If-None-Match", `W/"stale"`)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCatalogSearch_UsesPublicShape(t *testing.T) {
+	client := &fakeProductClient{}
+	router := newCatalogRouter(client)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/search?q=laptop", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, client.searches, 1)
+	assert.Equal(t, "laptop", client.searches[0].Query)
+	var body struct {
+		Products []map[string]any `json:"products"`
+		Facets   map[string]any   `json:"facets"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Products, 1)
+	assert.NotContains(t, body.Products[0], "stock")
+	assert.Contains(t, body.Facets, "categories")
+}
+
+func TestCatalogListProducts_ForwardsPaging(t *testing.T) {
+	client := &fakeProductClient{}
+	router := newCatalogRouter(client)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products?page=2&page_size=5", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, client.lists, 1)
+	assert.Equal(t, int32(2), client.lists[0].Page)
+	assert.Equal(t, int32(5), client.lists[0].PageSize)
+	assert.Contains(t, w.Body.String(), `"next_page_token":"next"`)
+	assert.Contains(t, w.Body.String(), `"total_pages":6`)
+}
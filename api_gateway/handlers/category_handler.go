@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// CreateCategoryHandler handles HTTP POST /categories - adds a category,
+// below parent_id if it's set
+func (p *ProductHandler) CreateCategoryHandler(c *gin.Context) {
+	var body struct {
+		Slug     string `json:"slug" binding:"required"`
+		Name     string `json:"name" binding:"required"`
+		ParentID string `json:"parent_id"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := p.ProductClient.CreateCategory(ctx, &productpb.CreateCategoryRequest{
+		Slug:     body.Slug,
+		Name:     body.Name,
+		ParentId: body.ParentID,
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusCreated, categoryResponse(res))
+}
+
+// ListCategoriesHandler handles HTTP GET /categories - all categories with
+// their product counts
+func (p *ProductHandler) ListCategoriesHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := p.ProductClient.ListCategories(ctx, &productpb.ListCategoriesRequest{})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	categories := make([]gin.H, len(res.Categories))
+	for i, category := range res.Categories {
+		categories[i] = categoryResponse(category)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+}
+
+// GetCategoryHandler handles HTTP GET /categories/:category_id
+func (p *ProductHandler) GetCategoryHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := p.ProductClient.GetCategory(ctx, &productpb.GetCategoryRequest{Id: c.Param("category_id")})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, categoryResponse(res))
+}
+
+// UpdateCategoryHandler handles HTTP PATCH /categories/:category_id - renames
+// or moves a category. Only fields present in the body change; a null or
+// empty parent_id moves the category to the top level.
+func (p *ProductHandler) UpdateCategoryHandler(c *gin.Context) {
+	var body map[string]*string
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body must be a JSON object of strings"})
+		return
+	}
+
+	req := &productpb.UpdateCategoryRequest{Id: c.Param("category_id"), UpdateMask: &fieldmaskpb.FieldMask{}}
+	targets := []struct {
+		field string
+		value *string
+	}{{"slug", &req.Slug}, {"name", &req.Name}, {"parent_id", &req.ParentId}}
+	for _, target := range targets {
+		value, ok := body[target.field]
+		if !ok {
+			continue
+		}
+		delete(body, target.field)
+		if value != nil {
+			*target.value = *value
+		}
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, target.field)
+	}
+	if len(body) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only slug, name and parent_id can be changed"})
+		return
+	}
+	if len(req.UpdateMask.Paths) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := p.ProductClient.UpdateCategory(ctx, req)
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, categoryResponse(res))
+}
+
+// DeleteCategoryHandler handles HTTP DELETE /categories/:category_id. Only
+// empty categories can be deleted; merge the others.
+func (p *ProductHandler) DeleteCategoryHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	_, err := p.ProductClient.DeleteCategory(ctx, &productpb.DeleteCategoryRequest{Id: c.Param("category_id")})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "category deleted successfully"})
+}
+
+// MergeCategoryHandler handles HTTP POST /categories/:category_id/merge - moves
+// the category's products and subcategories into target_id and deletes it
+func (p *ProductHandler) MergeCategoryHandler(c *gin.Context) {
+	var body struct {
+		TargetID string `json:"target_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := p.ProductClient.MergeCategories(ctx, &productpb.MergeCategoriesRequest{
+		SourceId: c.Param("category_id"),
+		TargetId: body.TargetID,
+	})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, categoryResponse(res))
+}
+
+func categoryResponse(res *productpb.Category) gin.H {
+	return gin.H{
+		"id":            res.Id,
+		"slug":          res.Slug,
+		"name":          res.Name,
+		"parent_id":     res.ParentId,
+		"product_count": res.ProductCount,
+		"created_at":    res.CreatedAt.AsTime(),
+		"updated_at":    res.UpdatedAt.AsTime(),
+	}
+}
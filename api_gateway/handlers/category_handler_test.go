@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeCategoryClient records UpdateCategory requests and serves a fixed tree
+type fakeCategoryClient struct {
+	productpb.ProductServiceClient
+	updates []*productpb.UpdateCategoryRequest
+}
+
+func (f *fakeCategoryClient) UpdateCategory(ctx context.Context, in *productpb.UpdateCategoryRequest, opts ...grpc.CallOption) (*productpb.Category, error) {
+	f.updates = append(f.updates, in)
+	return &productpb.Category{Id: in.Id, Slug: in.Slug, CreatedAt: timestamppb.Now(), UpdatedAt: timestamppb.Now()}, nil
+}
+
+func (f *fakeCategoryClient) GetCategoryTree(ctx context.Context, in *productpb.GetCategoryTreeRequest, opts ...grpc.CallOption) (*productpb.GetCategoryTreeResponse, error) {
+	return &productpb.GetCategoryTreeResponse{Roots: []*productpb.CategoryNode{{
+		Category:          &productpb.Category{Id: "c1", Slug: "clothing", Name: "Clothing", ProductCount: 1},
+		TotalProductCount: 4,
+		Children: []*productpb.CategoryNode{{
+			Category:          &productpb.Category{Id: "c2", Slug: "shirts", Name: "Shirts", ParentId: "c1", ProductCount: 3},
+			TotalProductCount: 3,
+		}},
+	}}}, nil
+}
+
+func TestUpdateCategoryHandler_MasksSentFields(t *testing.T) {
+	client := &fakeCategoryClient{}
+	router := gin.New()
+	handler := &ProductHandler{ProductClient: client}
+	router.PATCH("/categories/:category_id", handler.UpdateCategoryHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/categories/c2", strings.NewReader(`{"parent_id": null, "slug": "tees"}`)))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, client.updates, 1)
+	assert.Equal(t, "c2", client.updates[0].Id)
+	assert.Equal(t, []string{"slug", "parent_id"}, client.updates[0].UpdateMask.GetPaths())
+	assert.Equal(t, "tees", client.updates[0].Slug)
+	assert.Empty(t, client.updates[0].ParentId)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/categories/c2", strings.NewReader(`{"products": "x"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Len(t, client.updates, 1)
+}
+
+func TestCatalogCategoryTree(t *testing.T) {
+	router := gin.New()
+	handler := &CatalogHandler{ProductClient: &fakeCategoryClient{}}
+	router.GET("/categories", handler.CategoryTreeHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/categories", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+	var body struct {
+		Categories []struct {
+			Slug         string `json:"slug"`
+			ProductCount int64  `json:"product_count"`
+			Children     []struct {
+				Slug         string `json:"slug"`
+				ProductCount int64  `json:"product_count"`
+			} `json:"children"`
+		} `json:"categories"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Categories, 1)
+	assert.Equal(t, "clothing", body.Categories[0].Slug)
+	assert.Equal(t, int64(4), body.Categories[0].ProductCount, "counts include subcategories")
+	require.Len(t, body.Categories[0].Children, 1)
+	assert.Equal(t, "shirts", body.Categories[0].Children[0].Slug)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// httpStatusFromGRPC translates a gRPC error code into the matching HTTP status
+func httpStatusFromGRPC(err error) int {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.FailedPrecondition:
+		return http.StatusUnprocessableEntity
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// grpcErrorMessage returns the message of a gRPC status error without the code prefix
+func grpcErrorMessage(err error) string {
+	if st, ok := status.FromError(err); ok {
+		return st.Message()
+	}
+	return err.Error()
+}
+
+// setRetryAfter sets the Retry-After header from the RetryInfo of a gRPC
+// status error, if it has one
+func setRetryAfter(c *gin.Context, err error) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			seconds := math.Ceil(info.GetRetryDelay().AsDuration().Seconds())
+			c.Header("Retry-After", strconv.Itoa(int(seconds)))
+			return
+		}
+	}
+}
+
+// currentUserID reads the user ID set by JWTAuthMiddleware and aborts with 401 if it's missing
+func currentUserID(c *gin.Context) (string, bool) {
+	userIDRaw, exists := c.Get("user_id")
+	userID, ok := userIDRaw.(string)
+
+	if !exists || !ok || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid user ID"})
+		c.Abort()
+		return "", false
+	}
+
+	return userID, true
+}
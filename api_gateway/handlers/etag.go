@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// setETag exposes a resource version as a strong entity tag
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", strconv.Quote(strconv.FormatInt(version, 10)))
+}
+
+// ifMatchVersion reads the version a conditional request expects from its
+// If-Match header. Without the header, or with "*", it returns 0 and the
+// change is made unconditionally. An entity tag that isn't one of ours can
+// never match, so it aborts with 412; that includes "0", as versions start
+// at 1 and 0 is what asks for no check.
+func ifMatchVersion(c *gin.Context) (int64, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+
+	// Weak tags never match in If-Match, and we only hand out one version at a time
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		abortPreconditionFailed(c)
+		return 0, false
+	}
+	version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || version < 1 {
+		abortPreconditionFailed(c)
+		return 0, false
+	}
+
+	return version, true
+}
+
+// conditionalHTTPStatus is httpStatusFromGRPC for requests that may carry
+// If-Match: a version conflict means the precondition failed
+func conditionalHTTPStatus(err error) int {
+	if status.Code(err) == codes.Aborted {
+		return http.StatusPreconditionFailed
+	}
+	return httpStatusFromGRPC(err)
+}
+
+func abortPreconditionFailed(c *gin.Context) {
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "If-Match doesn't match the current version"})
+	c.Abort()
+}
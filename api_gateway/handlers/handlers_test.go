@@ -43,6 +43,7 @@ func TestProductHandlerMethods(t *testing.T) {
 	assert.NotNil(t, handler.CreateHandler, "CreateHandler method should exist")
 	assert.NotNil(t, handler.GetProductHandler, "GetProductHandler method should exist")
 	assert.NotNil(t, handler.UpdateProductHandler, "UpdateProductHandler method should exist")
+	assert.NotNil(t, handler.PatchProductHandler, "PatchProductHandler method should exist")
 	assert.NotNil(t, handler.DeleteProductHandler, "DeleteProductHandler method should exist")
 	assert.NotNil(t, handler.ListProductsHandler, "ListProductsHandler method should exist")
 	assert.NotNil(t, handler.GetProductsByCategoryHandler, "GetProductsByCategoryHandler method should exist")
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tird4d/go-microservices/product_service/money"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+)
+
+// moneyJSON is a price in request and response bodies. The amount is a
+// decimal string such as "12.50" so clients never have to round a float.
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// protoMoney is the Money message of any of the service protos
+type protoMoney interface {
+	GetAmount() int64
+	GetCurrency() string
+}
+
+// moneyResponse renders a price held in minor units as moneyJSON
+func moneyResponse(m protoMoney) moneyJSON {
+	value := money.New(m.GetAmount(), m.GetCurrency())
+	return moneyJSON{Amount: value.Decimal(), Currency: value.Currency}
+}
+
+// productMoney parses a price from a request body for product_service
+func (m moneyJSON) productMoney() (*productpb.Money, error) {
+	if m.Currency == "" {
+		return nil, errors.New("currency is required")
+	}
+	value, err := money.Parse(m.Amount, money.NormalizeCurrency(m.Currency))
+	if err != nil {
+		return nil, err
+	}
+	return &productpb.Money{Amount: value.Amount, Currency: value.Currency}, nil
+}
+
+// parseProductMoney reads a price field of a JSON body, such as
+// {"amount": "12.50", "currency": "EUR"}
+func parseProductMoney(raw json.RawMessage, field string) (*productpb.Money, error) {
+	var m moneyJSON
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("%s must be an object with a decimal string amount and a currency", field)
+	}
+	price, err := m.productMoney()
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", field, err)
+	}
+	return price, nil
+}
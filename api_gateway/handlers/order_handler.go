@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	orderpb "github.com/tird4d/go-microservices/order_service/proto"
+)
+
+type OrderHandler struct {
+	OrderClient orderpb.OrderServiceClient
+}
+
+// CreateOrderHandler handles HTTP POST /orders - places an order for the logged-in user
+func (o *OrderHandler) CreateOrderHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Lines []struct {
+			ProductID string `json:"product_id" binding:"required"`
+			Quantity  int32  `json:"quantity" binding:"required,min=1"`
+		} `json:"lines" binding:"required,min=1,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lines := make([]*orderpb.OrderLineRequest, len(body.Lines))
+	for i, line := range body.Lines {
+		lines[i] = &orderpb.OrderLineRequest{
+			ProductId: line.ProductID,
+			Quantity:  line.Quantity,
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	// The user always comes from the validated token, never from the body
+	res, err := o.OrderClient.CreateOrder(ctx, &orderpb.CreateOrderRequest{
+		UserId: userID,
+		Lines:  lines,
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusCreated, orderResponse(res))
+}
+
+// GetOrderHandler handles HTTP GET /orders/:id - retrieves one of the user's orders
+func (o *OrderHandler) GetOrderHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := o.OrderClient.GetOrder(ctx, &orderpb.GetOrderRequest{
+		Id:     c.Param("id"),
+		UserId: userID,
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, orderResponse(res))
+}
+
+// ListOrdersHandler handles HTTP GET /orders - lists the user's orders with pagination
+func (o *OrderHandler) ListOrdersHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	page := int32(parseIntDefault(c.DefaultQuery("page", "1"), 1))
+	pageSize := int32(parseIntDefault(c.DefaultQuery("page_size", "10"), 10))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := o.OrderClient.ListOrdersForUser(ctx, &orderpb.ListOrdersForUserRequest{
+		UserId:   userID,
+		Page:     page,
+		PageSize: pageSize,
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	orders := make([]gin.H, len(res.Orders))
+	for i, order := range res.Orders {
+		orders[i] = orderResponse(order)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders":      orders,
+		"total":       res.Total,
+		"page":        res.Page,
+		"page_size":   res.PageSize,
+		"total_pages": (res.Total + res.PageSize - 1) / res.PageSize,
+	})
+}
+
+// CancelOrderHandler handles HTTP POST /orders/:id/cancel - cancels a pending order
+func (o *OrderHandler) CancelOrderHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := o.OrderClient.CancelOrder(ctx, &orderpb.CancelOrderRequest{
+		Id:     c.Param("id"),
+		UserId: userID,
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, orderResponse(res))
+}
+
+// CheckoutHandler handles HTTP POST /checkout - turns the user's cart into an
+// order charged to the payment_method in the body.
+// Responds 201 once the order exists, 202 while a step is being retried (poll
+// GET /checkout/:id) and 422 when the checkout was rolled back. While one of
+// the user's checkouts is still running, a repeated request (double click,
+// client retry) gets that checkout back instead of starting another.
+func (o *OrderHandler) CheckoutHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		PaymentMethod string `json:"payment_method" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Leave room for the saga's own step timeouts
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	res, err := o.OrderClient.Checkout(ctx, &orderpb.CheckoutRequest{
+		UserId:        userID,
+		PaymentMethod: body.PaymentMethod,
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(checkoutHTTPStatus(res.Status), checkoutResponse(res))
+}
+
+// GetCheckoutHandler handles HTTP GET /checkout/:id - reports a checkout's progress
+func (o *OrderHandler) GetCheckoutHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := o.OrderClient.GetCheckout(ctx, &orderpb.GetCheckoutRequest{
+		Id:     c.Param("id"),
+		UserId: userID,
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, checkoutResponse(res))
+}
+
+func checkoutHTTPStatus(state string) int {
+	switch state {
+	case "completed":
+		return http.StatusCreated
+	case "failed":
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusAccepted
+	}
+}
+
+func checkoutResponse(checkout *orderpb.CheckoutStatus) gin.H {
+	res := gin.H{
+		"id":         checkout.Id,
+		"status":     checkout.Status,
+		"total":      moneyResponse(checkout.GetTotal()),
+		"created_at": checkout.CreatedAt.AsTime(),
+		"updated_at": checkout.UpdatedAt.AsTime(),
+	}
+	if checkout.OrderId != "" {
+		res["order_id"] = checkout.OrderId
+	}
+	if checkout.FailureReason != "" {
+		res["failure_reason"] = checkout.FailureReason
+	}
+	return res
+}
+
+func orderResponse(order *orderpb.Order) gin.H {
+	lines := make([]gin.H, len(order.Lines))
+	for i, line := range order.Lines {
+		lines[i] = gin.H{
+			"product_id":   line.ProductId,
+			"product_name": line.ProductName,
+			"unit_price":   moneyResponse(line.GetUnitPrice()),
+			"quantity":     line.Quantity,
+			"line_total":   moneyResponse(line.GetLineTotal()),
+		}
+		if line.Sku != "" {
+			lines[i]["sku"] = line.Sku
+		}
+	}
+
+	return gin.H{
+		"id":         order.Id,
+		"user_id":    order.UserId,
+		"lines":      lines,
+		"total":      moneyResponse(order.GetTotal()),
+		"status":     order.Status,
+		"created_at": order.CreatedAt.AsTime(),
+		"updated_at": order.UpdatedAt.AsTime(),
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckoutHTTPStatus(t *testing.T) {
+	tests := []struct {
+		state string
+		want  int
+	}{
+		{"completed", http.StatusCreated},
+		{"failed", http.StatusUnprocessableEntity},
+		{"started", http.StatusAccepted},
+		{"compensating", http.StatusAccepted},
+		{"order_created", http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			assert.Equal(t, tt.want, checkoutHTTPStatus(tt.state))
+		})
+	}
+}
@@ -2,12 +2,20 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tird4d/go-microservices/product_service/money"
 	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 type ProductHandler struct {
@@ -17,18 +25,23 @@ type ProductHandler struct {
 // CreateHandler handles HTTP POST /products - creates a new product
 func (p *ProductHandler) CreateHandler(c *gin.Context) {
 	var body struct {
-		Name        string  `json:"name" binding:"required"`
-		Description string  `json:"description"`
-		Price       float64 `json:"price" binding:"required"`
-		Category    string  `json:"category" binding:"required"`
-		Stock       int32   `json:"stock"`
-		ImageUrl    string  `json:"image_url"`
+		Name        string          `json:"name" binding:"required"`
+		Description string          `json:"description"`
+		Price       json.RawMessage `json:"price" binding:"required"`
+		Category    string          `json:"category" binding:"required"`
+		Stock       int32           `json:"stock"`
+		ImageUrl    string          `json:"image_url"`
 	}
 
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	price, err := parseProductMoney(body.Price, "price")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Create gRPC context with timeout
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
@@ -38,29 +51,21 @@ func (p *ProductHandler) CreateHandler(c *gin.Context) {
 	res, err := p.ProductClient.CreateProduct(ctx, &productpb.CreateProductRequest{
 		Name:        body.Name,
 		Description: body.Description,
-		Price:       body.Price,
+		Price:       price,
 		Category:    body.Category,
 		Stock:       body.Stock,
 		ImageUrl:    body.ImageUrl,
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// An unknown category is a 400
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
 		return
 	}
 
 	// Return created product
-	c.JSON(http.StatusCreated, gin.H{
-		"id":          res.Id,
-		"name":        res.Name,
-		"description": res.Description,
-		"price":       res.Price,
-		"category":    res.Category,
-		"stock":       res.Stock,
-		"image_url":   res.ImageUrl,
-		"created_at":  res.CreatedAt.AsTime(),
-		"updated_at":  res.UpdatedAt.AsTime(),
-	})
+	setETag(c, res.Version)
+	c.JSON(http.StatusCreated, productResponse(res))
 }
 
 // GetProductHandler handles HTTP GET /products/:id - retrieves a product by ID
@@ -89,20 +94,15 @@ func (p *ProductHandler) GetProductHandler(c *gin.Context) {
 	}
 
 	// Return product details
-	c.JSON(http.StatusOK, gin.H{
-		"id":          res.Id,
-		"name":        res.Name,
-		"description": res.Description,
-		"price":       res.Price,
-		"category":    res.Category,
-		"stock":       res.Stock,
-		"image_url":   res.ImageUrl,
-		"created_at":  res.CreatedAt.AsTime(),
-		"updated_at":  res.UpdatedAt.AsTime(),
-	})
+	setETag(c, res.Version)
+	c.JSON(http.StatusOK, productResponse(res))
 }
 
-// UpdateProductHandler handles HTTP PUT /products/:id - updates an existing product
+// UpdateProductHandler handles HTTP PUT /products/:id - replaces an existing product.
+// Every field is required; use PATCH to change some of them. A body with
+// stock is rejected, since stock only changes through POST /products/:id/stock.
+// Send the ETag from GET as If-Match to get 412 instead of overwriting
+// someone else's change.
 func (p *ProductHandler) UpdateProductHandler(c *gin.Context) {
 	// Extract ID from URL parameter
 	productID := c.Param("id")
@@ -113,52 +113,195 @@ func (p *ProductHandler) UpdateProductHandler(c *gin.Context) {
 
 	// Bind request body
 	var body struct {
-		Name        string  `json:"name"`
-		Description string  `json:"description"`
-		Price       float64 `json:"price"`
-		Category    string  `json:"category"`
-		Stock       int32   `json:"stock"`
-		ImageUrl    string  `json:"image_url"`
+		Name        string          `json:"name" binding:"required"`
+		Description string          `json:"description"`
+		Price       json.RawMessage `json:"price" binding:"required"`
+		Category    string          `json:"category" binding:"required"`
+		ImageUrl    string          `json:"image_url"`
+		Stock       json.RawMessage `json:"stock"`
 	}
 
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if body.Stock != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errStockNotUpdatable.Error()})
+		return
+	}
+	price, err := parseProductMoney(body.Price, "price")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
 
 	// Create gRPC context with timeout
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	// Call product-service via gRPC
-	// Note: Only fields that are provided will be updated
+	// A replacement sets every field, including the ones left out of the body
 	res, err := p.ProductClient.UpdateProduct(ctx, &productpb.UpdateProductRequest{
-		Id:          productID,
-		Name:        body.Name,
-		Description: body.Description,
-		Price:       body.Price,
-		Category:    body.Category,
-		Stock:       body.Stock,
-		ImageUrl:    body.ImageUrl,
+		Id:              productID,
+		Name:            body.Name,
+		Description:     body.Description,
+		Price:           price,
+		Category:        body.Category,
+		ImageUrl:        body.ImageUrl,
+		UpdateMask:      &fieldmaskpb.FieldMask{Paths: productFields},
+		ExpectedVersion: expectedVersion,
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(conditionalHTTPStatus(err), gin.H{"error": grpcErrorMessage(err)})
 		return
 	}
 
 	// Return updated product
-	c.JSON(http.StatusOK, gin.H{
+	setETag(c, res.Version)
+	c.JSON(http.StatusOK, productResponse(res))
+}
+
+// PatchProductHandler handles HTTP PATCH /products/:id - changes some fields of
+// a product with JSON merge patch (RFC 7396) semantics: fields left out of the
+// body are kept and null clears an optional field. If-Match works like PUT's.
+func (p *ProductHandler) PatchProductHandler(c *gin.Context) {
+	productID := c.Param("id")
+	if productID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product ID is required"})
+		return
+	}
+
+	if contentType := c.ContentType(); contentType != "" && contentType != "application/json" && contentType != "application/merge-patch+json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "expected application/merge-patch+json"})
+		return
+	}
+
+	req, err := productPatchRequest(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Id = productID
+
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+	req.ExpectedVersion = expectedVersion
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	// An empty patch changes nothing, so answer with the product as it is
+	var res *productpb.Product
+	if len(req.UpdateMask.Paths) == 0 {
+		res, err = p.ProductClient.GetProduct(ctx, &productpb.GetProductRequest{Id: productID})
+		if err == nil && expectedVersion > 0 && res.Version != expectedVersion {
+			abortPreconditionFailed(c)
+			return
+		}
+	} else {
+		res, err = p.ProductClient.UpdateProduct(ctx, req)
+	}
+
+	if err != nil {
+		c.JSON(conditionalHTTPStatus(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	setETag(c, res.Version)
+	c.JSON(http.StatusOK, productResponse(res))
+}
+
+// productFields are the product fields clients may change, by JSON and field
+// mask name. Stock isn't one; it changes through reservations and the stock
+// adjustment endpoint, which keep the ledger.
+var productFields = []string{"name", "description", "price", "category", "image_url"}
+
+// errStockNotUpdatable answers product updates that try to set the stock
+var errStockNotUpdatable = errors.New("stock can't be updated with the product; use POST /products/:id/stock")
+
+// productPatchRequest turns a merge patch document into an UpdateProductRequest
+// whose mask lists the patched fields. Required fields can't be removed.
+func productPatchRequest(body io.Reader) (*productpb.UpdateProductRequest, error) {
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&patch); err != nil || patch == nil {
+		return nil, errors.New("body must be a JSON object")
+	}
+
+	req := &productpb.UpdateProductRequest{UpdateMask: &fieldmaskpb.FieldMask{}}
+	for _, field := range productFields {
+		raw, ok := patch[field]
+		if !ok {
+			continue
+		}
+		delete(patch, field)
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, field)
+
+		if string(raw) == "null" {
+			switch field {
+			case "description", "image_url":
+				// Removing an optional field clears it, which is its zero value
+				continue
+			default:
+				return nil, fmt.Errorf("%s cannot be removed", field)
+			}
+		}
+
+		var err error
+		switch field {
+		case "name":
+			err = json.Unmarshal(raw, &req.Name)
+		case "description":
+			err = json.Unmarshal(raw, &req.Description)
+		case "price":
+			if req.Price, err = parseProductMoney(raw, "price"); err != nil {
+				return nil, err
+			}
+		case "category":
+			err = json.Unmarshal(raw, &req.Category)
+		case "image_url":
+			err = json.Unmarshal(raw, &req.ImageUrl)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s", field)
+		}
+	}
+
+	if _, ok := patch["stock"]; ok {
+		return nil, errStockNotUpdatable
+	}
+	if len(patch) > 0 {
+		unknown := make([]string, 0, len(patch))
+		for field := range patch {
+			unknown = append(unknown, field)
+		}
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown fields: %s", strings.Join(unknown, ", "))
+	}
+
+	return req, nil
+}
+
+func productResponse(res *productpb.Product) gin.H {
+	return gin.H{
 		"id":          res.Id,
 		"name":        res.Name,
 		"description": res.Description,
-		"price":       res.Price,
+		"price":       moneyResponse(res.GetPrice()),
 		"category":    res.Category,
 		"stock":       res.Stock,
 		"image_url":   res.ImageUrl,
 		"created_at":  res.CreatedAt.AsTime(),
 		"updated_at":  res.UpdatedAt.AsTime(),
-	})
+		"version":     res.Version,
+	}
 }
 
 // DeleteProductHandler handles HTTP DELETE /products/:id - deletes a product
@@ -170,17 +313,23 @@ func (p *ProductHandler) DeleteProductHandler(c *gin.Context) {
 		return
 	}
 
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
 	// Create gRPC context with timeout
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	// Call product-service via gRPC
 	_, err := p.ProductClient.DeleteProduct(ctx, &productpb.DeleteProductRequest{
-		Id: productID,
+		Id:              productID,
+		ExpectedVersion: expectedVersion,
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(conditionalHTTPStatus(err), gin.H{"error": grpcErrorMessage(err)})
 		return
 	}
 
@@ -190,6 +339,46 @@ func (p *ProductHandler) DeleteProductHandler(c *gin.Context) {
 	})
 }
 
+// AdjustStockHandler handles HTTP POST /products/:id/stock - adds delta (which
+// may be negative) to the stock of a product, or of one of its variants when
+// sku is given, and records the reason in the stock ledger
+func (p *ProductHandler) AdjustStockHandler(c *gin.Context) {
+	productID := c.Param("id")
+	if productID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product ID is required"})
+		return
+	}
+
+	var body struct {
+		Delta  int32  `json:"delta" binding:"required"`
+		Reason string `json:"reason" binding:"required"`
+		SKU    string `json:"sku"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Create gRPC context with timeout
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := p.ProductClient.AdjustStock(ctx, &productpb.AdjustStockRequest{
+		ProductId: productID,
+		Delta:     body.Delta,
+		Reason:    body.Reason,
+		Sku:       body.SKU,
+	})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	setETag(c, res.Version)
+	c.JSON(http.StatusOK, productResponse(res))
+}
+
 // ListProductsHandler handles HTTP GET /products - lists products with pagination
 func (p *ProductHandler) ListProductsHandler(c *gin.Context) {
 	// Get pagination parameters from query string
@@ -197,7 +386,8 @@ func (p *ProductHandler) ListProductsHandler(c *gin.Context) {
 	var page int32 = 1
 	var pageSize int32 = 10
 
-	// Simple query parameter parsing with defaults
+	// Simple query parameter parsing with defaults. A page_token from a
+	// previous response takes precedence over page.
 	if pageStr := c.DefaultQuery("page", "1"); pageStr != "" {
 		if pageVal := parseIntDefault(pageStr, 1); pageVal > 0 {
 			page = int32(pageVal)
@@ -216,38 +406,30 @@ func (p *ProductHandler) ListProductsHandler(c *gin.Context) {
 
 	// Call product-service via gRPC
 	res, err := p.ProductClient.ListProducts(ctx, &productpb.ListProductsRequest{
-		Page:     page,
-		PageSize: pageSize,
+		Page:      page,
+		PageSize:  pageSize,
+		PageToken: c.Query("page_token"),
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
 		return
 	}
 
 	// Convert products to JSON-friendly format
 	products := make([]gin.H, len(res.Products))
 	for i, product := range res.Products {
-		products[i] = gin.H{
-			"id":          product.Id,
-			"name":        product.Name,
-			"description": product.Description,
-			"price":       product.Price,
-			"category":    product.Category,
-			"stock":       product.Stock,
-			"image_url":   product.ImageUrl,
-			"created_at":  product.CreatedAt.AsTime(),
-			"updated_at":  product.UpdatedAt.AsTime(),
-		}
+		products[i] = productResponse(product)
 	}
 
 	// Return paginated response
 	c.JSON(http.StatusOK, gin.H{
-		"products":    products,
-		"total":       res.Total,
-		"page":        page,
-		"page_size":   pageSize,
-		"total_pages": (res.Total + pageSize - 1) / pageSize, // Ceiling division
+		"products":        products,
+		"total":           res.Total,
+		"page":            page,
+		"page_size":       pageSize,
+		"total_pages":     (res.Total + pageSize - 1) / pageSize, // Ceiling division
+		"next_page_token": res.NextPageToken,
 	})
 }
 
@@ -282,41 +464,141 @@ func (p *ProductHandler) GetProductsByCategoryHandler(c *gin.Context) {
 
 	// Call product-service via gRPC
 	res, err := p.ProductClient.GetProductsByCategory(ctx, &productpb.GetProductsByCategoryRequest{
-		Category: category,
-		Page:     page,
-		PageSize: pageSize,
+		Category:  category,
+		Page:      page,
+		PageSize:  pageSize,
+		PageToken: c.Query("page_token"),
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
 		return
 	}
 
 	// Convert products to JSON-friendly format
 	products := make([]gin.H, len(res.Products))
 	for i, product := range res.Products {
-		products[i] = gin.H{
-			"id":          product.Id,
-			"name":        product.Name,
-			"description": product.Description,
-			"price":       product.Price,
-			"category":    product.Category,
-			"stock":       product.Stock,
-			"image_url":   product.ImageUrl,
-			"created_at":  product.CreatedAt.AsTime(),
-			"updated_at":  product.UpdatedAt.AsTime(),
-		}
+		products[i] = productResponse(product)
 	}
 
 	// Return filtered and paginated response
 	c.JSON(http.StatusOK, gin.H{
+		"products":        products,
+		"category":        category,
+		"total":           res.Total,
+		"page":            page,
+		"page_size":       pageSize,
+		"total_pages":     (res.Total + pageSize - 1) / pageSize,
+		"next_page_token": res.NextPageToken,
+	})
+}
+
+// SearchProductsHandler handles HTTP GET /products/search - full-text search
+// with filters and facets for admins; CatalogHandler.SearchHandler is the
+// public version.
+// Example: /products/search?q=laptop&category=electronics&category=books&min_price=100&currency=EUR&in_stock=true&sort=price_asc
+func (p *ProductHandler) SearchProductsHandler(c *gin.Context) {
+	req, err := searchProductsRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := p.ProductClient.SearchProducts(ctx, req)
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	products := make([]gin.H, len(res.Products))
+	for i, product := range res.Products {
+		products[i] = productResponse(product)
+	}
+
+	c.JSON(http.StatusOK, searchResponse(res, products))
+}
+
+// searchProductsRequest reads the search, filters and paging from the query string
+func searchProductsRequest(c *gin.Context) (*productpb.SearchProductsRequest, error) {
+	req := &productpb.SearchProductsRequest{
+		Query: c.Query("q"),
+		Sort:  c.Query("sort"),
+		Page:  int32(parseIntDefault(c.DefaultQuery("page", "1"), 1)),
+		// The service applies its own default and cap
+		PageSize: int32(parseIntDefault(c.DefaultQuery("page_size", "10"), 10)),
+	}
+
+	// Categories may be repeated or comma separated
+	for _, value := range c.QueryArray("category") {
+		req.Categories = append(req.Categories, strings.Split(value, ",")...)
+	}
+
+	// Price bounds are decimals in the currency, EUR unless given
+	req.Currency = money.NormalizeCurrency(c.Query("currency"))
+	var err error
+	if req.MinPrice, err = parseMoneyQuery(c, "min_price", req.Currency); err != nil {
+		return nil, err
+	}
+	if req.MaxPrice, err = parseMoneyQuery(c, "max_price", req.Currency); err != nil {
+		return nil, err
+	}
+	if value := c.Query("in_stock"); value != "" {
+		if req.InStockOnly, err = strconv.ParseBool(value); err != nil {
+			return nil, errors.New("in_stock must be true or false")
+		}
+	}
+
+	return req, nil
+}
+
+// searchResponse wraps already converted products with the paging and facets of res
+func searchResponse(res *productpb.SearchProductsResponse, products []gin.H) gin.H {
+	categories := make([]gin.H, len(res.CategoryFacets))
+	for i, facet := range res.CategoryFacets {
+		categories[i] = gin.H{"category": facet.Category, "count": facet.Count}
+	}
+
+	prices := make([]gin.H, len(res.PriceFacets))
+	for i, facet := range res.PriceFacets {
+		bucket := gin.H{"min": moneyResponse(facet.GetMin()), "count": facet.Count}
+		// The last bucket is open-ended
+		if facet.Max != nil {
+			bucket["max"] = moneyResponse(facet.GetMax())
+		}
+		prices[i] = bucket
+	}
+
+	return gin.H{
 		"products":    products,
-		"category":    category,
 		"total":       res.Total,
-		"page":        page,
-		"page_size":   pageSize,
-		"total_pages": (res.Total + pageSize - 1) / pageSize,
-	})
+		"page":        res.Page,
+		"page_size":   res.PageSize,
+		"total_pages": (res.Total + res.PageSize - 1) / res.PageSize,
+		"facets": gin.H{
+			"categories": categories,
+			"prices":     prices,
+		},
+	}
+}
+
+// parseMoneyQuery reads a decimal price from the query string; an empty
+// currency means the default one
+func parseMoneyQuery(c *gin.Context, name, currency string) (*productpb.Money, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	m, err := money.Parse(value, currency)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a decimal amount in %s", name, currency)
+	}
+	return &productpb.Money{Amount: m.Amount, Currency: m.Currency}, nil
 }
 
 // Helper function to parse int with default value
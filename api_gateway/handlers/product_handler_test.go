@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeProductClient records UpdateProduct requests against a product at
+// version; other methods panic through the nil interface
+type fakeProductClient struct {
+	productpb.ProductServiceClient
+	version  int64
+	updates  []*productpb.UpdateProductRequest
+	searches []*productpb.SearchProductsRequest
+	lists    []*productpb.ListProductsRequest
+	variants []*productpb.Variant
+	adjusts  []*productpb.AdjustStockRequest
+}
+
+func (f *fakeProductClient) UpdateProduct(ctx context.Context, in *productpb.UpdateProductRequest, opts ...grpc.CallOption) (*productpb.Product, error) {
+	if in.ExpectedVersion != 0 && in.ExpectedVersion != f.version {
+		return nil, status.Error(codes.Aborted, "product was changed by someone else")
+	}
+	f.updates = append(f.updates, in)
+	f.version++
+	return &productpb.Product{Id: in.Id, Name: in.Name, Version: f.version, CreatedAt: timestamppb.Now(), UpdatedAt: timestamppb.Now()}, nil
+}
+
+func (f *fakeProductClient) GetProduct(ctx context.Context, in *productpb.GetProductRequest, opts ...grpc.CallOption) (*productpb.Product, error) {
+	return &productpb.Product{Id: in.Id, Name: "Laptop", Version: f.version, CreatedAt: timestamppb.Now(), UpdatedAt: timestamppb.Now()}, nil
+}
+
+func (f *fakeProductClient) SearchProducts(ctx context.Context, in *productpb.SearchProductsRequest, opts ...grpc.CallOption) (*productpb.SearchProductsResponse, error) {
+	f.searches = append(f.searches, in)
+	return &productpb.SearchProductsResponse{
+		Products:       []*productpb.Product{{Id: "p1", Name: "Laptop", CreatedAt: timestamppb.Now(), UpdatedAt: timestamppb.Now()}},
+		Total:          1,
+		Page:           1,
+		PageSize:       10,
+		CategoryFacets: []*productpb.CategoryFacet{{Category: "electronics", Count: 1}},
+		PriceFacets:    []*productpb.PriceFacet{{Min: &productpb.Money{Amount: 100000, Currency: "EUR"}, Count: 1}},
+	}, nil
+}
+
+func (f *fakeProductClient) ListProducts(ctx context.Context, in *productpb.ListProductsRequest, opts ...grpc.CallOption) (*productpb.ListProductsResponse, error) {
+	if in.PageToken == "bad" {
+		return nil, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+	f.lists = append(f.lists, in)
+	return &productpb.ListProductsResponse{Total: 30, Page: in.Page, PageSize: in.PageSize, NextPageToken: "next"}, nil
+}
+
+func (f *fakeProductClient) ListVariants(ctx context.Context, in *productpb.ListVariantsRequest, opts ...grpc.CallOption) (*productpb.ListVariantsResponse, error) {
+	return &productpb.ListVariantsResponse{Variants: f.variants}, nil
+}
+
+func (f *fakeProductClient) AdjustStock(ctx context.Context, in *productpb.AdjustStockRequest, opts ...grpc.CallOption) (*productpb.Product, error) {
+	f.adjusts = append(f.adjusts, in)
+	return &productpb.Product{Id: in.ProductId, Name: "Laptop", Version: f.version, CreatedAt: timestamppb.Now(), UpdatedAt: timestamppb.Now()}, nil
+}
+
+func newProductRouter(client productpb.ProductServiceClient) *gin.Engine {
+	router := gin.New()
+	handler := &ProductHandler{ProductClient: client}
+	router.PUT("/products/:id", handler.UpdateProductHandler)
+	router.PATCH("/products/:id", handler.PatchProductHandler)
+	router.GET("/products/search", handler.SearchProductsHandler)
+	router.GET("/products", handler.ListProductsHandler)
+	router.POST("/products/:id/stock", handler.AdjustStockHandler)
+	return router
+}
+
+func TestPatchProductHandler_OnlySendsPatchedFields(t *testing.T) {
+	client := &fakeProductClient{}
+	router := newProductRouter(client)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPatch, "/products/p1", strings.NewReader(`{"price": {"amount": "19.99", "currency": "eur"}, "image_url": null}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, client.updates, 1)
+	update := client.updates[0]
+	assert.Equal(t, "p1", update.Id)
+	assert.Equal(t, []string{"price", "image_url"}, update.UpdateMask.GetPaths())
+	assert.Equal(t, int64(1999), update.Price.GetAmount())
+	assert.Equal(t, "EUR", update.Price.GetCurrency())
+	assert.Empty(t, update.ImageUrl)
+}
+
+func TestPatchProductHandler_RejectsInvalidPatches(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not an object", `[{"price": 1}]`},
+		{"remove required field", `{"name": null}`},
+		{"wrong type", `{"name": 5}`},
+		{"stock", `{"stock": 5}`},
+		{"unknown field", `{"price": {"amount": "1.00", "currency": "EUR"}, "colour": "red"}`},
+		{"price as a number", `{"price": 19.99}`},
+		{"price without currency", `{"price": {"amount": "19.99"}}`},
+		{"price with too many decimals", `{"price": {"amount": "19.999", "currency": "EUR"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeProductClient{}
+			router := newProductRouter(client)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/products/p1", strings.NewReader(tt.body)))
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Empty(t, client.updates)
+		})
+	}
+}
+
+func TestPatchProductHandler_EmptyPatchReturnsProduct(t *testing.T) {
+	client := &fakeProductClient{}
+	router := newProductRouter(client)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/products/p1", strings.NewReader(`{}`)))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, client.updates)
+}
+
+func TestUpdateProductHandler_ReplacesEveryField(t *testing.T) {
+	client := &fakeProductClient{}
+	router := newProductRouter(client)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/products/p1", strings.NewReader(`{"name":"Laptop","price":{"amount":"10","currency":"EUR"},"category":"electronics"}`)))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.ElementsMatch(t, productFields, client.updates[0].UpdateMask.GetPaths())
+}
+
+func TestUpdateProductHandler_RejectsStock(t *testing.T) {
+	client := &fakeProductClient{}
+	router := newProductRouter(client)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/products/p1", strings.NewReader(`{"name":"Laptop","price":{"amount":"10","currency":"EUR"},"category":"electronics","stock":5}`)))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "POST /products/:id/stock")
+	assert.Empty(t, client.updates)
+}
+
+func TestUpdateProductHandler_RequiresFullProduct(t *testing.T) {
+	client := &fakeProductClient{}
+	router := newProductRouter(client)
+
+	// Sending only the price used to zero every other field
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/products/p1", strings.NewReader(`{"price":{"amount":"10","currency":"EUR"}}`)))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, client.updates)
+}
+
+func TestPatchProductHandler_IfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		want    int
+	}{
+		{"no precondition", "", http.StatusOK},
+		{"any version", "*", http.StatusOK},
+		{"current version", `"3"`, http.StatusOK},
+		{"stale version", `"2"`, http.StatusPreconditionFailed},
+		{"weak tag", `W/"3"`, http.StatusPreconditionFailed},
+		{"not our tag", `"abc"`, http.StatusPreconditionFailed},
+		{"version zero", `"0"`, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeProductClient{version: 3}
+			router := newProductRouter(client)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPatch, "/products/p1", strings.NewReader(`{"price": {"amount": "5", "currency": "EUR"}}`))
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.want, w.Code)
+			if tt.want == http.StatusOK {
+				assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+			} else {
+				assert.Empty(t, client.updates)
+			}
+		})
+	}
+}
+
+func TestPatchProductHandler_EmptyPatchChecksIfMatch(t *testing.T) {
+	client := &fakeProductClient{version: 3}
+	router := newProductRouter(client)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPatch, "/products/p1", strings.NewReader(`{}`))
+	req.Header.Set("If-Match", `"2"`)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+func TestSearchProductsHandler_ParsesFilters(t *testing.T) {
+	client := &fakeProductClient{}
+	router := newProductRouter(client)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/search?q=laptop&category=electronics,books&category=toys&min_price=10&max_price=99.5&currency=usd&in_stock=true&sort=price_asc&page=2", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, client.searches, 1)
+	search := client.searches[0]
+	assert.Equal(t, "laptop", search.Query)
+	assert.Equal(t, []string{"electronics", "books", "toys"}, search.Categories)
+	assert.Equal(t, "USD", search.Currency)
+	assert.Equal(t, &productpb.Money{Amount: 1000, Currency: "USD"}, search.MinPrice)
+	assert.Equal(t, &productpb.Money{Amount: 9950, Currency: "USD"}, search.MaxPrice)
+	assert.True(t, search.InStockOnly)
+	assert.Equal(t, "price_asc", search.Sort)
+	assert.Equal(t, int32(2), search.Page)
+
+	var body struct {
+		Facets struct {
+			Prices []map[string]any `json:"prices"`
+		} `json:"facets"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Facets.Prices, 1)
+	assert.Equal(t, map[string]any{"amount": "1000.00", "currency": "EUR"}, body.Facets.Prices[0]["min"])
+	assert.NotContains(t, body.Facets.Prices[0], "max", "the last price bucket is open-ended")
+}
+
+func TestSearchProductsHandler_RejectsBadNumbers(t *testing.T) {
+	for _, query := range []string{"min_price=cheap", "max_price=1e", "min_price=9.999", "min_price=10&currency=XYZ", "in_stock=maybe"} {
+		client := &fakeProductClient{}
+		router := newProductRouter(client)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/search?"+query, nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.Empty(t, client.searches)
+	}
+}
+
+func TestListProductsHandler_PageToken(t *testing.T) {
+	client := &fakeProductClient{}
+	router := newProductRouter(client)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products?page_size=5&page_token=abc", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, client.lists, 1)
+	assert.Equal(t, "abc", client.lists[0].PageToken)
+	assert.Equal(t, int32(5), client.lists[0].PageSize)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "next", body["next_page_token"])
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products?page_token=bad", nil))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid page token")
+}
+
+func TestAdjustStockHandler_VariantSKU(t *testing.T) {
+	client := &fakeProductClient{}
+	router := newProductRouter(client)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/products/p1/stock", strings.NewReader(`{"delta": -2, "reason": "damaged", "sku": "LAPTOP-16GB"}`)))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, client.adjusts, 1)
+	adjust := client.adjusts[0]
+	assert.Equal(t, "p1", adjust.ProductId)
+	assert.Equal(t, int32(-2), adjust.Delta)
+	assert.Equal(t, "damaged", adjust.Reason)
+	assert.Equal(t, "LAPTOP-16GB", adjust.Sku)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/products/p1/stock", strings.NewReader(`{"delta": 3}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Len(t, client.adjusts, 1)
+}
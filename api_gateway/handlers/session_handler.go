@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	authpb "github.com/tird4d/go-microservices/auth_service/proto"
+)
+
+// MySessionsHandler handles HTTP GET /me/sessions - lists where the user is
+// logged in, most recently used first
+func (h *GatewayHandler) MySessionsHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	h.listSessions(c, userID)
+}
+
+// RevokeMySessionHandler handles HTTP DELETE /me/sessions/:session_id - logs
+// one of the user's sessions out
+func (h *GatewayHandler) RevokeMySessionHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	h.revokeSession(c, userID, c.Param("session_id"))
+}
+
+// RevokeMySessionsHandler handles HTTP DELETE /me/sessions - logs the user out
+// everywhere, including the session making the request
+func (h *GatewayHandler) RevokeMySessionsHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	h.revokeAllSessions(c, userID)
+}
+
+// UserSessionsHandler handles HTTP GET /admin/users/:user_id/sessions
+func (h *GatewayHandler) UserSessionsHandler(c *gin.Context) {
+	h.listSessions(c, c.Param("user_id"))
+}
+
+// RevokeUserSessionHandler handles HTTP DELETE /admin/users/:user_id/sessions/:session_id
+func (h *GatewayHandler) RevokeUserSessionHandler(c *gin.Context) {
+	h.revokeSession(c, c.Param("user_id"), c.Param("session_id"))
+}
+
+// RevokeUserSessionsHandler handles HTTP DELETE /admin/users/:user_id/sessions
+func (h *GatewayHandler) RevokeUserSessionsHandler(c *gin.Context) {
+	h.revokeAllSessions(c, c.Param("user_id"))
+}
+
+func (h *GatewayHandler) listSessions(c *gin.Context, userID string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.AuthClient.ListSessions(ctx, &authpb.ListSessionsRequest{UserId: userID})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	sessions := make([]gin.H, len(res.Sessions))
+	for i, session := range res.Sessions {
+		sessions[i] = gin.H{
+			"id":           session.Id,
+			"created_at":   session.CreatedAt.AsTime(),
+			"last_used_at": session.LastUsedAt.AsTime(),
+			"ip":           session.Ip,
+			"user_agent":   session.UserAgent,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (h *GatewayHandler) revokeSession(c *gin.Context, userID, sessionID string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	_, err := h.AuthClient.RevokeSession(ctx, &authpb.RevokeSessionRequest{
+		UserId:    userID,
+		SessionId: sessionID,
+	})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked successfully"})
+}
+
+func (h *GatewayHandler) revokeAllSessions(c *gin.Context, userID string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.AuthClient.RevokeAllSessions(ctx, &authpb.RevokeAllSessionsRequest{UserId: userID})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "sessions revoked successfully",
+		"revoked": res.Revoked,
+	})
+}
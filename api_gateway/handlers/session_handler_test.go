@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authpb "github.com/tird4d/go-microservices/auth_service/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeSessionClient keeps the sessions of one user, "u1"
+type fakeSessionClient struct {
+	authpb.AuthServiceClient
+	sessions []*authpb.Session
+	listed   []string
+}
+
+func (f *fakeSessionClient) ListSessions(ctx context.Context, in *authpb.ListSessionsRequest, opts ...grpc.CallOption) (*authpb.ListSessionsResponse, error) {
+	f.listed = append(f.listed, in.UserId)
+	if in.UserId != "u1" {
+		return &authpb.ListSessionsResponse{}, nil
+	}
+	return &authpb.ListSessionsResponse{Sessions: f.sessions}, nil
+}
+
+func (f *fakeSessionClient) RevokeSession(ctx context.Context, in *authpb.RevokeSessionRequest, opts ...grpc.CallOption) (*authpb.RevokeSessionResponse, error) {
+	for i, session := range f.sessions {
+		if in.UserId == "u1" && session.Id == in.SessionId {
+			f.sessions = append(f.sessions[:i], f.sessions[i+1:]...)
+			return &authpb.RevokeSessionResponse{}, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "session not found")
+}
+
+func (f *fakeSessionClient) RevokeAllSessions(ctx context.Context, in *authpb.RevokeAllSessionsRequest, opts ...grpc.CallOption) (*authpb.RevokeAllSessionsResponse, error) {
+	revoked := len(f.sessions)
+	f.sessions = nil
+	return &authpb.RevokeAllSessionsResponse{Revoked: int32(revoked)}, nil
+}
+
+func newSessionRouter(client *fakeSessionClient, userID string) *gin.Engine {
+	h := &GatewayHandler{AuthClient: client}
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	router.GET("/me/sessions", h.MySessionsHandler)
+	router.DELETE("/me/sessions", h.RevokeMySessionsHandler)
+	router.DELETE("/me/sessions/:session_id", h.RevokeMySessionHandler)
+	router.GET("/admin/users/:user_id/sessions", h.UserSessionsHandler)
+	router.DELETE("/admin/users/:user_id/sessions/:session_id", h.RevokeUserSessionHandler)
+	return router
+}
+
+func TestSessionHandlers(t *testing.T) {
+	lastUsed := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	client := &fakeSessionClient{sessions: []*authpb.Session{
+		{Id: "s1", CreatedAt: timestamppb.New(lastUsed.Add(-time.Hour)), LastUsedAt: timestamppb.New(lastUsed), Ip: "203.0.113.7", UserAgent: "Firefox/128.0"},
+		{Id: "s2", CreatedAt: timestamppb.New(lastUsed.Add(-2 * time.Hour)), LastUsedAt: timestamppb.New(lastUsed), Ip: "198.51.100.2", UserAgent: "app/1.0"},
+	}}
+
+	do := func(router *gin.Engine, method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	// Users only ever see their own sessions
+	me := newSessionRouter(client, "u1")
+	w := do(me, http.MethodGet, "/me/sessions")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"sessions":[
+		{"id":"s1","created_at":"2026-03-01T11:00:00Z","last_used_at":"2026-03-01T12:00:00Z","ip":"203.0.113.7","user_agent":"Firefox/128.0"},
+		{"id":"s2","created_at":"2026-03-01T10:00:00Z","last_used_at":"2026-03-01T12:00:00Z","ip":"198.51.100.2","user_agent":"app/1.0"}
+	]}`, w.Body.String())
+
+	other := newSessionRouter(client, "u2")
+	assert.Equal(t, http.StatusNotFound, do(other, http.MethodDelete, "/me/sessions/s1").Code)
+
+	assert.Equal(t, http.StatusOK, do(me, http.MethodDelete, "/me/sessions/s1").Code)
+	assert.Equal(t, http.StatusNotFound, do(me, http.MethodDelete, "/me/sessions/s1").Code)
+
+	// Admins name the user in the path
+	admin := newSessionRouter(client, "admin")
+	w = do(admin, http.MethodGet, "/admin/users/u1/sessions")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"s2"`)
+	assert.Equal(t, []string{"u1", "u1"}, client.listed)
+
+	w = do(me, http.MethodDelete, "/me/sessions")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"revoked":1`)
+}
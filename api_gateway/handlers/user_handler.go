@@ -44,6 +44,7 @@ func (u *UserHandler) MeHandler(c *gin.Context) {
 		"username":   userRes.Name,     // Map backend 'name' to frontend 'username'
 		"name":       userRes.Name,     // Also provide 'name' field
 		"role":       userRes.Role,
+		"locale":     userRes.Locale,
 		"created_at": time.Now().Format(time.RFC3339), // Placeholder
 		"updated_at": time.Now().Format(time.RFC3339), // Placeholder
 	})
@@ -55,6 +56,8 @@ func (u *UserHandler) RegisterHandler(c *gin.Context) {
 		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password" binding:"required,min=6"`
 		Role     string `json:"role" binding:"required,oneof=admin user"`
+		// Locale is the preferred language of emails, e.g. "de-AT"
+		Locale string `json:"locale" binding:"omitempty,bcp47_language_tag"`
 	}
 
 	if err := c.ShouldBindJSON(&body); err != nil {
@@ -70,6 +73,7 @@ func (u *UserHandler) RegisterHandler(c *gin.Context) {
 		Email:    body.Email,
 		Password: body.Password,
 		Role:     body.Role,
+		Locale:   body.Locale,
 	})
 
 	if err != nil {
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// CreateVariantHandler handles HTTP POST /products/:id/variants - adds a variant
+// (e.g. a size or color) with its own SKU to a product
+func (p *ProductHandler) CreateVariantHandler(c *gin.Context) {
+	var body struct {
+		SKU        string            `json:"sku" binding:"required"`
+		Attributes map[string]string `json:"attributes"`
+		// Price overrides the product's price; without it the variant sells at the product price
+		Price    json.RawMessage `json:"price"`
+		Stock    int32           `json:"stock"`
+		ImageUrl string          `json:"image_url"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var price *productpb.Money
+	if len(body.Price) > 0 && string(body.Price) != "null" {
+		var err error
+		if price, err = parseProductMoney(body.Price, "price"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := p.ProductClient.CreateVariant(ctx, &productpb.CreateVariantRequest{
+		ProductId:  c.Param("id"),
+		Sku:        body.SKU,
+		Attributes: body.Attributes,
+		Price:      price,
+		Stock:      body.Stock,
+		ImageUrl:   body.ImageUrl,
+	})
+
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusCreated, variantResponse(res))
+}
+
+// ListVariantsHandler handles HTTP GET /products/:id/variants
+func (p *ProductHandler) ListVariantsHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := p.ProductClient.ListVariants(ctx, &productpb.ListVariantsRequest{ProductId: c.Param("id")})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	variants := make([]gin.H, len(res.Variants))
+	for i, variant := range res.Variants {
+		variants[i] = variantResponse(variant)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"variants": variants})
+}
+
+// GetVariantHandler handles HTTP GET /variants/:variant_id, or
+// GET /variants?sku=... to look a variant up by SKU
+func (p *ProductHandler) GetVariantHandler(c *gin.Context) {
+	req := &productpb.GetVariantRequest{Id: c.Param("variant_id"), Sku: c.Query("sku")}
+	if req.Id == "" && req.Sku == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "variant ID or sku is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := p.ProductClient.GetVariant(ctx, req)
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, variantResponse(res))
+}
+
+// UpdateVariantHandler handles HTTP PATCH /variants/:variant_id - changes the
+// fields present in the body and keeps the others. A null price removes the
+// variant's price override. Stock is not a field here; it changes through
+// the stock adjustment endpoint with the variant's SKU.
+func (p *ProductHandler) UpdateVariantHandler(c *gin.Context) {
+	var body struct {
+		SKU        *string            `json:"sku"`
+		Attributes *map[string]string `json:"attributes"`
+		Price      json.RawMessage    `json:"price"`
+		ImageUrl   *string            `json:"image_url"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req := &productpb.UpdateVariantRequest{Id: c.Param("variant_id"), UpdateMask: &fieldmaskpb.FieldMask{}}
+	if body.SKU != nil {
+		req.Sku = *body.SKU
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "sku")
+	}
+	if body.Attributes != nil {
+		req.Attributes = *body.Attributes
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "attributes")
+	}
+	if len(body.Price) > 0 {
+		if string(body.Price) != "null" {
+			var err error
+			if req.Price, err = parseProductMoney(body.Price, "price"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "price")
+	}
+	if body.ImageUrl != nil {
+		req.ImageUrl = *body.ImageUrl
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "image_url")
+	}
+	if len(req.UpdateMask.Paths) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := p.ProductClient.UpdateVariant(ctx, req)
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, variantResponse(res))
+}
+
+// DeleteVariantHandler handles HTTP DELETE /variants/:variant_id
+func (p *ProductHandler) DeleteVariantHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	_, err := p.ProductClient.DeleteVariant(ctx, &productpb.DeleteVariantRequest{Id: c.Param("variant_id")})
+	if err != nil {
+		c.JSON(httpStatusFromGRPC(err), gin.H{"error": grpcErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "variant deleted successfully"})
+}
+
+func variantResponse(res *productpb.Variant) gin.H {
+	variant := gin.H{
+		"id":         res.Id,
+		"product_id": res.ProductId,
+		"sku":        res.Sku,
+		"attributes": res.Attributes,
+		"stock":      res.Stock,
+		"image_url":  res.ImageUrl,
+		"created_at": res.CreatedAt.AsTime(),
+		"updated_at": res.UpdatedAt.AsTime(),
+	}
+	// Without an override the variant sells at the product price
+	if res.Price != nil {
+		variant["price"] = moneyResponse(res.GetPrice())
+	}
+	return variant
+}
@@ -4,16 +4,20 @@ import (
 	"context"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/tird4d/go-microservices/api_gateway/config"
 	"github.com/tird4d/go-microservices/api_gateway/handlers"
 	"github.com/tird4d/go-microservices/api_gateway/interceptors"
 	"github.com/tird4d/go-microservices/api_gateway/logger"
 	"github.com/tird4d/go-microservices/api_gateway/middlewares"
 	"github.com/tird4d/go-microservices/api_gateway/tracing"
 	authpb "github.com/tird4d/go-microservices/auth_service/proto"
+	cartpb "github.com/tird4d/go-microservices/cart_service/proto"
+	orderpb "github.com/tird4d/go-microservices/order_service/proto"
 	productpb "github.com/tird4d/go-microservices/product_service/proto"
 	userpb "github.com/tird4d/go-microservices/user_service/proto"
 
@@ -70,6 +74,13 @@ func main() {
 
 	authClient := authpb.NewAuthServiceClient(authConn)
 
+	// Access tokens are checked here with auth_service's published keys and
+	// the revocation denylist in Redis; AUTH_REMOTE_VALIDATE_FALLBACK sends
+	// tokens to auth_service when either can't be reached
+	config.ConnectRedis()
+	remoteFallback, _ := strconv.ParseBool(os.Getenv("AUTH_REMOTE_VALIDATE_FALLBACK"))
+	tokenVerifier := middlewares.NewTokenVerifier(authClient, middlewares.RedisDenylist{Client: config.RedisClient}, remoteFallback)
+
 
 	productConn, err := grpc.DialContext(ctx, os.Getenv("PRODUCT_SERVICE_ADDR"), grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithUnaryInterceptor(interceptors.UnaryClientInterceptor))
 	if err != nil {
@@ -78,9 +89,28 @@ func main() {
 
 		productClient := productpb.NewProductServiceClient(productConn)
 
+	orderConn, err := grpc.DialContext(ctx, os.Getenv("ORDER_SERVICE_ADDR"), grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithUnaryInterceptor(interceptors.UnaryClientInterceptor))
+	if err != nil {
+		log.Fatalf("❌ could not connect to order gRPC server: %v", err)
+	}
+
+	orderClient := orderpb.NewOrderServiceClient(orderConn)
+
+	cartConn, err := grpc.DialContext(ctx, os.Getenv("CART_SERVICE_ADDR"), grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithUnaryInterceptor(interceptors.UnaryClientInterceptor))
+	if err != nil {
+		log.Fatalf("❌ could not connect to cart gRPC server: %v", err)
+	}
+
+	cartClient := cartpb.NewCartServiceClient(cartConn)
+
 
 	// ایجاد روت‌ها
 	router := gin.Default()
+	// The client IP drives login throttling and session records, so only
+	// the ingress may name it in a header
+	if err := router.SetTrustedProxies(config.TrustedProxies()); err != nil {
+		log.Fatalf("❌ invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Add tracing middleware for all requests
 	router.Use(middlewares.TracingMiddleware())
@@ -91,16 +121,30 @@ func main() {
 
 	authHandler := handlers.GatewayHandler{
 		AuthClient: authClient,
+		CartClient: cartClient,
+		Verifier:   tokenVerifier,
 	}
 
 	adminHandler := handlers.AdminHandler{
 		UserClient: userClient,
 	}
 
+	catalogHandler := handlers.CatalogHandler{
+		ProductClient: productClient,
+	}
+
 	adminProductHandler := handlers.ProductHandler{
 		ProductClient: productClient,
 	}
 
+	orderHandler := handlers.OrderHandler{
+		OrderClient: orderClient,
+	}
+
+	cartHandler := handlers.CartHandler{
+		CartClient: cartClient,
+	}
+
 
 
 	router.GET("/healthz", func(c *gin.Context) {
@@ -110,30 +154,84 @@ func main() {
 		})
 	})
 
+	// Public catalog routes (read-only, cacheable); products are managed under /admin
+	catalog := router.Group("/api/v1/products")
+	catalog.GET("", catalogHandler.ListProductsHandler)
+	catalog.GET("/search", catalogHandler.SearchHandler)
+	catalog.GET("/category/:category", catalogHandler.CategoryHandler)
+	catalog.GET("/:id", catalogHandler.GetProductHandler)
+	router.GET("/api/v1/categories", catalogHandler.CategoryTreeHandler)
+
 	router.POST("/api/v1/register", userHandler.RegisterHandler)
 	router.POST("/api/v1/refresh-token", authHandler.RefreshTokenHandler)
 	router.POST("/api/v1/login", authHandler.LoginHandler)
+	router.GET("/.well-known/jwks.json", authHandler.JWKSHandler)
 
 	auth := router.Group("/api/v1/")
-	auth.Use(middlewares.JWTAuthMiddleware(authClient))
+	auth.Use(middlewares.JWTAuthMiddleware(tokenVerifier))
 	auth.GET("/me", userHandler.MeHandler)
 	auth.POST("/logout", authHandler.LogoutHandler)
+	auth.GET("/me/sessions", authHandler.MySessionsHandler)
+	auth.DELETE("/me/sessions", authHandler.RevokeMySessionsHandler)
+	auth.DELETE("/me/sessions/:session_id", authHandler.RevokeMySessionHandler)
+
+	// Order routes (the user is taken from the validated token)
+	auth.POST("/orders", orderHandler.CreateOrderHandler)
+	auth.GET("/orders", orderHandler.ListOrdersHandler)
+	auth.GET("/orders/:id", orderHandler.GetOrderHandler)
+	auth.POST("/orders/:id/cancel", orderHandler.CancelOrderHandler)
+	auth.POST("/checkout", orderHandler.CheckoutHandler)
+	auth.GET("/checkout/:id", orderHandler.GetCheckoutHandler)
+
+	// Cart routes work for anonymous shoppers (X-Cart-ID header) and logged-in users
+	cart := router.Group("/api/v1/cart")
+	cart.Use(middlewares.OptionalJWTAuthMiddleware(tokenVerifier))
+	cart.GET("", cartHandler.GetCartHandler)
+	cart.DELETE("", cartHandler.ClearCartHandler)
+	cart.POST("/items", cartHandler.AddItemHandler)
+	cart.PUT("/items/:product_id", cartHandler.UpdateQuantityHandler)
+	cart.DELETE("/items/:product_id", cartHandler.RemoveItemHandler)
 
 	admin := router.Group("/api/v1/admin")
-	admin.Use(middlewares.JWTAuthMiddleware(authClient))
-	admin.Use(middlewares.AdminMiddleware(authClient))
+	admin.Use(middlewares.JWTAuthMiddleware(tokenVerifier))
+	admin.Use(middlewares.AdminMiddleware())
 	admin.GET("/users", adminHandler.UsersHandler)
+	admin.GET("/users/:user_id", adminHandler.GetUserHandler)
 	admin.PUT("/users/:user_id", adminHandler.UpdateUserHandler)
 	admin.DELETE("/users/:user_id", adminHandler.DeleteHandler)
+	admin.GET("/users/:user_id/sessions", authHandler.UserSessionsHandler)
+	admin.DELETE("/users/:user_id/sessions", authHandler.RevokeUserSessionsHandler)
+	admin.DELETE("/users/:user_id/sessions/:session_id", authHandler.RevokeUserSessionHandler)
+	admin.POST("/users/:user_id/unlock", authHandler.UnlockUserHandler)
+	admin.POST("/ips/:ip/unlock", authHandler.UnlockIPHandler)
 
 	// Product routes (admin only)
 	admin.POST("/products", adminProductHandler.CreateHandler)
 	admin.GET("/products", adminProductHandler.ListProductsHandler)
+	admin.GET("/products/search", adminProductHandler.SearchProductsHandler)
 	admin.GET("/products/:id", adminProductHandler.GetProductHandler)
 	admin.PUT("/products/:id", adminProductHandler.UpdateProductHandler)
+	admin.PATCH("/products/:id", adminProductHandler.PatchProductHandler)
 	admin.DELETE("/products/:id", adminProductHandler.DeleteProductHandler)
+	admin.POST("/products/:id/stock", adminProductHandler.AdjustStockHandler)
 	admin.GET("/products/category/:category", adminProductHandler.GetProductsByCategoryHandler)
 
+	// Variant routes (admin only); GET /variants?sku=... looks a variant up by SKU
+	admin.POST("/products/:id/variants", adminProductHandler.CreateVariantHandler)
+	admin.GET("/products/:id/variants", adminProductHandler.ListVariantsHandler)
+	admin.GET("/variants", adminProductHandler.GetVariantHandler)
+	admin.GET("/variants/:variant_id", adminProductHandler.GetVariantHandler)
+	admin.PATCH("/variants/:variant_id", adminProductHandler.UpdateVariantHandler)
+	admin.DELETE("/variants/:variant_id", adminProductHandler.DeleteVariantHandler)
+
+	// Category routes (admin only); products reference categories by slug
+	admin.POST("/categories", adminProductHandler.CreateCategoryHandler)
+	admin.GET("/categories", adminProductHandler.ListCategoriesHandler)
+	admin.GET("/categories/:category_id", adminProductHandler.GetCategoryHandler)
+	admin.PATCH("/categories/:category_id", adminProductHandler.UpdateCategoryHandler)
+	admin.DELETE("/categories/:category_id", adminProductHandler.DeleteCategoryHandler)
+	admin.POST("/categories/:category_id/merge", adminProductHandler.MergeCategoryHandler)
+
 	log.Println("🚀 API Gateway is running on http://localhost:8080")
 	router.Run(":8080")
 }
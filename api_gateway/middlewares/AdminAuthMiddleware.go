@@ -4,10 +4,9 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	authpb "github.com/tird4d/go-microservices/auth_service/proto"
 )
 
-func AdminMiddleware(authClient authpb.AuthServiceClient) gin.HandlerFunc {
+func AdminMiddleware() gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 
@@ -1,14 +1,14 @@
 package middlewares
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	authpb "github.com/tird4d/go-microservices/auth_service/proto"
 )
 
-func JWTAuthMiddleware(authClient authpb.AuthServiceClient) gin.HandlerFunc {
+func JWTAuthMiddleware(verifier *TokenVerifier) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 
@@ -28,21 +28,34 @@ func JWTAuthMiddleware(authClient authpb.AuthServiceClient) gin.HandlerFunc {
 
 		token := parts[1]
 
-		claims, err := authClient.Validate(c.Request.Context(), &authpb.ValidateRequest{
-			Token: token,
-		})
-
+		claims, err := verifier.Verify(c.Request.Context(), token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			rejectToken(c, err)
 			return
 		}
 
-		c.Set("user_id", claims.UserId)
-		c.Set("email", claims.Email)
-		c.Set("role", claims.Role)
-		// c.Set("auth_at", claims["auth_at"])
+		setClaims(c, token, claims)
 		c.Next()
 
 	}
 }
+
+// setClaims makes the token's user available to handlers; the token itself
+// is kept so logout can revoke it
+func setClaims(c *gin.Context, token string, claims *TokenClaims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("email", claims.Email)
+	c.Set("role", claims.Role)
+	c.Set("access_token", token)
+}
+
+// rejectToken answers 503 when the token couldn't be checked, so clients
+// retry instead of logging the user out
+func rejectToken(c *gin.Context, err error) {
+	if errors.Is(err, ErrVerifierUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Cannot verify token, try again later"})
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+	}
+	c.Abort()
+}
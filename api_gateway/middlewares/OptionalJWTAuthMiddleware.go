@@ -0,0 +1,40 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OptionalJWTAuthMiddleware lets anonymous requests through but, when an
+// Authorization header is present, validates it like JWTAuthMiddleware.
+// A bad token is rejected rather than silently treated as anonymous.
+func OptionalJWTAuthMiddleware(verifier *TokenVerifier) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.Next()
+			return
+		}
+
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
+			c.Abort()
+			return
+		}
+
+		claims, err := verifier.Verify(c.Request.Context(), parts[1])
+		if err != nil {
+			rejectToken(c, err)
+			return
+		}
+
+		setClaims(c, parts[1], claims)
+		c.Next()
+
+	}
+}
@@ -0,0 +1,199 @@
+package middlewares
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/tird4d/go-microservices/api_gateway/logger"
+	"github.com/tird4d/go-microservices/auth_service/jwks"
+	authpb "github.com/tird4d/go-microservices/auth_service/proto"
+	"github.com/tird4d/go-microservices/auth_service/revocation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// keyRefreshInterval matches how long auth_service lets the key set be cached
+	keyRefreshInterval = 5 * time.Minute
+	// keyRetryInterval limits refetching when tokens name an unknown key or
+	// auth_service is down
+	keyRetryInterval = 10 * time.Second
+	keyFetchTimeout  = 3 * time.Second
+)
+
+var (
+	errInvalidToken = errors.New("invalid or expired token")
+	// ErrVerifierUnavailable means a token might be valid but the keys or the
+	// denylist needed to tell could not be reached
+	ErrVerifierUnavailable = errors.New("token verification unavailable")
+)
+
+// TokenClaims is the user an access token was issued to
+type TokenClaims struct {
+	UserID string
+	Email  string
+	Role   string
+}
+
+// Denylist tells whether an access token was revoked before it expired
+type Denylist interface {
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// RedisDenylist reads the denylist auth_service keeps in Redis
+type RedisDenylist struct {
+	Client redis.Cmdable
+}
+
+func (d RedisDenylist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return revocation.IsRevoked(ctx, d.Client, jti)
+}
+
+type accessClaims struct {
+	jwt.RegisteredClaims
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
+
+type verificationKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// TokenVerifier checks access tokens in the gateway with the keys auth_service
+// publishes, so requests don't wait on a Validate call. With remoteFallback,
+// tokens that can't be checked locally are sent to Validate instead.
+type TokenVerifier struct {
+	authClient     authpb.AuthServiceClient
+	denylist       Denylist
+	remoteFallback bool
+
+	mu        sync.Mutex
+	keys      map[string]verificationKey
+	fetchedAt time.Time
+	triedAt   time.Time
+}
+
+func NewTokenVerifier(authClient authpb.AuthServiceClient, denylist Denylist, remoteFallback bool) *TokenVerifier {
+	return &TokenVerifier{
+		authClient:     authClient,
+		denylist:       denylist,
+		remoteFallback: remoteFallback,
+	}
+}
+
+// Verify returns the claims of a valid, unrevoked access token
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (*TokenClaims, error) {
+	claims, err := v.verifyLocally(ctx, token)
+	if errors.Is(err, ErrVerifierUnavailable) && v.remoteFallback {
+		logger.Log.Warnw("⚠️ Verifying token with auth_service", "reason", err)
+		return v.verifyRemotely(ctx, token)
+	}
+	return claims, err
+}
+
+func (v *TokenVerifier) verifyLocally(ctx context.Context, token string) (*TokenClaims, error) {
+	var claims accessClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := v.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if t.Method.Alg() != key.alg {
+			return nil, errInvalidToken
+		}
+		return key.key, nil
+	}, jwt.WithValidMethods([]string{jwks.AlgRS256, jwks.AlgEdDSA}), jwt.WithExpirationRequired())
+
+	if errors.Is(err, ErrVerifierUnavailable) {
+		return nil, err
+	}
+	if err != nil || claims.ID == "" || claims.UserID == "" {
+		return nil, errInvalidToken
+	}
+
+	revoked, err := v.denylist.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerifierUnavailable, err)
+	}
+	if revoked {
+		return nil, errInvalidToken
+	}
+
+	return &TokenClaims{UserID: claims.UserID, Email: claims.Email, Role: claims.Role}, nil
+}
+
+func (v *TokenVerifier) verifyRemotely(ctx context.Context, token string) (*TokenClaims, error) {
+	res, err := v.authClient.Validate(ctx, &authpb.ValidateRequest{Token: token})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Unavailable, codes.DeadlineExceeded:
+			return nil, fmt.Errorf("%w: %v", ErrVerifierUnavailable, err)
+		default:
+			return nil, errInvalidToken
+		}
+	}
+	return &TokenClaims{UserID: res.UserId, Email: res.Email, Role: res.Role}, nil
+}
+
+// key returns the public key named kid, fetching the key set again when it is
+// stale or doesn't have kid yet. Known keys keep working while auth_service is
+// unreachable.
+func (v *TokenVerifier) key(ctx context.Context, kid string) (verificationKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key, ok := v.keys[kid]
+	stale := time.Since(v.fetchedAt) > keyRefreshInterval
+	if (!ok || stale) && time.Since(v.triedAt) >= keyRetryInterval {
+		v.triedAt = time.Now()
+		if err := v.refresh(ctx); err != nil {
+			logger.Log.Warnw("⚠️ Failed to fetch token keys", "error", err)
+		} else {
+			stale = false
+		}
+		key, ok = v.keys[kid]
+	}
+
+	switch {
+	case ok:
+		return key, nil
+	case v.keys == nil || stale:
+		// kid may be a key published since the last successful fetch
+		return verificationKey{}, ErrVerifierUnavailable
+	default:
+		return verificationKey{}, errInvalidToken
+	}
+}
+
+func (v *TokenVerifier) refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, keyFetchTimeout)
+	defer cancel()
+
+	res, err := v.authClient.GetJWKS(ctx, &authpb.GetJWKSRequest{})
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]verificationKey, len(res.GetKeys()))
+	for _, key := range jwks.FromProto(res).Keys {
+		pub, err := key.PublicKey()
+		if err != nil {
+			logger.Log.Warnw("⚠️ Skipping unusable token key", "kid", key.ID, "error", err)
+			continue
+		}
+		keys[key.ID] = verificationKey{alg: key.Algorithm, key: pub}
+	}
+
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	return nil
+}
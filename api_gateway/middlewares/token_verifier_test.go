@@ -0,0 +1,242 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/api_gateway/logger"
+	authpb "github.com/tird4d/go-microservices/auth_service/proto"
+	"github.com/tird4d/go-microservices/auth_service/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	logger.InitLogger(true)
+}
+
+// fakeAuthClient publishes the key set of auth_service's utils; a nil keys
+// means auth_service is down
+type fakeAuthClient struct {
+	authpb.AuthServiceClient
+	keys       *utils.KeySet
+	jwksCalls  int
+	validated  []string
+	validateFn func(token string) (*authpb.ValidateResponse, error)
+}
+
+func (f *fakeAuthClient) GetJWKS(ctx context.Context, in *authpb.GetJWKSRequest, opts ...grpc.CallOption) (*authpb.GetJWKSResponse, error) {
+	f.jwksCalls++
+	if f.keys == nil {
+		return nil, status.Error(codes.Unavailable, "auth_service is down")
+	}
+	set, err := f.keys.JWKS()
+	if err != nil {
+		return nil, err
+	}
+	return set.Proto(), nil
+}
+
+func (f *fakeAuthClient) Validate(ctx context.Context, in *authpb.ValidateRequest, opts ...grpc.CallOption) (*authpb.ValidateResponse, error) {
+	f.validated = append(f.validated, in.Token)
+	return f.validateFn(in.Token)
+}
+
+type fakeDenylist struct {
+	revoked map[string]bool
+	err     error
+}
+
+func (d *fakeDenylist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return d.revoked[jti], d.err
+}
+
+// issue signs a token with the claims auth_service puts in and returns it
+// with its jti
+func issue(t *testing.T, keys *utils.KeySet) (string, string) {
+	t.Helper()
+	key := keys.Active()
+	jti := uuid.NewString()
+	token := jwt.NewWithClaims(key.Method, jwt.MapClaims{
+		"user_id": "u1",
+		"email":   "test@example.com",
+		"role":    "admin",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+		"jti":     jti,
+	})
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.Private)
+	require.NoError(t, err)
+	return signed, jti
+}
+
+func newKeySet(t *testing.T) *utils.KeySet {
+	t.Helper()
+	keys, err := utils.GenerateKeySet()
+	require.NoError(t, err)
+	return keys
+}
+
+func TestTokenVerifier_VerifiesLocally(t *testing.T) {
+	keys := newKeySet(t)
+	client := &fakeAuthClient{keys: keys}
+	verifier := NewTokenVerifier(client, &fakeDenylist{}, true)
+
+	for i := 0; i < 3; i++ {
+		token, _ := issue(t, keys)
+		claims, err := verifier.Verify(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "test@example.com", claims.Email)
+		assert.Equal(t, "admin", claims.Role)
+	}
+
+	assert.Equal(t, 1, client.jwksCalls, "keys are cached")
+	assert.Empty(t, client.validated, "auth_service is not asked")
+}
+
+func TestTokenVerifier_RejectsRevokedTokens(t *testing.T) {
+	keys := newKeySet(t)
+	token, jti := issue(t, keys)
+	verifier := NewTokenVerifier(&fakeAuthClient{keys: keys}, &fakeDenylist{revoked: map[string]bool{jti: true}}, true)
+
+	_, err := verifier.Verify(context.Background(), token)
+	assert.ErrorIs(t, err, errInvalidToken)
+}
+
+func TestTokenVerifier_RejectsForeignAndTamperedTokens(t *testing.T) {
+	keys := newKeySet(t)
+	verifier := NewTokenVerifier(&fakeAuthClient{keys: keys}, &fakeDenylist{}, true)
+
+	foreign, _ := issue(t, newKeySet(t))
+	_, err := verifier.Verify(context.Background(), foreign)
+	assert.ErrorIs(t, err, errInvalidToken)
+
+	token, _ := issue(t, keys)
+	_, err = verifier.Verify(context.Background(), token[:len(token)-4]+"AAAA")
+	assert.ErrorIs(t, err, errInvalidToken)
+
+	_, err = verifier.Verify(context.Background(), "not-a-token")
+	assert.ErrorIs(t, err, errInvalidToken)
+}
+
+func TestTokenVerifier_PicksUpRotatedKeys(t *testing.T) {
+	oldKeys := newKeySet(t)
+	client := &fakeAuthClient{keys: oldKeys}
+	verifier := NewTokenVerifier(client, &fakeDenylist{}, false)
+
+	token, _ := issue(t, oldKeys)
+	_, err := verifier.Verify(context.Background(), token)
+	require.NoError(t, err)
+
+	// A token signed with a key published after the last fetch
+	newKeys := newKeySet(t)
+	client.keys = newKeys
+	verifier.triedAt = time.Time{}
+	token, _ = issue(t, newKeys)
+	_, err = verifier.Verify(context.Background(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, client.jwksCalls)
+}
+
+func TestTokenVerifier_KeysUnavailable(t *testing.T) {
+	keys := newKeySet(t)
+	token, _ := issue(t, keys)
+
+	t.Run("without fallback", func(t *testing.T) {
+		verifier := NewTokenVerifier(&fakeAuthClient{}, &fakeDenylist{}, false)
+		_, err := verifier.Verify(context.Background(), token)
+		assert.ErrorIs(t, err, ErrVerifierUnavailable)
+	})
+
+	t.Run("with fallback", func(t *testing.T) {
+		client := &fakeAuthClient{validateFn: func(string) (*authpb.ValidateResponse, error) {
+			return &authpb.ValidateResponse{UserId: "u1", Email: "test@example.com", Role: "user"}, nil
+		}}
+		verifier := NewTokenVerifier(client, &fakeDenylist{}, true)
+
+		claims, err := verifier.Verify(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "u1", claims.UserID)
+		assert.Equal(t, []string{token}, client.validated)
+	})
+}
+
+func TestTokenVerifier_KeepsKnownKeysWhileAuthServiceIsDown(t *testing.T) {
+	keys := newKeySet(t)
+	client := &fakeAuthClient{keys: keys}
+	verifier := NewTokenVerifier(client, &fakeDenylist{}, false)
+
+	token, _ := issue(t, keys)
+	_, err := verifier.Verify(context.Background(), token)
+	require.NoError(t, err)
+
+	client.keys = nil
+	verifier.fetchedAt = time.Now().Add(-2 * keyRefreshInterval)
+	_, err = verifier.Verify(context.Background(), token)
+	assert.NoError(t, err)
+}
+
+func TestTokenVerifier_DenylistUnavailable(t *testing.T) {
+	keys := newKeySet(t)
+	token, _ := issue(t, keys)
+	denylist := &fakeDenylist{err: errors.New("redis is down")}
+
+	verifier := NewTokenVerifier(&fakeAuthClient{keys: keys}, denylist, false)
+	_, err := verifier.Verify(context.Background(), token)
+	assert.ErrorIs(t, err, ErrVerifierUnavailable)
+
+	client := &fakeAuthClient{keys: keys, validateFn: func(string) (*authpb.ValidateResponse, error) {
+		return nil, status.Error(codes.Unauthenticated, "token was revoked")
+	}}
+	verifier = NewTokenVerifier(client, denylist, true)
+	_, err = verifier.Verify(context.Background(), token)
+	assert.ErrorIs(t, err, errInvalidToken, "auth_service's answer is final")
+}
+
+func TestJWTAuthMiddleware_StatusCodes(t *testing.T) {
+	keys := newKeySet(t)
+	token, _ := issue(t, keys)
+
+	tests := []struct {
+		name     string
+		client   *fakeAuthClient
+		header   string
+		want     int
+		wantUser bool
+	}{
+		{"valid token", &fakeAuthClient{keys: keys}, "Bearer " + token, http.StatusOK, true},
+		{"invalid token", &fakeAuthClient{keys: keys}, "Bearer nope", http.StatusUnauthorized, false},
+		{"keys unavailable", &fakeAuthClient{}, "Bearer " + token, http.StatusServiceUnavailable, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(JWTAuthMiddleware(NewTokenVerifier(tt.client, &fakeDenylist{}, false)))
+			router.GET("/me", func(c *gin.Context) {
+				assert.Equal(t, token, c.GetString("access_token"))
+				c.String(http.StatusOK, c.GetString("role"))
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", tt.header)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.want, w.Code)
+			if tt.wantUser {
+				assert.Equal(t, "admin", w.Body.String())
+			}
+		})
+	}
+}
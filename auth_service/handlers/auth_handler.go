@@ -19,28 +19,31 @@ type AuthServer struct {
 }
 
 func (s *AuthServer) Login(ctx context.Context, req *authpb.LoginRequest) (*authpb.LoginResponse, error) {
-	logger.Log.Infof("📥 Login called for email: %s and pass is: %s", req.Email, req.Password)
+	logger.Log.Infow("📥 Login called", "email", req.GetEmail())
 
-	token, refreshToken, err := services.LoginUser(ctx, s.UserClient, req.Email, req.Password)
-
-	message := "Login successful"
+	token, refreshToken, err := services.LoginUser(ctx, s.UserClient, req.Email, req.Password, clientInfo(req.GetClient()))
 	if err != nil {
+		// Wrong credentials are Unauthenticated and a lockout is
+		// ResourceExhausted with when to retry; callers answer by the code
 		logger.Log.Infof("❌ Login failed: %v", err)
-		message = err.Error()
+		return nil, err
 	}
 
 	return &authpb.LoginResponse{
 		Token:        token,
 		RefreshToken: refreshToken,
-		Message:      message,
+		Message:      "Login successful",
 	}, nil
 }
 
 func (s *AuthServer) Validate(ctx context.Context, req *authpb.ValidateRequest) (*authpb.ValidateResponse, error) {
 	logger.Log.Infof("🔐 Validate called with token: %s", req.Token)
 
-	claims, err := utils.ValidateJWT(req.Token)
+	claims, err := services.ValidateAccessToken(ctx, req.Token)
 	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			return nil, err
+		}
 		return nil, status.Error(codes.Unauthenticated, "Invalid or expired token")
 	}
 
@@ -62,9 +65,13 @@ func (s *AuthServer) Validate(ctx context.Context, req *authpb.ValidateRequest)
 
 func (s *AuthServer) ValidateRefreshToken(ctx context.Context, req *authpb.ValidateRefreshTokenRequest) (*authpb.ValidateRefreshTokenResponse, error) {
 
-	accessToken, RefreshToken, err := services.ValidateRefreshToken(ctx, s.UserClient, req.RefreshToken)
+	accessToken, RefreshToken, err := services.ValidateRefreshToken(ctx, s.UserClient, req.RefreshToken, clientInfo(req.GetClient()))
 	if err != nil {
 		logger.Log.Infof("❌ Refresh token validation failed: %v", err)
+		switch status.Code(err) {
+		case codes.Aborted, codes.Unavailable:
+			return nil, err
+		}
 		return nil, status.Error(codes.Unauthenticated, "Invalid refresh token")
 	}
 
@@ -77,6 +84,13 @@ func (s *AuthServer) ValidateRefreshToken(ctx context.Context, req *authpb.Valid
 func (s *AuthServer) Logout(ctx context.Context, req *authpb.LogoutRequest) (*authpb.LogoutResponse, error) {
 	logger.Log.Infof("🔐 Logout called with token: %s", req.RefreshToken)
 
+	// The access token would otherwise stay usable until it expires
+	if req.AccessToken != "" {
+		if err := services.RevokeAccessToken(ctx, req.AccessToken); err != nil {
+			return nil, status.Error(codes.Internal, "Failed to logout")
+		}
+	}
+
 	err := services.DeleteRefreshToken(ctx, req.RefreshToken)
 	if err != nil {
 		if status.Code(err) == codes.Unauthenticated {
@@ -90,3 +104,49 @@ func (s *AuthServer) Logout(ctx context.Context, req *authpb.LogoutRequest) (*au
 		Message: "Logout successful",
 	}, nil
 }
+
+// GetJWKS publishes the public keys of the signing key set
+func (s *AuthServer) GetJWKS(ctx context.Context, req *authpb.GetJWKSRequest) (*authpb.GetJWKSResponse, error) {
+	keySet := utils.CurrentKeySet()
+	if keySet == nil {
+		return nil, status.Error(codes.Unavailable, "signing keys are not loaded")
+	}
+
+	set, err := keySet.JWKS()
+	if err != nil {
+		logger.Log.Errorw("❌ Failed to encode signing keys", "error", err)
+		return nil, status.Error(codes.Internal, "failed to encode signing keys")
+	}
+
+	return set.Proto(), nil
+}
+
+// UnlockLogin lets a user or an IP locked out after failed logins try again
+// right away
+func (s *AuthServer) UnlockLogin(ctx context.Context, req *authpb.UnlockLoginRequest) (*authpb.UnlockLoginResponse, error) {
+	var email string
+	if req.UserId != "" {
+		user, err := s.UserClient.GetUser(ctx, &userpb.GetUserRequest{Id: req.UserId})
+		if status.Code(err) == codes.NotFound {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		if err != nil {
+			logger.Log.Errorw("❌ Failed to get user", "user_id", req.UserId, "error", err)
+			return nil, status.Error(codes.Unavailable, "cannot connect to user service")
+		}
+		email = user.Email
+	}
+
+	if err := services.UnlockLogin(ctx, email, req.Ip); err != nil {
+		return nil, err
+	}
+	return &authpb.UnlockLoginResponse{}, nil
+}
+
+func clientInfo(client *authpb.ClientInfo) services.ClientInfo {
+	return services.ClientInfo{
+		UserAgent: client.GetUserAgent(),
+		DeviceID:  client.GetDeviceId(),
+		IP:        client.GetIp(),
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+
+	authpb "github.com/tird4d/go-microservices/auth_service/proto"
+	"github.com/tird4d/go-microservices/auth_service/services"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ListSessions returns the sessions of a user. The caller decides whose
+// sessions it may see; the gateway passes the user of the token or, for
+// admins, any user.
+func (s *AuthServer) ListSessions(ctx context.Context, req *authpb.ListSessionsRequest) (*authpb.ListSessionsResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	sessions, err := services.ListSessions(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &authpb.ListSessionsResponse{Sessions: make([]*authpb.Session, len(sessions))}
+	for i, session := range sessions {
+		res.Sessions[i] = &authpb.Session{
+			Id:         session.ID,
+			CreatedAt:  timestamppb.New(session.CreatedAt),
+			LastUsedAt: timestamppb.New(session.LastUsed),
+			Ip:         session.IP,
+			UserAgent:  session.UserAgent,
+		}
+	}
+	return res, nil
+}
+
+func (s *AuthServer) RevokeSession(ctx context.Context, req *authpb.RevokeSessionRequest) (*authpb.RevokeSessionResponse, error) {
+	if req.UserId == "" || req.SessionId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id and session_id are required")
+	}
+
+	if err := services.RevokeSession(ctx, req.UserId, req.SessionId); err != nil {
+		return nil, err
+	}
+	return &authpb.RevokeSessionResponse{}, nil
+}
+
+// RevokeAllSessions logs a user out everywhere, e.g. after a password change
+func (s *AuthServer) RevokeAllSessions(ctx context.Context, req *authpb.RevokeAllSessionsRequest) (*authpb.RevokeAllSessionsResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	revoked, err := services.RevokeAllSessions(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.RevokeAllSessionsResponse{Revoked: int32(revoked)}, nil
+}
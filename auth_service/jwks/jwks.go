@@ -0,0 +1,104 @@
+// Package jwks encodes token verification keys as a JSON Web Key Set
+// (RFC 7517) and decodes them back, so services can check access tokens
+// without asking auth_service.
+package jwks
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Signing algorithms of the keys in a set
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var ErrUnsupportedKey = errors.New("unsupported key type")
+
+// Key is the public half of one signing key
+type Key struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and public point of an OKP key
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// Set is the document served at /.well-known/jwks.json
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// NewKey describes pub, an RSA or Ed25519 public key, as a signature key
+func NewKey(id string, pub crypto.PublicKey) (Key, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return Key{
+			KeyType:   "RSA",
+			ID:        id,
+			Use:       "sig",
+			Algorithm: AlgRS256,
+			N:         encode(pub.N.Bytes()),
+			E:         encode(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return Key{
+			KeyType:   "OKP",
+			ID:        id,
+			Use:       "sig",
+			Algorithm: AlgEdDSA,
+			Curve:     "Ed25519",
+			X:         encode(pub),
+		}, nil
+	default:
+		return Key{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+	}
+}
+
+// PublicKey decodes the key, returning an *rsa.PublicKey or an
+// ed25519.PublicKey
+func (k Key) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case k.KeyType == "RSA" && k.Algorithm == AlgRS256:
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid modulus: %w", k.ID, err)
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid exponent: %w", k.ID, err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("key %s: invalid RSA key", k.ID)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case k.KeyType == "OKP" && k.Curve == "Ed25519" && k.Algorithm == AlgEdDSA:
+		x, err := decode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %s: invalid Ed25519 key", k.ID)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("%w: %s %s", ErrUnsupportedKey, k.KeyType, k.Algorithm)
+	}
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
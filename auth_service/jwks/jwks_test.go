@@ -0,0 +1,72 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey_RoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, pub := range []crypto.PublicKey{&rsaKey.PublicKey, edPub} {
+		key, err := NewKey("k1", pub)
+		require.NoError(t, err)
+
+		// Through JSON, as a verifier would fetch it
+		data, err := json.Marshal(Set{Keys: []Key{key}})
+		require.NoError(t, err)
+		var set Set
+		require.NoError(t, json.Unmarshal(data, &set))
+		require.Len(t, set.Keys, 1)
+		assert.Equal(t, "k1", set.Keys[0].ID)
+		assert.Equal(t, "sig", set.Keys[0].Use)
+
+		decoded, err := set.Keys[0].PublicKey()
+		require.NoError(t, err)
+		assert.True(t, pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(decoded))
+	}
+}
+
+func TestKey_RSAFields(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	key, err := NewKey("k1", &rsaKey.PublicKey)
+	require.NoError(t, err)
+	assert.Equal(t, "RSA", key.KeyType)
+	assert.Equal(t, AlgRS256, key.Algorithm)
+	assert.Equal(t, "AQAB", key.E, "65537 without leading zero bytes")
+}
+
+func TestNewKey_Unsupported(t *testing.T) {
+	der, err := x509.MarshalPKIXPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	require.NoError(t, err)
+
+	_, err = NewKey("k1", der)
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+}
+
+func TestKey_PublicKeyRejectsBadKeys(t *testing.T) {
+	for _, key := range []Key{
+		{KeyType: "OKP", Algorithm: AlgEdDSA, Curve: "Ed25519", X: "c2hvcnQ"},
+		{KeyType: "OKP", Algorithm: AlgEdDSA, Curve: "X25519", X: "c2hvcnQ"},
+		{KeyType: "RSA", Algorithm: AlgRS256, N: "!!", E: "AQAB"},
+		{KeyType: "RSA", Algorithm: AlgRS256, N: "AQAB", E: ""},
+		{KeyType: "RSA", Algorithm: "RS512", N: "AQAB", E: "AQAB"},
+		{KeyType: "oct", Algorithm: "HS256"},
+	} {
+		_, err := key.PublicKey()
+		assert.Error(t, err, key)
+	}
+}
@@ -0,0 +1,39 @@
+package jwks
+
+import authpb "github.com/tird4d/go-microservices/auth_service/proto"
+
+// Proto converts the set to the GetJWKS response
+func (s Set) Proto() *authpb.GetJWKSResponse {
+	res := &authpb.GetJWKSResponse{Keys: make([]*authpb.JsonWebKey, len(s.Keys))}
+	for i, key := range s.Keys {
+		res.Keys[i] = &authpb.JsonWebKey{
+			Kty: key.KeyType,
+			Kid: key.ID,
+			Use: key.Use,
+			Alg: key.Algorithm,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Curve,
+			X:   key.X,
+		}
+	}
+	return res
+}
+
+// FromProto reads a set from the GetJWKS response
+func FromProto(res *authpb.GetJWKSResponse) Set {
+	set := Set{Keys: make([]Key, len(res.GetKeys()))}
+	for i, key := range res.GetKeys() {
+		set.Keys[i] = Key{
+			KeyType:   key.Kty,
+			ID:        key.Kid,
+			Use:       key.Use,
+			Algorithm: key.Alg,
+			N:         key.N,
+			E:         key.E,
+			Curve:     key.Crv,
+			X:         key.X,
+		}
+	}
+	return set
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/tird4d/go-microservices/auth_service/metrics"
 	authpb "github.com/tird4d/go-microservices/auth_service/proto"
 	"github.com/tird4d/go-microservices/auth_service/tracing"
+	"github.com/tird4d/go-microservices/auth_service/utils"
 	userpb "github.com/tird4d/go-microservices/user_service/proto"
 
 	"google.golang.org/grpc"
@@ -73,6 +74,15 @@ func main() {
 	// Connect to Redis
 	config.ConnectRedis()
 
+	// Access tokens are signed with the active key of JWT_KEYS_DIR; the other
+	// keys there only verify tokens issued before a rotation
+	keySet, err := loadKeySet()
+	if err != nil {
+		log.Fatalf("❌ Failed to load signing keys: %v", err)
+	}
+	utils.SetKeySet(keySet)
+	logger.Log.Infow("✅ Signing keys loaded", "active_kid", keySet.Active().ID)
+
 	// Make gRPC connection to User Service
 	// The connection is made to the User Service running on localhost:50051
 	conn, err := grpc.DialContext(ctx, os.Getenv("USER_SERVICE_ADDR"), grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithUnaryInterceptor(interceptors.UnaryClientInterceptor))
@@ -125,3 +135,15 @@ func main() {
 	}
 
 }
+
+// loadKeySet reads the signing keys from JWT_KEYS_DIR. Without it a throwaway
+// key is generated, so tokens stop working after a restart and across
+// replicas.
+func loadKeySet() (*utils.KeySet, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		logger.Log.Warn("⚠️ JWT_KEYS_DIR is not set, signing tokens with a generated key")
+		return utils.GenerateKeySet()
+	}
+	return utils.LoadKeySet(dir, os.Getenv("JWT_ACTIVE_KEY_ID"))
+}
@@ -23,10 +23,20 @@ var (
 		},
 		[]string{"endpoint"},
 	)
+
+	// Counter of suspicious events such as a replayed refresh token, for alerting
+	SecurityEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_service_security_events_total",
+			Help: "Total number of security events in auth-service, labeled by event",
+		},
+		[]string{"event"},
+	)
 )
 
 // Register all metrics
 func InitMetrics() {
 	prometheus.MustRegister(RequestCounter)
 	prometheus.MustRegister(RequestDurationHistogram)
+	prometheus.MustRegister(SecurityEvents)
 }
@@ -0,0 +1,37 @@
+// Package revocation keeps the denylist of access tokens revoked before they
+// expire, such as on logout. auth_service writes it and token verifiers read
+// it, so both share the key layout kept here.
+package revocation
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const keyPrefix = "revoked_jti:"
+
+// Key is the Redis key marking the token with ID jti as revoked
+func Key(jti string) string {
+	return keyPrefix + jti
+}
+
+// Revoke denylists the token with ID jti until it expires; after that it is
+// rejected anyway, so the entry goes away with it
+func Revoke(ctx context.Context, rdb redis.Cmdable, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return rdb.Set(ctx, Key(jti), 1, ttl).Err()
+}
+
+// IsRevoked reports whether the token with ID jti was revoked
+func IsRevoked(ctx context.Context, rdb redis.Cmdable, jti string) (bool, error) {
+	n, err := rdb.Exists(ctx, Key(jti)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
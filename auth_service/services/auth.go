@@ -2,35 +2,57 @@ package services
 
 import (
 	"context"
-	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"github.com/tird4d/go-microservices/auth_service/config"
 	"github.com/tird4d/go-microservices/auth_service/logger"
+	"github.com/tird4d/go-microservices/auth_service/revocation"
 	"github.com/tird4d/go-microservices/auth_service/utils"
 	userpb "github.com/tird4d/go-microservices/user_service/proto"
 )
 
-func LoginUser(ctx context.Context, userClient userpb.UserServiceClient, email, password string) (string, string, error) {
+// errInvalidCredentials answers both an unknown email and a wrong password,
+// so a failed login doesn't tell whether the email is registered
+var errInvalidCredentials = status.Error(codes.Unauthenticated, "invalid email or password")
+
+// dummyPasswordHash is a bcrypt hash at the cost HashPassword uses. The
+// password of an unknown email is checked against it, so rejecting it takes
+// as long as rejecting a wrong password.
+const dummyPasswordHash = "$2a$14$Vm0WIwmFzZHEGsaZKnIMHuyAklUjItvFR6e2ALT8LNSHyp8ayerH6"
+
+// LoginUser checks the credentials of email and starts a session for client.
+// Failed attempts are counted, and once an account or the client's IP has
+// failed too often, attempts are refused without checking the password.
+func LoginUser(ctx context.Context, userClient userpb.UserServiceClient, email, password string, client ClientInfo) (string, string, error) {
+	if err := checkLoginAllowed(ctx, email, client.IP); err != nil {
+		logger.Log.Infow("⛔ Login attempt blocked", "email", email, "ip", client.IP)
+		return "", "", err
+	}
 
 	res, err := userClient.GetUserCredential(ctx, &userpb.GetUserCredentialRequest{
 		Email: email,
 	})
-	logger.Log.Infof("🔍 User credential response: %v", res)
 
 	if res, err = userServiceResponseHandler(res, err); err != nil {
+		if err == errInvalidCredentials {
+			utils.CheckPasswordHash(password, dummyPasswordHash)
+			recordLoginFailure(ctx, email, client.IP)
+		}
 		return "", "", err
 	}
 
 	ok := utils.CheckPasswordHash(password, res.Password)
 	if !ok {
-		logger.Log.Errorw("Invalid password: %v", err)
+		logger.Log.Infow("❌ Invalid password", "email", email)
+		recordLoginFailure(ctx, email, client.IP)
 
-		return "", "", status.Errorf(codes.Unauthenticated, "invalid password")
+		return "", "", errInvalidCredentials
 	}
+	clearLoginFailures(ctx, email)
 
 	oid, err := primitive.ObjectIDFromHex(res.Id)
 	if err != nil {
@@ -44,7 +66,7 @@ func LoginUser(ctx context.Context, userClient userpb.UserServiceClient, email,
 		return "", "", status.Errorf(codes.Internal, "failed to generate JWT")
 	}
 
-	refreshToken, err := createRefreshToken(ctx, res.Id)
+	refreshToken, err := createRefreshToken(ctx, res.Id, client, token)
 	if err != nil || refreshToken == "" {
 		logger.Log.Errorw("Failed to create refresh token: %v", err)
 		return "", "", status.Errorf(codes.Internal, "failed to create refresh token")
@@ -55,31 +77,33 @@ func LoginUser(ctx context.Context, userClient userpb.UserServiceClient, email,
 
 }
 
-func ValidateRefreshToken(ctx context.Context, userClient userpb.UserServiceClient, refreshToken string) (string, string, error) {
+// ValidateRefreshToken exchanges a refresh token for a new access token and
+// the next refresh token of its family
+func ValidateRefreshToken(ctx context.Context, userClient userpb.UserServiceClient, refreshToken string, client ClientInfo) (string, string, error) {
 	// Check if the refresh token is valid
 	if refreshToken == "" {
-		return "", "", status.Errorf(codes.Unauthenticated, "invalid refresh token")
+		return "", "", errRefreshTokenInvalid
 	}
 
-	// Validate the refresh token with Redis
-	userID, err := config.RedisClient.Get(ctx, refreshToken).Result()
-
-	if err != nil || userID == "" {
-		logger.Log.Infof("❌ Failed to validate refresh token: %v", err.Error())
-		return "", "", status.Errorf(codes.Unauthenticated, "invalid refresh token")
+	record, err := findRefreshToken(ctx, refreshToken, client)
+	if err != nil {
+		logger.Log.Infof("❌ Failed to validate refresh token: %v", err)
+		return "", "", err
 	}
 
+	// Everything that can fail for reasons unrelated to the token happens
+	// before it is rotated, so a retry isn't mistaken for a replay
 	user, err := userClient.GetUser(ctx, &userpb.GetUserRequest{
-		Id: userID,
+		Id: record.UserID,
 	})
 
 	if err != nil || user == nil || user.Id == "" {
-		logger.Log.Infof("❌ Failed to connect to user_service: %v", err.Error())
+		logger.Log.Infof("❌ Failed to connect to user_service: %v", err)
 		return "", "", status.Errorf(codes.Unavailable, "cannot connect to user service")
 	}
 
 	// Convert userID to ObjectID
-	oid, err := primitive.ObjectIDFromHex(userID)
+	oid, err := primitive.ObjectIDFromHex(record.UserID)
 	if err != nil {
 		logger.Log.Infof("❌ Invalid user ID: %v", err)
 		return "", "", status.Errorf(codes.InvalidArgument, "invalid user ID")
@@ -92,66 +116,82 @@ func ValidateRefreshToken(ctx context.Context, userClient userpb.UserServiceClie
 		return "", "", status.Errorf(codes.Internal, "failed to generate JWT")
 	}
 
-	// Create a new refresh token
-	newRefreshToken, err := createRefreshToken(ctx, userID)
-
+	newRefreshToken, err := rotateRefreshToken(ctx, refreshToken, record, client, token)
 	if err != nil {
-		logger.Log.Infof("❌ Failed to store refresh token in Redis: %v", err)
-		return "", "", status.Errorf(codes.Internal, "failed to store refresh token")
+		return "", "", err
 	}
 
-	if newRefreshToken == "" {
-		return "", "", status.Errorf(codes.Internal, "failed to generate refresh token")
-	}
+	logger.Log.Infof("✅ New AccessToken and RefreshToken issued for user: %s", record.UserID)
+
+	return token, newRefreshToken, nil
+}
 
-	// Delete the old refresh token
-	err = DeleteRefreshToken(ctx, refreshToken)
+// DeleteRefreshToken ends the login refreshToken belongs to
+func DeleteRefreshToken(ctx context.Context, refreshToken string) error {
+	record, err := findRefreshToken(ctx, refreshToken, ClientInfo{})
 	if err != nil {
-		logger.Log.Infof("❌ Failed to delete old refresh token: %v", err)
-		return "", "", status.Errorf(codes.Internal, "failed to delete old refresh token")
+		logger.Log.Infof("❌ Refresh token not found in Redis")
+		return err
 	}
 
-	logger.Log.Infof("✅ New AccessToken and RefreshToken issued for user: %s", userID)
-
-	return token, newRefreshToken, nil
+	if err := revokeRefreshFamily(ctx, record.Family); err != nil {
+		logger.Log.Infof("❌ Failed to delete refresh token: %v", err)
+		return status.Errorf(codes.Internal, "failed to delete refresh token")
+	}
+	return nil
 }
 
-func createRefreshToken(ctx context.Context, userID string) (string, error) {
-	// Generate a refresh token with a longer expiration time
-	refreshToken := utils.GenerateRefreshToken()
+// ValidateAccessToken checks the signature and expiry of an access token and
+// that it wasn't revoked
+func ValidateAccessToken(ctx context.Context, token string) (jwt.MapClaims, error) {
+	claims, err := utils.ValidateJWT(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+	}
 
-	// Store the refresh token in Redis with userID as the key
-	err := config.RedisClient.Set(ctx, refreshToken, userID, 7*24*time.Hour).Err()
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+	}
 
-	return refreshToken, err
-}
+	revoked, err := revocation.IsRevoked(ctx, config.RedisClient, jti)
+	if err != nil {
+		logger.Log.Errorw("❌ Failed to check token revocation", "error", err)
+		return nil, status.Error(codes.Unavailable, "cannot check token revocation")
+	}
+	if revoked {
+		return nil, status.Error(codes.Unauthenticated, "token was revoked")
+	}
 
-func DeleteRefreshToken(ctx context.Context, refreshToken string) error {
-	// Check if the refresh token is exists in Redis
-	ok, err := config.RedisClient.Exists(ctx, refreshToken).Result()
+	return claims, nil
+}
 
+// RevokeAccessToken denylists an access token until it expires. A token that
+// doesn't verify can't be used anyway, so it is ignored.
+func RevokeAccessToken(ctx context.Context, token string) error {
+	claims, err := utils.ValidateJWT(token)
 	if err != nil {
-		logger.Log.Infof("❌ Failed to check if refresh token exists: %v", err)
-		return status.Errorf(codes.Internal, "failed to check if refresh token exists")
+		return nil
 	}
 
-	if ok == 0 {
-		logger.Log.Infof("❌ Refresh token not found in Redis")
-		return status.Errorf(codes.Unauthenticated, "invalid refresh token")
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if jti == "" || err != nil || exp == nil {
+		return nil
 	}
 
-	// Delete the refresh token from Redis
-	_, err = config.RedisClient.Del(ctx, refreshToken).Result()
-
-	return err
-
+	if err := revocation.Revoke(ctx, config.RedisClient, jti, exp.Time); err != nil {
+		logger.Log.Errorw("❌ Failed to revoke access token", "error", err)
+		return status.Error(codes.Internal, "failed to revoke access token")
+	}
+	return nil
 }
 
 func userServiceResponseHandler(res *userpb.UserCredentialResponse, err error) (*userpb.UserCredentialResponse, error) {
 	if err != nil {
 		st, ok := status.FromError(err)
 		if ok && st.Code() == codes.NotFound {
-			return nil, status.Error(codes.NotFound, "email not found")
+			return nil, errInvalidCredentials
 		}
 		logger.Log.Errorw("Failed to connect to user_service: %v", err)
 		return nil, status.Error(codes.Unavailable, "cannot connect to user service")
@@ -9,6 +9,7 @@ import (
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
@@ -18,10 +19,16 @@ import (
 	"github.com/tird4d/go-microservices/auth_service/utils"
 	userpb "github.com/tird4d/go-microservices/user_service/proto"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+var testClient = ClientInfo{UserAgent: "test-agent/1.0"}
+
+// testRedis backs config.RedisClient; tests move its clock to expire keys
+var testRedis *miniredis.Miniredis
+
 func TestMain(m *testing.M) {
 	err := godotenv.Load("../.env")
 	logger.InitLogger(true)
@@ -30,19 +37,20 @@ func TestMain(m *testing.M) {
 		logger.Log.Info("Error loading .env file")
 	}
 
-	// Ensure JWT_SECRET is set for tests (fallback when .env is absent, e.g. in CI)
-	if os.Getenv("JWT_SECRET") == "" {
-		os.Setenv("JWT_SECRET", "test-secret-key-for-ci")
+	keySet, err := utils.GenerateKeySet()
+	if err != nil {
+		log.Fatalf("❌ Failed to generate signing keys: %v", err)
 	}
+	utils.SetKeySet(keySet)
 
 	//Create a redis client with in-memory database
-	s, err := miniredis.Run()
+	testRedis, err = miniredis.Run()
 	if err != nil {
 		log.Fatalf("❌ Failed to start mini redis: %v", err)
 	}
 
 	config.RedisClient = redis.NewClient(&redis.Options{
-		Addr: s.Addr(),
+		Addr: testRedis.Addr(),
 	})
 
 	os.Exit(m.Run())
@@ -71,7 +79,7 @@ func TestLoginUser_Success(t *testing.T) {
 			Password: hashedPassword,
 		}, nil)
 
-	token, refreshToken, err := LoginUser(ctx, mockUserClient, email, password)
+	token, refreshToken, err := LoginUser(ctx, mockUserClient, email, password, testClient)
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
@@ -100,9 +108,10 @@ func TestLoginUser_InvalidPassword(t *testing.T) {
 		}, nil)
 
 		// Call the function
-	token, refreshToken, err := LoginUser(ctx, mockUserClient, email, wrongPassword)
+	token, refreshToken, err := LoginUser(ctx, mockUserClient, email, wrongPassword, testClient)
 	// Check the result
-	assert.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "invalid email or password", status.Convert(err).Message())
 	assert.Empty(t, token)
 	assert.Empty(t, refreshToken)
 }
@@ -128,13 +137,28 @@ func TestLoginUser_UserNotFound(t *testing.T) {
 		}, status.Error(codes.NotFound, "email not found"))
 
 	// Call the function
-	token, refreshToken, err := LoginUser(ctx, mockUserClient, email, password)
-	// Check the result
-	assert.ErrorIs(t, err, status.Error(codes.NotFound, "email not found"))
+	token, refreshToken, err := LoginUser(ctx, mockUserClient, email, password, testClient)
+	// Check the result: the same answer as a wrong password
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "invalid email or password", status.Convert(err).Message())
 	assert.Empty(t, token)
 	assert.Empty(t, refreshToken)
 }
 
+// An unknown email is only as fast to reject as a wrong password if the dummy
+// hash is well-formed and as expensive as a real one
+func TestDummyPasswordHash_MatchesPasswordCost(t *testing.T) {
+	hash, err := utils.HashPassword("password123")
+	assert.NoError(t, err)
+	hashCost, err := bcrypt.Cost([]byte(hash))
+	assert.NoError(t, err)
+
+	cost, err := bcrypt.Cost([]byte(dummyPasswordHash))
+
+	assert.NoError(t, err)
+	assert.Equal(t, hashCost, cost)
+}
+
 func TestLoginUser_InvalidUserIDFormat(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -155,7 +179,7 @@ func TestLoginUser_InvalidUserIDFormat(t *testing.T) {
 			Password: hashedPassword,
 		}, nil)
 
-	token, refreshToken, err := LoginUser(ctx, mockUserClient, email, password)
+	token, refreshToken, err := LoginUser(ctx, mockUserClient, email, password, testClient)
 
 	assert.Error(t, err)
 	st, _ := status.FromError(err)
@@ -173,10 +197,9 @@ func TestValidateRefreshToken_Success(t *testing.T) {
 
 	//Test data
 	email := "test@example.com"
-	refreshToken := "valid_refresh_token"
 	userID := primitive.NewObjectID().Hex()
-	// Set the refresh token in Redis
-	config.RedisClient.Set(ctx, refreshToken, userID, time.Minute)
+	refreshToken, err := createRefreshToken(ctx, userID, testClient, "")
+	assert.NoError(t, err)
 
 	// Answer mock
 	mockUserClient.EXPECT().
@@ -188,22 +211,150 @@ func TestValidateRefreshToken_Success(t *testing.T) {
 		}, nil)
 
 	// Call the function
-	token, newRefreshToken, err := ValidateRefreshToken(ctx, mockUserClient, refreshToken)
+	token, newRefreshToken, err := ValidateRefreshToken(ctx, mockUserClient, refreshToken, testClient)
 	// Check the result
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
 	assert.NotEmpty(t, newRefreshToken)
 	assert.NotEqual(t, refreshToken, newRefreshToken)
-	// Check if the new refresh token is stored in Redis
-	redisUserID, err := config.RedisClient.Get(ctx, newRefreshToken).Result()
+
+	// The new token belongs to the same family and is now its current token
+	oldRecord, err := loadRefreshToken(ctx, refreshToken)
 	assert.NoError(t, err)
-	assert.Equal(t, userID, redisUserID)
-	// Check if the old refresh token is deleted from Redis
+	newRecord, err := loadRefreshToken(ctx, newRefreshToken)
+	assert.NoError(t, err)
+	assert.Equal(t, oldRecord, newRecord)
+	current, err := config.RedisClient.HGet(ctx, refreshFamilyKey(newRecord.Family), "current").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, newRefreshToken, current)
+
+	ttl, err := config.RedisClient.TTL(ctx, refreshTokenKey(newRefreshToken)).Result()
+	assert.NoError(t, err)
+	assert.InDelta(t, refreshTokenTTL, ttl, float64(time.Minute))
+}
+
+func TestValidateRefreshToken_ReuseRevokesFamily(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserClient := mocks.NewMockUserServiceClient(ctrl)
+	ctx := context.Background()
+
+	userID := primitive.NewObjectID().Hex()
+	mockUserClient.EXPECT().
+		GetUser(gomock.Any(), &userpb.GetUserRequest{Id: userID}).
+		Return(&userpb.UserResponse{Id: userID, Email: "test@example.com"}, nil).
+		Times(2)
+
+	refreshToken, err := createRefreshToken(ctx, userID, testClient, "")
+	assert.NoError(t, err)
+	_, newRefreshToken, err := ValidateRefreshToken(ctx, mockUserClient, refreshToken, testClient)
+	assert.NoError(t, err)
+
+	// The rotated token is presented again, e.g. by whoever copied it
+	_, _, err = ValidateRefreshToken(ctx, mockUserClient, refreshToken, testClient)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// The legitimate client's token stopped working as well
+	_, _, err = ValidateRefreshToken(ctx, mockUserClient, newRefreshToken, testClient)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestValidateRefreshToken_OtherClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserClient := mocks.NewMockUserServiceClient(ctrl)
+	ctx := context.Background()
+
+	userID := primitive.NewObjectID().Hex()
+	mockUserClient.EXPECT().
+		GetUser(gomock.Any(), &userpb.GetUserRequest{Id: userID}).
+		Return(&userpb.UserResponse{Id: userID, Email: "test@example.com"}, nil).
+		AnyTimes()
+
+	tests := []struct {
+		name   string
+		issued ClientInfo
+		used   ClientInfo
+	}{
+		{"other user agent", ClientInfo{UserAgent: "app/1.0"}, ClientInfo{UserAgent: "curl/8.0"}},
+		{"other device", ClientInfo{UserAgent: "app/1.0", DeviceID: "d1"}, ClientInfo{UserAgent: "app/1.0", DeviceID: "d2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refreshToken, err := createRefreshToken(ctx, userID, tt.issued, "")
+			assert.NoError(t, err)
+
+			_, _, err = ValidateRefreshToken(ctx, mockUserClient, refreshToken, tt.used)
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+			// The family is revoked, so the token is gone for its own client too
+			_, _, err = ValidateRefreshToken(ctx, mockUserClient, refreshToken, tt.issued)
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		})
+	}
+
+	// The device ID binds the token, not the user agent, which changes with
+	// app updates
+	refreshToken, err := createRefreshToken(ctx, userID, ClientInfo{UserAgent: "app/1.0", DeviceID: "d1"}, "")
+	assert.NoError(t, err)
+	_, _, err = ValidateRefreshToken(ctx, mockUserClient, refreshToken, ClientInfo{UserAgent: "app/1.1", DeviceID: "d1"})
+	assert.NoError(t, err)
+}
+
+func TestValidateRefreshToken_LegacyToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserClient := mocks.NewMockUserServiceClient(ctrl)
+	ctx := context.Background()
+
+	// A token stored before refresh token families
+	refreshToken := uuid.NewString()
+	userID := primitive.NewObjectID().Hex()
+	config.RedisClient.Set(ctx, refreshToken, userID, time.Minute)
+
+	mockUserClient.EXPECT().
+		GetUser(gomock.Any(), &userpb.GetUserRequest{Id: userID}).
+		Return(&userpb.UserResponse{Id: userID, Email: "test@example.com"}, nil)
+
+	_, newRefreshToken, err := ValidateRefreshToken(ctx, mockUserClient, refreshToken, testClient)
+	assert.NoError(t, err)
+
+	record, err := loadRefreshToken(ctx, newRefreshToken)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, record.UserID)
+
+	// The bare key is gone, so the old token can't start a second family
 	_, err = config.RedisClient.Get(ctx, refreshToken).Result()
-	assert.Error(t, err)
 	assert.Equal(t, redis.Nil, err)
 }
 
+func TestValidateRefreshToken_DoesNotTouchOtherKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserClient := mocks.NewMockUserServiceClient(ctrl)
+	ctx := context.Background()
+
+	// Keys that aren't refresh tokens, such as a revoked access token or a
+	// login lockout, must survive being sent as one
+	keys := []string{"revoked_jti:" + uuid.NewString(), "login_block:account:test@example.com"}
+	for _, key := range keys {
+		config.RedisClient.Set(ctx, key, primitive.NewObjectID().Hex(), time.Minute)
+
+		_, _, err := ValidateRefreshToken(ctx, mockUserClient, key, testClient)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Equal(t, codes.Unauthenticated, status.Code(DeleteRefreshToken(ctx, key)))
+
+		exists, err := config.RedisClient.Exists(ctx, key).Result()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), exists, key)
+	}
+}
+
 func TestValidateRefreshToken_InvalidRefreshToken(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -215,7 +366,7 @@ func TestValidateRefreshToken_InvalidRefreshToken(t *testing.T) {
 	refreshToken := "invalid_refresh_token"
 
 	// Call the function
-	token, newRefreshToken, err := ValidateRefreshToken(ctx, mockUserClient, refreshToken)
+	token, newRefreshToken, err := ValidateRefreshToken(ctx, mockUserClient, refreshToken, testClient)
 	// Check the result
 	assert.Error(t, err)
 	st, _ := status.FromError(err)
@@ -232,10 +383,9 @@ func TestValidateRefreshToken_UserServiceUnavailable(t *testing.T) {
 	ctx := context.Background()
 
 	//Test data
-	refreshToken := "valid_refresh_token"
 	userID := primitive.NewObjectID().Hex()
-	// Set the refresh token in Redis
-	config.RedisClient.Set(ctx, refreshToken, userID, time.Minute)
+	refreshToken, err := createRefreshToken(ctx, userID, testClient, "")
+	assert.NoError(t, err)
 
 	// Answer mock
 	mockUserClient.EXPECT().
@@ -243,13 +393,18 @@ func TestValidateRefreshToken_UserServiceUnavailable(t *testing.T) {
 		Return(nil, status.Error(codes.Unavailable, "service unavailable"))
 
 	// Call the function
-	token, newRefreshToken, err := ValidateRefreshToken(ctx, mockUserClient, refreshToken)
+	token, newRefreshToken, err := ValidateRefreshToken(ctx, mockUserClient, refreshToken, testClient)
 	// Check the result
 	assert.Error(t, err)
 	st, _ := status.FromError(err)
 	assert.Equal(t, codes.Unavailable, st.Code())
 	assert.Empty(t, token)
 	assert.Empty(t, newRefreshToken)
+
+	// The token wasn't rotated, so retrying isn't taken for a replay
+	current, err := config.RedisClient.HGet(ctx, refreshFamilyKey(mustLoad(t, refreshToken).Family), "current").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, refreshToken, current)
 }
 func TestValidateRefreshToken_InvalidUserIDFormat(t *testing.T) {
 	ctrl := gomock.NewController(t)
@@ -259,10 +414,9 @@ func TestValidateRefreshToken_InvalidUserIDFormat(t *testing.T) {
 	ctx := context.Background()
 
 	//Test data
-	refreshToken := "valid_refresh_token"
 	userID := "NOT_A_VALID_OBJECT_ID"
-	// Set the refresh token in Redis
-	config.RedisClient.Set(ctx, refreshToken, userID, time.Minute)
+	refreshToken, err := createRefreshToken(ctx, userID, testClient, "")
+	assert.NoError(t, err)
 
 	// Answer mock
 	mockUserClient.EXPECT().
@@ -274,7 +428,7 @@ func TestValidateRefreshToken_InvalidUserIDFormat(t *testing.T) {
 		}, nil)
 
 	// Call the function
-	token, newRefreshToken, err := ValidateRefreshToken(ctx, mockUserClient, refreshToken)
+	token, newRefreshToken, err := ValidateRefreshToken(ctx, mockUserClient, refreshToken, testClient)
 	// Check the result
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, status.Error(codes.InvalidArgument, "invalid user ID"))
@@ -287,20 +441,55 @@ func TestDeleteRefreshToken(t *testing.T) {
 	defer ctrl.Finish()
 
 	ctx := context.Background()
-	refreshToken := "valid_refresh_token"
 	userID := primitive.NewObjectID().Hex()
-	// Set the refresh token in Redis
-	config.RedisClient.Set(ctx, refreshToken, userID, time.Minute)
+	refreshToken, err := createRefreshToken(ctx, userID, testClient, "")
+	assert.NoError(t, err)
+	family := mustLoad(t, refreshToken).Family
+
 	// Call the function
-	err := DeleteRefreshToken(ctx, refreshToken)
+	err = DeleteRefreshToken(ctx, refreshToken)
 	// Check the result
 	assert.NoError(t, err)
-	// Check if the refresh token is deleted from Redis
-	_, err = config.RedisClient.Get(ctx, refreshToken).Result()
-	assert.Error(t, err)
-	assert.Equal(t, redis.Nil, err)
-	// Check if the refresh token is deleted from Redis
-	_, err = config.RedisClient.Get(ctx, refreshToken).Result()
-	assert.Error(t, err)
-	assert.Equal(t, redis.Nil, err)
+	// Check if the refresh token and its family are deleted from Redis
+	_, err = loadRefreshToken(ctx, refreshToken)
+	assert.Equal(t, errRefreshTokenInvalid, err)
+	exists, err := config.RedisClient.Exists(ctx, refreshFamilyKey(family)).Result()
+	assert.NoError(t, err)
+	assert.Zero(t, exists)
+
+	// A second logout with the same token fails
+	err = DeleteRefreshToken(ctx, refreshToken)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func mustLoad(t *testing.T, refreshToken string) *refreshTokenRecord {
+	t.Helper()
+	record, err := loadRefreshToken(context.Background(), refreshToken)
+	if err != nil {
+		t.Fatalf("refresh token %q not found: %v", refreshToken, err)
+	}
+	return record
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	ctx := context.Background()
+	token, err := utils.GenerateJWT(primitive.NewObjectID(), "test@example.com", "user")
+	assert.NoError(t, err)
+
+	claims, err := ValidateAccessToken(ctx, token)
+	assert.NoError(t, err)
+
+	assert.NoError(t, RevokeAccessToken(ctx, token))
+
+	_, err = ValidateAccessToken(ctx, token)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// The denylist entry lives only as long as the token would
+	ttl, err := config.RedisClient.TTL(ctx, "revoked_jti:"+claims["jti"].(string)).Result()
+	assert.NoError(t, err)
+	assert.InDelta(t, 24*time.Hour, ttl, float64(time.Minute))
+}
+
+func TestRevokeAccessToken_IgnoresInvalidTokens(t *testing.T) {
+	assert.NoError(t, RevokeAccessToken(context.Background(), "not-a-token"))
 }
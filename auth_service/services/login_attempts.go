@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/tird4d/go-microservices/auth_service/config"
+	"github.com/tird4d/go-microservices/auth_service/logger"
+)
+
+// Failed logins are counted per account and per client IP. Past a few
+// failures an account has to wait before the next attempt, twice as long
+// after every further failure, until it is locked out. An IP is only locked
+// out, at a higher threshold, since many users may share it. Blocked attempts
+// are rejected before the password is hashed.
+//
+// Accounts are keyed by the email as typed, whether or not it exists, so a
+// lockout looks the same for every email.
+const (
+	loginFailuresPrefix = "login_failures:"
+	loginBlockPrefix    = "login_block:"
+
+	// loginFailureWindow is how long failures are remembered after the last one
+	loginFailureWindow = 15 * time.Minute
+	// loginDelayAfter failures start the delays, which begin at loginBaseDelay
+	loginDelayAfter = 3
+	loginBaseDelay  = time.Second
+	// accountLockoutThreshold failures lock the account for loginLockoutDuration
+	accountLockoutThreshold = 10
+	ipLockoutThreshold      = 50
+	loginLockoutDuration    = 15 * time.Minute
+)
+
+// errLoginBlocked is the answer to every blocked attempt; retryAfter is added
+// as RetryInfo
+func errLoginBlocked(retryAfter time.Duration) error {
+	st := status.New(codes.ResourceExhausted, "too many failed login attempts, try again later")
+	if withInfo, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter.Round(time.Second))}); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
+// loginSubject is an account or an IP that failed logins are counted against
+type loginSubject struct {
+	key  string
+	isIP bool
+}
+
+func accountSubject(email string) loginSubject {
+	return loginSubject{key: "account:" + strings.ToLower(strings.TrimSpace(email))}
+}
+
+func ipSubject(ip string) loginSubject {
+	return loginSubject{key: "ip:" + ip, isIP: true}
+}
+
+// loginSubjects are what the attempts of email from ip are counted against
+func loginSubjects(email, ip string) []loginSubject {
+	subjects := []loginSubject{accountSubject(email)}
+	if ip != "" {
+		subjects = append(subjects, ipSubject(ip))
+	}
+	return subjects
+}
+
+// block is how long the subject waits after its failures-th failure
+func (s loginSubject) block(failures int64) time.Duration {
+	switch {
+	case failures >= s.lockoutThreshold():
+		return loginLockoutDuration
+	case !s.isIP && failures >= loginDelayAfter:
+		return loginBaseDelay << (failures - loginDelayAfter)
+	default:
+		return 0
+	}
+}
+
+func (s loginSubject) lockoutThreshold() int64 {
+	if s.isIP {
+		return ipLockoutThreshold
+	}
+	return accountLockoutThreshold
+}
+
+// checkLoginAllowed rejects an attempt while its account or IP is blocked
+func checkLoginAllowed(ctx context.Context, email, ip string) error {
+	subjects := loginSubjects(email, ip)
+	cmds := make([]*redis.DurationCmd, len(subjects))
+	_, err := config.RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, subject := range subjects {
+			cmds[i] = pipe.PTTL(ctx, loginBlockPrefix+subject.key)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Errorw("❌ Failed to check login attempts", "error", err)
+		return status.Error(codes.Unavailable, "cannot check login attempts")
+	}
+
+	var wait time.Duration
+	for _, cmd := range cmds {
+		if ttl := cmd.Val(); ttl > wait {
+			wait = ttl
+		}
+	}
+	if wait > 0 {
+		return errLoginBlocked(wait)
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed attempt and blocks the account or IP
+// for as long as their failure counts call for
+func recordLoginFailure(ctx context.Context, email, ip string) {
+	subjects := loginSubjects(email, ip)
+	counts := make([]*redis.IntCmd, len(subjects))
+	_, err := config.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, subject := range subjects {
+			counts[i] = pipe.Incr(ctx, loginFailuresPrefix+subject.key)
+			pipe.Expire(ctx, loginFailuresPrefix+subject.key, loginFailureWindow)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Errorw("❌ Failed to record login failure", "error", err)
+		return
+	}
+
+	for i, subject := range subjects {
+		failures := counts[i].Val()
+		block := subject.block(failures)
+		if block == 0 {
+			continue
+		}
+
+		if err := config.RedisClient.Set(ctx, loginBlockPrefix+subject.key, failures, block).Err(); err != nil {
+			logger.Log.Errorw("❌ Failed to block login", "subject", subject.key, "error", err)
+			continue
+		}
+		// Only the failure that crosses the threshold is reported, not every
+		// attempt of an attacker who keeps going
+		switch {
+		case failures != subject.lockoutThreshold():
+		case subject.isIP:
+			securityEvent("ip_locked", "ip", ip, "failures", failures)
+		default:
+			securityEvent("account_locked", "email", email, "ip", ip, "failures", failures)
+		}
+	}
+}
+
+// clearLoginFailures forgets the failures of an account after a successful
+// login. Those of the IP stay; they may belong to other accounts.
+func clearLoginFailures(ctx context.Context, email string) {
+	subject := accountSubject(email)
+	if err := config.RedisClient.Del(ctx, loginFailuresPrefix+subject.key, loginBlockPrefix+subject.key).Err(); err != nil {
+		logger.Log.Warnw("⚠️ Failed to clear login failures", "error", err)
+	}
+}
+
+// UnlockLogin lifts the lockout and forgets the failures of an account, an IP
+// or both; either may be empty
+func UnlockLogin(ctx context.Context, email, ip string) error {
+	var keys []string
+	if email != "" {
+		subject := accountSubject(email)
+		keys = append(keys, loginFailuresPrefix+subject.key, loginBlockPrefix+subject.key)
+	}
+	if ip != "" {
+		subject := ipSubject(ip)
+		keys = append(keys, loginFailuresPrefix+subject.key, loginBlockPrefix+subject.key)
+	}
+	if len(keys) == 0 {
+		return status.Error(codes.InvalidArgument, "an account or an IP is required")
+	}
+
+	if err := config.RedisClient.Del(ctx, keys...).Err(); err != nil {
+		logger.Log.Errorw("❌ Failed to unlock login", "error", err)
+		return status.Error(codes.Internal, "failed to unlock login")
+	}
+
+	logger.Log.Infow("✅ Login unlocked", "email", email, "ip", ip)
+	return nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/auth_service/metrics"
+	"github.com/tird4d/go-microservices/auth_service/mocks"
+	userpb "github.com/tird4d/go-microservices/user_service/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeCredentials answers GetUserCredential for one account whose password
+// is "password123", hashed cheaply to keep the test fast, and counts lookups
+type fakeCredentials struct {
+	email   string
+	hash    string
+	lookups int
+}
+
+func newFakeCredentials(t *testing.T, ctrl *gomock.Controller, email string) (*mocks.MockUserServiceClient, *fakeCredentials) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	creds := &fakeCredentials{email: email, hash: string(hash)}
+
+	client := mocks.NewMockUserServiceClient(ctrl)
+	client.EXPECT().GetUserCredential(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, in *userpb.GetUserCredentialRequest, opts ...interface{}) (*userpb.UserCredentialResponse, error) {
+			creds.lookups++
+			if in.Email != creds.email {
+				return nil, status.Error(codes.NotFound, "user not found")
+			}
+			return &userpb.UserCredentialResponse{Id: primitive.NewObjectID().Hex(), Email: in.Email, Password: creds.hash}, nil
+		}).AnyTimes()
+	return client, creds
+}
+
+// retryAfter returns the RetryInfo of a blocked login
+func retryAfter(t *testing.T, err error) time.Duration {
+	t.Helper()
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code(), "login should be blocked: %v", err)
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			return info.RetryDelay.AsDuration()
+		}
+	}
+	t.Fatalf("no RetryInfo in %v", err)
+	return 0
+}
+
+func TestLoginUser_ProgressiveDelayAndLockout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	email := "delay@example.com"
+	client := ClientInfo{IP: "203.0.113.10"}
+	userClient, creds := newFakeCredentials(t, ctrl, email)
+	lockouts := testutil.ToFloat64(metrics.SecurityEvents.WithLabelValues("account_locked"))
+
+	// The first failures cost nothing but the failed attempt
+	for i := 1; i < loginDelayAfter; i++ {
+		_, _, err := LoginUser(ctx, userClient, email, "wrong", client)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+
+	// After that every failure doubles the wait for the next attempt
+	wait := loginBaseDelay
+	for i := loginDelayAfter; i < accountLockoutThreshold; i++ {
+		_, _, err := LoginUser(ctx, userClient, email, "wrong", client)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		lookups := creds.lookups
+		_, _, err = LoginUser(ctx, userClient, email, "password123", client)
+		assert.Equal(t, wait, retryAfter(t, err))
+		assert.Equal(t, lookups, creds.lookups, "blocked attempts don't check the password")
+
+		testRedis.FastForward(wait)
+		wait *= 2
+	}
+
+	_, _, err := LoginUser(ctx, userClient, email, "wrong", client)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Locked out, even with the right password and in other letter case
+	_, _, err = LoginUser(ctx, userClient, "Delay@Example.com", "password123", client)
+	assert.Equal(t, loginLockoutDuration, retryAfter(t, err))
+	assert.Equal(t, lockouts+1, testutil.ToFloat64(metrics.SecurityEvents.WithLabelValues("account_locked")))
+
+	testRedis.FastForward(loginLockoutDuration)
+	token, _, err := LoginUser(ctx, userClient, email, "password123", client)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+}
+
+func TestLoginUser_SuccessClearsFailures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	email := "forgetful@example.com"
+	userClient, _ := newFakeCredentials(t, ctrl, email)
+
+	for i := 1; i < loginDelayAfter; i++ {
+		_, _, err := LoginUser(ctx, userClient, email, "wrong", testClient)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+	_, _, err := LoginUser(ctx, userClient, email, "password123", testClient)
+	require.NoError(t, err)
+
+	// The count starts over, so this failure doesn't delay the next attempt
+	_, _, err = LoginUser(ctx, userClient, email, "wrong", testClient)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, _, err = LoginUser(ctx, userClient, email, "password123", testClient)
+	assert.NoError(t, err)
+}
+
+func TestLoginUser_LockoutDoesNotRevealEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	userClient, _ := newFakeCredentials(t, ctrl, "exists@example.com")
+
+	lockOut := func(email string) error {
+		for failures := 0; failures < accountLockoutThreshold; {
+			_, _, err := LoginUser(ctx, userClient, email, "wrong", ClientInfo{})
+			if status.Code(err) == codes.ResourceExhausted {
+				testRedis.FastForward(retryAfter(t, err))
+				continue
+			}
+			failures++
+		}
+		_, _, err := LoginUser(ctx, userClient, email, "password123", ClientInfo{})
+		return err
+	}
+
+	existing := lockOut("exists@example.com")
+	missing := lockOut("missing@example.com")
+	assert.Equal(t, status.Convert(existing).Proto(), status.Convert(missing).Proto())
+
+	require.NoError(t, UnlockLogin(ctx, "exists@example.com", ""))
+	_, _, err := LoginUser(ctx, userClient, "exists@example.com", "password123", ClientInfo{})
+	assert.NoError(t, err)
+}
+
+func TestLoginUser_IPLockout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	userClient, _ := newFakeCredentials(t, ctrl, "victim@example.com")
+	attacker := ClientInfo{IP: "198.51.100.66"}
+	lockouts := testutil.ToFloat64(metrics.SecurityEvents.WithLabelValues("ip_locked"))
+
+	// One guess per account stays below every account threshold
+	for i := 0; i < ipLockoutThreshold; i++ {
+		_, _, err := LoginUser(ctx, userClient, fmt.Sprintf("user%d@example.com", i), "guess", attacker)
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+
+	_, _, err := LoginUser(ctx, userClient, "victim@example.com", "password123", attacker)
+	assert.Equal(t, loginLockoutDuration, retryAfter(t, err))
+	assert.Equal(t, lockouts+1, testutil.ToFloat64(metrics.SecurityEvents.WithLabelValues("ip_locked")))
+
+	// Other clients are unaffected, and admins can lift the block
+	_, _, err = LoginUser(ctx, userClient, "victim@example.com", "password123", ClientInfo{IP: "203.0.113.1"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(UnlockLogin(ctx, "", "")))
+	require.NoError(t, UnlockLogin(ctx, "", attacker.IP))
+	_, _, err = LoginUser(ctx, userClient, "victim@example.com", "password123", attacker)
+	assert.NoError(t, err)
+}
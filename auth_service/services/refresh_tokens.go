@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/tird4d/go-microservices/auth_service/config"
+	"github.com/tird4d/go-microservices/auth_service/logger"
+	"github.com/tird4d/go-microservices/auth_service/metrics"
+	"github.com/tird4d/go-microservices/auth_service/revocation"
+	"github.com/tird4d/go-microservices/auth_service/utils"
+)
+
+// A login starts a family of refresh tokens; every refresh replaces the
+// family's current token with a new one. Rotated tokens are kept until they
+// expire so that presenting one again is recognised as a replay.
+const (
+	refreshTokenTTL     = 7 * 24 * time.Hour
+	refreshTokenPrefix  = "refresh_token:"
+	refreshFamilyPrefix = "refresh_family:"
+	// familyAccessPrefix keys the IDs of the access tokens issued in a family
+	familyAccessPrefix = "refresh_family_access:"
+)
+
+var (
+	errRefreshTokenInvalid = status.Error(codes.Unauthenticated, "invalid refresh token")
+	// errRefreshTokenConflict means another refresh of the same token won the race
+	errRefreshTokenConflict = status.Error(codes.Aborted, "refresh token is being rotated")
+)
+
+// ClientInfo identifies the client a refresh token is issued to. IP is only
+// recorded for the session list; it changes too often to bind tokens to.
+type ClientInfo struct {
+	UserAgent string
+	DeviceID  string
+	IP        string
+}
+
+// binding is what a refresh token is bound to: the device ID when the client
+// sends one, its user agent otherwise. Only a hash of it is stored.
+func (c ClientInfo) binding() string {
+	value := "ua:" + c.UserAgent
+	if c.DeviceID != "" {
+		value = "device:" + c.DeviceID
+	}
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// refreshTokenRecord is stored for every refresh token of a family
+type refreshTokenRecord struct {
+	Family string
+	UserID string
+	Client string
+}
+
+func refreshTokenKey(token string) string {
+	return refreshTokenPrefix + token
+}
+
+func refreshFamilyKey(family string) string {
+	return refreshFamilyPrefix + family
+}
+
+func familyAccessTokensKey(family string) string {
+	return familyAccessPrefix + family
+}
+
+// createRefreshToken starts a new token family, that is a new session, for
+// userID, bound to client. accessToken is the access token issued with it.
+func createRefreshToken(ctx context.Context, userID string, client ClientInfo, accessToken string) (string, error) {
+	token := utils.GenerateRefreshToken()
+	record := refreshTokenRecord{Family: uuid.NewString(), UserID: userID, Client: client.binding()}
+
+	return token, startRefreshFamily(ctx, token, record, client, accessToken)
+}
+
+// startRefreshFamily stores token as the first token of record's family and
+// adds the family to the user's sessions
+func startRefreshFamily(ctx context.Context, token string, record refreshTokenRecord, client ClientInfo, accessToken string) error {
+	familyKey := refreshFamilyKey(record.Family)
+	_, err := config.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		storeRefreshToken(ctx, pipe, token, record)
+		pipe.HSet(ctx, familyKey, "user_id", record.UserID, "current", token, "created_at", time.Now().Unix())
+		pipe.HSet(ctx, familyKey, sessionFields(client)...)
+		pipe.Expire(ctx, familyKey, refreshTokenTTL)
+		recordAccessToken(ctx, pipe, record.Family, accessToken)
+		pipe.SAdd(ctx, userSessionsKey(record.UserID), record.Family)
+		pipe.Expire(ctx, userSessionsKey(record.UserID), refreshTokenTTL)
+		return nil
+	})
+	return err
+}
+
+func storeRefreshToken(ctx context.Context, pipe redis.Pipeliner, token string, record refreshTokenRecord) {
+	pipe.HSet(ctx, refreshTokenKey(token), "family", record.Family, "user_id", record.UserID, "client", record.Client)
+	pipe.Expire(ctx, refreshTokenKey(token), refreshTokenTTL)
+}
+
+// loadRefreshToken returns the record of token, or errRefreshTokenInvalid
+func loadRefreshToken(ctx context.Context, token string) (*refreshTokenRecord, error) {
+	fields, err := config.RedisClient.HGetAll(ctx, refreshTokenKey(token)).Result()
+	if err != nil {
+		logger.Log.Errorw("❌ Failed to read refresh token", "error", err)
+		return nil, status.Error(codes.Internal, "failed to read refresh token")
+	}
+	if len(fields) == 0 {
+		return nil, errRefreshTokenInvalid
+	}
+	return &refreshTokenRecord{Family: fields["family"], UserID: fields["user_id"], Client: fields["client"]}, nil
+}
+
+// findRefreshToken is loadRefreshToken that also accepts tokens stored
+// before families existed, as a bare token -> user ID key. Such a token is
+// moved into a new family bound to client.
+func findRefreshToken(ctx context.Context, token string, client ClientInfo) (*refreshTokenRecord, error) {
+	record, err := loadRefreshToken(ctx, token)
+	if err != errRefreshTokenInvalid {
+		return record, err
+	}
+
+	// The token is used as a key name, so anything but a token
+	// GenerateRefreshToken could have made may name another key
+	if !isLegacyRefreshToken(token) {
+		return nil, errRefreshTokenInvalid
+	}
+
+	userID, err := config.RedisClient.GetDel(ctx, token).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, errRefreshTokenInvalid
+	}
+	if err != nil {
+		logger.Log.Errorw("❌ Failed to read refresh token", "error", err)
+		return nil, status.Error(codes.Internal, "failed to read refresh token")
+	}
+
+	record = &refreshTokenRecord{Family: uuid.NewString(), UserID: userID, Client: client.binding()}
+	if err := startRefreshFamily(ctx, token, *record, client, ""); err != nil {
+		logger.Log.Errorw("❌ Failed to store refresh token", "error", err)
+		return nil, status.Error(codes.Internal, "failed to store refresh token")
+	}
+	return record, nil
+}
+
+// isLegacyRefreshToken reports whether token has the form of the refresh
+// tokens stored before families existed: a UUID in its canonical form
+func isLegacyRefreshToken(token string) bool {
+	parsed, err := uuid.Parse(token)
+	return err == nil && parsed.String() == token
+}
+
+// rotateRefreshToken replaces token, which must be its family's current
+// token, with a new one issued together with accessToken. A rotated token or
+// one from another client revokes the whole family: either it was stolen or
+// the thief already used it.
+func rotateRefreshToken(ctx context.Context, token string, record *refreshTokenRecord, client ClientInfo, accessToken string) (string, error) {
+	familyKey := refreshFamilyKey(record.Family)
+	var newToken string
+	var breach string
+
+	err := config.RedisClient.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.HGet(ctx, familyKey, "current").Result()
+		if errors.Is(err, redis.Nil) {
+			// The family was revoked or has expired
+			return errRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case current != token:
+			breach = "refresh_token_reuse"
+			return errRefreshTokenInvalid
+		case record.Client != client.binding():
+			breach = "refresh_token_client_mismatch"
+			return errRefreshTokenInvalid
+		}
+
+		newToken = utils.GenerateRefreshToken()
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			storeRefreshToken(ctx, pipe, newToken, *record)
+			pipe.HSet(ctx, familyKey, "current", newToken)
+			pipe.HSet(ctx, familyKey, sessionFields(client)...)
+			pipe.Expire(ctx, familyKey, refreshTokenTTL)
+			recordAccessToken(ctx, pipe, record.Family, accessToken)
+			pipe.Expire(ctx, userSessionsKey(record.UserID), refreshTokenTTL)
+			return nil
+		})
+		return err
+	}, familyKey)
+
+	if breach != "" {
+		securityEvent(breach, "user_id", record.UserID, "family", record.Family)
+		if err := revokeRefreshFamily(ctx, record.Family); err != nil {
+			logger.Log.Errorw("❌ Failed to revoke refresh token family", "family", record.Family, "error", err)
+		}
+		return "", errRefreshTokenInvalid
+	}
+
+	switch {
+	case errors.Is(err, redis.TxFailedErr):
+		// A concurrent refresh got there first; retrying would look like a replay
+		return "", errRefreshTokenConflict
+	case err == errRefreshTokenInvalid:
+		return "", err
+	case err != nil:
+		logger.Log.Errorw("❌ Failed to rotate refresh token", "error", err)
+		return "", status.Error(codes.Internal, "failed to store refresh token")
+	}
+	return newToken, nil
+}
+
+// revokeRefreshFamily ends a login: none of the family's tokens work anymore
+// and every access token issued with them that has not expired is revoked
+func revokeRefreshFamily(ctx context.Context, family string) error {
+	familyKey := refreshFamilyKey(family)
+	accessKey := familyAccessTokensKey(family)
+	fields, err := config.RedisClient.HMGet(ctx, familyKey, "current", "user_id").Result()
+	if err != nil {
+		return err
+	}
+	current, _ := fields[0].(string)
+	userID, _ := fields[1].(string)
+
+	accessTokens, err := config.RedisClient.ZRangeByScoreWithScores(ctx, accessKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = config.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, token := range accessTokens {
+			jti, _ := token.Member.(string)
+			if err := revocation.Revoke(ctx, pipe, jti, time.Unix(int64(token.Score), 0)); err != nil {
+				return err
+			}
+		}
+		keys := []string{familyKey, accessKey}
+		if current != "" {
+			keys = append(keys, refreshTokenKey(current))
+		}
+		pipe.Del(ctx, keys...)
+		if userID != "" {
+			pipe.SRem(ctx, userSessionsKey(userID), family)
+		}
+		return nil
+	})
+	return err
+}
+
+// securityEvent logs and counts an event worth alerting on
+func securityEvent(event string, keysAndValues ...interface{}) {
+	metrics.SecurityEvents.WithLabelValues(event).Inc()
+	logger.Log.Warnw("🚨 Security event", append([]interface{}{"event", event}, keysAndValues...)...)
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/tird4d/go-microservices/auth_service/config"
+	"github.com/tird4d/go-microservices/auth_service/logger"
+	"github.com/tird4d/go-microservices/auth_service/utils"
+)
+
+// A session is a refresh token family. Its metadata is kept in the family
+// hash and every user has a set of their family IDs. Families expire on their
+// own, so the set may name some that are gone; they are dropped when listed.
+const userSessionsPrefix = "user_sessions:"
+
+// Session is a login of a user and the client it was made from
+type Session struct {
+	ID        string
+	CreatedAt time.Time
+	LastUsed  time.Time
+	IP        string
+	UserAgent string
+}
+
+func userSessionsKey(userID string) string {
+	return userSessionsPrefix + userID
+}
+
+// sessionFields are the family hash fields updated whenever tokens are
+// issued: who used the session last
+func sessionFields(client ClientInfo) []interface{} {
+	return []interface{}{
+		"last_used", time.Now().Unix(),
+		"ip", client.IP,
+		"user_agent", client.UserAgent,
+	}
+}
+
+// recordAccessToken adds accessToken to the access tokens issued in family,
+// so revoking the session can revoke every one of them that is still valid.
+// They are kept in a sorted set scored by expiry, which drops the expired
+// ones as new ones come in.
+func recordAccessToken(ctx context.Context, pipe redis.Pipeliner, family, accessToken string) {
+	claims, err := utils.ValidateJWT(accessToken)
+	if err != nil {
+		return
+	}
+	jti, _ := claims["jti"].(string)
+	expiresAt, err := claims.GetExpirationTime()
+	if jti == "" || err != nil || expiresAt == nil {
+		return
+	}
+
+	key := familyAccessTokensKey(family)
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(expiresAt.Unix()), Member: jti})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+	pipe.Expire(ctx, key, refreshTokenTTL)
+}
+
+// ListSessions returns the active sessions of userID, most recently used first
+func ListSessions(ctx context.Context, userID string) ([]Session, error) {
+	families, err := config.RedisClient.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		logger.Log.Errorw("❌ Failed to list sessions", "user_id", userID, "error", err)
+		return nil, status.Error(codes.Internal, "failed to list sessions")
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(families))
+	_, err = config.RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, family := range families {
+			cmds[i] = pipe.HGetAll(ctx, refreshFamilyKey(family))
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Errorw("❌ Failed to list sessions", "user_id", userID, "error", err)
+		return nil, status.Error(codes.Internal, "failed to list sessions")
+	}
+
+	sessions := make([]Session, 0, len(families))
+	var expired []interface{}
+	for i, family := range families {
+		fields := cmds[i].Val()
+		if len(fields) == 0 || fields["user_id"] != userID {
+			expired = append(expired, family)
+			continue
+		}
+		sessions = append(sessions, Session{
+			ID:        family,
+			CreatedAt: unixField(fields["created_at"]),
+			LastUsed:  unixField(fields["last_used"]),
+			IP:        fields["ip"],
+			UserAgent: fields["user_agent"],
+		})
+	}
+
+	if len(expired) > 0 {
+		if err := config.RedisClient.SRem(ctx, userSessionsKey(userID), expired...).Err(); err != nil {
+			logger.Log.Warnw("⚠️ Failed to drop expired sessions", "user_id", userID, "error", err)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsed.After(sessions[j].LastUsed)
+	})
+	return sessions, nil
+}
+
+// RevokeSession ends the session sessionID of userID. Sessions of other users
+// are reported as not found.
+func RevokeSession(ctx context.Context, userID, sessionID string) error {
+	owner, err := config.RedisClient.HGet(ctx, refreshFamilyKey(sessionID), "user_id").Result()
+	if errors.Is(err, redis.Nil) || (err == nil && owner != userID) {
+		return status.Error(codes.NotFound, "session not found")
+	}
+	if err != nil {
+		logger.Log.Errorw("❌ Failed to read session", "session_id", sessionID, "error", err)
+		return status.Error(codes.Internal, "failed to revoke session")
+	}
+
+	if err := revokeRefreshFamily(ctx, sessionID); err != nil {
+		logger.Log.Errorw("❌ Failed to revoke session", "session_id", sessionID, "error", err)
+		return status.Error(codes.Internal, "failed to revoke session")
+	}
+
+	logger.Log.Infow("✅ Session revoked", "user_id", userID, "session_id", sessionID)
+	return nil
+}
+
+// RevokeAllSessions logs userID out everywhere and returns how many sessions
+// were ended
+func RevokeAllSessions(ctx context.Context, userID string) (int, error) {
+	sessions, err := ListSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, session := range sessions {
+		if err := revokeRefreshFamily(ctx, session.ID); err != nil {
+			logger.Log.Errorw("❌ Failed to revoke session", "session_id", session.ID, "error", err)
+			return 0, status.Error(codes.Internal, "failed to revoke sessions")
+		}
+	}
+
+	logger.Log.Infow("✅ All sessions revoked", "user_id", userID, "count", len(sessions))
+	return len(sessions), nil
+}
+
+func unixField(value string) time.Time {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/auth_service/config"
+	"github.com/tird4d/go-microservices/auth_service/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// login starts a session the way LoginUser does and returns its tokens
+func login(t *testing.T, userID primitive.ObjectID, client ClientInfo) (string, string) {
+	t.Helper()
+	accessToken, err := utils.GenerateJWT(userID, "test@example.com", "user")
+	require.NoError(t, err)
+	refreshToken, err := createRefreshToken(context.Background(), userID.Hex(), client, accessToken)
+	require.NoError(t, err)
+	return accessToken, refreshToken
+}
+
+func TestSessions_ListAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+
+	laptop := ClientInfo{UserAgent: "Firefox/128.0", IP: "203.0.113.7"}
+	phone := ClientInfo{UserAgent: "app/1.0", DeviceID: "phone-1", IP: "198.51.100.2"}
+	laptopAccess, laptopRefresh := login(t, userID, laptop)
+	phoneAccess, _ := login(t, userID, phone)
+
+	sessions, err := ListSessions(ctx, userID.Hex())
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	for _, session := range sessions {
+		assert.NotEmpty(t, session.ID)
+		assert.WithinDuration(t, time.Now(), session.CreatedAt, time.Minute)
+		assert.WithinDuration(t, time.Now(), session.LastUsed, time.Minute)
+	}
+	assert.ElementsMatch(t, []string{"203.0.113.7", "198.51.100.2"}, []string{sessions[0].IP, sessions[1].IP})
+
+	laptopSession := mustLoad(t, laptopRefresh).Family
+
+	// Another user can't end the session
+	err = RevokeSession(ctx, primitive.NewObjectID().Hex(), laptopSession)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	require.NoError(t, RevokeSession(ctx, userID.Hex(), laptopSession))
+
+	sessions, err = ListSessions(ctx, userID.Hex())
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "app/1.0", sessions[0].UserAgent)
+
+	// Both tokens of the revoked session stop working; the other session is untouched
+	_, err = ValidateAccessToken(ctx, laptopAccess)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = loadRefreshToken(ctx, laptopRefresh)
+	assert.Equal(t, errRefreshTokenInvalid, err)
+	_, err = ValidateAccessToken(ctx, phoneAccess)
+	assert.NoError(t, err)
+
+	err = RevokeSession(ctx, userID.Hex(), laptopSession)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	revoked, err := RevokeAllSessions(ctx, userID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, 1, revoked)
+
+	sessions, err = ListSessions(ctx, userID.Hex())
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+	_, err = ValidateAccessToken(ctx, phoneAccess)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestListSessions_DropsExpiredSessions(t *testing.T) {
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+
+	_, refreshToken := login(t, userID, testClient)
+	login(t, userID, testClient)
+
+	// The family expired before the user's session set did
+	family := mustLoad(t, refreshToken).Family
+	require.NoError(t, config.RedisClient.Del(ctx, refreshFamilyKey(family)).Err())
+
+	sessions, err := ListSessions(ctx, userID.Hex())
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+
+	isMember, err := config.RedisClient.SIsMember(ctx, userSessionsKey(userID.Hex()), family).Result()
+	require.NoError(t, err)
+	assert.False(t, isMember)
+}
+
+func TestValidateRefreshToken_UpdatesSession(t *testing.T) {
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+
+	_, refreshToken := login(t, userID, ClientInfo{UserAgent: "app/1.0", DeviceID: "d1", IP: "203.0.113.7"})
+	family := mustLoad(t, refreshToken).Family
+	require.NoError(t, config.RedisClient.HSet(ctx, refreshFamilyKey(family), "last_used", 0).Err())
+
+	accessToken, err := utils.GenerateJWT(userID, "test@example.com", "user")
+	require.NoError(t, err)
+	_, err = rotateRefreshToken(ctx, refreshToken, mustLoad(t, refreshToken), ClientInfo{UserAgent: "app/1.1", DeviceID: "d1", IP: "198.51.100.2"}, accessToken)
+	require.NoError(t, err)
+
+	sessions, err := ListSessions(ctx, userID.Hex())
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, family, sessions[0].ID)
+	assert.Equal(t, "198.51.100.2", sessions[0].IP)
+	assert.Equal(t, "app/1.1", sessions[0].UserAgent)
+	assert.WithinDuration(t, time.Now(), sessions[0].LastUsed, time.Minute)
+
+	// Revoking the session revokes the access token issued by the refresh
+	require.NoError(t, RevokeSession(ctx, userID.Hex(), family))
+	_, err = ValidateAccessToken(ctx, accessToken)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestRevokeSession_RevokesEveryAccessToken(t *testing.T) {
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+
+	firstAccess, refreshToken := login(t, userID, testClient)
+	family := mustLoad(t, refreshToken).Family
+
+	// Each refresh issues another access token that is valid until it expires
+	accessTokens := []string{firstAccess}
+	for i := 0; i < 2; i++ {
+		accessToken, err := utils.GenerateJWT(userID, "test@example.com", "user")
+		require.NoError(t, err)
+		refreshToken, err = rotateRefreshToken(ctx, refreshToken, mustLoad(t, refreshToken), testClient, accessToken)
+		require.NoError(t, err)
+		accessTokens = append(accessTokens, accessToken)
+	}
+	for _, accessToken := range accessTokens {
+		_, err := ValidateAccessToken(ctx, accessToken)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, RevokeSession(ctx, userID.Hex(), family))
+
+	for i, accessToken := range accessTokens {
+		_, err := ValidateAccessToken(ctx, accessToken)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "access token %d", i)
+	}
+	exists, err := config.RedisClient.Exists(ctx, familyAccessTokensKey(family)).Result()
+	require.NoError(t, err)
+	assert.Zero(t, exists)
+}
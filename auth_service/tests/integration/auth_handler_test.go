@@ -9,12 +9,16 @@ import (
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/tird4d/go-microservices/auth_service/config"
 	"github.com/tird4d/go-microservices/auth_service/handlers"
+	"github.com/tird4d/go-microservices/auth_service/jwks"
 	"github.com/tird4d/go-microservices/auth_service/logger"
 	"github.com/tird4d/go-microservices/auth_service/mocks"
 	authpb "github.com/tird4d/go-microservices/auth_service/proto"
@@ -27,6 +31,8 @@ import (
 	"google.golang.org/grpc/test/bufconn"
 )
 
+var testClient = &authpb.ClientInfo{UserAgent: "test-agent/1.0"}
+
 func TestMain(m *testing.M) {
 	err := godotenv.Load("../../.env")
 	logger.InitLogger(true)
@@ -35,10 +41,11 @@ func TestMain(m *testing.M) {
 		logger.Log.Info("Error loading .env file")
 	}
 
-	// Ensure JWT_SECRET is set for tests (fallback when .env is absent, e.g. in CI)
-	if os.Getenv("JWT_SECRET") == "" {
-		os.Setenv("JWT_SECRET", "test-secret-key-for-ci")
+	keySet, err := utils.GenerateKeySet()
+	if err != nil {
+		log.Fatalf("❌ Failed to generate signing keys: %v", err)
 	}
+	utils.SetKeySet(keySet)
 
 	//Create a redis client with in-memory database
 	s, err := miniredis.Run()
@@ -159,9 +166,10 @@ func TestAuthServer_Login_Unsuccess(t *testing.T) {
 	})
 
 	// بررسی نتیجه
-	assert.Empty(t, resp.Token)
-	assert.Empty(t, resp.RefreshToken)
-	assert.Contains(t, resp.Message, "invalid password")
+	assert.Nil(t, resp)
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.Unauthenticated, st.Code())
+	assert.Equal(t, "invalid email or password", st.Message())
 }
 
 func TestAuthServer_ValidateRefreshToken_Success(t *testing.T) {
@@ -181,13 +189,15 @@ func TestAuthServer_ValidateRefreshToken_Success(t *testing.T) {
 			Id:    userID,
 			Name:  name,
 			Email: email,
-		}, nil)
+		}, nil).
+		Times(2)
 
 	startTestGRPCServer(t, mockUserClient)
 
 	ctx := context.Background()
 
-	refreshToken := "valid_refresh_token"
+	// A token stored before refresh token families is still accepted
+	refreshToken := uuid.NewString()
 
 	// Set the refresh token in Redis
 	config.RedisClient.Set(ctx, refreshToken, userID, time.Minute)
@@ -201,7 +211,8 @@ func TestAuthServer_ValidateRefreshToken_Success(t *testing.T) {
 
 	// ارسال درخواست
 	resp, err := client.ValidateRefreshToken(ctx, &authpb.ValidateRefreshTokenRequest{
-		RefreshToken: "valid_refresh_token",
+		RefreshToken: refreshToken,
+		Client:       testClient,
 	})
 
 	// بررسی نتیجه
@@ -210,15 +221,72 @@ func TestAuthServer_ValidateRefreshToken_Success(t *testing.T) {
 	assert.NotEmpty(t, resp.RefreshToken)
 	assert.NotEqual(t, resp.RefreshToken, refreshToken)
 
-	// Check if the new refresh token is stored in Redis
-	redisUserID, err := config.RedisClient.Get(ctx, resp.RefreshToken).Result()
-	assert.Equal(t, userID, redisUserID)
-
 	// Check if the old refresh token is deleted from Redis
 	_, err = config.RedisClient.Get(ctx, refreshToken).Result()
-
 	assert.Error(t, err)
 	assert.Equal(t, redis.Nil, err)
+
+	// The new refresh token works in turn
+	resp, err = client.ValidateRefreshToken(ctx, &authpb.ValidateRefreshTokenRequest{
+		RefreshToken: resp.RefreshToken,
+		Client:       testClient,
+	})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, resp.RefreshToken)
+}
+
+func TestAuthServer_ValidateRefreshToken_ReuseRevokesFamily(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserClient := mocks.NewMockUserServiceClient(ctrl)
+
+	email := "test@example.com"
+	password := "password123"
+	hashedPassword, _ := utils.HashPassword(password)
+	userID := primitive.NewObjectID().Hex()
+
+	mockUserClient.EXPECT().
+		GetUserCredential(gomock.Any(), &userpb.GetUserCredentialRequest{Email: email}).
+		Return(&userpb.UserCredentialResponse{Id: userID, Email: email, Password: hashedPassword}, nil).
+		Times(2)
+	mockUserClient.EXPECT().
+		GetUser(gomock.Any(), &userpb.GetUserRequest{Id: userID}).
+		Return(&userpb.UserResponse{Id: userID, Email: email}, nil).
+		AnyTimes()
+
+	startTestGRPCServer(t, mockUserClient)
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(dialer()), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := authpb.NewAuthServiceClient(conn)
+
+	login, err := client.Login(ctx, &authpb.LoginRequest{Email: email, Password: password, Client: testClient})
+	require.NoError(t, err)
+	require.NotEmpty(t, login.RefreshToken)
+
+	refresh := func(token string, info *authpb.ClientInfo) (*authpb.ValidateRefreshTokenResponse, error) {
+		return client.ValidateRefreshToken(ctx, &authpb.ValidateRefreshTokenRequest{RefreshToken: token, Client: info})
+	}
+
+	// Another client can't use the token
+	_, err = refresh(login.RefreshToken, &authpb.ClientInfo{UserAgent: "curl/8.0"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	login, err = client.Login(ctx, &authpb.LoginRequest{Email: email, Password: password, Client: testClient})
+	require.NoError(t, err)
+
+	rotated, err := refresh(login.RefreshToken, testClient)
+	require.NoError(t, err)
+
+	// Replaying the first token ends the login, including the rotated token
+	_, err = refresh(login.RefreshToken, testClient)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = refresh(rotated.RefreshToken, testClient)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
 }
 
 func TestAuthServer_ValidateRefreshToken_TokenNotInRedis(t *testing.T) {
@@ -255,7 +323,7 @@ func TestAuthServer_ValidateRefreshToken_TokenNotInRedis(t *testing.T) {
 func TestAuthServer_Logout_Success(t *testing.T) {
 
 	// داده‌های تست
-	refreshToken := "valid_refresh_token"
+	refreshToken := uuid.NewString()
 	ctx := context.Background()
 
 	// Set the refresh token in Redis
@@ -306,3 +374,129 @@ func TestAuthServer_Logout_TokenNotInRedis(t *testing.T) {
 	assert.Equal(t, codes.Unauthenticated, st.Code())
 	assert.Contains(t, st.Message(), "Invalid or expired refresh token")
 }
+
+func TestAuthServer_GetJWKS_VerifiesIssuedTokens(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserClient := mocks.NewMockUserServiceClient(ctrl)
+
+	email := "test@example.com"
+	password := "password123"
+	hashedPassword, _ := utils.HashPassword(password)
+	userID := primitive.NewObjectID().Hex()
+
+	mockUserClient.EXPECT().
+		GetUserCredential(gomock.Any(), &userpb.GetUserCredentialRequest{Email: email}).
+		Return(&userpb.UserCredentialResponse{
+			Id:       userID,
+			Email:    email,
+			Password: hashedPassword,
+		}, nil)
+
+	startTestGRPCServer(t, mockUserClient)
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(dialer()), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	client := authpb.NewAuthServiceClient(conn)
+
+	login, err := client.Login(ctx, &authpb.LoginRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	res, err := client.GetJWKS(ctx, &authpb.GetJWKSRequest{})
+	require.NoError(t, err)
+	set := jwks.FromProto(res)
+	require.NotEmpty(t, set.Keys)
+	published := set.Keys[0]
+	assert.Equal(t, utils.CurrentKeySet().Active().ID, published.ID)
+
+	// A service holding only the published key can check the token
+	publicKey, err := published.PublicKey()
+	require.NoError(t, err)
+
+	token, err := jwt.Parse(login.Token, func(t *jwt.Token) (interface{}, error) {
+		return publicKey, nil
+	}, jwt.WithValidMethods([]string{published.Algorithm}))
+	require.NoError(t, err)
+	assert.Equal(t, published.ID, token.Header["kid"])
+	assert.Equal(t, userID, token.Claims.(jwt.MapClaims)["user_id"])
+}
+
+func TestAuthServer_Logout_RevokesAccessToken(t *testing.T) {
+	ctx := context.Background()
+	refreshToken := uuid.NewString()
+	config.RedisClient.Set(ctx, refreshToken, "user_id", time.Minute)
+
+	accessToken, err := utils.GenerateJWT(primitive.NewObjectID(), "test@example.com", "user")
+	require.NoError(t, err)
+
+	startTestGRPCServer(t, nil)
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(dialer()), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := authpb.NewAuthServiceClient(conn)
+
+	_, err = client.Validate(ctx, &authpb.ValidateRequest{Token: accessToken})
+	require.NoError(t, err)
+
+	_, err = client.Logout(ctx, &authpb.LogoutRequest{RefreshToken: refreshToken, AccessToken: accessToken})
+	require.NoError(t, err)
+
+	_, err = client.Validate(ctx, &authpb.ValidateRequest{Token: accessToken})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAuthServer_Sessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserClient := mocks.NewMockUserServiceClient(ctrl)
+
+	email := "test@example.com"
+	password := "password123"
+	hashedPassword, _ := utils.HashPassword(password)
+	userID := primitive.NewObjectID().Hex()
+
+	mockUserClient.EXPECT().
+		GetUserCredential(gomock.Any(), &userpb.GetUserCredentialRequest{Email: email}).
+		Return(&userpb.UserCredentialResponse{Id: userID, Email: email, Password: hashedPassword}, nil)
+
+	startTestGRPCServer(t, mockUserClient)
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(dialer()), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := authpb.NewAuthServiceClient(conn)
+
+	login, err := client.Login(ctx, &authpb.LoginRequest{
+		Email:    email,
+		Password: password,
+		Client:   &authpb.ClientInfo{UserAgent: "Firefox/128.0", Ip: "203.0.113.7"},
+	})
+	require.NoError(t, err)
+
+	list, err := client.ListSessions(ctx, &authpb.ListSessionsRequest{UserId: userID})
+	require.NoError(t, err)
+	require.Len(t, list.Sessions, 1)
+	assert.Equal(t, "Firefox/128.0", list.Sessions[0].UserAgent)
+	assert.Equal(t, "203.0.113.7", list.Sessions[0].Ip)
+
+	_, err = client.RevokeSession(ctx, &authpb.RevokeSessionRequest{UserId: userID})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	res, err := client.RevokeAllSessions(ctx, &authpb.RevokeAllSessionsRequest{UserId: userID})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), res.Revoked)
+
+	// Logged out everywhere: neither token of the login works anymore
+	_, err = client.Validate(ctx, &authpb.ValidateRequest{Token: login.Token})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.ValidateRefreshToken(ctx, &authpb.ValidateRefreshTokenRequest{RefreshToken: login.RefreshToken, Client: testClient})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -3,7 +3,6 @@ package utils
 import (
 	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,14 +10,12 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// GenerateJWT signs an access token with the active key of the key set
 func GenerateJWT(userId primitive.ObjectID, email string, role string) (string, error) {
-	_ = userId
-
-	secret := os.Getenv("JWT_SECRET")
-
-	if secret == "" {
-		return "", errors.New("JWT_SECRET is not set")
+	if signingKeys == nil {
+		return "", errors.New("signing keys are not loaded")
 	}
+	key := signingKeys.Active()
 
 	claims := jwt.MapClaims{
 		"user_id": userId.Hex(),
@@ -26,30 +23,33 @@ func GenerateJWT(userId primitive.ObjectID, email string, role string) (string,
 		"role":    role,
 		"auth_at": time.Now().Unix(),
 		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		// jti lets a token be revoked before it expires
+		"jti": uuid.NewString(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secret))
-
-	fmt.Println(token)
-	return tokenString, err
-
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
 }
 
+// ValidateJWT checks a token against the key named by its kid header, which
+// may be a previous key of the set
 func ValidateJWT(tokenString string) (jwt.MapClaims, error) {
-
-	secret := os.Getenv("JWT_SECRET")
-
-	if secret == "" {
-		return nil, errors.New("JWT_SECRET is not set")
+	if signingKeys == nil {
+		return nil, errors.New("signing keys are not loaded")
 	}
 
 	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		id, _ := t.Header["kid"].(string)
+		key, ok := signingKeys.Key(id)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", id)
+		}
+		if t.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
-		return []byte(secret), nil
-	})
+		return key.Private.Public(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
 
 	if err != nil {
 		return nil, err
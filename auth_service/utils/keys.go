@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tird4d/go-microservices/auth_service/jwks"
+)
+
+// minRSABits is the smallest RSA key accepted for signing
+const minRSABits = 2048
+
+// SigningKey is a private key that signs access tokens. Its ID goes into the
+// kid header so verifiers can pick the matching public key.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+}
+
+// KeySet holds the active signing key and the previous keys, which only
+// verify tokens signed before a rotation. A retired key can be dropped once
+// the tokens it signed have expired.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+var signingKeys *KeySet
+
+// SetKeySet makes ks the key set used by GenerateJWT and ValidateJWT
+func SetKeySet(ks *KeySet) {
+	signingKeys = ks
+}
+
+// CurrentKeySet returns the key set in use, nil before SetKeySet
+func CurrentKeySet() *KeySet {
+	return signingKeys
+}
+
+// NewKeySet builds a key set signing with the key named activeID
+func NewKeySet(activeID string, keys ...*SigningKey) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*SigningKey, len(keys))}
+	for _, key := range keys {
+		if _, ok := ks.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate signing key %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+
+	active, ok := ks.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q not found", activeID)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+// LoadKeySet reads PEM private keys (PKCS#8, or PKCS#1 for RSA) from dir;
+// each file's name without extension is its key ID. With a single key,
+// activeID may be empty.
+func LoadKeySet(dir, activeID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no signing keys in %s", dir)
+	}
+	sort.Strings(files)
+
+	keys := make([]*SigningKey, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(filepath.Base(file), ".pem")
+		key, err := ParseSigningKey(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if activeID == "" {
+		if len(keys) > 1 {
+			return nil, errors.New("several signing keys found, set the active key ID")
+		}
+		activeID = keys[0].ID
+	}
+	return NewKeySet(activeID, keys...)
+}
+
+// GenerateKeySet creates a key set with a fresh Ed25519 key. Tokens signed
+// with it stop verifying after a restart and on other replicas, so it is only
+// meant for development and tests.
+func GenerateKeySet() (*KeySet, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: "dev-" + hex.EncodeToString(id), Method: jwt.SigningMethodEdDSA, Private: private}
+	return NewKeySet(key.ID, key)
+}
+
+// ParseSigningKey decodes a PEM private key. RSA keys sign with RS256 and
+// Ed25519 keys with EdDSA.
+func ParseSigningKey(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key must have at least %d bits", minRSABits)
+		}
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, Private: private}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, Private: private}, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", jwks.ErrUnsupportedKey, parsed)
+	}
+}
+
+// Active returns the key new tokens are signed with
+func (ks *KeySet) Active() *SigningKey {
+	return ks.active
+}
+
+// Key looks a key up by the kid of a token
+func (ks *KeySet) Key(id string) (*SigningKey, bool) {
+	key, ok := ks.keys[id]
+	return key, ok
+}
+
+// JWKS returns the public keys of the set, the active one first
+func (ks *KeySet) JWKS() (jwks.Set, error) {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		if id != ks.active.ID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	ids = append([]string{ks.active.ID}, ids...)
+
+	set := jwks.Set{Keys: make([]jwks.Key, len(ids))}
+	for i, id := range ids {
+		key, err := jwks.NewKey(id, ks.keys[id].Private.Public())
+		if err != nil {
+			return jwks.Set{}, err
+		}
+		set.Keys[i] = key
+	}
+	return set, nil
+}
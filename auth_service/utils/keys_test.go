@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func rsaPEM(t *testing.T, bits int) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func ed25519PEM(t *testing.T) []byte {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func useKeySet(t *testing.T, ks *KeySet) {
+	t.Helper()
+	previous := CurrentKeySet()
+	SetKeySet(ks)
+	t.Cleanup(func() { SetKeySet(previous) })
+}
+
+func TestGenerateJWT_SignsWithActiveKey(t *testing.T) {
+	for name, data := range map[string][]byte{"RS256": rsaPEM(t, 2048), "EdDSA": ed25519PEM(t)} {
+		t.Run(name, func(t *testing.T) {
+			key, err := ParseSigningKey("2024-01", data)
+			require.NoError(t, err)
+			ks, err := NewKeySet("2024-01", key)
+			require.NoError(t, err)
+			useKeySet(t, ks)
+
+			userID := primitive.NewObjectID()
+			token, err := GenerateJWT(userID, "test@example.com", "user")
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, name, parsed.Header["alg"])
+			assert.Equal(t, "2024-01", parsed.Header["kid"])
+
+			claims, err := ValidateJWT(token)
+			require.NoError(t, err)
+			assert.Equal(t, userID.Hex(), claims["user_id"])
+		})
+	}
+}
+
+func TestValidateJWT_AfterRotation(t *testing.T) {
+	oldKey, err := ParseSigningKey("old", ed25519PEM(t))
+	require.NoError(t, err)
+	newKey, err := ParseSigningKey("new", ed25519PEM(t))
+	require.NoError(t, err)
+
+	before, err := NewKeySet("old", oldKey)
+	require.NoError(t, err)
+	useKeySet(t, before)
+	token, err := GenerateJWT(primitive.NewObjectID(), "test@example.com", "user")
+	require.NoError(t, err)
+
+	// The old key is kept for verification only
+	after, err := NewKeySet("new", oldKey, newKey)
+	require.NoError(t, err)
+	SetKeySet(after)
+	_, err = ValidateJWT(token)
+	assert.NoError(t, err)
+
+	// Once it is dropped, its tokens no longer verify
+	retired, err := NewKeySet("new", newKey)
+	require.NoError(t, err)
+	SetKeySet(retired)
+	_, err = ValidateJWT(token)
+	assert.Error(t, err)
+}
+
+func TestValidateJWT_RejectsForeignTokens(t *testing.T) {
+	ks, err := GenerateKeySet()
+	require.NoError(t, err)
+	useKeySet(t, ks)
+	claims := jwt.MapClaims{"user_id": "u1", "exp": time.Now().Add(time.Hour).Unix()}
+
+	// An HMAC token naming a real key must not be checked with its public half
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hmac.Header["kid"] = ks.Active().ID
+	forged, err := hmac.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = ValidateJWT(forged)
+	assert.Error(t, err)
+
+	// A key the set doesn't know
+	other, err := GenerateKeySet()
+	require.NoError(t, err)
+	unknown := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	unknown.Header["kid"] = other.Active().ID
+	signed, err := unknown.SignedString(other.Active().Private)
+	require.NoError(t, err)
+	_, err = ValidateJWT(signed)
+	assert.Error(t, err)
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-01.pem"), rsaPEM(t, 2048), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-06.pem"), ed25519PEM(t), 0o600))
+
+	_, err := LoadKeySet(dir, "")
+	assert.Error(t, err, "the active key has to be named when there are several")
+
+	ks, err := LoadKeySet(dir, "2024-06")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06", ks.Active().ID)
+	_, ok := ks.Key("2024-01")
+	assert.True(t, ok)
+
+	set, err := ks.JWKS()
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 2)
+	assert.Equal(t, "2024-06", set.Keys[0].ID, "the active key comes first")
+	assert.Equal(t, "EdDSA", set.Keys[0].Algorithm)
+	assert.Equal(t, "RS256", set.Keys[1].Algorithm)
+
+	_, err = LoadKeySet(dir, "2023-12")
+	assert.Error(t, err)
+	_, err = LoadKeySet(t.TempDir(), "")
+	assert.Error(t, err)
+}
+
+func TestParseSigningKey_Rejects(t *testing.T) {
+	_, err := ParseSigningKey("k", []byte("not a key"))
+	assert.Error(t, err)
+
+	_, err = ParseSigningKey("k", rsaPEM(t, 1024))
+	assert.Error(t, err, "short RSA keys")
+
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{0}})
+	_, err = ParseSigningKey("k", public)
+	assert.Error(t, err)
+}
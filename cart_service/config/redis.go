@@ -0,0 +1,65 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/tird4d/go-microservices/cart_service/logger"
+)
+
+// DefaultCartTTL is how long a cart survives without any activity
+const DefaultCartTTL = 7 * 24 * time.Hour
+
+var RedisClient *redis.Client
+
+func ConnectRedis() *redis.Client {
+	addr := os.Getenv("REDIS_ADDR")
+
+	// Optional: enable TLS via env (recommended for ElastiCache Serverless)
+	useTLS, _ := strconv.ParseBool(os.Getenv("REDIS_TLS"))
+
+	opts := &redis.Options{
+		Addr:     addr,
+		DB:       0,
+		Username: os.Getenv("REDIS_USERNAME"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+	}
+
+	if useTLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	RedisClient = redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := RedisClient.Ping(ctx).Err(); err != nil {
+		log.Fatalf("❌ Failed to connect to Redis (addr=%s tls=%v): %v", addr, useTLS, err)
+	}
+
+	logger.Log.Infow("✅ Redis client connected", "addr", addr)
+
+	return RedisClient
+}
+
+// CartTTL reads CART_TTL (a Go duration such as "72h"), falling back to DefaultCartTTL
+func CartTTL() time.Duration {
+	raw := os.Getenv("CART_TTL")
+	if raw == "" {
+		return DefaultCartTTL
+	}
+
+	ttl, err := time.ParseDuration(raw)
+	if err != nil || ttl <= 0 {
+		logger.Log.Warnw("⚠️ Invalid CART_TTL, using default", "value", raw, "default", DefaultCartTTL)
+		return DefaultCartTTL
+	}
+
+	return ttl
+}
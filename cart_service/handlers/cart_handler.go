@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/tird4d/go-microservices/cart_service/logger"
+	cartpb "github.com/tird4d/go-microservices/cart_service/proto"
+	"github.com/tird4d/go-microservices/cart_service/repositories"
+	"github.com/tird4d/go-microservices/cart_service/services"
+	"github.com/tird4d/go-microservices/product_service/money"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Server struct {
+	cartpb.UnimplementedCartServiceServer
+	Repo          repositories.CartRepository
+	ProductClient productpb.ProductServiceClient
+}
+
+// AddItem adds a product to the cart
+func (s *Server) AddItem(ctx context.Context, req *cartpb.AddItemRequest) (*cartpb.Cart, error) {
+	logger.Log.Infow("Adding item to cart",
+		"user_id", req.GetUserId(),
+		"anonymous_id", req.GetAnonymousId(),
+		"product_id", req.GetProductId(),
+		"sku", req.GetSku(),
+		"quantity", req.GetQuantity(),
+	)
+
+	owner := services.CartOwner{UserID: req.GetUserId(), AnonymousID: req.GetAnonymousId()}
+
+	cart, err := services.AddItem(ctx, s.Repo, s.ProductClient, owner, req.GetProductId(), req.GetSku(), req.GetQuantity())
+	if err != nil {
+		logger.Log.Errorw("Failed to add item to cart", "error", err)
+		return nil, err
+	}
+
+	return toCartResponse(cart), nil
+}
+
+// UpdateQuantity changes the quantity of a product already in the cart
+func (s *Server) UpdateQuantity(ctx context.Context, req *cartpb.UpdateQuantityRequest) (*cartpb.Cart, error) {
+	logger.Log.Infow("Updating cart item quantity",
+		"user_id", req.GetUserId(),
+		"anonymous_id", req.GetAnonymousId(),
+		"product_id", req.GetProductId(),
+		"sku", req.GetSku(),
+		"quantity", req.GetQuantity(),
+	)
+
+	owner := services.CartOwner{UserID: req.GetUserId(), AnonymousID: req.GetAnonymousId()}
+
+	cart, err := services.UpdateQuantity(ctx, s.Repo, s.ProductClient, owner, req.GetProductId(), req.GetSku(), req.GetQuantity())
+	if err != nil {
+		logger.Log.Errorw("Failed to update cart item", "error", err)
+		return nil, err
+	}
+
+	return toCartResponse(cart), nil
+}
+
+// RemoveItem removes a product from the cart
+func (s *Server) RemoveItem(ctx context.Context, req *cartpb.RemoveItemRequest) (*cartpb.Cart, error) {
+	logger.Log.Infow("Removing item from cart",
+		"user_id", req.GetUserId(),
+		"anonymous_id", req.GetAnonymousId(),
+		"product_id", req.GetProductId(),
+		"sku", req.GetSku(),
+	)
+
+	owner := services.CartOwner{UserID: req.GetUserId(), AnonymousID: req.GetAnonymousId()}
+
+	cart, err := services.RemoveItem(ctx, s.Repo, s.ProductClient, owner, req.GetProductId(), req.GetSku())
+	if err != nil {
+		return nil, err
+	}
+
+	return toCartResponse(cart), nil
+}
+
+// GetCart returns the cart with current prices and availability
+func (s *Server) GetCart(ctx context.Context, req *cartpb.GetCartRequest) (*cartpb.Cart, error) {
+	owner := services.CartOwner{UserID: req.GetUserId(), AnonymousID: req.GetAnonymousId()}
+
+	cart, err := services.GetCart(ctx, s.Repo, s.ProductClient, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return toCartResponse(cart), nil
+}
+
+// ClearCart empties the cart
+func (s *Server) ClearCart(ctx context.Context, req *cartpb.ClearCartRequest) (*cartpb.ClearCartResponse, error) {
+	owner := services.CartOwner{UserID: req.GetUserId(), AnonymousID: req.GetAnonymousId()}
+
+	if err := services.ClearCart(ctx, s.Repo, owner); err != nil {
+		return nil, err
+	}
+
+	return &cartpb.ClearCartResponse{
+		Success: true,
+		Message: "Cart cleared",
+	}, nil
+}
+
+// MergeCarts moves an anonymous cart into the user's cart after login
+func (s *Server) MergeCarts(ctx context.Context, req *cartpb.MergeCartsRequest) (*cartpb.Cart, error) {
+	logger.Log.Infow("Merging carts", "user_id", req.GetUserId(), "anonymous_id", req.GetAnonymousId())
+
+	cart, err := services.MergeCarts(ctx, s.Repo, s.ProductClient, req.GetUserId(), req.GetAnonymousId())
+	if err != nil {
+		logger.Log.Errorw("Failed to merge carts", "error", err)
+		return nil, err
+	}
+
+	return toCartResponse(cart), nil
+}
+
+func toCartResponse(cart *services.PricedCart) *cartpb.Cart {
+	items := make([]*cartpb.CartItem, len(cart.Lines))
+	for i, line := range cart.Lines {
+		items[i] = &cartpb.CartItem{
+			ProductId:   line.ProductID,
+			Sku:         line.SKU,
+			ProductName: line.ProductName,
+			UnitPrice:   toMoneyResponse(line.UnitPrice),
+			Quantity:    line.Quantity,
+			LineTotal:   toMoneyResponse(line.LineTotal),
+			Available:   line.Available,
+		}
+	}
+
+	res := &cartpb.Cart{
+		UserId:      cart.Owner.UserID,
+		AnonymousId: cart.Owner.AnonymousID,
+		Items:       items,
+		Total:       toMoneyResponse(cart.Total),
+		ItemCount:   cart.ItemCount,
+	}
+
+	// An empty cart isn't stored, so it has no timestamps
+	if !cart.UpdatedAt.IsZero() {
+		res.UpdatedAt = timestamppb.New(cart.UpdatedAt)
+	}
+	if !cart.ExpiresAt.IsZero() {
+		res.ExpiresAt = timestamppb.New(cart.ExpiresAt)
+	}
+
+	return res
+}
+
+func toMoneyResponse(m money.Money) *cartpb.Money {
+	return &cartpb.Money{Amount: m.Amount, Currency: m.Currency}
+}
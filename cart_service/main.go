@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tird4d/go-microservices/cart_service/config"
+	"github.com/tird4d/go-microservices/cart_service/handlers"
+	"github.com/tird4d/go-microservices/cart_service/interceptors"
+	"github.com/tird4d/go-microservices/cart_service/logger"
+	"github.com/tird4d/go-microservices/cart_service/metrics"
+	cartpb "github.com/tird4d/go-microservices/cart_service/proto"
+	"github.com/tird4d/go-microservices/cart_service/repositories"
+	"github.com/tird4d/go-microservices/cart_service/tracing"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	health "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func main() {
+	logger.InitLogger(true)
+
+	err := godotenv.Load()
+	if err != nil {
+		logger.Log.Infow("⚠️ Error loading .env file", "error", err)
+	}
+
+	// ============ PROMETHEUS METRICS ============
+	metrics.InitMetrics()
+	go func() {
+		http.Handle("/metrics", promhttp.Handler())
+		if err := http.ListenAndServe(":2112", nil); err != nil {
+			logger.Log.Fatalw("❌ Failed to start metrics HTTP server", "error", err)
+		}
+	}()
+
+	// Initialize Jaeger tracing
+	jaegerEndpoint := os.Getenv("JAEGER_ENDPOINT")
+	if jaegerEndpoint == "" {
+		jaegerEndpoint = "jaeger:4317" // Default for docker-compose
+	}
+	tp, err := tracing.InitTracer("cart-service", jaegerEndpoint)
+	if err != nil {
+		logger.Log.Errorw("❌ Failed to initialize tracer", "error", err)
+		os.Exit(1)
+	}
+	defer tp.Shutdown(context.Background())
+
+	// Carts live in Redis and expire after CART_TTL without activity
+	cartRepo := &repositories.RedisCartRepository{
+		Client: config.ConnectRedis(),
+		TTL:    config.CartTTL(),
+	}
+
+	// Connect to product service to validate items and price carts
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	productConn, err := grpc.DialContext(ctx, os.Getenv("PRODUCT_SERVICE_ADDR"), grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithUnaryInterceptor(interceptors.UnaryClientInterceptor))
+	if err != nil {
+		log.Fatalf("❌ could not connect to product gRPC server: %v", err)
+	}
+
+	productClient := productpb.NewProductServiceClient(productConn)
+
+	lis, err := net.Listen("tcp", ":50055")
+	if err != nil {
+		logger.Log.Errorw("❌ Failed to listen", "error", err)
+		os.Exit(1)
+	}
+
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(interceptors.UnaryServerInterceptor))
+
+	// ✅ Register CartService
+	cartpb.RegisterCartServiceServer(grpcServer, &handlers.Server{
+		Repo:          cartRepo,
+		ProductClient: productClient,
+	})
+
+	// ✅ Health Check setup
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("cart.CartService", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	logger.Log.Infow("✅ gRPC server is running on port", "port", 50055)
+
+	if err := grpcServer.Serve(lis); err != nil {
+		logger.Log.Fatal("❌ Failed to serve", "error", err)
+	}
+}
@@ -0,0 +1,61 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tird4d/go-microservices/cart_service/models"
+	"github.com/tird4d/go-microservices/cart_service/repositories"
+)
+
+// CartRepositoryMock mocks CartRepository. Update and Merge return the cart
+// given to Return after running the mutation on it, like the real repository
+// would.
+type CartRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *CartRepositoryMock) Get(ctx context.Context, cartID string) (*models.Cart, error) {
+	args := m.Called(ctx, cartID)
+	if result, ok := args.Get(0).(*models.Cart); ok {
+		return result, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *CartRepositoryMock) Update(ctx context.Context, cartID string, mutate repositories.CartMutation) (*models.Cart, error) {
+	args := m.Called(ctx, cartID)
+	if err := args.Error(1); err != nil {
+		return nil, err
+	}
+
+	cart, _ := args.Get(0).(*models.Cart)
+	if cart == nil {
+		cart = &models.Cart{ID: cartID}
+	}
+	if err := mutate(cart); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+func (m *CartRepositoryMock) Clear(ctx context.Context, cartID string) error {
+	args := m.Called(ctx, cartID)
+	return args.Error(0)
+}
+
+func (m *CartRepositoryMock) Merge(ctx context.Context, fromID, toID string, mutate repositories.CartMutation) (*models.Cart, error) {
+	args := m.Called(ctx, fromID, toID)
+	if err := args.Error(1); err != nil {
+		return nil, err
+	}
+
+	cart, _ := args.Get(0).(*models.Cart)
+	if cart == nil {
+		cart = &models.Cart{ID: toID}
+	}
+	if err := mutate(cart); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
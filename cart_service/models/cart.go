@@ -0,0 +1,82 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/tird4d/go-microservices/product_service/money"
+)
+
+// Cart is a shopper's cart. ID is derived from its owner with UserCartID
+// or AnonymousCartID.
+type Cart struct {
+	ID        string
+	Items     []CartItem
+	UpdatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// CartItem is one product line, or one variant line when SKU is set. Name
+// and UnitPrice are the snapshot taken when the item was last added or updated.
+type CartItem struct {
+	ProductID   string      `json:"product_id"`
+	SKU         string      `json:"sku,omitempty"`
+	ProductName string      `json:"product_name"`
+	UnitPrice   money.Money `json:"unit_price"`
+	Quantity    int32       `json:"quantity"`
+	AddedAt     time.Time   `json:"added_at"`
+}
+
+// UnmarshalJSON also reads items stored before prices had a currency, whose
+// unit_price is a number in major units of the default currency
+func (i *CartItem) UnmarshalJSON(data []byte) error {
+	type plain CartItem
+	var item struct {
+		plain
+		UnitPrice json.RawMessage `json:"unit_price"`
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return err
+	}
+	*i = CartItem(item.plain)
+
+	switch {
+	case len(item.UnitPrice) == 0 || string(item.UnitPrice) == "null":
+		return nil
+	case item.UnitPrice[0] == '{':
+		return json.Unmarshal(item.UnitPrice, &i.UnitPrice)
+	}
+
+	var legacy float64
+	if err := json.Unmarshal(item.UnitPrice, &legacy); err != nil {
+		return err
+	}
+	price, err := money.FromMajor(legacy, money.DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	i.UnitPrice = price
+	return nil
+}
+
+// Item returns the line for productID and sku, if the cart has one
+func (c *Cart) Item(productID, sku string) (CartItem, bool) {
+	for _, item := range c.Items {
+		if item.Is(productID, sku) {
+			return item, true
+		}
+	}
+	return CartItem{}, false
+}
+
+// Is reports whether the item is the line for productID and sku. Variants
+// of the same product are separate lines.
+func (i CartItem) Is(productID, sku string) bool {
+	return i.ProductID == productID && i.SKU == sku
+}
+
+// UserCartID is the cart ID of a logged-in user
+func UserCartID(userID string) string { return "user:" + userID }
+
+// AnonymousCartID is the cart ID of a shopper who hasn't logged in yet
+func AnonymousCartID(anonymousID string) string { return "anon:" + anonymousID }
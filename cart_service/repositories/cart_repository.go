@@ -0,0 +1,32 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tird4d/go-microservices/cart_service/models"
+)
+
+// ErrConcurrentUpdate is returned when a cart kept changing underneath an
+// update and it gave up retrying
+var ErrConcurrentUpdate = errors.New("cart was modified concurrently")
+
+// CartMutation changes a cart in place. Returning an error aborts the update
+// and the error is passed back to the caller unchanged. It runs inside the
+// cart's transaction and is repeated when the transaction is retried, so it
+// shouldn't call other services.
+type CartMutation func(cart *models.Cart) error
+
+// CartRepository defines the interface for cart storage. Every read or write
+// counts as activity and pushes the cart's expiry back.
+type CartRepository interface {
+	// Get returns the cart, or an empty one if it doesn't exist or expired
+	Get(ctx context.Context, cartID string) (*models.Cart, error)
+	// Update applies mutate atomically. A cart left without items is deleted.
+	Update(ctx context.Context, cartID string, mutate CartMutation) (*models.Cart, error)
+	Clear(ctx context.Context, cartID string) error
+	// Merge moves every item of fromID into toID, adding up quantities of
+	// products found in both, applies mutate to the merged cart and deletes
+	// fromID, all atomically
+	Merge(ctx context.Context, fromID, toID string, mutate CartMutation) (*models.Cart, error)
+}
@@ -0,0 +1,176 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/tird4d/go-microservices/cart_service/models"
+)
+
+// maxUpdateAttempts bounds the optimistic retries when a watched cart changes
+// between read and write
+const maxUpdateAttempts = 5
+
+// RedisCartRepository stores each cart as one JSON value under "cart:<id>".
+// The key's TTL is reset on every access, so carts expire after TTL of inactivity.
+type RedisCartRepository struct {
+	Client *redis.Client
+	TTL    time.Duration
+}
+
+// storedCart is the JSON layout of a cart in Redis
+type storedCart struct {
+	Items     []models.CartItem `json:"items"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+func cartKey(cartID string) string { return "cart:" + cartID }
+
+func (r *RedisCartRepository) Get(ctx context.Context, cartID string) (*models.Cart, error) {
+	data, err := r.Client.GetEx(ctx, cartKey(cartID), r.TTL).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return &models.Cart{ID: cartID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := decodeCart(cartID, data)
+	if err != nil {
+		return nil, err
+	}
+	cart.ExpiresAt = time.Now().Add(r.TTL)
+	return cart, nil
+}
+
+func (r *RedisCartRepository) Update(ctx context.Context, cartID string, mutate CartMutation) (*models.Cart, error) {
+	key := cartKey(cartID)
+	var result *models.Cart
+
+	err := r.watch(ctx, func(tx *redis.Tx) error {
+		cart, err := r.load(ctx, tx, cartID)
+		if err != nil {
+			return err
+		}
+
+		if err := mutate(cart); err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return r.save(ctx, pipe, cart)
+		})
+		result = cart
+		return err
+	}, key)
+
+	return result, err
+}
+
+func (r *RedisCartRepository) Clear(ctx context.Context, cartID string) error {
+	return r.Client.Del(ctx, cartKey(cartID)).Err()
+}
+
+func (r *RedisCartRepository) Merge(ctx context.Context, fromID, toID string, mutate CartMutation) (*models.Cart, error) {
+	var result *models.Cart
+
+	err := r.watch(ctx, func(tx *redis.Tx) error {
+		from, err := r.load(ctx, tx, fromID)
+		if err != nil {
+			return err
+		}
+		to, err := r.load(ctx, tx, toID)
+		if err != nil {
+			return err
+		}
+
+		mergeItems(to, from.Items)
+		if err := mutate(to); err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, cartKey(fromID))
+			return r.save(ctx, pipe, to)
+		})
+		result = to
+		return err
+	}, cartKey(fromID), cartKey(toID))
+
+	return result, err
+}
+
+// watch runs fn in a WATCH transaction on keys, retrying when another client
+// modified one of them before EXEC
+func (r *RedisCartRepository) watch(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		err := r.Client.Watch(ctx, fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return ErrConcurrentUpdate
+}
+
+func (r *RedisCartRepository) load(ctx context.Context, tx *redis.Tx, cartID string) (*models.Cart, error) {
+	data, err := tx.Get(ctx, cartKey(cartID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return &models.Cart{ID: cartID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeCart(cartID, data)
+}
+
+func (r *RedisCartRepository) save(ctx context.Context, pipe redis.Pipeliner, cart *models.Cart) error {
+	key := cartKey(cart.ID)
+
+	if len(cart.Items) == 0 {
+		cart.UpdatedAt = time.Time{}
+		cart.ExpiresAt = time.Time{}
+		pipe.Del(ctx, key)
+		return nil
+	}
+
+	cart.UpdatedAt = time.Now().UTC()
+	cart.ExpiresAt = cart.UpdatedAt.Add(r.TTL)
+
+	data, err := json.Marshal(storedCart{Items: cart.Items, UpdatedAt: cart.UpdatedAt})
+	if err != nil {
+		return fmt.Errorf("encode cart: %w", err)
+	}
+
+	pipe.Set(ctx, key, data, r.TTL)
+	return nil
+}
+
+func decodeCart(cartID string, data []byte) (*models.Cart, error) {
+	var stored storedCart
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("decode cart %s: %w", cartID, err)
+	}
+	return &models.Cart{ID: cartID, Items: stored.Items, UpdatedAt: stored.UpdatedAt}, nil
+}
+
+// mergeItems adds items to cart. Products and variants already in the cart
+// keep their line and get the extra quantity.
+func mergeItems(cart *models.Cart, items []models.CartItem) {
+	for _, item := range items {
+		merged := false
+		for i := range cart.Items {
+			if cart.Items[i].Is(item.ProductID, item.SKU) {
+				cart.Items[i].Quantity += item.Quantity
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			cart.Items = append(cart.Items, item)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/cart_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
+)
+
+func newTestRepository(t *testing.T) (*RedisCartRepository, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return &RedisCartRepository{Client: client, TTL: time.Hour}, s
+}
+
+func addItem(productID string, quantity int32) CartMutation {
+	return func(cart *models.Cart) error {
+		for i := range cart.Items {
+			if cart.Items[i].ProductID == productID {
+				cart.Items[i].Quantity += quantity
+				return nil
+			}
+		}
+		cart.Items = append(cart.Items, models.CartItem{ProductID: productID, Quantity: quantity})
+		return nil
+	}
+}
+
+func noMutation(*models.Cart) error { return nil }
+
+func TestRedisCartRepository_GetMissingCartIsEmpty(t *testing.T) {
+	repo, _ := newTestRepository(t)
+
+	cart, err := repo.Get(context.Background(), "user:u1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "user:u1", cart.ID)
+	assert.Empty(t, cart.Items)
+}
+
+func TestRedisCartRepository_ExpiresAfterInactivity(t *testing.T) {
+	ctx := context.Background()
+	repo, s := newTestRepository(t)
+
+	_, err := repo.Update(ctx, "user:u1", addItem("p1", 1))
+	require.NoError(t, err)
+
+	// Reading the cart counts as activity and resets the TTL
+	s.FastForward(50 * time.Minute)
+	_, err = repo.Get(ctx, "user:u1")
+	require.NoError(t, err)
+	s.FastForward(50 * time.Minute)
+
+	cart, err := repo.Get(ctx, "user:u1")
+	require.NoError(t, err)
+	assert.Len(t, cart.Items, 1, "cart should still exist after being read")
+
+	s.FastForward(61 * time.Minute)
+
+	cart, err = repo.Get(ctx, "user:u1")
+	require.NoError(t, err)
+	assert.Empty(t, cart.Items, "cart should expire after an hour without activity")
+}
+
+func TestRedisCartRepository_UpdateDeletesEmptyCart(t *testing.T) {
+	ctx := context.Background()
+	repo, s := newTestRepository(t)
+
+	_, err := repo.Update(ctx, "user:u1", addItem("p1", 1))
+	require.NoError(t, err)
+
+	_, err = repo.Update(ctx, "user:u1", func(cart *models.Cart) error {
+		cart.Items = nil
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.False(t, s.Exists("cart:user:u1"))
+}
+
+func TestRedisCartRepository_ConcurrentUpdates(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := newTestRepository(t)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := int32(0)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := repo.Update(ctx, "user:u1", addItem("p1", 1)); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			} else {
+				assert.ErrorIs(t, err, ErrConcurrentUpdate)
+			}
+		}()
+	}
+	wg.Wait()
+
+	cart, err := repo.Get(ctx, "user:u1")
+	require.NoError(t, err)
+	require.Len(t, cart.Items, 1)
+	assert.Equal(t, succeeded, cart.Items[0].Quantity, "no increment should be lost")
+}
+
+func TestRedisCartRepository_Merge(t *testing.T) {
+	ctx := context.Background()
+	repo, s := newTestRepository(t)
+
+	_, err := repo.Update(ctx, "anon:a1", addItem("p1", 2))
+	require.NoError(t, err)
+	_, err = repo.Update(ctx, "anon:a1", addItem("p2", 1))
+	require.NoError(t, err)
+	_, err = repo.Update(ctx, "user:u1", addItem("p1", 1))
+	require.NoError(t, err)
+
+	cart, err := repo.Merge(ctx, "anon:a1", "user:u1", noMutation)
+	require.NoError(t, err)
+
+	require.Len(t, cart.Items, 2)
+	assert.Equal(t, "p1", cart.Items[0].ProductID)
+	assert.Equal(t, int32(3), cart.Items[0].Quantity)
+	assert.Equal(t, "p2", cart.Items[1].ProductID)
+	assert.False(t, s.Exists("cart:anon:a1"), "anonymous cart should be deleted")
+
+	stored, err := repo.Get(ctx, "user:u1")
+	require.NoError(t, err)
+	assert.Equal(t, cart.Items, stored.Items)
+}
+
+func TestRedisCartRepository_MergeMissingAnonymousCart(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := newTestRepository(t)
+
+	_, err := repo.Update(ctx, "user:u1", addItem("p1", 1))
+	require.NoError(t, err)
+
+	cart, err := repo.Merge(ctx, "anon:a1", "user:u1", noMutation)
+
+	require.NoError(t, err)
+	assert.Len(t, cart.Items, 1)
+}
+
+func TestRedisCartRepository_MergeAbortedByMutation(t *testing.T) {
+	ctx := context.Background()
+	repo, s := newTestRepository(t)
+
+	_, err := repo.Update(ctx, "anon:a1", addItem("p1", 2))
+	require.NoError(t, err)
+
+	failure := errors.New("rejected")
+	_, err = repo.Merge(ctx, "anon:a1", "user:u1", func(*models.Cart) error { return failure })
+
+	assert.ErrorIs(t, err, failure)
+	assert.True(t, s.Exists("cart:anon:a1"), "anonymous cart should be kept")
+	assert.False(t, s.Exists("cart:user:u1"))
+}
+
+func TestRedisCartRepository_ReadsLegacyFloatPrices(t *testing.T) {
+	repo, s := newTestRepository(t)
+
+	// Carts stored before prices had a currency
+	require.NoError(t, s.Set(cartKey("user:u1"), `{"items":[{"product_id":"p1","unit_price":12.99,"quantity":2}],"updated_at":"2026-01-02T00:00:00Z"}`))
+
+	cart, err := repo.Get(context.Background(), "user:u1")
+
+	require.NoError(t, err)
+	require.Len(t, cart.Items, 1)
+	assert.Equal(t, money.New(1299, money.DefaultCurrency), cart.Items[0].UnitPrice)
+	assert.Equal(t, int32(2), cart.Items[0].Quantity)
+
+	// Saving writes the new layout, which reads back the same
+	cart, err = repo.Update(context.Background(), "user:u1", addItem("p1", 1))
+	require.NoError(t, err)
+	cart, err = repo.Get(context.Background(), "user:u1")
+	require.NoError(t, err)
+	assert.Equal(t, money.New(1299, money.DefaultCurrency), cart.Items[0].UnitPrice)
+	assert.Equal(t, int32(3), cart.Items[0].Quantity)
+}
@@ -0,0 +1,480 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tird4d/go-microservices/cart_service/logger"
+	"github.com/tird4d/go-microservices/cart_service/models"
+	"github.com/tird4d/go-microservices/cart_service/repositories"
+	"github.com/tird4d/go-microservices/product_service/money"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxItemQuantity caps a single cart line regardless of stock
+const MaxItemQuantity = 99
+
+// CartOwner names a cart: the user's cart when UserID is set, otherwise the
+// anonymous cart identified by AnonymousID
+type CartOwner struct {
+	UserID      string
+	AnonymousID string
+}
+
+// PricedCart is a cart with every line re-checked against product_service.
+// A cart is in one currency, that of its first line.
+type PricedCart struct {
+	*models.Cart
+	Owner     CartOwner
+	Lines     []PricedLine
+	Total     money.Money
+	ItemCount int32
+}
+
+// PricedLine is a cart item with its current price and availability
+type PricedLine struct {
+	models.CartItem
+	LineTotal money.Money
+	Available bool
+}
+
+// AddItem adds quantity units of a product, or of its variant sku, to the
+// cart, validating it exists and has enough stock for the resulting
+// quantity. A product with variants can only be added by SKU, and only
+// products priced in the currency of the cart's other lines can be added.
+func AddItem(ctx context.Context, repo repositories.CartRepository, productClient productpb.ProductServiceClient, owner CartOwner, productID, sku string, quantity int32) (*PricedCart, error) {
+	cartID, err := cartID(owner)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateItem(productID, quantity); err != nil {
+		return nil, err
+	}
+
+	offer, err := fetchOffer(ctx, productClient, productID, sku)
+	if err != nil {
+		return nil, err
+	}
+	if sku == "" {
+		if err := requireNoVariants(ctx, productClient, productID); err != nil {
+			return nil, err
+		}
+	}
+
+	cart, err := repo.Update(ctx, cartID, func(cart *models.Cart) error {
+		for i := range cart.Items {
+			if cart.Items[i].Is(productID, sku) {
+				newQuantity := cart.Items[i].Quantity + quantity
+				if err := checkQuantity(offer, newQuantity); err != nil {
+					return err
+				}
+				cart.Items[i] = snapshot(cart.Items[i], offer, newQuantity)
+				return nil
+			}
+		}
+
+		if err := checkQuantity(offer, quantity); err != nil {
+			return err
+		}
+		if err := checkCurrency(cart, offer); err != nil {
+			return err
+		}
+		cart.Items = append(cart.Items, snapshot(models.CartItem{}, offer, quantity))
+		return nil
+	})
+	if err != nil {
+		return nil, updateError(err, "failed to add item to cart")
+	}
+
+	logger.Log.Infow("Item added to cart", "cart_id", cartID, "product_id", productID, "sku", sku, "quantity", quantity)
+
+	return priceCart(ctx, productClient, owner, cart), nil
+}
+
+// UpdateQuantity sets the quantity of a product or variant that is already in the cart
+func UpdateQuantity(ctx context.Context, repo repositories.CartRepository, productClient productpb.ProductServiceClient, owner CartOwner, productID, sku string, quantity int32) (*PricedCart, error) {
+	cartID, err := cartID(owner)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateItem(productID, quantity); err != nil {
+		return nil, err
+	}
+
+	offer, err := fetchOffer(ctx, productClient, productID, sku)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := repo.Update(ctx, cartID, func(cart *models.Cart) error {
+		for i := range cart.Items {
+			if cart.Items[i].Is(productID, sku) {
+				if err := checkQuantity(offer, quantity); err != nil {
+					return err
+				}
+				cart.Items[i] = snapshot(cart.Items[i], offer, quantity)
+				return nil
+			}
+		}
+		return notInCart(productID, sku)
+	})
+	if err != nil {
+		return nil, updateError(err, "failed to update cart item")
+	}
+
+	return priceCart(ctx, productClient, owner, cart), nil
+}
+
+// RemoveItem removes a product or variant line from the cart
+func RemoveItem(ctx context.Context, repo repositories.CartRepository, productClient productpb.ProductServiceClient, owner CartOwner, productID, sku string) (*PricedCart, error) {
+	cartID, err := cartID(owner)
+	if err != nil {
+		return nil, err
+	}
+	if productID == "" {
+		return nil, status.Error(codes.InvalidArgument, "product_id is required")
+	}
+
+	cart, err := repo.Update(ctx, cartID, func(cart *models.Cart) error {
+		for i := range cart.Items {
+			if cart.Items[i].Is(productID, sku) {
+				cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
+				return nil
+			}
+		}
+		return notInCart(productID, sku)
+	})
+	if err != nil {
+		return nil, updateError(err, "failed to remove cart item")
+	}
+
+	return priceCart(ctx, productClient, owner, cart), nil
+}
+
+// GetCart returns the cart with current prices. Reading a cart keeps it alive.
+func GetCart(ctx context.Context, repo repositories.CartRepository, productClient productpb.ProductServiceClient, owner CartOwner) (*PricedCart, error) {
+	cartID, err := cartID(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := repo.Get(ctx, cartID)
+	if err != nil {
+		logger.Log.Errorw("Failed to load cart", "cart_id", cartID, "error", err)
+		return nil, status.Error(codes.Internal, "failed to retrieve cart")
+	}
+
+	return priceCart(ctx, productClient, owner, cart), nil
+}
+
+// ClearCart removes every item from the cart
+func ClearCart(ctx context.Context, repo repositories.CartRepository, owner CartOwner) error {
+	cartID, err := cartID(owner)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.Clear(ctx, cartID); err != nil {
+		logger.Log.Errorw("Failed to clear cart", "cart_id", cartID, "error", err)
+		return status.Error(codes.Internal, "failed to clear cart")
+	}
+
+	logger.Log.Infow("Cart cleared", "cart_id", cartID)
+
+	return nil
+}
+
+// MergeCarts moves the anonymous cart into the user's cart. Quantities of
+// products and variants in both carts are added up and clamped to
+// MaxItemQuantity and the available stock; stock is re-checked when the cart
+// is priced. The stock is looked up before the merge, so product_service
+// isn't called inside the cart transaction.
+func MergeCarts(ctx context.Context, repo repositories.CartRepository, productClient productpb.ProductServiceClient, userID, anonymousID string) (*PricedCart, error) {
+	if userID == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if err := validateAnonymousID(anonymousID); err != nil {
+		return nil, err
+	}
+
+	owner := CartOwner{UserID: userID}
+	fromID, toID := models.AnonymousCartID(anonymousID), models.UserCartID(userID)
+
+	limits, err := quantityLimits(ctx, repo, productClient, fromID, toID)
+	if err != nil {
+		return nil, updateError(err, "failed to merge carts")
+	}
+
+	cart, err := repo.Merge(ctx, fromID, toID, func(cart *models.Cart) error {
+		clampQuantities(cart, limits)
+		return nil
+	})
+	if err != nil {
+		return nil, updateError(err, "failed to merge carts")
+	}
+
+	logger.Log.Infow("Anonymous cart merged", "user_id", userID, "anonymous_id", anonymousID, "items", len(cart.Items))
+
+	return priceCart(ctx, productClient, owner, cart), nil
+}
+
+// cartID resolves the cart a request refers to. A logged-in user always
+// gets their own cart, even if the client also sent an anonymous ID.
+func cartID(owner CartOwner) (string, error) {
+	if owner.UserID != "" {
+		return models.UserCartID(owner.UserID), nil
+	}
+	if owner.AnonymousID == "" {
+		return "", status.Error(codes.InvalidArgument, "user_id or anonymous_id is required")
+	}
+	if err := validateAnonymousID(owner.AnonymousID); err != nil {
+		return "", err
+	}
+	return models.AnonymousCartID(owner.AnonymousID), nil
+}
+
+// validateAnonymousID only accepts UUIDs so clients can't pick guessable cart IDs
+func validateAnonymousID(anonymousID string) error {
+	if _, err := uuid.Parse(anonymousID); err != nil {
+		return status.Error(codes.InvalidArgument, "anonymous_id must be a UUID")
+	}
+	return nil
+}
+
+func validateItem(productID string, quantity int32) error {
+	if productID == "" {
+		return status.Error(codes.InvalidArgument, "product_id is required")
+	}
+	if quantity <= 0 {
+		return status.Error(codes.InvalidArgument, "quantity must be positive")
+	}
+	return nil
+}
+
+// productOffer is what a cart line sells: a product, or one of its variants with
+// the variant's stock and price
+type productOffer struct {
+	ProductID string
+	SKU       string
+	Name      string
+	Price     money.Money
+	Stock     int32
+}
+
+// checkCurrency keeps a cart in one currency so its total can be added up
+func checkCurrency(cart *models.Cart, offer *productOffer) error {
+	for _, item := range cart.Items {
+		if item.UnitPrice.Currency != offer.Price.Currency {
+			return status.Errorf(codes.FailedPrecondition,
+				"the cart is priced in %s and product %s in %s", item.UnitPrice.Currency, offer.ProductID, offer.Price.Currency)
+		}
+	}
+	return nil
+}
+
+func checkQuantity(offer *productOffer, quantity int32) error {
+	if quantity > MaxItemQuantity {
+		return status.Errorf(codes.InvalidArgument, "quantity cannot exceed %d", MaxItemQuantity)
+	}
+	if offer.Stock < quantity {
+		if offer.SKU != "" {
+			return status.Errorf(codes.FailedPrecondition, "insufficient stock for sku %s", offer.SKU)
+		}
+		return status.Errorf(codes.FailedPrecondition, "insufficient stock for product %s", offer.ProductID)
+	}
+	return nil
+}
+
+// lineKey identifies a cart line: a product, or one variant of it
+type lineKey struct {
+	productID string
+	sku       string
+}
+
+// quantityLimits returns the most units each line of the carts fromID and
+// toID may have once they're merged: MaxItemQuantity, or the stock of the
+// product or variant if that's lower. Lines keep at least one unit so an
+// out-of-stock line still shows up as unavailable, and lines whose stock
+// can't be looked up are only capped at MaxItemQuantity.
+func quantityLimits(ctx context.Context, repo repositories.CartRepository, productClient productpb.ProductServiceClient, fromID, toID string) (map[lineKey]int32, error) {
+	limits := make(map[lineKey]int32)
+	for _, id := range []string{fromID, toID} {
+		cart, err := repo.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range cart.Items {
+			key := lineKey{productID: item.ProductID, sku: item.SKU}
+			if _, ok := limits[key]; ok {
+				continue
+			}
+			limit := int32(MaxItemQuantity)
+			if offer, err := fetchOffer(ctx, productClient, item.ProductID, item.SKU); err == nil && offer.Stock < limit {
+				limit = max(offer.Stock, 1)
+			}
+			limits[key] = limit
+		}
+	}
+	return limits, nil
+}
+
+// clampQuantities caps every line of a merged cart at its limit, instead of
+// failing the merge like AddItem would. Lines added since the limits were
+// looked up are capped at MaxItemQuantity.
+func clampQuantities(cart *models.Cart, limits map[lineKey]int32) {
+	for i, item := range cart.Items {
+		limit, ok := limits[lineKey{productID: item.ProductID, sku: item.SKU}]
+		if !ok {
+			limit = MaxItemQuantity
+		}
+		if item.Quantity > limit {
+			cart.Items[i].Quantity = limit
+		}
+	}
+}
+
+// fetchOffer loads the product and, for a SKU, its variant. A variant that
+// belongs to another product is reported as not found.
+func fetchOffer(ctx context.Context, productClient productpb.ProductServiceClient, productID, sku string) (*productOffer, error) {
+	product, err := productClient.GetProduct(ctx, &productpb.GetProductRequest{Id: productID})
+	if err != nil {
+		return nil, productServiceError(err, "product "+productID)
+	}
+
+	result := &productOffer{
+		ProductID: product.GetId(),
+		Name:      product.GetName(),
+		Price:     money.New(product.GetPrice().GetAmount(), product.GetPrice().GetCurrency()),
+		Stock:     product.GetStock(),
+	}
+	if sku == "" {
+		return result, nil
+	}
+
+	variant, err := productClient.GetVariant(ctx, &productpb.GetVariantRequest{Sku: sku})
+	if err != nil {
+		return nil, productServiceError(err, "sku "+sku)
+	}
+	if variant.GetProductId() != product.GetId() {
+		return nil, status.Errorf(codes.NotFound, "sku %s not found for product %s", sku, productID)
+	}
+
+	result.SKU = variant.GetSku()
+	result.Stock = variant.GetStock()
+	if price := variant.GetPrice(); price != nil {
+		result.Price = money.New(price.GetAmount(), price.GetCurrency())
+	}
+	return result, nil
+}
+
+// requireNoVariants rejects adding a product without a SKU when the shopper
+// has to pick one of its variants
+func requireNoVariants(ctx context.Context, productClient productpb.ProductServiceClient, productID string) error {
+	variants, err := productClient.ListVariants(ctx, &productpb.ListVariantsRequest{ProductId: productID})
+	if err != nil {
+		return productServiceError(err, "product "+productID)
+	}
+	if len(variants.GetVariants()) > 0 {
+		return status.Errorf(codes.InvalidArgument, "product %s has variants, a sku is required", productID)
+	}
+	return nil
+}
+
+// productServiceError maps a failed product_service lookup of what
+func productServiceError(err error, what string) error {
+	switch status.Code(err) {
+	case codes.NotFound, codes.InvalidArgument:
+		return status.Errorf(codes.NotFound, "%s not found", what)
+	default:
+		logger.Log.Errorw("Failed to fetch from product service", "item", what, "error", err)
+		return status.Error(codes.Unavailable, "cannot connect to product service")
+	}
+}
+
+func notInCart(productID, sku string) error {
+	if sku != "" {
+		return status.Errorf(codes.NotFound, "sku %s is not in the cart", sku)
+	}
+	return status.Errorf(codes.NotFound, "product %s is not in the cart", productID)
+}
+
+// snapshot refreshes a cart line with the current name and price
+func snapshot(item models.CartItem, offer *productOffer, quantity int32) models.CartItem {
+	if item.AddedAt.IsZero() {
+		item.AddedAt = time.Now().UTC()
+	}
+	item.ProductID = offer.ProductID
+	item.SKU = offer.SKU
+	item.ProductName = offer.Name
+	item.UnitPrice = offer.Price
+	item.Quantity = quantity
+	return item
+}
+
+// priceCart re-checks every line against product_service. If the product
+// service can't be reached the stored snapshot is used as is. Lines priced
+// in another currency than the first one, which merged carts can have, are
+// unavailable.
+func priceCart(ctx context.Context, productClient productpb.ProductServiceClient, owner CartOwner, cart *models.Cart) *PricedCart {
+	// The anonymous ID is ignored once a user is known, don't echo it back
+	if owner.UserID != "" {
+		owner.AnonymousID = ""
+	}
+
+	priced := &PricedCart{
+		Cart:  cart,
+		Owner: owner,
+		Lines: make([]PricedLine, 0, len(cart.Items)),
+		Total: money.Zero(money.DefaultCurrency),
+	}
+
+	for _, item := range cart.Items {
+		line := PricedLine{CartItem: item, Available: true}
+
+		offer, err := fetchOffer(ctx, productClient, item.ProductID, item.SKU)
+		switch {
+		case err == nil:
+			line.ProductName = offer.Name
+			line.UnitPrice = offer.Price
+			line.Available = offer.Stock >= item.Quantity
+		case status.Code(err) == codes.NotFound:
+			line.Available = false
+		default:
+			logger.Log.Warnw("⚠️ Could not refresh cart item, using snapshot", "product_id", item.ProductID, "sku", item.SKU, "error", err)
+		}
+
+		if len(priced.Lines) == 0 {
+			priced.Total = money.Zero(line.UnitPrice.Currency)
+		}
+		line.LineTotal = line.UnitPrice.Mul(int64(line.Quantity))
+		if line.Available {
+			total, err := priced.Total.Add(line.LineTotal)
+			if err == nil {
+				priced.Total = total
+				priced.ItemCount += line.Quantity
+			} else {
+				line.Available = false
+			}
+		}
+		priced.Lines = append(priced.Lines, line)
+	}
+
+	return priced
+}
+
+// updateError passes status errors raised inside a mutation through and maps
+// everything else to a gRPC error
+func updateError(err error, message string) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, repositories.ErrConcurrentUpdate) {
+		return status.Error(codes.Aborted, "cart was modified concurrently, please retry")
+	}
+	logger.Log.Errorw(message, "error", err)
+	return status.Error(codes.Internal, message)
+}
@@ -0,0 +1,433 @@
+package services
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/cart_service/logger"
+	"github.com/tird4d/go-microservices/cart_service/mocks"
+	"github.com/tird4d/go-microservices/cart_service/models"
+	"github.com/tird4d/go-microservices/cart_service/repositories"
+	"github.com/tird4d/go-microservices/product_service/money"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const anonymousID = "5b0e7c8e-3f39-4d55-9a39-0c6f7e4c2a11"
+
+func TestMain(m *testing.M) {
+	logger.InitLogger(true)
+
+	os.Exit(m.Run())
+}
+
+func laptop(stock int32) *productpb.Product {
+	return &productpb.Product{Id: "p1", Name: "Laptop", Price: &productpb.Money{Amount: 1000, Currency: "EUR"}, Stock: stock}
+}
+
+func eur(amount int64) money.Money {
+	return money.New(amount, "EUR")
+}
+
+// withoutVariants lets AddItem add products by product ID alone
+func withoutVariants(mockProducts *mocks.ProductClientMock) {
+	mockProducts.On("ListVariants", mock.Anything, mock.Anything).Return(&productpb.ListVariantsResponse{}, nil)
+}
+
+// --- ADD ITEM TESTS ---
+
+func TestAddItem_NewItem(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p1"}).Return(laptop(5), nil)
+	withoutVariants(mockProducts)
+	mockRepo.On("Update", mock.Anything, "user:u1").Return(nil, nil)
+
+	cart, err := AddItem(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"}, "p1", "", 2)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Len(t, cart.Lines, 1)
+	assert.Equal(t, "Laptop", cart.Lines[0].ProductName)
+	assert.Equal(t, eur(2000), cart.Total)
+	assert.Equal(t, int32(2), cart.ItemCount)
+	assert.True(t, cart.Lines[0].Available)
+}
+
+func TestAddItem_AddsToExistingQuantity(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	existing := &models.Cart{ID: "user:u1", Items: []models.CartItem{{ProductID: "p1", Quantity: 2, UnitPrice: eur(900)}}}
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).Return(laptop(5), nil)
+	withoutVariants(mockProducts)
+	mockRepo.On("Update", mock.Anything, "user:u1").Return(existing, nil)
+
+	cart, err := AddItem(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"}, "p1", "", 3)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), cart.Items[0].Quantity)
+	assert.Equal(t, eur(1000), cart.Items[0].UnitPrice, "price snapshot should be refreshed")
+}
+
+func TestAddItem_OtherCurrencyThanCart(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	existing := &models.Cart{ID: "user:u1", Items: []models.CartItem{{ProductID: "p2", Quantity: 1, UnitPrice: money.New(2500, "USD")}}}
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).Return(laptop(5), nil)
+	withoutVariants(mockProducts)
+	mockRepo.On("Update", mock.Anything, "user:u1").Return(existing, nil)
+
+	_, err := AddItem(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"}, "p1", "", 1)
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Len(t, existing.Items, 1)
+}
+
+func TestAddItem_InsufficientStock(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	existing := &models.Cart{ID: "user:u1", Items: []models.CartItem{{ProductID: "p1", Quantity: 4}}}
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).Return(laptop(5), nil)
+	withoutVariants(mockProducts)
+	mockRepo.On("Update", mock.Anything, "user:u1").Return(existing, nil)
+
+	_, err := AddItem(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"}, "p1", "", 2)
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestAddItem_UnknownProduct(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).
+		Return(nil, status.Error(codes.NotFound, "product not found"))
+
+	_, err := AddItem(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"}, "missing", "", 1)
+
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestAddItem_ProductServiceDown(t *testing.T) {
+	ctx := context.Background()
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).
+		Return(nil, status.Error(codes.Unavailable, "connection refused"))
+
+	_, err := AddItem(ctx, new(mocks.CartRepositoryMock), mockProducts, CartOwner{UserID: "u1"}, "p1", "", 1)
+
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestAddItem_AnonymousCart(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).Return(laptop(5), nil)
+	withoutVariants(mockProducts)
+	mockRepo.On("Update", mock.Anything, "anon:"+anonymousID).Return(nil, nil)
+
+	_, err := AddItem(ctx, mockRepo, mockProducts, CartOwner{AnonymousID: anonymousID}, "p1", "", 1)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+}
+
+func TestAddItem_InvalidOwner(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := AddItem(ctx, new(mocks.CartRepositoryMock), new(mocks.ProductClientMock), CartOwner{}, "p1", "", 1)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = AddItem(ctx, new(mocks.CartRepositoryMock), new(mocks.ProductClientMock), CartOwner{AnonymousID: "cart-1"}, "p1", "", 1)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "anonymous IDs must be UUIDs")
+}
+
+func TestAddItem_InvalidQuantity(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := AddItem(ctx, new(mocks.CartRepositoryMock), new(mocks.ProductClientMock), CartOwner{UserID: "u1"}, "p1", "", 0)
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestAddItem_ConcurrentUpdate(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).Return(laptop(5), nil)
+	withoutVariants(mockProducts)
+	mockRepo.On("Update", mock.Anything, "user:u1").Return(nil, repositories.ErrConcurrentUpdate)
+
+	_, err := AddItem(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"}, "p1", "", 1)
+
+	assert.Equal(t, codes.Aborted, status.Code(err))
+}
+
+// --- UPDATE / REMOVE TESTS ---
+
+func TestUpdateQuantity_Success(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	existing := &models.Cart{ID: "user:u1", Items: []models.CartItem{{ProductID: "p1", Quantity: 4}}}
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).Return(laptop(5), nil)
+	mockRepo.On("Update", mock.Anything, "user:u1").Return(existing, nil)
+
+	cart, err := UpdateQuantity(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"}, "p1", "", 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), cart.Items[0].Quantity)
+}
+
+func TestUpdateQuantity_ItemNotInCart(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).Return(laptop(5), nil)
+	mockRepo.On("Update", mock.Anything, "user:u1").Return(&models.Cart{ID: "user:u1"}, nil)
+
+	_, err := UpdateQuantity(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"}, "p1", "", 1)
+
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestRemoveItem_Success(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	existing := &models.Cart{ID: "user:u1", Items: []models.CartItem{{ProductID: "p1", Quantity: 1}}}
+	mockRepo.On("Update", mock.Anything, "user:u1").Return(existing, nil)
+
+	cart, err := RemoveItem(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"}, "p1", "")
+
+	assert.NoError(t, err)
+	assert.Empty(t, cart.Lines)
+	mockProducts.AssertNotCalled(t, "GetProduct", mock.Anything, mock.Anything)
+}
+
+// --- GET / MERGE TESTS ---
+
+func TestGetCart_MarksUnavailableItems(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockRepo.On("Get", mock.Anything, "user:u1").Return(&models.Cart{ID: "user:u1", Items: []models.CartItem{
+		{ProductID: "p1", ProductName: "Laptop", UnitPrice: eur(900), Quantity: 2},
+		{ProductID: "p2", ProductName: "Mouse", UnitPrice: eur(25), Quantity: 1},
+		{ProductID: "p3", ProductName: "Desk", UnitPrice: eur(300), Quantity: 3},
+	}}, nil)
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p1"}).Return(laptop(5), nil)
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p2"}).
+		Return(nil, status.Error(codes.NotFound, "product not found"))
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p3"}).
+		Return(&productpb.Product{Id: "p3", Name: "Desk", Price: &productpb.Money{Amount: 300, Currency: "EUR"}, Stock: 1}, nil)
+
+	cart, err := GetCart(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, eur(1000), cart.Lines[0].UnitPrice, "lines should use the current price")
+	assert.True(t, cart.Lines[0].Available)
+	assert.False(t, cart.Lines[1].Available, "deleted products are unavailable")
+	assert.False(t, cart.Lines[2].Available, "lines above stock are unavailable")
+	assert.Equal(t, eur(2000), cart.Total, "unavailable lines are not part of the total")
+	assert.Equal(t, int32(2), cart.ItemCount)
+}
+
+func TestMergeCarts_Success(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockRepo.On("Get", mock.Anything, "anon:"+anonymousID).Return(&models.Cart{Items: []models.CartItem{{ProductID: "p1", Quantity: 2}}}, nil)
+	mockRepo.On("Get", mock.Anything, "user:u1").Return(&models.Cart{Items: []models.CartItem{{ProductID: "p1", Quantity: 1}}}, nil)
+	mockRepo.On("Merge", mock.Anything, "anon:"+anonymousID, "user:u1").
+		Return(&models.Cart{ID: "user:u1", Items: []models.CartItem{{ProductID: "p1", Quantity: 3}}}, nil)
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).Return(laptop(5), nil)
+
+	cart, err := MergeCarts(ctx, mockRepo, mockProducts, "u1", anonymousID)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", cart.Owner.UserID)
+	assert.Equal(t, eur(3000), cart.Total)
+}
+
+func TestMergeCarts_ClampsQuantities(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockRepo.On("Get", mock.Anything, "anon:"+anonymousID).Return(&models.Cart{Items: []models.CartItem{
+		{ProductID: "p1", Quantity: 6},
+		{ProductID: "p2", Quantity: 100},
+	}}, nil)
+	mockRepo.On("Get", mock.Anything, "user:u1").Return(&models.Cart{Items: []models.CartItem{
+		{ProductID: "p1", Quantity: 2},
+		{ProductID: "p2", Quantity: 50},
+		{ProductID: "p3", Quantity: 4},
+	}}, nil)
+	mockRepo.On("Merge", mock.Anything, "anon:"+anonymousID, "user:u1").
+		Return(&models.Cart{ID: "user:u1", Items: []models.CartItem{
+			{ProductID: "p1", Quantity: 8},
+			{ProductID: "p2", Quantity: 150},
+			{ProductID: "p3", Quantity: 4},
+		}}, nil)
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p1"}).Return(laptop(5), nil)
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p2"}).
+		Return(&productpb.Product{Id: "p2", Name: "Cable", Price: &productpb.Money{Amount: 10, Currency: "EUR"}, Stock: 500}, nil)
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p3"}).
+		Return(&productpb.Product{Id: "p3", Name: "Mouse", Price: &productpb.Money{Amount: 20, Currency: "EUR"}, Stock: 0}, nil)
+
+	cart, err := MergeCarts(ctx, mockRepo, mockProducts, "u1", anonymousID)
+
+	require.NoError(t, err)
+	require.Len(t, cart.Lines, 3)
+	assert.Equal(t, int32(5), cart.Lines[0].Quantity, "clamped to stock")
+	assert.Equal(t, int32(MaxItemQuantity), cart.Lines[1].Quantity, "clamped to the line maximum")
+	assert.Equal(t, int32(1), cart.Lines[2].Quantity, "out of stock lines keep one unit")
+	assert.False(t, cart.Lines[2].Available)
+	// Once per line for the limits and once more for pricing
+	mockProducts.AssertNumberOfCalls(t, "GetProduct", 6)
+}
+
+func TestGetCart_LinesInAnotherCurrencyAreUnavailable(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	// Merging an anonymous cart can bring in lines of another currency
+	mockRepo.On("Get", mock.Anything, "user:u1").Return(&models.Cart{ID: "user:u1", Items: []models.CartItem{
+		{ProductID: "p1", Quantity: 1},
+		{ProductID: "p2", Quantity: 1},
+	}}, nil)
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p1"}).Return(laptop(5), nil)
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p2"}).
+		Return(&productpb.Product{Id: "p2", Name: "Mouse", Price: &productpb.Money{Amount: 2500, Currency: "USD"}, Stock: 5}, nil)
+
+	cart, err := GetCart(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"})
+
+	require.NoError(t, err)
+	assert.True(t, cart.Lines[0].Available)
+	assert.False(t, cart.Lines[1].Available)
+	assert.Equal(t, money.New(2500, "USD"), cart.Lines[1].LineTotal)
+	assert.Equal(t, eur(1000), cart.Total)
+	assert.Equal(t, int32(1), cart.ItemCount)
+}
+
+func TestGetCart_EmptyCartTotal(t *testing.T) {
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockRepo.On("Get", mock.Anything, "user:u1").Return(&models.Cart{ID: "user:u1"}, nil)
+
+	cart, err := GetCart(context.Background(), mockRepo, new(mocks.ProductClientMock), CartOwner{UserID: "u1"})
+
+	require.NoError(t, err)
+	assert.Equal(t, money.Zero(money.DefaultCurrency), cart.Total)
+}
+
+func TestMergeCarts_RequiresUser(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := MergeCarts(ctx, new(mocks.CartRepositoryMock), new(mocks.ProductClientMock), "", anonymousID)
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// --- VARIANT TESTS ---
+
+// shirtVariant is a variant of the laptop product; a price of 0 means no override
+func shirtVariant(sku string, price int64, stock int32) *productpb.Variant {
+	variant := &productpb.Variant{ProductId: "p1", Sku: sku, Stock: stock}
+	if price > 0 {
+		variant.Price = &productpb.Money{Amount: price, Currency: "EUR"}
+	}
+	return variant
+}
+
+func TestAddItem_VariantUsesVariantPriceAndStock(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	existing := &models.Cart{ID: "user:u1", Items: []models.CartItem{{ProductID: "p1", SKU: "SHIRT-S", UnitPrice: eur(1000), Quantity: 1}}}
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).Return(laptop(0), nil)
+	mockProducts.On("GetVariant", mock.Anything, &productpb.GetVariantRequest{Sku: "SHIRT-M"}).Return(shirtVariant("SHIRT-M", 1200, 3), nil)
+	mockProducts.On("GetVariant", mock.Anything, &productpb.GetVariantRequest{Sku: "SHIRT-S"}).Return(shirtVariant("SHIRT-S", 0, 3), nil)
+	mockRepo.On("Update", mock.Anything, "user:u1").Return(existing, nil)
+
+	cart, err := AddItem(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"}, "p1", "SHIRT-M", 2)
+
+	assert.NoError(t, err)
+	mockProducts.AssertNotCalled(t, "ListVariants", mock.Anything, mock.Anything)
+	require.Len(t, cart.Lines, 2)
+	// Variants of the same product stay separate lines
+	assert.Equal(t, "SHIRT-S", cart.Lines[0].SKU)
+	assert.Equal(t, eur(1000), cart.Lines[0].UnitPrice, "no override sells at the product price")
+	assert.Equal(t, "SHIRT-M", cart.Lines[1].SKU)
+	assert.Equal(t, eur(1200), cart.Lines[1].UnitPrice)
+	assert.Equal(t, int32(2), cart.Lines[1].Quantity)
+	assert.True(t, cart.Lines[1].Available)
+}
+
+func TestAddItem_VariantInsufficientStock(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.CartRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).Return(laptop(50), nil)
+	mockProducts.On("GetVariant", mock.Anything, mock.Anything).Return(shirtVariant("SHIRT-M", 0, 1), nil)
+	mockRepo.On("Update", mock.Anything, "user:u1").Return(nil, nil)
+
+	_, err := AddItem(ctx, mockRepo, mockProducts, CartOwner{UserID: "u1"}, "p1", "SHIRT-M", 2)
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestAddItem_SKUOfAnotherProduct(t *testing.T) {
+	ctx := context.Background()
+	mockProducts := new(mocks.ProductClientMock)
+
+	other := shirtVariant("MUG-1", 0, 5)
+	other.ProductId = "p2"
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).Return(laptop(5), nil)
+	mockProducts.On("GetVariant", mock.Anything, mock.Anything).Return(other, nil)
+
+	_, err := AddItem(ctx, new(mocks.CartRepositoryMock), mockProducts, CartOwner{UserID: "u1"}, "p1", "MUG-1", 1)
+
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestAddItem_ProductWithVariantsNeedsSKU(t *testing.T) {
+	ctx := context.Background()
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).Return(laptop(5), nil)
+	mockProducts.On("ListVariants", mock.Anything, &productpb.ListVariantsRequest{ProductId: "p1"}).
+		Return(&productpb.ListVariantsResponse{Variants: []*productpb.Variant{shirtVariant("SHIRT-M", 0, 1)}}, nil)
+
+	_, err := AddItem(ctx, new(mocks.CartRepositoryMock), mockProducts, CartOwner{UserID: "u1"}, "p1", "", 1)
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
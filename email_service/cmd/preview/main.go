@@ -0,0 +1,111 @@
+// Command preview renders an email template with sample data to a file:
+//
+//	go run ./cmd/preview -event user.registered -locale de -format html
+//
+// -data overrides the sample data with a JSON file, -list prints the event
+// types that have templates.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/tird4d/go-microservices/email_service/sender"
+	"github.com/tird4d/go-microservices/email_service/templates"
+)
+
+func main() {
+	eventType := flag.String("event", "", "event type of the template, e.g. user.registered")
+	locale := flag.String("locale", templates.DefaultLocale, "preferred locale, falls back like in production")
+	dataFile := flag.String("data", "", "JSON file with template data (default: the template's sample.json)")
+	format := flag.String("format", "html", "output format: html, text or eml")
+	out := flag.String("out", "", "output file (default: <event>.<locale>.<format>)")
+	list := flag.Bool("list", false, "list event types with templates and exit")
+	flag.Parse()
+
+	registry, err := templates.Default()
+	if err != nil {
+		log.Fatalf("❌ Failed to load templates: %v", err)
+	}
+
+	if *list {
+		types := registry.EventTypes()
+		sort.Strings(types)
+		for _, t := range types {
+			fmt.Println(t)
+		}
+		return
+	}
+
+	if *eventType == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, err := loadData(registry, *eventType, *dataFile)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	_, usedLocale, err := registry.Lookup(*eventType, *locale)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	rendered, err := registry.Render(*eventType, *locale, data)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	var output []byte
+	switch *format {
+	case "html":
+		output = []byte(rendered.HTML)
+	case "text":
+		output = []byte(rendered.Text)
+	case "eml":
+		output, err = sender.Message{
+			From:    "Go Microservices <no-reply@go-microservices.local>",
+			To:      []string{"preview@example.com"},
+			Subject: rendered.Subject,
+			Text:    rendered.Text,
+			HTML:    rendered.HTML,
+		}.Bytes()
+		if err != nil {
+			log.Fatalf("❌ Failed to build message: %v", err)
+		}
+	default:
+		log.Fatalf("❌ Unknown format %q", *format)
+	}
+
+	path := *out
+	if path == "" {
+		path = fmt.Sprintf("%s.%s.%s", *eventType, usedLocale, *format)
+	}
+	if err := os.WriteFile(path, output, 0o644); err != nil {
+		log.Fatalf("❌ Failed to write preview: %v", err)
+	}
+
+	fmt.Printf("✅ %s (%s): %q written to %s\n", *eventType, usedLocale, rendered.Subject, path)
+}
+
+func loadData(registry *templates.Registry, eventType, dataFile string) (map[string]any, error) {
+	if dataFile == "" {
+		return registry.SampleData(eventType)
+	}
+
+	raw, err := os.ReadFile(dataFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("%s: %w", dataFile, err)
+	}
+	return data, nil
+}
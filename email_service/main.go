@@ -1,96 +1,95 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/joho/godotenv"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/tird4d/go-microservices/email_service/notifications"
+	"github.com/tird4d/go-microservices/email_service/sender"
+	"github.com/tird4d/go-microservices/email_service/templates"
+	"github.com/tird4d/go-microservices/events"
+	"github.com/tird4d/go-microservices/events/subscriber"
 )
 
-type UserRegisteredEvent struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Name   string `json:"name"`
-}
-
 func main() {
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatal("⚠️ Error loading .env file")
+		log.Println("⚠️ Error loading .env file")
 	}
 
-	rabbitMQAddr := os.Getenv("RABBITMQ_CONNECTION_STRING")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	conn, err := amqp.Dial(rabbitMQAddr)
+	// ============ EMAIL DELIVERY ============
+	baseSender, err := sender.FromEnv()
 	if err != nil {
-		log.Fatalf("❌ Failed to connect to RabbitMQ: %v", err)
+		log.Fatalf("❌ Failed to configure email sender: %v", err)
 	}
-	defer conn.Close()
 
-	ch, err := conn.Channel()
-	if err != nil {
-		log.Fatalf("❌ Failed to open channel: %v", err)
+	failureLog := os.Getenv("EMAIL_FAILURE_LOG")
+	if failureLog == "" {
+		failureLog = "failed_emails.jsonl"
 	}
-	defer ch.Close()
-
-	err = ch.ExchangeDeclare(
-		"user_exchange",
-		"fanout",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+	failures, err := sender.NewFileFailureRecorder(failureLog)
 	if err != nil {
-		log.Fatalf("❌ Failed to declare exchange: %v", err)
+		log.Fatalf("❌ Failed to open email failure log: %v", err)
 	}
 
-	q, err := ch.QueueDeclare(
-		"",    // zufälliger Queue-Name
-		false, // nicht dauerhaft
-		true,  // automatisch löschen
-		true,  // exklusiv
-		false, // no-wait
-		nil,
-	)
-	if err != nil {
-		log.Fatalf("❌ Failed to declare queue: %v", err)
+	from := os.Getenv("EMAIL_FROM")
+	if from == "" {
+		from = "Go Microservices <no-reply@go-microservices.local>"
 	}
 
-	err = ch.QueueBind(
-		q.Name,
-		"",
-		"user_exchange",
-		false,
-		nil,
-	)
+	registry, err := templates.Default()
 	if err != nil {
-		log.Fatalf("❌ Failed to bind queue: %v", err)
+		log.Fatalf("❌ Failed to load email templates: %v", err)
 	}
 
-	msgs, err := ch.Consume(
-		q.Name,
-		"",
-		true,  // auto-ack
-		true,  // exclusive
-		false, // no-local
-		false, // no-wait
-		nil,
-	)
-	if err != nil {
-		log.Fatalf("❌ Failed to register consumer: %v", err)
+	notifier := &notifications.Notifier{
+		Sender:    sender.NewRetryingSender(baseSender, sender.RetryConfig{}, failures),
+		Templates: registry,
+		From:      from,
 	}
 
+	// ============ USER EVENTS ============
+	// Registrations get a welcome email, updates an account-change notice.
+	// The queue is durable so users who register or change their account
+	// while the service is down still get their email; messages that keep
+	// failing end up on the queue's dead-letter exchange.
+	userEvents := subscriber.New(subscriber.Config{
+		URL:          os.Getenv("RABBITMQ_CONNECTION_STRING"),
+		Exchange:     events.UserExchange,
+		ExchangeType: events.UserExchangeKind,
+		Queue:        "email_service.user_events",
+		BindingKeys:  []string{events.UserRegistered, events.UserUpdated},
+		// One email at a time, the sender already retries each one
+		Prefetch: 1,
+		Log:      stdLogger{},
+	}, func(ctx context.Context, msg amqp.Delivery) error {
+		return notifier.Handle(ctx, msg.Body)
+	})
+
 	log.Println("📩 Waiting for events...")
-	for msg := range msgs {
-		var event UserRegisteredEvent
-		if err := json.Unmarshal(msg.Body, &event); err != nil {
-			log.Println("⚠️ Failed to parse message:", err)
-			continue
-		}
-			log.Printf("📨 New user registered! Sending welcome email to %s <%s>\n", event.Name, event.Email)
-	}
+	userEvents.Run(ctx)
+	log.Println("Shutting down")
+}
+
+// stdLogger logs the subscriber's structured messages through the standard logger
+type stdLogger struct{}
+
+func (stdLogger) Infow(msg string, keysAndValues ...interface{}) {
+	log.Println(append([]interface{}{msg}, keysAndValues...)...)
+}
+
+func (stdLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	log.Println(append([]interface{}{msg}, keysAndValues...)...)
+}
+
+func (stdLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	log.Println(append([]interface{}{msg}, keysAndValues...)...)
 }
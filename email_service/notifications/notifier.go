@@ -0,0 +1,104 @@
+// Package notifications turns domain events into emails
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/tird4d/go-microservices/email_service/sender"
+	"github.com/tird4d/go-microservices/email_service/templates"
+	"github.com/tird4d/go-microservices/events"
+	"github.com/tird4d/go-microservices/events/subscriber"
+)
+
+// Notifier renders the template registered for an event and sends it
+type Notifier struct {
+	Sender    sender.Sender
+	Templates *templates.Registry
+	From      string
+}
+
+// Handle sends the email for a user_exchange message. A plain error means
+// the message should be redelivered later. Malformed events and events
+// without a template can't be handled by retrying and are returned as
+// subscriber.Permanent errors, so they go to the dead-letter exchange.
+// Permanently failed sends were recorded by the sender and are dropped.
+func (n *Notifier) Handle(ctx context.Context, body []byte) error {
+	env, err := events.Decode(body)
+	if err != nil {
+		return subscriber.Permanent(err)
+	}
+	ctx = env.Context(ctx)
+
+	switch env.Type {
+	case events.UserRegistered:
+		event, err := events.DecodePayload[events.UserRegisteredEvent](env)
+		if err != nil {
+			return subscriber.Permanent(err)
+		}
+		log.Printf("📨 New user registered! Sending welcome email to %s <%s>\n", event.Name, event.Email)
+		return n.Notify(ctx, env.Type, event.Locale, event.Email, welcomeData{
+			Name:  displayName(event.Name, event.Email),
+			Email: event.Email,
+		})
+
+	case events.UserUpdated:
+		event, err := events.DecodePayload[events.UserUpdatedEvent](env)
+		if err != nil {
+			return subscriber.Permanent(err)
+		}
+		return n.Notify(ctx, env.Type, event.Locale, event.Email, accountChangedData{
+			Name:          displayName(event.Name, event.Email),
+			Email:         event.Email,
+			ChangedFields: event.ChangedFields,
+		})
+
+	default:
+		log.Printf("⚠️ No email for event type %s", env.Type)
+		return nil
+	}
+}
+
+// Notify renders the template for eventType in the recipient's locale and sends it
+func (n *Notifier) Notify(ctx context.Context, eventType, locale, to string, data any) error {
+	rendered, err := n.Templates.Render(eventType, locale, data)
+	if err != nil {
+		return subscriber.Permanent(fmt.Errorf("render %s email: %w", eventType, err))
+	}
+
+	err = n.Sender.Send(ctx, sender.Message{
+		From:    n.From,
+		To:      []string{to},
+		Subject: rendered.Subject,
+		Text:    rendered.Text,
+		HTML:    rendered.HTML,
+	})
+	if err != nil {
+		if sender.IsPermanent(err) {
+			return nil
+		}
+		return err
+	}
+
+	log.Printf("✅ %s email sent to %s", eventType, to)
+	return nil
+}
+
+type welcomeData struct {
+	Name  string
+	Email string
+}
+
+type accountChangedData struct {
+	Name          string
+	Email         string
+	ChangedFields []string
+}
+
+func displayName(name, email string) string {
+	if name != "" {
+		return name
+	}
+	return email
+}
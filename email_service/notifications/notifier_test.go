@@ -0,0 +1,95 @@
+package notifications
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/email_service/sender"
+	"github.com/tird4d/go-microservices/email_service/templates"
+	"github.com/tird4d/go-microservices/events"
+	"github.com/tird4d/go-microservices/events/subscriber"
+)
+
+func newNotifier(t *testing.T, s sender.Sender) *Notifier {
+	t.Helper()
+
+	registry, err := templates.Default()
+	require.NoError(t, err)
+
+	return &Notifier{Sender: s, Templates: registry, From: "no-reply@example.com"}
+}
+
+func encode(t *testing.T, payload events.Payload) []byte {
+	t.Helper()
+
+	body, err := events.Encode(context.Background(), payload)
+	require.NoError(t, err)
+	return body
+}
+
+func TestHandle_UserRegisteredSendsWelcomeEmail(t *testing.T) {
+	mail := sender.NewMemorySender()
+	n := newNotifier(t, mail)
+
+	require.NoError(t, n.Handle(context.Background(), encode(t, events.UserRegisteredEvent{UserID: "u1", Email: "jane@example.com", Name: "Jane", UserVersion: 1})))
+
+	sent := mail.Sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, []string{"jane@example.com"}, sent[0].To)
+	assert.Contains(t, sent[0].Subject, "Welcome")
+	assert.Contains(t, sent[0].Text, "Hi Jane")
+	assert.Contains(t, sent[0].HTML, "<h1")
+}
+
+func TestHandle_UsesPreferredLocale(t *testing.T) {
+	mail := sender.NewMemorySender()
+	n := newNotifier(t, mail)
+
+	require.NoError(t, n.Handle(context.Background(), encode(t, events.UserRegisteredEvent{UserID: "u1", Email: "jan@example.com", Name: "Jan", Locale: "de-AT", UserVersion: 1})))
+
+	sent := mail.Sent()
+	require.Len(t, sent, 1)
+	assert.Contains(t, sent[0].Subject, "Willkommen")
+}
+
+func TestHandle_UserUpdatedSendsAccountChangeEmail(t *testing.T) {
+	mail := sender.NewMemorySender()
+	n := newNotifier(t, mail)
+
+	require.NoError(t, n.Handle(context.Background(), encode(t, events.UserUpdatedEvent{UserID: "u1", Email: "new@example.com", Name: "Jane", ChangedFields: []string{"email"}, UserVersion: 2})))
+
+	sent := mail.Sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, []string{"new@example.com"}, sent[0].To)
+	assert.Contains(t, sent[0].Text, "email")
+}
+
+func TestHandle_IgnoresEventsWithoutEmail(t *testing.T) {
+	mail := sender.NewMemorySender()
+	n := newNotifier(t, mail)
+
+	require.NoError(t, n.Handle(context.Background(), encode(t, events.UserDeletedEvent{UserID: "u1", UserVersion: 3})))
+
+	assert.Empty(t, mail.Sent())
+}
+
+func TestHandle_MalformedEventsAreDeadLettered(t *testing.T) {
+	mail := sender.NewMemorySender()
+	n := newNotifier(t, mail)
+
+	err := n.Handle(context.Background(), []byte(`{"user_id":"u1"}`))
+
+	assert.True(t, subscriber.IsPermanent(err), "retrying can't fix a malformed event")
+	assert.Empty(t, mail.Sent())
+}
+
+func TestHandle_PermanentSendFailureIsNotRequeued(t *testing.T) {
+	n := newNotifier(t, sender.NewMemorySender())
+
+	// An invalid address fails validation permanently
+	err := n.Handle(context.Background(), encode(t, events.UserRegisteredEvent{UserID: "u1", Email: "not an address", UserVersion: 1}))
+
+	assert.NoError(t, err)
+}
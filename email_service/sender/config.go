@@ -0,0 +1,49 @@
+package sender
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// FromEnv builds the Sender selected by EMAIL_SENDER:
+//
+//	smtp   - SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, SMTP_TLS (starttls|tls|none), SMTP_INSECURE_SKIP_VERIFY
+//	file   - writes .eml files to EMAIL_FILE_DIR (default ./mail)
+//	memory - keeps messages in memory
+//
+// The default is file, so local runs never send real mail by accident.
+func FromEnv() (Sender, error) {
+	switch kind := os.Getenv("EMAIL_SENDER"); kind {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp sender")
+		}
+		tlsMode := os.Getenv("SMTP_TLS")
+		switch tlsMode {
+		case "", TLSStartTLS, TLSImplicit, TLSNone:
+		default:
+			return nil, fmt.Errorf("unknown SMTP_TLS %q", tlsMode)
+		}
+		insecure, _ := strconv.ParseBool(os.Getenv("SMTP_INSECURE_SKIP_VERIFY"))
+		return NewSMTPSender(SMTPConfig{
+			Host:               host,
+			Port:               os.Getenv("SMTP_PORT"),
+			Username:           os.Getenv("SMTP_USERNAME"),
+			Password:           os.Getenv("SMTP_PASSWORD"),
+			TLS:                tlsMode,
+			InsecureSkipVerify: insecure,
+		}), nil
+	case "", "file":
+		dir := os.Getenv("EMAIL_FILE_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return NewFileSender(dir)
+	case "memory":
+		return NewMemorySender(), nil
+	default:
+		return nil, fmt.Errorf("unknown EMAIL_SENDER %q", kind)
+	}
+}
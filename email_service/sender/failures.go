@@ -0,0 +1,76 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Failure describes a message that could not be delivered
+type Failure struct {
+	To       []string  `json:"to"`
+	Subject  string    `json:"subject"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// FailureRecorder keeps undeliverable messages for inspection
+type FailureRecorder interface {
+	Record(ctx context.Context, failure Failure) error
+}
+
+// FileFailureRecorder appends failures as JSON lines to a file
+type FileFailureRecorder struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileFailureRecorder(path string) (*FileFailureRecorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return &FileFailureRecorder{path: path}, nil
+}
+
+func (r *FileFailureRecorder) Record(ctx context.Context, failure Failure) error {
+	line, err := json.Marshal(failure)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// MemoryFailureRecorder keeps failures in memory, for tests
+type MemoryFailureRecorder struct {
+	mu       sync.Mutex
+	failures []Failure
+}
+
+func (r *MemoryFailureRecorder) Record(ctx context.Context, failure Failure) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, failure)
+	return nil
+}
+
+// Failures returns a copy of the recorded failures
+func (r *MemoryFailureRecorder) Failures() []Failure {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Failure(nil), r.failures...)
+}
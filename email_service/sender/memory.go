@@ -0,0 +1,34 @@
+package sender
+
+import (
+	"context"
+	"sync"
+)
+
+// MemorySender keeps sent messages in memory, for tests
+type MemorySender struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(ctx context.Context, msg Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+// Sent returns a copy of the messages sent so far
+func (s *MemorySender) Sent() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.sent...)
+}
@@ -0,0 +1,96 @@
+package sender
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RetryConfig controls how RetryingSender backs off between attempts
+type RetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// RetryingSender retries transient send errors with exponential backoff.
+// When a message fails permanently or runs out of attempts it is handed to
+// the FailureRecorder and the error is returned as permanent.
+type RetryingSender struct {
+	next     Sender
+	cfg      RetryConfig
+	failures FailureRecorder
+}
+
+func NewRetryingSender(next Sender, cfg RetryConfig, failures FailureRecorder) *RetryingSender {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 1 * time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	return &RetryingSender{next: next, cfg: cfg, failures: failures}
+}
+
+// Send returns nil once the message was delivered. A cancelled ctx stops
+// retrying and returns the context error without recording a failure.
+func (s *RetryingSender) Send(ctx context.Context, msg Message) error {
+	var err error
+	attempt := 0
+
+	for attempt < s.cfg.MaxAttempts {
+		attempt++
+
+		err = s.next.Send(ctx, msg)
+		if err == nil {
+			return nil
+		}
+		if IsPermanent(err) || attempt == s.cfg.MaxAttempts {
+			break
+		}
+
+		delay := s.backoff(attempt)
+		log.Printf("⚠️ Sending email to %v failed (attempt %d/%d), retrying in %s: %v", msg.To, attempt, s.cfg.MaxAttempts, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	log.Printf("❌ Giving up on email to %v after %d attempt(s): %v", msg.To, attempt, err)
+
+	failure := Failure{
+		To:       msg.To,
+		Subject:  msg.Subject,
+		Error:    err.Error(),
+		Attempts: attempt,
+		FailedAt: time.Now().UTC(),
+	}
+	if recordErr := s.failures.Record(ctx, failure); recordErr != nil {
+		// Not recorded: let the caller retry the whole message later
+		return recordErr
+	}
+
+	return Permanent(err)
+}
+
+// backoff doubles InitialBackoff per attempt, capped at MaxBackoff
+func (s *RetryingSender) backoff(attempt int) time.Duration {
+	delay := s.cfg.InitialBackoff
+	for i := 1; i < attempt && delay < s.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.cfg.MaxBackoff {
+		delay = s.cfg.MaxBackoff
+	}
+	return delay
+}
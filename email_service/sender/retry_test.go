@@ -0,0 +1,102 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakySender fails with errs in order, then succeeds
+type flakySender struct {
+	errs  []error
+	calls int
+}
+
+func (s *flakySender) Send(ctx context.Context, msg Message) error {
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	return nil
+}
+
+var fastRetry = RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+func TestRetryingSender_RetriesTransientErrors(t *testing.T) {
+	next := &flakySender{errs: []error{errors.New("timeout"), errors.New("timeout")}}
+	failures := &MemoryFailureRecorder{}
+
+	err := NewRetryingSender(next, fastRetry, failures).Send(context.Background(), testMessage())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, next.calls)
+	assert.Empty(t, failures.Failures())
+}
+
+func TestRetryingSender_RecordsPermanentFailureWithoutRetrying(t *testing.T) {
+	next := &flakySender{errs: []error{Permanent(errors.New("550 no such user"))}}
+	failures := &MemoryFailureRecorder{}
+
+	err := NewRetryingSender(next, fastRetry, failures).Send(context.Background(), testMessage())
+
+	assert.True(t, IsPermanent(err))
+	assert.Equal(t, 1, next.calls)
+	require.Len(t, failures.Failures(), 1)
+	assert.Equal(t, []string{"jane@example.com"}, failures.Failures()[0].To)
+	assert.Equal(t, 1, failures.Failures()[0].Attempts)
+}
+
+func TestRetryingSender_RecordsFailureAfterLastAttempt(t *testing.T) {
+	next := &flakySender{errs: []error{errors.New("a"), errors.New("b"), errors.New("c"), errors.New("d")}}
+	failures := &MemoryFailureRecorder{}
+
+	err := NewRetryingSender(next, fastRetry, failures).Send(context.Background(), testMessage())
+
+	assert.True(t, IsPermanent(err))
+	assert.Equal(t, 3, next.calls)
+	require.Len(t, failures.Failures(), 1)
+	assert.Equal(t, "c", failures.Failures()[0].Error)
+}
+
+func TestRetryingSender_StopsWhenContextIsCancelled(t *testing.T) {
+	next := &flakySender{errs: []error{errors.New("timeout")}}
+	failures := &MemoryFailureRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := NewRetryingSender(next, RetryConfig{MaxAttempts: 3, InitialBackoff: time.Hour}, failures).Send(ctx, testMessage())
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, failures.Failures())
+}
+
+func TestRetryingSender_Backoff(t *testing.T) {
+	s := NewRetryingSender(nil, RetryConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}, nil)
+
+	assert.Equal(t, 1*time.Second, s.backoff(1))
+	assert.Equal(t, 2*time.Second, s.backoff(2))
+	assert.Equal(t, 4*time.Second, s.backoff(3))
+	assert.Equal(t, 5*time.Second, s.backoff(10))
+}
+
+func TestFileFailureRecorder_AppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failures", "failed.jsonl")
+	r, err := NewFileFailureRecorder(path)
+	require.NoError(t, err)
+
+	require.NoError(t, r.Record(context.Background(), Failure{To: []string{"a@b.c"}, Error: "boom"}))
+	require.NoError(t, r.Record(context.Background(), Failure{To: []string{"d@e.f"}, Error: "bang"}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+}
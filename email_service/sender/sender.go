@@ -0,0 +1,33 @@
+// Package sender delivers email messages. Sender has an SMTP implementation
+// for real delivery and file/in-memory sinks for local runs and tests.
+package sender
+
+import (
+	"context"
+	"errors"
+)
+
+// Sender delivers a single message
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a send error that retrying can't fix, e.g. a rejected
+// recipient or bad credentials
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
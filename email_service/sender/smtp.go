@@ -0,0 +1,166 @@
+package sender
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+// TLS modes for SMTPConfig.TLS
+const (
+	TLSNone     = "none"     // plain connection, only for local test servers
+	TLSStartTLS = "starttls" // upgrade with STARTTLS, usually port 587
+	TLSImplicit = "tls"      // TLS from the first byte, usually port 465
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	TLS      string
+	// InsecureSkipVerify disables certificate checks, for self-signed dev servers only
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+}
+
+// SMTPSender sends every message over a new SMTP connection
+type SMTPSender struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPSender(cfg SMTPConfig) *SMTPSender {
+	if cfg.Port == "" {
+		cfg.Port = "587"
+	}
+	if cfg.TLS == "" {
+		cfg.TLS = TLSStartTLS
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return &SMTPSender{cfg: cfg}
+}
+
+// Send delivers msg. 5xx replies from the server are permanent, everything
+// else (connection errors, 4xx replies) can be retried.
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+
+	body, err := msg.Bytes()
+	if err != nil {
+		return Permanent(fmt.Errorf("render message: %w", err))
+	}
+
+	client, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := s.authenticate(client); err != nil {
+		return err
+	}
+
+	if err := client.Mail(msg.From); err != nil {
+		return classify("MAIL FROM", err)
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return classify("RCPT TO", err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return classify("DATA", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return classify("DATA", err)
+	}
+	if err := w.Close(); err != nil {
+		return classify("DATA", err)
+	}
+
+	// The message is accepted once DATA is closed, a failing QUIT doesn't matter
+	_ = client.Quit()
+	return nil
+}
+
+func (s *SMTPSender) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.cfg.Host, s.cfg.Port)
+	tlsConfig := &tls.Config{ServerName: s.cfg.Host, InsecureSkipVerify: s.cfg.InsecureSkipVerify}
+	dialer := &net.Dialer{Timeout: s.cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+	if s.cfg.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", addr, err)
+	}
+
+	deadline := time.Now().Add(s.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, classify("greeting", err)
+	}
+
+	if s.cfg.TLS == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, Permanent(fmt.Errorf("%s does not support STARTTLS", addr))
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, classify("STARTTLS", err)
+		}
+	}
+
+	return client, nil
+}
+
+func (s *SMTPSender) authenticate(client *smtp.Client) error {
+	if s.cfg.Username == "" {
+		return nil
+	}
+	if ok, _ := client.Extension("AUTH"); !ok {
+		return Permanent(errors.New("server does not support AUTH"))
+	}
+	if err := client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+		// Bad credentials and refusing to send them unencrypted are both config problems
+		var tpErr *textproto.Error
+		if errors.As(err, &tpErr) && tpErr.Code < 500 {
+			return fmt.Errorf("AUTH: %w", err)
+		}
+		return Permanent(fmt.Errorf("AUTH: %w", err))
+	}
+	return nil
+}
+
+// classify marks 5xx SMTP replies as permanent
+func classify(step string, err error) error {
+	err = fmt.Errorf("%s: %w", step, err)
+
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
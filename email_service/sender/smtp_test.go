@@ -0,0 +1,140 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMessage() Message {
+	return Message{
+		From:    "no-reply@example.com",
+		To:      []string{"jane@example.com"},
+		Subject: "Welcome, Jäne",
+		Text:    "Hi Jane,\n\nwelcome!\n",
+	}
+}
+
+func TestSMTPSender_DeliversMessage(t *testing.T) {
+	server := newTestSMTPServer(t)
+	s := NewSMTPSender(SMTPConfig{
+		Host:     "localhost",
+		Port:     server.Port(),
+		Username: "user",
+		Password: "secret",
+		TLS:      TLSNone,
+		Timeout:  5 * time.Second,
+	})
+
+	err := s.Send(context.Background(), testMessage())
+
+	require.NoError(t, err)
+	messages := server.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "To: jane@example.com")
+	assert.Contains(t, messages[0], "Subject: =?utf-8?q?Welcome,_J=C3=A4ne?=")
+	assert.Contains(t, messages[0], "welcome!")
+	assert.Len(t, server.auth, 1)
+}
+
+func TestSMTPSender_RejectedRecipientIsPermanent(t *testing.T) {
+	server := newTestSMTPServer(t)
+	server.rcptReply = "550 No such user"
+	s := NewSMTPSender(SMTPConfig{Host: "localhost", Port: server.Port(), TLS: TLSNone})
+
+	err := s.Send(context.Background(), testMessage())
+
+	assert.Error(t, err)
+	assert.True(t, IsPermanent(err))
+}
+
+func TestSMTPSender_TemporaryRejectionIsRetryable(t *testing.T) {
+	server := newTestSMTPServer(t)
+	server.rcptReply = "451 Try again later"
+	s := NewSMTPSender(SMTPConfig{Host: "localhost", Port: server.Port(), TLS: TLSNone})
+
+	err := s.Send(context.Background(), testMessage())
+
+	assert.Error(t, err)
+	assert.False(t, IsPermanent(err))
+}
+
+func TestSMTPSender_StartTLSRequiredButUnsupported(t *testing.T) {
+	server := newTestSMTPServer(t)
+	s := NewSMTPSender(SMTPConfig{Host: "localhost", Port: server.Port(), TLS: TLSStartTLS})
+
+	err := s.Send(context.Background(), testMessage())
+
+	assert.True(t, IsPermanent(err))
+	assert.Empty(t, server.Messages())
+}
+
+func TestSMTPSender_ConnectionRefusedIsRetryable(t *testing.T) {
+	server := newTestSMTPServer(t)
+	port := server.Port()
+	server.listener.Close()
+
+	s := NewSMTPSender(SMTPConfig{Host: "localhost", Port: port, TLS: TLSNone, Timeout: time.Second})
+	err := s.Send(context.Background(), testMessage())
+
+	assert.Error(t, err)
+	assert.False(t, IsPermanent(err))
+}
+
+func TestMessage_ValidateRejectsBadAddresses(t *testing.T) {
+	msg := testMessage()
+	msg.To = []string{"not an address"}
+
+	assert.True(t, IsPermanent(msg.Validate()))
+	assert.True(t, IsPermanent(Message{From: "a@b.c"}.Validate()))
+}
+
+func TestFileSender_WritesEMLFile(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileSender(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Send(context.Background(), testMessage()))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.True(t, strings.HasSuffix(entries[0].Name(), ".eml"))
+}
+
+func TestMessage_BytesWithHTMLIsMultipartAlternative(t *testing.T) {
+	msg := testMessage()
+	msg.HTML = "<p>Hi Jane, <strong>welcome!</strong></p>"
+
+	raw, err := msg.Bytes()
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+	assert.Equal(t, []string{`text/plain; charset="utf-8"`, `text/html; charset="utf-8"`}, types)
+}
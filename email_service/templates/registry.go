@@ -0,0 +1,238 @@
+// Package templates renders email subjects and bodies. Templates are keyed
+// by the event type that triggers the email and by locale; a consumer for a
+// new event only needs to add a template directory.
+//
+// Embedded templates live in files/<event type>/<locale>/ with:
+//
+//	subject.txt  - text/template, one line
+//	body.txt     - text/template, plain-text part
+//	body.html    - html/template, defines "content" inside files/layout.html
+//
+// files/<event type>/sample.json holds sample data for tests and the preview command.
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed files
+var embedded embed.FS
+
+// DefaultLocale is used when neither the preferred locale nor its base language has a template
+const DefaultLocale = "en"
+
+// ErrNoTemplate means no template is registered for the event type in any fallback locale
+var ErrNoTemplate = errors.New("no email template")
+
+// Template is one localized email
+type Template struct {
+	Subject *texttemplate.Template
+	Text    *texttemplate.Template
+	HTML    *htmltemplate.Template
+}
+
+// Rendered is the output of a template, ready to be put into a message
+type Rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Registry holds templates by event type and locale
+type Registry struct {
+	defaultLocale string
+	templates     map[string]map[string]*Template
+	samples       map[string]json.RawMessage
+}
+
+func NewRegistry(defaultLocale string) *Registry {
+	return &Registry{
+		defaultLocale: normalizeLocale(defaultLocale),
+		templates:     make(map[string]map[string]*Template),
+		samples:       make(map[string]json.RawMessage),
+	}
+}
+
+// Default returns a registry with the embedded templates
+func Default() (*Registry, error) {
+	r := NewRegistry(DefaultLocale)
+	if err := r.LoadFS(embedded, "files"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Register adds or replaces the template for an event type and locale
+func (r *Registry) Register(eventType, locale string, t *Template) {
+	locale = normalizeLocale(locale)
+	if r.templates[eventType] == nil {
+		r.templates[eventType] = make(map[string]*Template)
+	}
+	r.templates[eventType][locale] = t
+}
+
+// LoadFS registers every <event type>/<locale>/ directory under root
+func (r *Registry) LoadFS(fsys fs.FS, root string) error {
+	layout, err := fs.ReadFile(fsys, path.Join(root, "layout.html"))
+	if err != nil {
+		return fmt.Errorf("read layout: %w", err)
+	}
+
+	eventDirs, err := fs.ReadDir(fsys, root)
+	if err != nil {
+		return err
+	}
+
+	for _, eventDir := range eventDirs {
+		if !eventDir.IsDir() {
+			continue
+		}
+		eventType := eventDir.Name()
+		eventPath := path.Join(root, eventType)
+
+		if sample, err := fs.ReadFile(fsys, path.Join(eventPath, "sample.json")); err == nil {
+			r.samples[eventType] = sample
+		}
+
+		localeDirs, err := fs.ReadDir(fsys, eventPath)
+		if err != nil {
+			return err
+		}
+		for _, localeDir := range localeDirs {
+			if !localeDir.IsDir() {
+				continue
+			}
+			t, err := parseTemplate(fsys, path.Join(eventPath, localeDir.Name()), string(layout))
+			if err != nil {
+				return fmt.Errorf("%s/%s: %w", eventType, localeDir.Name(), err)
+			}
+			r.Register(eventType, localeDir.Name(), t)
+		}
+	}
+
+	return nil
+}
+
+func parseTemplate(fsys fs.FS, dir, layout string) (*Template, error) {
+	read := func(name string) (string, error) {
+		b, err := fs.ReadFile(fsys, path.Join(dir, name))
+		return string(b), err
+	}
+
+	subject, err := read("subject.txt")
+	if err != nil {
+		return nil, err
+	}
+	text, err := read("body.txt")
+	if err != nil {
+		return nil, err
+	}
+	html, err := read("body.html")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Template{}
+	if t.Subject, err = texttemplate.New("subject").Option("missingkey=error").Parse(strings.TrimSpace(subject)); err != nil {
+		return nil, err
+	}
+	if t.Text, err = texttemplate.New("text").Option("missingkey=error").Parse(text); err != nil {
+		return nil, err
+	}
+	if t.HTML, err = htmltemplate.New("layout").Option("missingkey=error").Parse(layout); err != nil {
+		return nil, err
+	}
+	if _, err = t.HTML.Parse(html); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Has reports whether any locale of eventType is registered
+func (r *Registry) Has(eventType string) bool {
+	return len(r.templates[eventType]) > 0
+}
+
+// Lookup finds the template for eventType in the first available locale of:
+// the preferred locale, its base language ("de-AT" -> "de") and the default.
+// It also returns the locale that was picked.
+func (r *Registry) Lookup(eventType, locale string) (*Template, string, error) {
+	byLocale := r.templates[eventType]
+
+	for _, candidate := range fallbackLocales(normalizeLocale(locale), r.defaultLocale) {
+		if t, ok := byLocale[candidate]; ok {
+			return t, candidate, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("%w for %s", ErrNoTemplate, eventType)
+}
+
+// Render executes the template for eventType in the best matching locale
+func (r *Registry) Render(eventType, locale string, data any) (*Rendered, error) {
+	t, _, err := r.Lookup(eventType, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := t.Subject.Execute(&subject, data); err != nil {
+		return nil, fmt.Errorf("render %s subject: %w", eventType, err)
+	}
+	if err := t.Text.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("render %s text: %w", eventType, err)
+	}
+	if err := t.HTML.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("render %s html: %w", eventType, err)
+	}
+
+	return &Rendered{Subject: subject.String(), Text: text.String(), HTML: html.String()}, nil
+}
+
+// SampleData returns the sample data shipped with an event type's templates
+func (r *Registry) SampleData(eventType string) (map[string]any, error) {
+	raw, ok := r.samples[eventType]
+	if !ok {
+		return nil, fmt.Errorf("no sample data for %s", eventType)
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("sample data for %s: %w", eventType, err)
+	}
+	return data, nil
+}
+
+// EventTypes lists the event types that have templates
+func (r *Registry) EventTypes() []string {
+	types := make([]string, 0, len(r.templates))
+	for eventType := range r.templates {
+		types = append(types, eventType)
+	}
+	return types
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+func fallbackLocales(locale, defaultLocale string) []string {
+	var candidates []string
+	if locale != "" {
+		candidates = append(candidates, locale)
+		if base, _, found := strings.Cut(locale, "-"); found {
+			candidates = append(candidates, base)
+		}
+	}
+	return append(candidates, defaultLocale)
+}
@@ -0,0 +1,97 @@
+package templates
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefault_AllTemplatesRenderWithSampleData(t *testing.T) {
+	r, err := Default()
+	require.NoError(t, err)
+	require.NotEmpty(t, r.EventTypes())
+
+	for eventType, byLocale := range r.templates {
+		data, err := r.SampleData(eventType)
+		require.NoError(t, err, eventType)
+
+		for locale := range byLocale {
+			rendered, err := r.Render(eventType, locale, data)
+			require.NoError(t, err, "%s/%s", eventType, locale)
+			assert.NotEmpty(t, rendered.Subject, "%s/%s", eventType, locale)
+			assert.NotEmpty(t, rendered.Text, "%s/%s", eventType, locale)
+			assert.Contains(t, rendered.HTML, "<html>", "%s/%s", eventType, locale)
+		}
+	}
+}
+
+func TestLookup_LocaleFallback(t *testing.T) {
+	r, err := Default()
+	require.NoError(t, err)
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"de", "de"},
+		{"de-AT", "de"},
+		{"de_CH", "de"},
+		{"fr-FR", DefaultLocale},
+		{"", DefaultLocale},
+	}
+	for _, tt := range tests {
+		_, got, err := r.Lookup("user.registered", tt.locale)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, tt.locale)
+	}
+}
+
+func TestLookup_UnknownEventType(t *testing.T) {
+	r, err := Default()
+	require.NoError(t, err)
+
+	_, _, err = r.Lookup("payment.refunded", "en")
+
+	assert.ErrorIs(t, err, ErrNoTemplate)
+	assert.False(t, r.Has("payment.refunded"))
+}
+
+func TestRender_EscapesHTMLButNotText(t *testing.T) {
+	r, err := Default()
+	require.NoError(t, err)
+
+	rendered, err := r.Render("user.registered", "en", map[string]any{"Name": "<b>Jane</b>", "Email": "jane@example.com"})
+	require.NoError(t, err)
+
+	assert.Contains(t, rendered.HTML, "&lt;b&gt;Jane&lt;/b&gt;")
+	assert.Contains(t, rendered.Text, "<b>Jane</b>")
+}
+
+func TestRender_MissingFieldIsAnError(t *testing.T) {
+	r, err := Default()
+	require.NoError(t, err)
+
+	_, err = r.Render("user.registered", "en", map[string]any{"Email": "jane@example.com"})
+
+	assert.Error(t, err)
+}
+
+func TestLoadFS_RegistersNewEventType(t *testing.T) {
+	fsys := fstest.MapFS{
+		"t/layout.html":                     {Data: []byte(`<html>{{template "content" .}}</html>`)},
+		"t/payment.refunded/en/subject.txt": {Data: []byte("Refund of {{.Amount}}")},
+		"t/payment.refunded/en/body.txt":    {Data: []byte("We refunded {{.Amount}}.")},
+		"t/payment.refunded/en/body.html":   {Data: []byte(`{{define "content"}}<p>We refunded {{.Amount}}.</p>{{end}}`)},
+		"t/payment.refunded/sample.json":    {Data: []byte(`{"Amount":"10.00"}`)},
+	}
+
+	r := NewRegistry("en")
+	require.NoError(t, r.LoadFS(fsys, "t"))
+
+	rendered, err := r.Render("payment.refunded", "en", map[string]any{"Amount": "10.00"})
+	require.NoError(t, err)
+	assert.Equal(t, "Refund of 10.00", rendered.Subject)
+	assert.Equal(t, "<html><p>We refunded 10.00.</p></html>", rendered.HTML)
+}
@@ -0,0 +1,140 @@
+// Package events defines the envelope and payloads of every message the
+// services exchange over RabbitMQ. Producers and consumers both import it,
+// so a payload change is a compile error instead of a silently dropped field.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var (
+	// ErrInvalidEnvelope means the message isn't an envelope or misses a required field
+	ErrInvalidEnvelope = errors.New("invalid event envelope")
+	// ErrTypeMismatch means the envelope holds a different event type than requested
+	ErrTypeMismatch = errors.New("event type mismatch")
+	// ErrIncompatibleVersion means the payload schema version isn't the one this build understands
+	ErrIncompatibleVersion = errors.New("incompatible event schema version")
+)
+
+// Payload is implemented by every event body. SchemaVersion is bumped only
+// for breaking changes; adding an optional field keeps the version.
+type Payload interface {
+	EventType() string
+	SchemaVersion() int
+}
+
+// Envelope wraps a payload with the metadata every consumer needs
+type Envelope struct {
+	EventID    string    `json:"event_id"`
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// TraceContext holds W3C trace headers (traceparent, tracestate) of the
+	// producing request so consumer spans join the same trace
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+	Payload      json.RawMessage   `json:"payload"`
+}
+
+// New wraps payload in an envelope with a fresh event ID and the trace
+// context of ctx
+func New(ctx context.Context, payload Payload) (*Envelope, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s payload: %w", payload.EventType(), err)
+	}
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	env := &Envelope{
+		EventID:    uuid.NewString(),
+		Type:       payload.EventType(),
+		Version:    payload.SchemaVersion(),
+		OccurredAt: time.Now().UTC(),
+		Payload:    body,
+	}
+	if len(carrier) > 0 {
+		env.TraceContext = carrier
+	}
+
+	return env, nil
+}
+
+// Encode wraps payload in a new envelope and marshals it
+func Encode(ctx context.Context, payload Payload) ([]byte, error) {
+	env, err := New(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(env)
+}
+
+// Decode unmarshals and validates an envelope without looking at the payload
+func Decode(data []byte) (*Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+
+	switch {
+	case env.EventID == "":
+		return nil, fmt.Errorf("%w: missing event_id", ErrInvalidEnvelope)
+	case env.Type == "":
+		return nil, fmt.Errorf("%w: missing type", ErrInvalidEnvelope)
+	case env.Version < 1:
+		return nil, fmt.Errorf("%w: missing version", ErrInvalidEnvelope)
+	case len(env.Payload) == 0:
+		return nil, fmt.Errorf("%w: missing payload", ErrInvalidEnvelope)
+	}
+
+	return &env, nil
+}
+
+// DecodePayload unmarshals the payload as T after checking that the envelope
+// holds a T with the schema version this build was compiled against
+func DecodePayload[T Payload](env *Envelope) (T, error) {
+	var payload T
+
+	if env.Type != payload.EventType() {
+		return payload, fmt.Errorf("%w: got %q, want %q", ErrTypeMismatch, env.Type, payload.EventType())
+	}
+
+	if !Compatible(env.Version, payload.SchemaVersion()) {
+		return payload, fmt.Errorf("%w: %s v%d, supported v%d", ErrIncompatibleVersion, env.Type, env.Version, payload.SchemaVersion())
+	}
+
+	if err := json.Unmarshal(env.Payload, &payload); err != nil {
+		return payload, fmt.Errorf("%w: %s payload: %v", ErrInvalidEnvelope, env.Type, err)
+	}
+
+	return payload, nil
+}
+
+// Compatible reports whether a consumer built for schema version supported can
+// read a payload written with version. Versions only change on breaking
+// changes, so they have to match.
+func Compatible(version, supported int) bool {
+	return version == supported
+}
+
+// IsDecodeError reports whether err came from Decode or DecodePayload.
+// Redelivering such a message won't help.
+func IsDecodeError(err error) bool {
+	return errors.Is(err, ErrInvalidEnvelope) || errors.Is(err, ErrTypeMismatch) || errors.Is(err, ErrIncompatibleVersion)
+}
+
+// Context returns ctx carrying the producer's trace context, if any
+func (e *Envelope) Context(ctx context.Context) context.Context {
+	if len(e.TraceContext) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(e.TraceContext))
+}
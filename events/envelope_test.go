@@ -0,0 +1,95 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestEncodeDecode_RoundTrip(t *testing.T) {
+	data, err := Encode(context.Background(), UserRegisteredEvent{UserID: "u1", Email: "a@b.c", Name: "A", UserVersion: 1})
+	require.NoError(t, err)
+
+	env, err := Decode(data)
+	require.NoError(t, err)
+	assert.NotEmpty(t, env.EventID)
+	assert.Equal(t, UserRegistered, env.Type)
+	assert.Equal(t, 1, env.Version)
+	assert.False(t, env.OccurredAt.IsZero())
+
+	event, err := DecodePayload[UserRegisteredEvent](env)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", event.UserID)
+	assert.Equal(t, "a@b.c", event.Email)
+}
+
+func TestDecode_RejectsNonEnvelopes(t *testing.T) {
+	for _, body := range []string{
+		`{not json`,
+		`{"user_id":"u1","email":"a@b.c"}`,
+		`{"event_id":"1","type":"user.registered","version":1}`,
+	} {
+		_, err := Decode([]byte(body))
+		assert.ErrorIs(t, err, ErrInvalidEnvelope, body)
+		assert.True(t, IsDecodeError(err))
+	}
+}
+
+func TestDecodePayload_TypeMismatch(t *testing.T) {
+	env, err := New(context.Background(), UserDeletedEvent{UserID: "u1", UserVersion: 2})
+	require.NoError(t, err)
+
+	_, err = DecodePayload[UserRegisteredEvent](env)
+
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+}
+
+func TestDecodePayload_IncompatibleVersion(t *testing.T) {
+	env, err := New(context.Background(), UserRegisteredEvent{UserID: "u1"})
+	require.NoError(t, err)
+	env.Version = 2
+
+	_, err = DecodePayload[UserRegisteredEvent](env)
+
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+	assert.True(t, IsDecodeError(err))
+}
+
+func TestEnvelope_PropagatesTraceContext(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(previous)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	data, err := Encode(ctx, UserRegisteredEvent{UserID: "u1"})
+	require.NoError(t, err)
+
+	var raw map[string]any
+	require.NoError(t, json.Unmarshal(data, &raw))
+	assert.Contains(t, raw, "trace_context")
+
+	env, err := Decode(data)
+	require.NoError(t, err)
+
+	consumerCtx := env.Context(context.Background())
+	assert.Equal(t, traceID, trace.SpanContextFromContext(consumerCtx).TraceID())
+}
+
+func TestCompatible(t *testing.T) {
+	assert.True(t, Compatible(1, 1))
+	assert.False(t, Compatible(2, 1))
+	assert.False(t, Compatible(1, 2))
+}
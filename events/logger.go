@@ -0,0 +1,9 @@
+package events
+
+// Logger is the part of *zap.SugaredLogger the outbox relay and publisher
+// and the subscriber log through, so each service passes its own
+type Logger interface {
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
@@ -0,0 +1,53 @@
+// Package outbox is the transactional outbox the services publish events
+// through: a service stores a Message in the same MongoDB transaction as the
+// change it describes, and a Relay publishes it to RabbitMQ afterwards.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/events"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusPublished = "published"
+)
+
+// Message is an event stored in the same transaction as the change it
+// describes. The relay publishes it to RabbitMQ afterwards.
+type Message struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	Exchange      string             `bson:"exchange"`
+	RoutingKey    string             `bson:"routing_key"`
+	EventType     string             `bson:"event_type"`
+	Payload       []byte             `bson:"payload"`
+	Status        string             `bson:"status"`
+	Attempts      int                `bson:"attempts"`
+	LastError     string             `bson:"last_error,omitempty"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	PublishedAt   *time.Time         `bson:"published_at,omitempty"`
+}
+
+// NewMessage wraps payload in an event envelope and builds a pending
+// message for it. The event type doubles as the routing key.
+func NewMessage(ctx context.Context, exchange string, payload events.Payload) (*Message, error) {
+	body, err := events.Encode(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Message{
+		Exchange:      exchange,
+		RoutingKey:    payload.EventType(),
+		EventType:     payload.EventType(),
+		Payload:       body,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}, nil
+}
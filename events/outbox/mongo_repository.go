@@ -0,0 +1,85 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// publishedRetention is how long published messages are kept for debugging
+const publishedRetention = 7 * 24 * time.Hour
+
+// Repository is what the relay needs from the stored messages
+type Repository interface {
+	// FindPending returns unpublished messages that are due, oldest first
+	FindPending(ctx context.Context, now time.Time, limit int64) ([]*Message, error)
+	MarkPublished(ctx context.Context, id primitive.ObjectID) error
+	// MarkFailed records a failed publish and when it should be retried
+	MarkFailed(ctx context.Context, id primitive.ObjectID, lastError string, nextAttemptAt time.Time) error
+}
+
+// MongoRepository keeps the messages in the service's outbox collection
+type MongoRepository struct {
+	Collection *mongo.Collection
+}
+
+// EnsureIndexes creates the index the relay polls on and a TTL index that
+// removes published messages. Pending messages have no published_at and are
+// never expired.
+func (r *MongoRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.Collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "published_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(publishedRetention.Seconds())),
+		},
+	})
+	return err
+}
+
+func (r *MongoRepository) FindPending(ctx context.Context, now time.Time, limit int64) ([]*Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"status":          StatusPending,
+		"next_attempt_at": bson.M{"$lte": now},
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := r.Collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var messages []*Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (r *MongoRepository) MarkPublished(ctx context.Context, id primitive.ObjectID) error {
+	now := time.Now()
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set":   bson.M{"status": StatusPublished, "published_at": now},
+		"$unset": bson.M{"last_error": ""},
+	})
+	return err
+}
+
+func (r *MongoRepository) MarkFailed(ctx context.Context, id primitive.ObjectID, lastError string, nextAttemptAt time.Time) error {
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"last_error": lastError, "next_attempt_at": nextAttemptAt},
+		"$inc": bson.M{"attempts": 1},
+	})
+	return err
+}
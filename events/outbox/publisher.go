@@ -0,0 +1,112 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/tird4d/go-microservices/events"
+)
+
+// Exchange is declared by the publisher every time it (re)connects
+type Exchange struct {
+	Name string
+	Kind string
+}
+
+// Publisher keeps one AMQP connection and confirm-mode channel open across
+// publishes. If the connection breaks it is redialled on the next Publish.
+type Publisher struct {
+	url       string
+	exchanges []Exchange
+	log       events.Logger
+
+	mu   sync.Mutex
+	conn *amqp.Connection
+	ch   *amqp.Channel
+}
+
+func NewPublisher(url string, log events.Logger, exchanges ...Exchange) *Publisher {
+	return &Publisher{url: url, exchanges: exchanges, log: log}
+}
+
+// Publish sends msg and waits until the broker confirms it
+func (p *Publisher) Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch, err := p.channel()
+	if err != nil {
+		return err
+	}
+
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, false, false, msg)
+	if err != nil {
+		p.reset()
+		return fmt.Errorf("publish: %w", err)
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("wait for confirm: %w", err)
+	}
+	if !acked {
+		return errors.New("publish not confirmed by broker")
+	}
+
+	return nil
+}
+
+// Close closes the connection, if any
+func (p *Publisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reset()
+}
+
+// channel returns the open channel, dialling a new connection when needed.
+// Callers must hold p.mu.
+func (p *Publisher) channel() (*amqp.Channel, error) {
+	if p.ch != nil && !p.ch.IsClosed() && !p.conn.IsClosed() {
+		return p.ch, nil
+	}
+	p.reset()
+
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("open channel: %w", err)
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("enable confirms: %w", err)
+	}
+
+	for _, ex := range p.exchanges {
+		if err := ch.ExchangeDeclare(ex.Name, ex.Kind, true, false, false, false, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("declare exchange %s: %w", ex.Name, err)
+		}
+	}
+
+	p.log.Infow("✅ Connected to RabbitMQ")
+
+	p.conn, p.ch = conn, ch
+	return ch, nil
+}
+
+func (p *Publisher) reset() {
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn, p.ch = nil, nil
+}
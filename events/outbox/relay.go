@@ -0,0 +1,127 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/tird4d/go-microservices/events"
+)
+
+const (
+	defaultPollInterval = 1 * time.Second
+	defaultBatchSize    = 100
+
+	minOutboxRetryDelay = 1 * time.Second
+	maxOutboxRetryDelay = 5 * time.Minute
+)
+
+// MessagePublisher is the part of Publisher the relay uses
+type MessagePublisher interface {
+	Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error
+}
+
+// Relay publishes pending outbox messages until they are confirmed by
+// the broker. Delivery is at-least-once: a crash between publish and
+// MarkPublished sends the message again, so consumers must be idempotent.
+type Relay struct {
+	Repo         Repository
+	Publisher    MessagePublisher
+	Log          events.Logger
+	PollInterval time.Duration
+	BatchSize    int64
+}
+
+// Run polls the outbox until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	interval := r.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	r.Log.Infow("📤 Outbox relay started", "poll_interval", interval)
+
+	for {
+		if _, err := r.relayBatch(ctx); err != nil && ctx.Err() == nil {
+			r.Log.Errorw("❌ Failed to read outbox", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			r.Log.Infow("Outbox relay stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayBatch publishes one batch of due messages in order and returns how
+// many were published. It stops at the first failure so later events for the
+// same entity don't overtake an earlier one.
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	messages, err := r.Repo.FindPending(ctx, time.Now(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, msg := range messages {
+		err := r.Publisher.Publish(ctx, msg.Exchange, msg.RoutingKey, toPublishing(msg))
+		if err != nil {
+			next := time.Now().Add(outboxRetryDelay(msg.Attempts + 1))
+			r.Log.Warnw("⚠️ Failed to publish outbox message",
+				"id", msg.ID.Hex(),
+				"event_type", msg.EventType,
+				"attempt", msg.Attempts+1,
+				"next_attempt_at", next,
+				"error", err,
+			)
+			if markErr := r.Repo.MarkFailed(ctx, msg.ID, err.Error(), next); markErr != nil {
+				r.Log.Errorw("Failed to record outbox failure", "id", msg.ID.Hex(), "error", markErr)
+			}
+			return published, nil
+		}
+
+		if err := r.Repo.MarkPublished(ctx, msg.ID); err != nil {
+			// The message is published again on the next poll
+			r.Log.Errorw("Failed to mark outbox message published", "id", msg.ID.Hex(), "error", err)
+			return published, nil
+		}
+
+		r.Log.Infow("✅ Event published", "id", msg.ID.Hex(), "event_type", msg.EventType)
+		published++
+	}
+
+	return published, nil
+}
+
+func toPublishing(msg *Message) amqp.Publishing {
+	return amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.ID.Hex(),
+		Type:         msg.EventType,
+		Timestamp:    msg.CreatedAt,
+		Body:         msg.Payload,
+	}
+}
+
+// outboxRetryDelay is an exponential backoff capped at maxOutboxRetryDelay
+func outboxRetryDelay(attempt int) time.Duration {
+	delay := minOutboxRetryDelay
+	for i := 1; i < attempt && delay < maxOutboxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxOutboxRetryDelay {
+		delay = maxOutboxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,123 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tird4d/go-microservices/events"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type repositoryMock struct {
+	mock.Mock
+}
+
+func (m *repositoryMock) FindPending(ctx context.Context, now time.Time, limit int64) ([]*Message, error) {
+	args := m.Called(ctx, now, limit)
+	if messages, ok := args.Get(0).([]*Message); ok {
+		return messages, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *repositoryMock) MarkPublished(ctx context.Context, id primitive.ObjectID) error {
+	return m.Called(ctx, id).Error(0)
+}
+
+func (m *repositoryMock) MarkFailed(ctx context.Context, id primitive.ObjectID, lastError string, nextAttemptAt time.Time) error {
+	return m.Called(ctx, id, lastError, nextAttemptAt).Error(0)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Infow(string, ...interface{})  {}
+func (nopLogger) Warnw(string, ...interface{})  {}
+func (nopLogger) Errorw(string, ...interface{}) {}
+
+type fakePublisher struct {
+	published []amqp.Publishing
+	failAfter int
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	if p.failAfter >= 0 && len(p.published) >= p.failAfter {
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, msg)
+	return nil
+}
+
+func pendingMessage() *Message {
+	return &Message{
+		ID:         primitive.NewObjectID(),
+		Exchange:   events.UserExchange,
+		RoutingKey: events.UserRegistered,
+		EventType:  events.UserRegistered,
+		Payload:    []byte(`{"user_id":"u1"}`),
+		Status:     StatusPending,
+	}
+}
+
+func TestRelayBatch_PublishesAndMarksMessages(t *testing.T) {
+	repo := new(repositoryMock)
+	publisher := &fakePublisher{failAfter: -1}
+	first, second := pendingMessage(), pendingMessage()
+
+	repo.On("FindPending", mock.Anything, mock.Anything, int64(defaultBatchSize)).Return([]*Message{first, second}, nil)
+	repo.On("MarkPublished", mock.Anything, first.ID).Return(nil)
+	repo.On("MarkPublished", mock.Anything, second.ID).Return(nil)
+
+	relay := &Relay{Repo: repo, Publisher: publisher, Log: nopLogger{}}
+	published, err := relay.relayBatch(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, published)
+	assert.Equal(t, first.ID.Hex(), publisher.published[0].MessageId)
+	assert.Equal(t, events.UserRegistered, publisher.published[0].Type)
+	assert.Equal(t, amqp.Persistent, publisher.published[0].DeliveryMode)
+	repo.AssertExpectations(t)
+}
+
+func TestRelayBatch_StopsAtFirstFailureAndSchedulesRetry(t *testing.T) {
+	repo := new(repositoryMock)
+	publisher := &fakePublisher{failAfter: 1}
+	first, second, third := pendingMessage(), pendingMessage(), pendingMessage()
+	second.Attempts = 2
+
+	repo.On("FindPending", mock.Anything, mock.Anything, mock.Anything).Return([]*Message{first, second, third}, nil)
+	repo.On("MarkPublished", mock.Anything, first.ID).Return(nil)
+	repo.On("MarkFailed", mock.Anything, second.ID, "broker unavailable", mock.MatchedBy(func(next time.Time) bool {
+		// Third attempt backs off 4s
+		return time.Until(next) > 3*time.Second && time.Until(next) <= 4*time.Second
+	})).Return(nil)
+
+	relay := &Relay{Repo: repo, Publisher: publisher, Log: nopLogger{}}
+	published, err := relay.relayBatch(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, published)
+	repo.AssertExpectations(t)
+	repo.AssertNotCalled(t, "MarkPublished", mock.Anything, third.ID)
+}
+
+func TestRelayBatch_FindError(t *testing.T) {
+	repo := new(repositoryMock)
+	repo.On("FindPending", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("mongo down"))
+
+	relay := &Relay{Repo: repo, Publisher: &fakePublisher{failAfter: -1}, Log: nopLogger{}}
+	_, err := relay.relayBatch(context.Background())
+
+	assert.Error(t, err)
+}
+
+func TestOutboxRetryDelay(t *testing.T) {
+	assert.Equal(t, 1*time.Second, outboxRetryDelay(1))
+	assert.Equal(t, 2*time.Second, outboxRetryDelay(2))
+	assert.Equal(t, 8*time.Second, outboxRetryDelay(4))
+	assert.Equal(t, maxOutboxRetryDelay, outboxRetryDelay(20))
+}
@@ -0,0 +1,48 @@
+package events
+
+// payment_exchange is a topic exchange. payment_service publishes captures
+// and refunds with the event type as routing key.
+const (
+	PaymentExchange     = "payment_exchange"
+	PaymentExchangeKind = "topic"
+
+	PaymentCaptured = "payment.captured"
+	PaymentRefunded = "payment.refunded"
+)
+
+// Money is an amount in the minor unit of an ISO 4217 currency, e.g.
+// {"amount": 1299, "currency": "EUR"} is 12.99 euros
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// PaymentCapturedEvent is published once per capture. OrderID is whatever the
+// caller passed when authorizing and may be empty. Version 1 had amounts as
+// numbers in major units.
+type PaymentCapturedEvent struct {
+	PaymentID      string `json:"payment_id"`
+	OrderID        string `json:"order_id,omitempty"`
+	UserID         string `json:"user_id"`
+	CapturedAmount Money  `json:"captured_amount"`
+}
+
+func (PaymentCapturedEvent) EventType() string  { return PaymentCaptured }
+func (PaymentCapturedEvent) SchemaVersion() int { return 2 }
+
+// PaymentRefundedEvent is published once per refund. Amount is this refund,
+// RefundedAmount the total refunded so far; FullyRefunded is set once nothing
+// of the captured amount is left. Version 1 had amounts as numbers in major
+// units.
+type PaymentRefundedEvent struct {
+	PaymentID      string `json:"payment_id"`
+	OrderID        string `json:"order_id,omitempty"`
+	UserID         string `json:"user_id"`
+	Amount         Money  `json:"amount"`
+	RefundedAmount Money  `json:"refunded_amount"`
+	FullyRefunded  bool   `json:"fully_refunded"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+func (PaymentRefundedEvent) EventType() string  { return PaymentRefunded }
+func (PaymentRefundedEvent) SchemaVersion() int { return 2 }
@@ -0,0 +1,338 @@
+// Package subscriber consumes a RabbitMQ exchange through a durable named
+// queue with manual acks. Failed messages wait in a retry queue, carrying a
+// retry count header, and end up on a dead-letter exchange once they run out
+// of retries or fail permanently. The connection is re-established with
+// backoff whenever it drops.
+package subscriber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/tird4d/go-microservices/events"
+)
+
+// RetryCountHeader carries how many times a message has been redelivered
+// after a failed handler run. Messages that reach the dead-letter queue keep it.
+const RetryCountHeader = "x-retry-count"
+
+const (
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// Handler processes a single delivery. Returning nil acks the message,
+// returning an error schedules a retry (or dead-letters it, see Permanent).
+type Handler func(ctx context.Context, msg amqp.Delivery) error
+
+// Config describes a durable queue bound to an exchange
+type Config struct {
+	URL          string
+	Exchange     string
+	ExchangeType string
+	Queue        string
+	BindingKeys  []string
+
+	// MaxRetries is how many times a failing message is redelivered before
+	// it is moved to the dead-letter exchange
+	MaxRetries int
+	// RetryDelay is how long a failed message waits in the retry queue
+	RetryDelay time.Duration
+	// Prefetch limits unacked messages in flight on this consumer
+	Prefetch int
+
+	Log events.Logger
+}
+
+// DeadLetterExchange is the exchange poison messages are published to
+func (c Config) DeadLetterExchange() string { return c.Queue + ".dlx" }
+
+// DeadLetterQueue holds poison messages for inspection or manual replay
+func (c Config) DeadLetterQueue() string { return c.Queue + ".dlq" }
+
+// RetryQueue delays failed messages before they're routed back to Queue
+func (c Config) RetryQueue() string { return c.Queue + ".retry" }
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a handler error that retrying can't fix (e.g. a malformed
+// payload), so the message goes straight to the dead-letter exchange
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// Subscriber reads a durable queue with manual acks and reconnects with
+// backoff whenever the AMQP connection or channel closes
+type Subscriber struct {
+	cfg     Config
+	handler Handler
+}
+
+func New(cfg Config, handler Handler) *Subscriber {
+	if cfg.ExchangeType == "" {
+		cfg.ExchangeType = "fanout"
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = 5 * time.Second
+	}
+	if cfg.Prefetch <= 0 {
+		cfg.Prefetch = 10
+	}
+	return &Subscriber{cfg: cfg, handler: handler}
+}
+
+// Run consumes until ctx is cancelled
+func (c *Subscriber) Run(ctx context.Context) {
+	attempt := 0
+	for {
+		consumed, err := c.consume(ctx)
+		if ctx.Err() != nil {
+			c.cfg.Log.Infow("Consumer stopped", "queue", c.cfg.Queue)
+			return
+		}
+
+		// A session that got as far as consuming resets the backoff
+		if consumed {
+			attempt = 0
+		}
+		delay := reconnectDelay(attempt)
+		attempt++
+
+		c.cfg.Log.Warnw("⚠️ RabbitMQ session ended, reconnecting",
+			"queue", c.cfg.Queue,
+			"error", err,
+			"retry_in", delay,
+		)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// consume runs one connection lifetime. The returned bool reports whether the
+// consumer was registered before the session ended.
+func (c *Subscriber) consume(ctx context.Context) (bool, error) {
+	conn, err := amqp.Dial(c.cfg.URL)
+	if err != nil {
+		return false, fmt.Errorf("dial: %w", err)
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return false, fmt.Errorf("open channel: %w", err)
+	}
+	defer ch.Close()
+
+	if err := c.declareTopology(ch); err != nil {
+		return false, err
+	}
+
+	if err := ch.Qos(c.cfg.Prefetch, 0, false); err != nil {
+		return false, fmt.Errorf("set qos: %w", err)
+	}
+
+	// Republishing to the retry queue or the DLX must be confirmed before
+	// the original delivery is acked, otherwise the message could be lost
+	if err := ch.Confirm(false); err != nil {
+		return false, fmt.Errorf("enable confirms: %w", err)
+	}
+
+	msgs, err := ch.Consume(c.cfg.Queue, "", false, false, false, false, nil)
+	if err != nil {
+		return false, fmt.Errorf("register consumer: %w", err)
+	}
+
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	c.cfg.Log.Infow("📡 Listening for events", "exchange", c.cfg.Exchange, "queue", c.cfg.Queue)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case amqpErr := <-connClosed:
+			return true, fmt.Errorf("connection closed: %v", amqpErr)
+		case amqpErr := <-chClosed:
+			return true, fmt.Errorf("channel closed: %v", amqpErr)
+		case msg, ok := <-msgs:
+			if !ok {
+				return true, errors.New("delivery channel closed")
+			}
+			c.handle(ctx, ch, msg)
+		}
+	}
+}
+
+func (c *Subscriber) declareTopology(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(c.cfg.Exchange, c.cfg.ExchangeType, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare exchange: %w", err)
+	}
+
+	// Dead-letter exchange and queue for poison messages
+	if err := ch.ExchangeDeclare(c.cfg.DeadLetterExchange(), "fanout", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare dead-letter exchange: %w", err)
+	}
+	if _, err := ch.QueueDeclare(c.cfg.DeadLetterQueue(), true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare dead-letter queue: %w", err)
+	}
+	if err := ch.QueueBind(c.cfg.DeadLetterQueue(), "", c.cfg.DeadLetterExchange(), false, nil); err != nil {
+		return fmt.Errorf("bind dead-letter queue: %w", err)
+	}
+
+	// Main queue: named and durable so events published while we're down are kept.
+	// Anything rejected without requeue falls through to the DLX.
+	if _, err := ch.QueueDeclare(c.cfg.Queue, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange": c.cfg.DeadLetterExchange(),
+	}); err != nil {
+		return fmt.Errorf("declare queue: %w", err)
+	}
+
+	bindingKeys := c.cfg.BindingKeys
+	if len(bindingKeys) == 0 {
+		bindingKeys = []string{""}
+	}
+	for _, key := range bindingKeys {
+		if err := ch.QueueBind(c.cfg.Queue, key, c.cfg.Exchange, false, nil); err != nil {
+			return fmt.Errorf("bind queue: %w", err)
+		}
+	}
+
+	// Retry queue: messages expire after RetryDelay and are dead-lettered
+	// back to the main queue through the default exchange
+	if _, err := ch.QueueDeclare(c.cfg.RetryQueue(), true, false, false, false, amqp.Table{
+		"x-message-ttl":             c.cfg.RetryDelay.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": c.cfg.Queue,
+	}); err != nil {
+		return fmt.Errorf("declare retry queue: %w", err)
+	}
+
+	return nil
+}
+
+// handle runs the handler and settles the delivery. The message is only
+// acked once it was either handled or safely republished elsewhere.
+func (c *Subscriber) handle(ctx context.Context, ch *amqp.Channel, msg amqp.Delivery) {
+	err := c.handler(ctx, msg)
+	if err == nil {
+		if ackErr := msg.Ack(false); ackErr != nil {
+			c.cfg.Log.Errorw("Failed to ack message", "queue", c.cfg.Queue, "error", ackErr)
+		}
+		return
+	}
+
+	// Shutting down: leave the message unacked so the broker redelivers it
+	if ctx.Err() != nil {
+		return
+	}
+
+	retries := RetryCount(msg.Headers)
+
+	if IsPermanent(err) || retries >= c.cfg.MaxRetries {
+		c.cfg.Log.Errorw("❌ Dead-lettering message",
+			"queue", c.cfg.Queue,
+			"message_id", msg.MessageId,
+			"retries", retries,
+			"error", err,
+		)
+		c.republish(ctx, ch, msg, c.cfg.DeadLetterExchange(), "", retries, err)
+		return
+	}
+
+	c.cfg.Log.Warnw("⚠️ Handler failed, scheduling retry",
+		"queue", c.cfg.Queue,
+		"message_id", msg.MessageId,
+		"retry", retries+1,
+		"error", err,
+	)
+	c.republish(ctx, ch, msg, "", c.cfg.RetryQueue(), retries+1, err)
+}
+
+func (c *Subscriber) republish(ctx context.Context, ch *amqp.Channel, msg amqp.Delivery, exchange, routingKey string, retries int, cause error) {
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[RetryCountHeader] = int32(retries)
+	headers["x-last-error"] = cause.Error()
+
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, false, false, amqp.Publishing{
+		Headers:       headers,
+		ContentType:   msg.ContentType,
+		Body:          msg.Body,
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     msg.MessageId,
+		CorrelationId: msg.CorrelationId,
+		Timestamp:     msg.Timestamp,
+		Type:          msg.Type,
+	})
+	if err == nil && !confirmation.Wait() {
+		err = errors.New("publish not confirmed by broker")
+	}
+
+	if err != nil {
+		// Let the broker dead-letter the original instead
+		c.cfg.Log.Errorw("Failed to republish message", "queue", c.cfg.Queue, "error", err)
+		if nackErr := msg.Nack(false, false); nackErr != nil {
+			c.cfg.Log.Errorw("Failed to nack message", "queue", c.cfg.Queue, "error", nackErr)
+		}
+		return
+	}
+
+	if ackErr := msg.Ack(false); ackErr != nil {
+		c.cfg.Log.Errorw("Failed to ack message", "queue", c.cfg.Queue, "error", ackErr)
+	}
+}
+
+// RetryCount reads RetryCountHeader, treating a missing or malformed header as 0
+func RetryCount(headers amqp.Table) int {
+	switch v := headers[RetryCountHeader].(type) {
+	case int:
+		return v
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// reconnectDelay is an exponential backoff capped at maxReconnectDelay
+func reconnectDelay(attempt int) time.Duration {
+	delay := minReconnectDelay
+	for i := 0; i < attempt && delay < maxReconnectDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxReconnectDelay {
+		delay = maxReconnectDelay
+	}
+	return delay
+}
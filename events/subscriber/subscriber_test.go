@@ -0,0 +1,45 @@
+package subscriber
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryCount(t *testing.T) {
+	assert.Equal(t, 0, RetryCount(nil))
+	assert.Equal(t, 0, RetryCount(amqp.Table{}))
+	assert.Equal(t, 0, RetryCount(amqp.Table{RetryCountHeader: "3"}))
+	assert.Equal(t, 3, RetryCount(amqp.Table{RetryCountHeader: int32(3)}))
+	assert.Equal(t, 4, RetryCount(amqp.Table{RetryCountHeader: int64(4)}))
+}
+
+func TestReconnectDelay(t *testing.T) {
+	assert.Equal(t, 1*time.Second, reconnectDelay(0))
+	assert.Equal(t, 2*time.Second, reconnectDelay(1))
+	assert.Equal(t, 16*time.Second, reconnectDelay(4))
+	assert.Equal(t, maxReconnectDelay, reconnectDelay(10))
+	assert.Equal(t, maxReconnectDelay, reconnectDelay(1000))
+}
+
+func TestPermanent(t *testing.T) {
+	cause := errors.New("bad payload")
+
+	assert.Nil(t, Permanent(nil))
+	assert.True(t, IsPermanent(Permanent(cause)))
+	assert.ErrorIs(t, Permanent(cause), cause)
+	assert.False(t, IsPermanent(cause))
+}
+
+func TestNew_Defaults(t *testing.T) {
+	c := New(Config{Queue: "orders.users"}, nil)
+
+	assert.Equal(t, "fanout", c.cfg.ExchangeType)
+	assert.Equal(t, 5, c.cfg.MaxRetries)
+	assert.Equal(t, "orders.users.dlx", c.cfg.DeadLetterExchange())
+	assert.Equal(t, "orders.users.dlq", c.cfg.DeadLetterQueue())
+	assert.Equal(t, "orders.users.retry", c.cfg.RetryQueue())
+}
@@ -0,0 +1,52 @@
+package events
+
+// user_exchange is a topic exchange. user_service publishes every user event
+// with its type as routing key, so consumers bind only what they need
+// (e.g. "user.registered" or "user.*").
+const (
+	UserExchange     = "user_exchange"
+	UserExchangeKind = "topic"
+
+	UserRegistered = "user.registered"
+	UserUpdated    = "user.updated"
+	UserDeleted    = "user.deleted"
+)
+
+// UserVersion in the user payloads increases with every change to the user
+// in user_service, so consumers can drop stale or redelivered events.
+
+type UserRegisteredEvent struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+	// Locale is the user's preferred language (e.g. "de-AT"), empty if unknown
+	Locale      string `json:"locale,omitempty"`
+	UserVersion int64  `json:"user_version"`
+}
+
+func (UserRegisteredEvent) EventType() string  { return UserRegistered }
+func (UserRegisteredEvent) SchemaVersion() int { return 1 }
+
+// UserUpdatedEvent carries the user as it is after the update together with
+// the names of the fields that were changed
+type UserUpdatedEvent struct {
+	UserID        string   `json:"user_id"`
+	Email         string   `json:"email"`
+	Name          string   `json:"name"`
+	Role          string   `json:"role"`
+	Locale        string   `json:"locale,omitempty"`
+	ChangedFields []string `json:"changed_fields"`
+	UserVersion   int64    `json:"user_version"`
+}
+
+func (UserUpdatedEvent) EventType() string  { return UserUpdated }
+func (UserUpdatedEvent) SchemaVersion() int { return 1 }
+
+// UserDeletedEvent is a tombstone; UserVersion is one past the user's last version
+type UserDeletedEvent struct {
+	UserID      string `json:"user_id"`
+	UserVersion int64  `json:"user_version"`
+}
+
+func (UserDeletedEvent) EventType() string  { return UserDeleted }
+func (UserDeletedEvent) SchemaVersion() int { return 1 }
@@ -0,0 +1,101 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/tird4d/go-microservices/events"
+	"github.com/tird4d/go-microservices/events/subscriber"
+	"github.com/tird4d/go-microservices/order_service/logger"
+	"github.com/tird4d/go-microservices/order_service/models"
+	"github.com/tird4d/go-microservices/order_service/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NewPaymentEventHandler returns a Handler that moves orders along with
+// payment_exchange events: a captured payment marks its order paid and a
+// full refund marks it refunded. Partial refunds leave the order as it is.
+// Redelivered events find the order already moved and are acked.
+func NewPaymentEventHandler(repo repositories.OrderRepository) subscriber.Handler {
+	return func(ctx context.Context, msg amqp.Delivery) error {
+		env, err := events.Decode(msg.Body)
+		if err != nil {
+			return subscriber.Permanent(err)
+		}
+		ctx = env.Context(ctx)
+
+		var orderID, fromStatus, toStatus string
+		switch env.Type {
+		case events.PaymentCaptured:
+			event, err := events.DecodePayload[events.PaymentCapturedEvent](env)
+			if err != nil {
+				return subscriber.Permanent(err)
+			}
+			orderID, fromStatus, toStatus = event.OrderID, models.OrderStatusPending, models.OrderStatusPaid
+
+		case events.PaymentRefunded:
+			event, err := events.DecodePayload[events.PaymentRefundedEvent](env)
+			if err != nil {
+				return subscriber.Permanent(err)
+			}
+			if !event.FullyRefunded {
+				logger.Log.Infow("Ignoring partial refund", "event_id", env.EventID, "order_id", event.OrderID, "refunded_amount", event.RefundedAmount)
+				return nil
+			}
+			orderID, fromStatus, toStatus = event.OrderID, models.OrderStatusPaid, models.OrderStatusRefunded
+
+		default:
+			return subscriber.Permanent(fmt.Errorf("unknown payment event %q", env.Type))
+		}
+
+		// Payments made outside a checkout have no order to update
+		oid, err := primitive.ObjectIDFromHex(orderID)
+		if err != nil {
+			logger.Log.Infow("Skipping payment event without order", "event", env.Type, "event_id", env.EventID, "order_id", orderID)
+			return nil
+		}
+
+		_, err = repo.UpdateStatus(ctx, oid, fromStatus, toStatus)
+		if err == nil {
+			logger.Log.Infow("✅ Order status updated from payment", "event", env.Type, "event_id", env.EventID, "order_id", orderID, "status", toStatus)
+			return nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("update order status: %w", err)
+		}
+
+		return checkOrderStatus(ctx, repo, env, oid, fromStatus, toStatus)
+	}
+}
+
+// checkOrderStatus explains why an order wasn't in fromStatus. An order that
+// already reached toStatus means a redelivery; one that is still pending on a
+// refund hasn't seen its capture event yet, so the refund is retried.
+func checkOrderStatus(ctx context.Context, repo repositories.OrderRepository, env *events.Envelope, oid primitive.ObjectID, fromStatus, toStatus string) error {
+	order, err := repo.FindByID(ctx, oid)
+	if err != nil {
+		// The saga creates the order before capturing, so a missing order is
+		// most likely a replica that hasn't caught up yet
+		return fmt.Errorf("find order %s: %w", oid.Hex(), err)
+	}
+
+	switch {
+	case order.Status == toStatus:
+		logger.Log.Infow("Skipping duplicate payment event", "event", env.Type, "event_id", env.EventID, "order_id", oid.Hex())
+		return nil
+	case toStatus == models.OrderStatusRefunded && order.Status == models.OrderStatusPending:
+		return fmt.Errorf("order %s not paid yet", oid.Hex())
+	default:
+		logger.Log.Warnw("⚠️ Payment event doesn't match order status",
+			"event", env.Type,
+			"event_id", env.EventID,
+			"order_id", oid.Hex(),
+			"status", order.Status,
+			"expected", fromStatus,
+		)
+		return nil
+	}
+}
@@ -0,0 +1,116 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tird4d/go-microservices/events"
+	"github.com/tird4d/go-microservices/events/subscriber"
+	"github.com/tird4d/go-microservices/order_service/models"
+	"github.com/tird4d/go-microservices/order_service/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// statusOrders is the part of OrderRepository the payment handler uses
+type statusOrders struct {
+	repositories.OrderRepository
+	orders map[primitive.ObjectID]*models.Order
+	err    error
+}
+
+func newStatusOrders(orders ...*models.Order) *statusOrders {
+	f := &statusOrders{orders: make(map[primitive.ObjectID]*models.Order)}
+	for _, order := range orders {
+		f.orders[order.ID] = order
+	}
+	return f
+}
+
+func (f *statusOrders) FindByID(ctx context.Context, oid primitive.ObjectID) (*models.Order, error) {
+	order, ok := f.orders[oid]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return order, nil
+}
+
+func (f *statusOrders) UpdateStatus(ctx context.Context, oid primitive.ObjectID, fromStatus, toStatus string) (*models.Order, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	order, ok := f.orders[oid]
+	if !ok || order.Status != fromStatus {
+		return nil, mongo.ErrNoDocuments
+	}
+	order.Status = toStatus
+	return order, nil
+}
+
+func TestPaymentEventHandler_CaptureMarksOrderPaid(t *testing.T) {
+	order := &models.Order{ID: primitive.NewObjectID(), Status: models.OrderStatusPending}
+	handler := NewPaymentEventHandler(newStatusOrders(order))
+	ctx := context.Background()
+	event := events.PaymentCapturedEvent{PaymentID: "p1", OrderID: order.ID.Hex(), UserID: "u1", CapturedAmount: events.Money{Amount: 1000, Currency: "EUR"}}
+
+	assert.NoError(t, handler(ctx, delivery(t, event)))
+	assert.Equal(t, models.OrderStatusPaid, order.Status)
+
+	// Redelivery finds the order already paid
+	assert.NoError(t, handler(ctx, delivery(t, event)))
+	assert.Equal(t, models.OrderStatusPaid, order.Status)
+}
+
+func TestPaymentEventHandler_FullRefundMarksOrderRefunded(t *testing.T) {
+	order := &models.Order{ID: primitive.NewObjectID(), Status: models.OrderStatusPaid}
+	handler := NewPaymentEventHandler(newStatusOrders(order))
+	ctx := context.Background()
+
+	partial := events.PaymentRefundedEvent{PaymentID: "p1", OrderID: order.ID.Hex(), Amount: events.Money{Amount: 400, Currency: "EUR"}, RefundedAmount: events.Money{Amount: 400, Currency: "EUR"}}
+	assert.NoError(t, handler(ctx, delivery(t, partial)))
+	assert.Equal(t, models.OrderStatusPaid, order.Status)
+
+	full := events.PaymentRefundedEvent{PaymentID: "p1", OrderID: order.ID.Hex(), Amount: events.Money{Amount: 600, Currency: "EUR"}, RefundedAmount: events.Money{Amount: 1000, Currency: "EUR"}, FullyRefunded: true}
+	assert.NoError(t, handler(ctx, delivery(t, full)))
+	assert.Equal(t, models.OrderStatusRefunded, order.Status)
+}
+
+func TestPaymentEventHandler_RefundBeforeCaptureIsRetried(t *testing.T) {
+	order := &models.Order{ID: primitive.NewObjectID(), Status: models.OrderStatusPending}
+	handler := NewPaymentEventHandler(newStatusOrders(order))
+
+	err := handler(context.Background(), delivery(t, events.PaymentRefundedEvent{PaymentID: "p1", OrderID: order.ID.Hex(), Amount: events.Money{Amount: 1000, Currency: "EUR"}, RefundedAmount: events.Money{Amount: 1000, Currency: "EUR"}, FullyRefunded: true}))
+
+	assert.Error(t, err)
+	assert.False(t, subscriber.IsPermanent(err))
+	assert.Equal(t, models.OrderStatusPending, order.Status)
+}
+
+func TestPaymentEventHandler_CancelledOrderIsLeftAlone(t *testing.T) {
+	order := &models.Order{ID: primitive.NewObjectID(), Status: models.OrderStatusCancelled}
+	handler := NewPaymentEventHandler(newStatusOrders(order))
+
+	err := handler(context.Background(), delivery(t, events.PaymentCapturedEvent{PaymentID: "p1", OrderID: order.ID.Hex(), CapturedAmount: events.Money{Amount: 1000, Currency: "EUR"}}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusCancelled, order.Status)
+}
+
+func TestPaymentEventHandler_PaymentWithoutOrderIsAcked(t *testing.T) {
+	handler := NewPaymentEventHandler(newStatusOrders())
+
+	assert.NoError(t, handler(context.Background(), delivery(t, events.PaymentCapturedEvent{PaymentID: "p1", CapturedAmount: events.Money{Amount: 1000, Currency: "EUR"}})))
+}
+
+func TestPaymentEventHandler_StoreErrorIsRetried(t *testing.T) {
+	orders := newStatusOrders()
+	orders.err = errors.New("mongo down")
+	handler := NewPaymentEventHandler(orders)
+
+	err := handler(context.Background(), delivery(t, events.PaymentCapturedEvent{PaymentID: "p1", OrderID: primitive.NewObjectID().Hex(), CapturedAmount: events.Money{Amount: 1000, Currency: "EUR"}}))
+
+	assert.Error(t, err)
+	assert.False(t, subscriber.IsPermanent(err))
+}
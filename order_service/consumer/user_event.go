@@ -1,57 +1,83 @@
 package consumer
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"fmt"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
-	"github.com/tird4d/go-microservices/order_service/storage"
+	"github.com/tird4d/go-microservices/events"
+	"github.com/tird4d/go-microservices/events/subscriber"
+	"github.com/tird4d/go-microservices/order_service/logger"
+	"github.com/tird4d/go-microservices/order_service/models"
+	"github.com/tird4d/go-microservices/order_service/repositories"
 )
 
-type UserRegisteredEvent struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Name   string `json:"name"`
-}
+// NewUserEventHandler returns a Handler that applies user_exchange events to
+// the local user projection. Events are idempotent on user ID and version:
+// a redelivered or out-of-order event is acked without changing anything.
+func NewUserEventHandler(repo repositories.UserProjectionRepository) subscriber.Handler {
+	return func(ctx context.Context, msg amqp.Delivery) error {
+		env, err := events.Decode(msg.Body)
+		if err != nil {
+			return subscriber.Permanent(err)
+		}
+		ctx = env.Context(ctx)
 
-func StartUserConsumer(ch *amqp.Channel) {
-	err := ch.ExchangeDeclare("user_exchange", "fanout", true, false, false, false, nil)
-	if err != nil {
-		log.Fatalf("❌ Failed to declare exchange: %v", err)
-	}
+		user, err := userProjectionFromEvent(env)
+		if err != nil {
+			return subscriber.Permanent(err)
+		}
 
-	q, err := ch.QueueDeclare("", false, true, true, false, nil)
-	if err != nil {
-		log.Fatalf("❌ Failed to declare queue: %v", err)
-	}
+		if user.ID == "" {
+			return subscriber.Permanent(fmt.Errorf("%s event %s without user_id", env.Type, env.EventID))
+		}
 
-	err = ch.QueueBind(q.Name, "", "user_exchange", false, nil)
-	if err != nil {
-		log.Fatalf("❌ Failed to bind queue: %v", err)
-	}
+		user.UpdatedAt = time.Now()
 
-	msgs, err := ch.Consume(q.Name, "", true, true, false, false, nil)
-	if err != nil {
-		log.Fatalf("❌ Failed to register consumer: %v", err)
-	}
+		applied, err := repo.Upsert(ctx, user)
+		if err != nil {
+			return fmt.Errorf("save user projection: %w", err)
+		}
 
-	log.Println("📡 Listening for user.created events...")
+		if !applied {
+			logger.Log.Infow("Skipping stale user event", "event", env.Type, "event_id", env.EventID, "user_id", user.ID, "version", user.Version)
+			return nil
+		}
 
-	go func() {
-		for msg := range msgs {
-			var event UserRegisteredEvent
-			if err := json.Unmarshal(msg.Body, &event); err != nil {
-				log.Println("⚠️ Invalid message:", err)
-				continue
-			}
+		logger.Log.Infow("✅ User projection updated", "event", env.Type, "event_id", env.EventID, "user_id", user.ID, "version", user.Version)
 
-			storage.SaveUser(storage.User{
-				ID:    event.UserID,
-				Email: event.Email,
-				Name:  event.Name,
-			})
+		return nil
+	}
+}
+
+// userProjectionFromEvent maps a user event to the projection it results in.
+// Updates carry the whole user, so they are applied like registrations;
+// deletions leave a tombstone.
+func userProjectionFromEvent(env *events.Envelope) (*models.UserProjection, error) {
+	switch env.Type {
+	case events.UserRegistered:
+		event, err := events.DecodePayload[events.UserRegisteredEvent](env)
+		if err != nil {
+			return nil, err
+		}
+		return &models.UserProjection{ID: event.UserID, Email: event.Email, Name: event.Name, Version: event.UserVersion}, nil
 
-				log.Printf("✅ User %s saved (%s)", event.Name, event.UserID)
+	case events.UserUpdated:
+		event, err := events.DecodePayload[events.UserUpdatedEvent](env)
+		if err != nil {
+			return nil, err
 		}
-	}()
+		return &models.UserProjection{ID: event.UserID, Email: event.Email, Name: event.Name, Version: event.UserVersion}, nil
+
+	case events.UserDeleted:
+		event, err := events.DecodePayload[events.UserDeletedEvent](env)
+		if err != nil {
+			return nil, err
+		}
+		return &models.UserProjection{ID: event.UserID, Version: event.UserVersion, Deleted: true}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown user event %q", env.Type)
+	}
 }
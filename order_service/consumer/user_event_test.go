@@ -0,0 +1,147 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/tird4d/go-microservices/events"
+	"github.com/tird4d/go-microservices/events/subscriber"
+	"github.com/tird4d/go-microservices/order_service/logger"
+	"github.com/tird4d/go-microservices/order_service/models"
+	"github.com/tird4d/go-microservices/order_service/repositories"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger(true)
+
+	os.Exit(m.Run())
+}
+
+// delivery wraps payload in an envelope the way user_service publishes it
+func delivery(t *testing.T, payload events.Payload) amqp.Delivery {
+	t.Helper()
+
+	body, err := events.Encode(context.Background(), payload)
+	assert.NoError(t, err)
+
+	return amqp.Delivery{RoutingKey: payload.EventType(), Body: body}
+}
+
+func TestUserEventHandler_MalformedPayloadIsPermanent(t *testing.T) {
+	handler := NewUserEventHandler(repositories.NewMemoryUserProjectionRepository())
+
+	err := handler(context.Background(), amqp.Delivery{Body: []byte("{not json")})
+
+	assert.True(t, subscriber.IsPermanent(err))
+}
+
+func TestUserEventHandler_RawPayloadWithoutEnvelopeIsPermanent(t *testing.T) {
+	handler := NewUserEventHandler(repositories.NewMemoryUserProjectionRepository())
+
+	err := handler(context.Background(), amqp.Delivery{Body: []byte(`{"user_id":"u1","email":"a@b.c"}`)})
+
+	assert.True(t, subscriber.IsPermanent(err))
+}
+
+func TestUserEventHandler_MissingUserIDIsPermanent(t *testing.T) {
+	handler := NewUserEventHandler(repositories.NewMemoryUserProjectionRepository())
+
+	err := handler(context.Background(), delivery(t, events.UserRegisteredEvent{Email: "a@b.c", UserVersion: 1}))
+
+	assert.True(t, subscriber.IsPermanent(err))
+}
+
+func TestUserEventHandler_IncompatibleVersionIsPermanent(t *testing.T) {
+	handler := NewUserEventHandler(repositories.NewMemoryUserProjectionRepository())
+
+	env, err := events.New(context.Background(), events.UserRegisteredEvent{UserID: "u1", UserVersion: 1})
+	assert.NoError(t, err)
+	env.Version = 99
+	body, _ := json.Marshal(env)
+
+	err = handler(context.Background(), amqp.Delivery{Body: body})
+
+	assert.True(t, subscriber.IsPermanent(err))
+}
+
+func TestUserEventHandler_IgnoresStaleVersions(t *testing.T) {
+	repo := repositories.NewMemoryUserProjectionRepository()
+	handler := NewUserEventHandler(repo)
+	ctx := context.Background()
+
+	assert.NoError(t, handler(ctx, delivery(t, events.UserRegisteredEvent{UserID: "u1", Email: "new@b.c", Name: "New", UserVersion: 2})))
+	// An older event delivered late is acked but must not roll the user back
+	assert.NoError(t, handler(ctx, delivery(t, events.UserRegisteredEvent{UserID: "u1", Email: "old@b.c", Name: "Old", UserVersion: 1})))
+	// Redelivery of the same version is a no-op
+	assert.NoError(t, handler(ctx, delivery(t, events.UserRegisteredEvent{UserID: "u1", Email: "dup@b.c", Name: "Dup", UserVersion: 2})))
+
+	user, err := repo.FindByID(ctx, "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, "new@b.c", user.Email)
+	assert.Equal(t, int64(2), user.Version)
+}
+
+type failingProjectionRepository struct {
+	repositories.UserProjectionRepository
+}
+
+func (failingProjectionRepository) Upsert(ctx context.Context, user *models.UserProjection) (bool, error) {
+	return false, errors.New("mongo down")
+}
+
+func TestUserEventHandler_StoreErrorIsRetried(t *testing.T) {
+	handler := NewUserEventHandler(failingProjectionRepository{})
+
+	err := handler(context.Background(), delivery(t, events.UserRegisteredEvent{UserID: "u1", UserVersion: 1}))
+
+	assert.Error(t, err)
+	assert.False(t, subscriber.IsPermanent(err))
+}
+
+func TestUserEventHandler_UpdatedEventReplacesProjection(t *testing.T) {
+	repo := repositories.NewMemoryUserProjectionRepository()
+	handler := NewUserEventHandler(repo)
+	ctx := context.Background()
+
+	assert.NoError(t, handler(ctx, delivery(t, events.UserRegisteredEvent{UserID: "u1", Email: "a@b.c", Name: "A", UserVersion: 1})))
+	assert.NoError(t, handler(ctx, delivery(t, events.UserUpdatedEvent{UserID: "u1", Email: "new@b.c", Name: "A", ChangedFields: []string{"email"}, UserVersion: 2})))
+
+	user, err := repo.FindByID(ctx, "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, "new@b.c", user.Email)
+	assert.Equal(t, int64(2), user.Version)
+}
+
+func TestUserEventHandler_DeletedEventLeavesTombstone(t *testing.T) {
+	repo := repositories.NewMemoryUserProjectionRepository()
+	handler := NewUserEventHandler(repo)
+	ctx := context.Background()
+
+	assert.NoError(t, handler(ctx, delivery(t, events.UserRegisteredEvent{UserID: "u1", Email: "a@b.c", Name: "A", UserVersion: 1})))
+	assert.NoError(t, handler(ctx, delivery(t, events.UserDeletedEvent{UserID: "u1", UserVersion: 2})))
+	// A redelivered registration must not resurrect the user
+	assert.NoError(t, handler(ctx, delivery(t, events.UserRegisteredEvent{UserID: "u1", Email: "a@b.c", Name: "A", UserVersion: 1})))
+
+	user, err := repo.FindByID(ctx, "u1")
+	assert.NoError(t, err)
+	assert.True(t, user.Deleted)
+	assert.Empty(t, user.Email)
+}
+
+func TestUserEventHandler_UnknownEventTypeIsPermanent(t *testing.T) {
+	handler := NewUserEventHandler(repositories.NewMemoryUserProjectionRepository())
+
+	env, err := events.New(context.Background(), events.UserDeletedEvent{UserID: "u1", UserVersion: 1})
+	assert.NoError(t, err)
+	env.Type = "user.exploded"
+	body, _ := json.Marshal(env)
+
+	err = handler(context.Background(), amqp.Delivery{Body: body})
+
+	assert.True(t, subscriber.IsPermanent(err))
+}
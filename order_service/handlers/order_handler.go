@@ -0,0 +1,188 @@
+// order_handler.go
+package handlers
+
+import (
+	"context"
+
+	cartpb "github.com/tird4d/go-microservices/cart_service/proto"
+	"github.com/tird4d/go-microservices/order_service/logger"
+	"github.com/tird4d/go-microservices/order_service/models"
+	orderpb "github.com/tird4d/go-microservices/order_service/proto"
+	"github.com/tird4d/go-microservices/order_service/repositories"
+	"github.com/tird4d/go-microservices/order_service/saga"
+	"github.com/tird4d/go-microservices/order_service/services"
+	"github.com/tird4d/go-microservices/product_service/money"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Server struct {
+	orderpb.UnimplementedOrderServiceServer
+	ProductClient productpb.ProductServiceClient
+	CartClient    cartpb.CartServiceClient
+	Checkouts     *saga.Orchestrator
+}
+
+// CreateOrder places a new order for the authenticated user
+func (s *Server) CreateOrder(ctx context.Context, req *orderpb.CreateOrderRequest) (*orderpb.Order, error) {
+	logger.Log.Infow("Creating new order",
+		"user_id", req.GetUserId(),
+		"lines", len(req.GetLines()),
+	)
+
+	items := make([]services.OrderItem, len(req.GetLines()))
+	for i, line := range req.GetLines() {
+		items[i] = services.OrderItem{
+			ProductID: line.GetProductId(),
+			Quantity:  line.GetQuantity(),
+		}
+	}
+
+	repo := &repositories.MongoOrderRepository{}
+
+	order, err := services.CreateOrder(ctx, repo, s.ProductClient, req.GetUserId(), items)
+	if err != nil {
+		logger.Log.Errorw("Failed to create order", "error", err)
+		return nil, err
+	}
+
+	return toOrderResponse(order), nil
+}
+
+// GetOrder retrieves an order owned by the authenticated user
+func (s *Server) GetOrder(ctx context.Context, req *orderpb.GetOrderRequest) (*orderpb.Order, error) {
+	logger.Log.Infow("Getting order", "id", req.GetId(), "user_id", req.GetUserId())
+
+	repo := &repositories.MongoOrderRepository{}
+
+	order, err := services.GetOrder(ctx, repo, req.GetId(), req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	return toOrderResponse(order), nil
+}
+
+// ListOrdersForUser lists the authenticated user's orders with pagination
+func (s *Server) ListOrdersForUser(ctx context.Context, req *orderpb.ListOrdersForUserRequest) (*orderpb.ListOrdersResponse, error) {
+	logger.Log.Infow("Listing orders",
+		"user_id", req.GetUserId(),
+		"page", req.GetPage(),
+		"pageSize", req.GetPageSize(),
+	)
+
+	repo := &repositories.MongoOrderRepository{}
+
+	orders, total, err := services.ListOrdersForUser(ctx, repo, req.GetUserId(), req.GetPage(), req.GetPageSize())
+	if err != nil {
+		logger.Log.Errorw("Failed to list orders", "error", err)
+		return nil, err
+	}
+
+	orderResponses := make([]*orderpb.Order, len(orders))
+	for i, order := range orders {
+		orderResponses[i] = toOrderResponse(order)
+	}
+
+	// Apply default values for response metadata
+	page := req.GetPage()
+	if page < 1 {
+		page = 1
+	}
+	pageSize := req.GetPageSize()
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	return &orderpb.ListOrdersResponse{
+		Orders:   orderResponses,
+		Total:    int32(total),
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// CancelOrder cancels a pending order owned by the authenticated user
+func (s *Server) CancelOrder(ctx context.Context, req *orderpb.CancelOrderRequest) (*orderpb.Order, error) {
+	logger.Log.Infow("Cancelling order", "id", req.GetId(), "user_id", req.GetUserId())
+
+	repo := &repositories.MongoOrderRepository{}
+
+	order, err := services.CancelOrder(ctx, repo, req.GetId(), req.GetUserId())
+	if err != nil {
+		logger.Log.Errorw("Failed to cancel order", "error", err)
+		return nil, err
+	}
+
+	return toOrderResponse(order), nil
+}
+
+// Checkout turns the authenticated user's cart into an order
+func (s *Server) Checkout(ctx context.Context, req *orderpb.CheckoutRequest) (*orderpb.CheckoutStatus, error) {
+	logger.Log.Infow("Starting checkout", "user_id", req.GetUserId())
+
+	checkout, err := services.Checkout(ctx, s.Checkouts, s.CartClient, req.GetUserId(), req.GetPaymentMethod())
+	if err != nil {
+		logger.Log.Errorw("Failed to check out", "error", err)
+		return nil, err
+	}
+
+	return toCheckoutResponse(checkout), nil
+}
+
+// GetCheckout reports the progress of one of the authenticated user's checkouts
+func (s *Server) GetCheckout(ctx context.Context, req *orderpb.GetCheckoutRequest) (*orderpb.CheckoutStatus, error) {
+	checkout, err := services.GetCheckout(ctx, s.Checkouts.Sagas, req.GetId(), req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	return toCheckoutResponse(checkout), nil
+}
+
+func toCheckoutResponse(checkout *models.CheckoutSaga) *orderpb.CheckoutStatus {
+	res := &orderpb.CheckoutStatus{
+		Id:            checkout.ID,
+		UserId:        checkout.UserID,
+		Status:        checkout.State,
+		Total:         toMoneyResponse(checkout.Total),
+		FailureReason: checkout.FailureReason,
+		CreatedAt:     timestamppb.New(checkout.CreatedAt),
+		UpdatedAt:     timestamppb.New(checkout.UpdatedAt),
+	}
+
+	// The order ID is reserved up front but only meaningful once the order exists
+	if checkout.State == models.CheckoutCompleted {
+		res.OrderId = checkout.OrderID.Hex()
+	}
+
+	return res
+}
+
+func toOrderResponse(order *models.Order) *orderpb.Order {
+	lines := make([]*orderpb.OrderLine, len(order.Lines))
+	for i, line := range order.Lines {
+		lines[i] = &orderpb.OrderLine{
+			ProductId:   line.ProductID,
+			ProductName: line.ProductName,
+			UnitPrice:   toMoneyResponse(line.UnitPrice),
+			Quantity:    line.Quantity,
+			LineTotal:   toMoneyResponse(line.LineTotal),
+			Sku:         line.SKU,
+		}
+	}
+
+	return &orderpb.Order{
+		Id:        order.ID.Hex(),
+		UserId:    order.UserID,
+		Lines:     lines,
+		Total:     toMoneyResponse(order.Total),
+		Status:    order.Status,
+		CreatedAt: timestamppb.New(order.CreatedAt),
+		UpdatedAt: timestamppb.New(order.UpdatedAt),
+	}
+}
+
+func toMoneyResponse(m money.Money) *orderpb.Money {
+	return &orderpb.Money{Amount: m.Amount, Currency: m.Currency}
+}
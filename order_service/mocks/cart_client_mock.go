@@ -0,0 +1,32 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	cartpb "github.com/tird4d/go-microservices/cart_service/proto"
+	"google.golang.org/grpc"
+)
+
+// CartClientMock mocks the cart_service calls made by order_service.
+// Methods that aren't overridden panic through the nil embedded interface.
+type CartClientMock struct {
+	mock.Mock
+	cartpb.CartServiceClient
+}
+
+func (m *CartClientMock) GetCart(ctx context.Context, in *cartpb.GetCartRequest, opts ...grpc.CallOption) (*cartpb.Cart, error) {
+	args := m.Called(ctx, in)
+	if result, ok := args.Get(0).(*cartpb.Cart); ok {
+		return result, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *CartClientMock) ClearCart(ctx context.Context, in *cartpb.ClearCartRequest, opts ...grpc.CallOption) (*cartpb.ClearCartResponse, error) {
+	args := m.Called(ctx, in)
+	if result, ok := args.Get(0).(*cartpb.ClearCartResponse); ok {
+		return result, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
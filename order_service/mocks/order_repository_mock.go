@@ -0,0 +1,56 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tird4d/go-microservices/order_service/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OrderRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *OrderRepositoryMock) Create(ctx context.Context, order *models.Order) (*models.Order, error) {
+	args := m.Called(ctx, order)
+	if fn, ok := args.Get(0).(func(context.Context, *models.Order) *models.Order); ok {
+		return fn(ctx, order), args.Error(1)
+	}
+	if result, ok := args.Get(0).(*models.Order); ok {
+		return result, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *OrderRepositoryMock) FindByID(ctx context.Context, oid primitive.ObjectID) (*models.Order, error) {
+	args := m.Called(ctx, oid)
+	if result, ok := args.Get(0).(*models.Order); ok {
+		return result, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *OrderRepositoryMock) FindByUser(ctx context.Context, userID string, skip, pageSize int64) ([]*models.Order, error) {
+	args := m.Called(ctx, userID, skip, pageSize)
+	if result, ok := args.Get(0).([]*models.Order); ok {
+		return result, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *OrderRepositoryMock) CountByUser(ctx context.Context, userID string) (int64, error) {
+	args := m.Called(ctx, userID)
+	if count, ok := args.Get(0).(int64); ok {
+		return count, args.Error(1)
+	}
+	return 0, args.Error(1)
+}
+
+func (m *OrderRepositoryMock) UpdateStatus(ctx context.Context, oid primitive.ObjectID, fromStatus, toStatus string) (*models.Order, error) {
+	args := m.Called(ctx, oid, fromStatus, toStatus)
+	if result, ok := args.Get(0).(*models.Order); ok {
+		return result, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
@@ -0,0 +1,24 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"google.golang.org/grpc"
+)
+
+// ProductClientMock mocks the product_service calls made by order_service.
+// Methods that aren't overridden panic through the nil embedded interface.
+type ProductClientMock struct {
+	mock.Mock
+	productpb.ProductServiceClient
+}
+
+func (m *ProductClientMock) GetProduct(ctx context.Context, in *productpb.GetProductRequest, opts ...grpc.CallOption) (*productpb.Product, error) {
+	args := m.Called(ctx, in)
+	if result, ok := args.Get(0).(*productpb.Product); ok {
+		return result, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tird4d/go-microservices/order_service/config"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Checkout saga states. The forward path is
+// started → stock_reserved → payment_authorized → order_created → completed;
+// the last step commits the stock and captures the payment.
+// A failure before order_created, or a reservation that expired before it
+// could be committed, moves the saga to compensating, which undoes the
+// finished steps in reverse and ends in failed.
+const (
+	CheckoutStarted           = "started"
+	CheckoutStockReserved     = "stock_reserved"
+	CheckoutPaymentAuthorized = "payment_authorized"
+	CheckoutOrderCreated      = "order_created"
+	CheckoutCompleted         = "completed"
+	CheckoutCompensating      = "compensating"
+	CheckoutFailed            = "failed"
+)
+
+// CheckoutSaga is the persisted state of one checkout. IDs used by the steps
+// (reservation, order) are fixed when the saga is created, so a step that is
+// re-run after a crash addresses the same resources instead of creating new ones.
+type CheckoutSaga struct {
+	ID            string             `bson:"_id" json:"id"`
+	UserID        string             `bson:"user_id" json:"user_id"`
+	Lines         []OrderLine        `bson:"lines" json:"lines"`
+	Total         money.Money        `bson:"total" json:"total"`
+	State         string             `bson:"state" json:"state"`
+	ReservationID string             `bson:"reservation_id" json:"reservation_id"`
+	PaymentID     string             `bson:"payment_id,omitempty" json:"payment_id,omitempty"`
+	OrderID       primitive.ObjectID `bson:"order_id" json:"order_id"`
+	// PaymentMethod is the payment provider's token for the user's card
+	PaymentMethod string `bson:"payment_method" json:"-"`
+	// ActiveUserID is the user's ID until the saga is done. A unique index
+	// on it lets each user have only one checkout in flight.
+	ActiveUserID string `bson:"active_user_id,omitempty" json:"-"`
+
+	// FailedAt is the state the saga was in when a step failed; it decides
+	// which steps compensation has to undo
+	FailedAt          string `bson:"failed_at,omitempty" json:"failed_at,omitempty"`
+	FailureReason     string `bson:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	CompensationsDone int    `bson:"compensations_done" json:"compensations_done"`
+
+	Attempts      int       `bson:"attempts" json:"attempts"`
+	LastError     string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttemptAt time.Time `bson:"next_attempt_at" json:"next_attempt_at"`
+	// Deadline is when forward progress is given up and compensation starts
+	Deadline time.Time `bson:"deadline" json:"deadline"`
+
+	Version   int64     `bson:"version" json:"version"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Done reports whether the saga reached a terminal state
+func (s *CheckoutSaga) Done() bool {
+	return s.State == CheckoutCompleted || s.State == CheckoutFailed
+}
+
+func CheckoutSagaCollection() *mongo.Collection {
+	return config.DB.Collection("checkout_sagas")
+}
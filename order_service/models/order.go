@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tird4d/go-microservices/order_service/config"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Order statuses. A checkout creates its order as pending; payment events
+// move it to paid once the payment is captured and to refunded once all of
+// it was given back.
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusRefunded  = "refunded"
+	OrderStatusCancelled = "cancelled"
+)
+
+// OrderLine keeps a snapshot of the product at the time the order was placed,
+// so later price or name changes in product_service don't alter old orders
+type OrderLine struct {
+	ProductID   string      `bson:"product_id" json:"product_id"`
+	ProductName string      `bson:"product_name" json:"product_name"`
+	UnitPrice   money.Money `bson:"unit_price" json:"unit_price"`
+	Quantity    int32       `bson:"quantity" json:"quantity"`
+	LineTotal   money.Money `bson:"line_total" json:"line_total"`
+	// SKU is set when the line is for a variant of the product
+	SKU string `bson:"sku,omitempty" json:"sku,omitempty"`
+}
+
+type Order struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	Lines     []OrderLine        `bson:"lines" json:"lines"`
+	Total     money.Money        `bson:"total" json:"total"`
+	Status    string             `bson:"status" json:"status"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// LinesTotal adds up the line totals, which have to share one currency.
+// No lines add up to nothing in the default currency.
+func LinesTotal(lines []OrderLine) (money.Money, error) {
+	if len(lines) == 0 {
+		return money.Zero(money.DefaultCurrency), nil
+	}
+	totals := make([]money.Money, len(lines))
+	for i, line := range lines {
+		totals[i] = line.LineTotal
+	}
+	return money.Sum(lines[0].LineTotal.Currency, totals...)
+}
+
+func OrderCollection() *mongo.Collection {
+	return config.DB.Collection("orders")
+}
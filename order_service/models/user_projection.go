@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tird4d/go-microservices/order_service/config"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UserProjection is order_service's local, read-only copy of a user_service
+// user, built from user_exchange events. Version is the user's version from
+// the event that last wrote it and is used to drop stale redeliveries.
+// Deleted users are kept as tombstones without personal data so a late
+// registration or update event can't bring them back.
+type UserProjection struct {
+	ID        string    `bson:"_id" json:"id"`
+	Email     string    `bson:"email" json:"email"`
+	Name      string    `bson:"name" json:"name"`
+	Version   int64     `bson:"version" json:"version"`
+	Deleted   bool      `bson:"deleted" json:"deleted"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+func UserProjectionCollection() *mongo.Collection {
+	return config.DB.Collection("user_projections")
+}
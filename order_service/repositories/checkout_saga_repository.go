@@ -0,0 +1,28 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tird4d/go-microservices/order_service/models"
+)
+
+// ErrSagaConflict is returned by Save when the stored saga has a different
+// version, i.e. another orchestrator advanced it in the meantime
+var ErrSagaConflict = errors.New("checkout saga was modified concurrently")
+
+// CheckoutSagaRepository persists checkout sagas so they survive restarts
+type CheckoutSagaRepository interface {
+	// Create fails with a duplicate key error if the saga's ActiveUserID
+	// already has a saga in flight
+	Create(ctx context.Context, saga *models.CheckoutSaga) error
+	// FindByID returns mongo.ErrNoDocuments for unknown sagas
+	FindByID(ctx context.Context, id string) (*models.CheckoutSaga, error)
+	// FindActive returns the user's unfinished saga, or mongo.ErrNoDocuments
+	FindActive(ctx context.Context, userID string) (*models.CheckoutSaga, error)
+	// Save writes saga if its version still matches and bumps the version
+	Save(ctx context.Context, saga *models.CheckoutSaga) error
+	// FindDue returns unfinished sagas whose next attempt is due
+	FindDue(ctx context.Context, now time.Time, limit int64) ([]*models.CheckoutSaga, error)
+}
@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tird4d/go-microservices/order_service/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MemoryCheckoutSagaRepository is a mutex-guarded in-memory
+// CheckoutSagaRepository for tests and local runs without Mongo
+type MemoryCheckoutSagaRepository struct {
+	mu    sync.Mutex
+	sagas map[string]models.CheckoutSaga
+}
+
+func NewMemoryCheckoutSagaRepository() *MemoryCheckoutSagaRepository {
+	return &MemoryCheckoutSagaRepository{sagas: make(map[string]models.CheckoutSaga)}
+}
+
+func (r *MemoryCheckoutSagaRepository) Create(ctx context.Context, saga *models.CheckoutSaga) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sagas[saga.ID]; ok {
+		return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key"}}}
+	}
+	if saga.ActiveUserID != "" {
+		for _, stored := range r.sagas {
+			if stored.ActiveUserID == saga.ActiveUserID {
+				return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key"}}}
+			}
+		}
+	}
+
+	r.sagas[saga.ID] = copySaga(saga)
+	return nil
+}
+
+// FindByID returns mongo.ErrNoDocuments for unknown sagas, like the Mongo implementation
+func (r *MemoryCheckoutSagaRepository) FindByID(ctx context.Context, id string) (*models.CheckoutSaga, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	saga, ok := r.sagas[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	found := copySaga(&saga)
+	return &found, nil
+}
+
+func (r *MemoryCheckoutSagaRepository) FindActive(ctx context.Context, userID string) (*models.CheckoutSaga, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, saga := range r.sagas {
+		if saga.ActiveUserID == userID {
+			found := copySaga(&saga)
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *MemoryCheckoutSagaRepository) Save(ctx context.Context, saga *models.CheckoutSaga) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.sagas[saga.ID]
+	if !ok || stored.Version != saga.Version {
+		return ErrSagaConflict
+	}
+
+	saga.Version++
+	saga.UpdatedAt = time.Now()
+	r.sagas[saga.ID] = copySaga(saga)
+	return nil
+}
+
+func (r *MemoryCheckoutSagaRepository) FindDue(ctx context.Context, now time.Time, limit int64) ([]*models.CheckoutSaga, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []*models.CheckoutSaga
+	for _, saga := range r.sagas {
+		if !saga.Done() && !saga.NextAttemptAt.After(now) {
+			found := copySaga(&saga)
+			due = append(due, &found)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if int64(len(due)) > limit {
+		due = due[:limit]
+	}
+
+	return due, nil
+}
+
+// copySaga detaches the stored value from the caller's slice
+func copySaga(saga *models.CheckoutSaga) models.CheckoutSaga {
+	c := *saga
+	c.Lines = append([]models.OrderLine(nil), saga.Lines...)
+	return c
+}
@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tird4d/go-microservices/order_service/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MemoryUserProjectionRepository is a mutex-guarded in-memory
+// UserProjectionRepository for tests and local runs without Mongo
+type MemoryUserProjectionRepository struct {
+	mu    sync.RWMutex
+	users map[string]models.UserProjection
+}
+
+func NewMemoryUserProjectionRepository() *MemoryUserProjectionRepository {
+	return &MemoryUserProjectionRepository{users: make(map[string]models.UserProjection)}
+}
+
+func (r *MemoryUserProjectionRepository) Upsert(ctx context.Context, user *models.UserProjection) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.users[user.ID]; ok && existing.Version >= user.Version {
+		return false, nil
+	}
+
+	r.users[user.ID] = *user
+	return true, nil
+}
+
+// FindByID returns mongo.ErrNoDocuments for unknown users, like the Mongo implementation
+func (r *MemoryUserProjectionRepository) FindByID(ctx context.Context, id string) (*models.UserProjection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	return &user, nil
+}
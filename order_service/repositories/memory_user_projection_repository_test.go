@@ -0,0 +1,39 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tird4d/go-microservices/order_service/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMemoryUserProjectionRepository_ConcurrentUpsertsKeepHighestVersion(t *testing.T) {
+	repo := NewMemoryUserProjectionRepository()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for v := int64(1); v <= 50; v++ {
+		wg.Add(1)
+		go func(v int64) {
+			defer wg.Done()
+			_, err := repo.Upsert(ctx, &models.UserProjection{ID: "u1", Version: v})
+			assert.NoError(t, err)
+		}(v)
+	}
+	wg.Wait()
+
+	user, err := repo.FindByID(ctx, "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50), user.Version)
+}
+
+func TestMemoryUserProjectionRepository_FindByIDUnknownUser(t *testing.T) {
+	repo := NewMemoryUserProjectionRepository()
+
+	_, err := repo.FindByID(context.Background(), "missing")
+
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
@@ -0,0 +1,101 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/order_service/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoCheckoutSagaRepository struct{}
+
+// EnsureIndexes creates the index the recovery loop polls on and the unique
+// index that allows one unfinished saga per user
+func (r *MongoCheckoutSagaRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := models.CheckoutSagaCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "state", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "active_user_id", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"active_user_id": bson.M{"$exists": true}}),
+		},
+	})
+	return err
+}
+
+func (r *MongoCheckoutSagaRepository) Create(ctx context.Context, saga *models.CheckoutSaga) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := models.CheckoutSagaCollection().InsertOne(ctx, saga)
+	return err
+}
+
+func (r *MongoCheckoutSagaRepository) FindByID(ctx context.Context, id string) (*models.CheckoutSaga, error) {
+	saga := &models.CheckoutSaga{}
+
+	if err := models.CheckoutSagaCollection().FindOne(ctx, bson.M{"_id": id}).Decode(saga); err != nil {
+		return nil, err
+	}
+
+	return saga, nil
+}
+
+func (r *MongoCheckoutSagaRepository) FindActive(ctx context.Context, userID string) (*models.CheckoutSaga, error) {
+	saga := &models.CheckoutSaga{}
+
+	if err := models.CheckoutSagaCollection().FindOne(ctx, bson.M{"active_user_id": userID}).Decode(saga); err != nil {
+		return nil, err
+	}
+
+	return saga, nil
+}
+
+// Save replaces the saga only if nobody else saved it since it was read
+func (r *MongoCheckoutSagaRepository) Save(ctx context.Context, saga *models.CheckoutSaga) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	next := *saga
+	next.Version++
+	next.UpdatedAt = time.Now()
+
+	result, err := models.CheckoutSagaCollection().ReplaceOne(ctx, bson.M{"_id": saga.ID, "version": saga.Version}, &next)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrSagaConflict
+	}
+
+	*saga = next
+	return nil
+}
+
+func (r *MongoCheckoutSagaRepository) FindDue(ctx context.Context, now time.Time, limit int64) ([]*models.CheckoutSaga, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"state":           bson.M{"$nin": []string{models.CheckoutCompleted, models.CheckoutFailed}},
+		"next_attempt_at": bson.M{"$lte": now},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetLimit(limit)
+
+	cursor, err := models.CheckoutSagaCollection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sagas []*models.CheckoutSaga
+	if err := cursor.All(ctx, &sagas); err != nil {
+		return nil, err
+	}
+
+	return sagas, nil
+}
@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/order_service/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoOrderRepository struct{}
+
+// Create inserts a new order and returns it with the generated ID
+func (r *MongoOrderRepository) Create(ctx context.Context, order *models.Order) (*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := models.OrderCollection().InsertOne(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	order.ID = result.InsertedID.(primitive.ObjectID)
+
+	return order, nil
+}
+
+// FindByID retrieves an order by ID
+func (r *MongoOrderRepository) FindByID(ctx context.Context, oid primitive.ObjectID) (*models.Order, error) {
+	order := &models.Order{}
+
+	if err := models.OrderCollection().FindOne(ctx, bson.M{"_id": oid}).Decode(order); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// FindByUser retrieves a user's orders, newest first, with pagination
+func (r *MongoOrderRepository) FindByUser(ctx context.Context, userID string, skip, pageSize int64) ([]*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(pageSize)
+
+	cursor, err := models.OrderCollection().Find(ctx, bson.M{"user_id": userID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var orders []*models.Order
+	for cursor.Next(ctx) {
+		var order models.Order
+		if err := cursor.Decode(&order); err == nil {
+			orders = append(orders, &order)
+		}
+	}
+
+	return orders, nil
+}
+
+// CountByUser returns total number of orders placed by a user
+func (r *MongoOrderRepository) CountByUser(ctx context.Context, userID string) (int64, error) {
+	return models.OrderCollection().CountDocuments(ctx, bson.M{"user_id": userID})
+}
+
+// UpdateStatus moves an order from fromStatus to toStatus.
+// The status is part of the filter, so a concurrent transition makes this
+// return mongo.ErrNoDocuments instead of overwriting the other change.
+func (r *MongoOrderRepository) UpdateStatus(ctx context.Context, oid primitive.ObjectID, fromStatus, toStatus string) (*models.Order, error) {
+	filter := bson.M{"_id": oid, "status": fromStatus}
+	update := bson.M{"$set": bson.M{"status": toStatus, "updated_at": time.Now()}}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	order := &models.Order{}
+	if err := models.OrderCollection().FindOneAndUpdate(ctx, filter, update, opts).Decode(order); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
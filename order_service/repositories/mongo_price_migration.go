@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/order_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MigrateFloatPrices converts orders whose prices are stored as numbers in
+// major units, as they were before prices had a currency, into Money in the
+// default currency. Converted orders no longer match, which makes it safe
+// to run on every start.
+func (r *MongoOrderRepository) MigrateFloatPrices(ctx context.Context) (int64, error) {
+	return migrateFloatPrices(ctx, models.OrderCollection())
+}
+
+// MigrateFloatPrices converts the prices of sagas the same way
+// MongoOrderRepository.MigrateFloatPrices converts orders
+func (r *MongoCheckoutSagaRepository) MigrateFloatPrices(ctx context.Context) (int64, error) {
+	return migrateFloatPrices(ctx, models.CheckoutSagaCollection())
+}
+
+// migrateFloatPrices rewrites the total and the unit price and line total
+// of every line in one update per collection
+func migrateFloatPrices(ctx context.Context, collection *mongo.Collection) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	filter := bson.M{"total": bson.M{"$type": bson.A{"double", "int", "long", "decimal"}}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"total": toMoney("$total"),
+		"lines": bson.M{"$map": bson.M{
+			"input": "$lines",
+			"as":    "line",
+			"in": bson.M{"$mergeObjects": bson.A{"$$line", bson.M{
+				"unit_price": toMoney("$$line.unit_price"),
+				"line_total": toMoney("$$line.line_total"),
+			}}},
+		}},
+	}}}}
+
+	result, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// toMoney is the aggregation expression turning the number at field into
+// Money in the default currency, rounded to the nearest minor unit with
+// halves away from zero
+func toMoney(field string) bson.M {
+	scale := money.Scale(money.DefaultCurrency)
+	return bson.M{
+		"amount":   bson.M{"$toLong": roundHalfAwayFromZero(bson.M{"$multiply": bson.A{field, scale}})},
+		"currency": money.DefaultCurrency,
+	}
+}
+
+// roundHalfAwayFromZero is the aggregation expression rounding the number
+// expr evaluates to like math.Round, and so like money.FromMajor: halves
+// round away from zero. $round would round them to even instead.
+func roundHalfAwayFromZero(expr interface{}) bson.M {
+	return bson.M{"$let": bson.M{
+		"vars": bson.M{"value": expr},
+		"in": bson.M{"$cond": bson.A{
+			bson.M{"$gte": bson.A{"$$value", 0}},
+			bson.M{"$floor": bson.M{"$add": bson.A{"$$value", 0.5}}},
+			bson.M{"$ceil": bson.M{"$subtract": bson.A{"$$value", 0.5}}},
+		}},
+	}}
+}
@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/order_service/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoUserProjectionRepository struct{}
+
+// Upsert only matches a stored document with a lower version. If the user
+// exists with an equal or higher version the filter misses, the upsert tries
+// to insert a second document with the same _id and fails with a duplicate
+// key error, which is how a stale event is detected.
+func (r *MongoUserProjectionRepository) Upsert(ctx context.Context, user *models.UserProjection) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": user.ID, "version": bson.M{"$lt": user.Version}}
+	update := bson.M{"$set": bson.M{
+		"email":      user.Email,
+		"name":       user.Name,
+		"version":    user.Version,
+		"deleted":    user.Deleted,
+		"updated_at": user.UpdatedAt,
+	}}
+
+	_, err := models.UserProjectionCollection().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// FindByID retrieves a user projection by user ID
+func (r *MongoUserProjectionRepository) FindByID(ctx context.Context, id string) (*models.UserProjection, error) {
+	user := &models.UserProjection{}
+
+	if err := models.UserProjectionCollection().FindOne(ctx, bson.M{"_id": id}).Decode(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
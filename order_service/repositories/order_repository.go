@@ -0,0 +1,17 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/tird4d/go-microservices/order_service/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OrderRepository defines the interface for order data operations
+type OrderRepository interface {
+	Create(ctx context.Context, order *models.Order) (*models.Order, error)
+	FindByID(ctx context.Context, oid primitive.ObjectID) (*models.Order, error)
+	FindByUser(ctx context.Context, userID string, skip, pageSize int64) ([]*models.Order, error)
+	CountByUser(ctx context.Context, userID string) (int64, error)
+	UpdateStatus(ctx context.Context, oid primitive.ObjectID, fromStatus, toStatus string) (*models.Order, error)
+}
@@ -0,0 +1,17 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/tird4d/go-microservices/order_service/models"
+)
+
+// UserProjectionRepository stores the users order_service learns about from
+// user_service events
+type UserProjectionRepository interface {
+	// Upsert writes the projection only if it is newer than the stored one.
+	// It reports false when an equal or newer version was already stored,
+	// so redelivered or reordered events never roll a user back.
+	Upsert(ctx context.Context, user *models.UserProjection) (bool, error)
+	FindByID(ctx context.Context, id string) (*models.UserProjection, error)
+}
@@ -0,0 +1,103 @@
+package saga
+
+import (
+	"context"
+	"time"
+
+	cartpb "github.com/tird4d/go-microservices/cart_service/proto"
+	"github.com/tird4d/go-microservices/order_service/models"
+	paymentpb "github.com/tird4d/go-microservices/payment_service/proto"
+	"github.com/tird4d/go-microservices/product_service/money"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ProductInventory holds stock through product_service's reservation RPCs.
+// The saga's reservation ID is used as the product_service reservation ID,
+// which makes every call idempotent across retries and restarts.
+type ProductInventory struct {
+	Products productpb.ProductServiceClient
+	// TTL is how long product_service holds the stock if the saga never
+	// commits or releases it. It must comfortably exceed the saga timeout;
+	// the saga extends it before creating the order.
+	TTL time.Duration
+}
+
+func (i *ProductInventory) Reserve(ctx context.Context, reservationID string, lines []models.OrderLine) error {
+	req := &productpb.ReserveStockRequest{
+		ReservationId: reservationID,
+		TtlSeconds:    int32(i.TTL / time.Second),
+	}
+	for _, line := range lines {
+		req.Lines = append(req.Lines, &productpb.StockReservationLine{
+			ProductId: line.ProductID,
+			Sku:       line.SKU,
+			Quantity:  line.Quantity,
+		})
+	}
+
+	_, err := i.Products.ReserveStock(ctx, req)
+	if status.Code(err) == codes.NotFound {
+		return status.Errorf(codes.FailedPrecondition, "product is no longer available: %s", status.Convert(err).Message())
+	}
+	return err
+}
+
+func (i *ProductInventory) Extend(ctx context.Context, reservationID string, ttl time.Duration) error {
+	_, err := i.Products.ExtendReservation(ctx, &productpb.ExtendReservationRequest{
+		ReservationId: reservationID,
+		TtlSeconds:    int32(ttl / time.Second),
+	})
+	return err
+}
+
+func (i *ProductInventory) Release(ctx context.Context, reservationID string, lines []models.OrderLine) error {
+	_, err := i.Products.ReleaseReservation(ctx, &productpb.ReleaseReservationRequest{ReservationId: reservationID})
+	return err
+}
+
+func (i *ProductInventory) Commit(ctx context.Context, reservationID string, lines []models.OrderLine) error {
+	_, err := i.Products.CommitReservation(ctx, &productpb.CommitReservationRequest{ReservationId: reservationID})
+	return err
+}
+
+// PaymentServicePayments charges checkouts through payment_service. Capture
+// and Void use keys derived from the checkout, so repeating them is safe.
+type PaymentServicePayments struct {
+	Client paymentpb.PaymentServiceClient
+}
+
+func (p *PaymentServicePayments) Authorize(ctx context.Context, key, userID, orderID, paymentMethod string, amount money.Money) (string, error) {
+	payment, err := p.Client.Authorize(ctx, &paymentpb.AuthorizeRequest{
+		IdempotencyKey: key,
+		UserId:         userID,
+		OrderId:        orderID,
+		Amount:         &paymentpb.Money{Amount: amount.Amount, Currency: amount.Currency},
+		PaymentMethod:  paymentMethod,
+	})
+	if err != nil {
+		return "", err
+	}
+	return payment.GetId(), nil
+}
+
+func (p *PaymentServicePayments) Capture(ctx context.Context, key, paymentID string) error {
+	_, err := p.Client.Capture(ctx, &paymentpb.CaptureRequest{IdempotencyKey: key, PaymentId: paymentID})
+	return err
+}
+
+func (p *PaymentServicePayments) Void(ctx context.Context, key, paymentID string) error {
+	_, err := p.Client.Void(ctx, &paymentpb.VoidRequest{IdempotencyKey: key, PaymentId: paymentID})
+	return err
+}
+
+// CartServiceCarts clears carts through cart_service
+type CartServiceCarts struct {
+	Client cartpb.CartServiceClient
+}
+
+func (c *CartServiceCarts) Clear(ctx context.Context, userID string) error {
+	_, err := c.Client.ClearCart(ctx, &cartpb.ClearCartRequest{UserId: userID})
+	return err
+}
@@ -0,0 +1,478 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tird4d/go-microservices/order_service/logger"
+	"github.com/tird4d/go-microservices/order_service/models"
+	"github.com/tird4d/go-microservices/order_service/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultStepTimeout  = 5 * time.Second
+	defaultSagaTimeout  = 2 * time.Minute
+	defaultPollInterval = 5 * time.Second
+	defaultBatchSize    = 20
+	// defaultCommitHold is product_service's maximum reservation TTL
+	defaultCommitHold = 24 * time.Hour
+
+	// leaseMargin is added to the step timeout while a step runs, so the
+	// recovery loop doesn't pick up a saga that is still being worked on
+	leaseMargin = 5 * time.Second
+
+	minRetryDelay = 1 * time.Second
+	maxRetryDelay = 1 * time.Minute
+)
+
+// Orchestrator drives checkout sagas: reserve stock, authorize payment,
+// create the order, then commit the reservation and capture the payment.
+// Every transition is saved before the next step runs, so a restarted
+// orchestrator resumes a saga from its last recorded state (see Resume).
+//
+// Once the order is created the saga only moves forward: committing the
+// reservation and capturing the payment are retried until they succeed. A
+// step failing before that point compensates the earlier steps in reverse
+// order. The one exception is a reservation that can no longer be committed
+// because it expired: the stock may have been sold again, so the order is
+// cancelled and the payment voided.
+type Orchestrator struct {
+	Sagas     repositories.CheckoutSagaRepository
+	Orders    repositories.OrderRepository
+	Inventory Inventory
+	Payments  Payments
+	// Carts is optional; when set the user's cart is emptied on completion
+	Carts Carts
+
+	// StepTimeout bounds a single call to another service
+	StepTimeout time.Duration
+	// SagaTimeout is how long a checkout may take to reach the order
+	// before it's abandoned and compensated
+	SagaTimeout time.Duration
+	// CommitHold is how long the reservation is extended to just before the
+	// order is created, so it outlives the retries of the commit
+	CommitHold time.Duration
+	// PollInterval is how often Resume looks for sagas due for a retry
+	PollInterval time.Duration
+	BatchSize    int64
+}
+
+type step func(ctx context.Context, saga *models.CheckoutSaga) error
+
+// Start persists a new saga for lines, paid with paymentMethod, and runs it
+// as far as it can go. The returned saga is either done or has a retry
+// scheduled that Resume will pick up. A user has at most one checkout in
+// flight: while one is, Start returns it instead of starting another, so a
+// repeated request doesn't order and charge twice.
+func (o *Orchestrator) Start(ctx context.Context, userID, paymentMethod string, lines []models.OrderLine) (*models.CheckoutSaga, error) {
+	total, err := models.LinesTotal(lines)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	id := uuid.NewString()
+	saga := &models.CheckoutSaga{
+		ID:            id,
+		UserID:        userID,
+		ActiveUserID:  userID,
+		Lines:         lines,
+		Total:         total,
+		State:         models.CheckoutStarted,
+		ReservationID: id,
+		OrderID:       primitive.NewObjectID(),
+		PaymentMethod: paymentMethod,
+		NextAttemptAt: now,
+		Deadline:      now.Add(o.sagaTimeout()),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if err := o.Sagas.Create(ctx, saga); err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		active, findErr := o.Sagas.FindActive(ctx, userID)
+		if findErr != nil {
+			// It finished in the meantime
+			return nil, err
+		}
+		logger.Log.Infow("Checkout already in progress", "checkout_id", active.ID, "user_id", userID)
+		return active, nil
+	}
+
+	logger.Log.Infow("🛒 Checkout started", "checkout_id", id, "user_id", userID, "total", total)
+
+	return o.Run(ctx, saga)
+}
+
+// Run advances saga until it's done or a step has to be retried later.
+// It keeps going if ctx is cancelled, because abandoning a step halfway
+// would leave the saga's state behind what actually happened.
+func (o *Orchestrator) Run(ctx context.Context, saga *models.CheckoutSaga) (*models.CheckoutSaga, error) {
+	if saga.Done() {
+		return saga, nil
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	for !saga.Done() {
+		if saga.State != models.CheckoutCompensating && !pastPivot(saga) && time.Now().After(saga.Deadline) {
+			startCompensation(saga, "checkout timed out")
+			if err := o.Sagas.Save(ctx, saga); err != nil {
+				return saga, err
+			}
+			continue
+		}
+
+		// Claim the saga for the duration of the step
+		saga.NextAttemptAt = time.Now().Add(o.stepTimeout() + leaseMargin)
+		if err := o.Sagas.Save(ctx, saga); err != nil {
+			return saga, err
+		}
+
+		stepCtx, cancel := context.WithTimeout(ctx, o.stepTimeout())
+		from := saga.State
+		err := o.nextStep(saga)(stepCtx, saga)
+		cancel()
+
+		switch {
+		case err == nil:
+			saga.Attempts = 0
+			saga.LastError = ""
+			saga.NextAttemptAt = time.Now()
+			if saga.Done() {
+				saga.ActiveUserID = ""
+			}
+
+		case from != models.CheckoutCompensating && !pastPivot(saga) && !retryable(err):
+			logger.Log.Warnw("⚠️ Checkout step rejected, compensating",
+				"checkout_id", saga.ID,
+				"state", from,
+				"error", err,
+			)
+			startCompensation(saga, failureReason(err))
+
+		default:
+			saga.Attempts++
+			saga.LastError = err.Error()
+			saga.NextAttemptAt = time.Now().Add(retryDelay(saga.Attempts))
+
+			logger.Log.Warnw("⚠️ Checkout step failed, retry scheduled",
+				"checkout_id", saga.ID,
+				"state", from,
+				"attempt", saga.Attempts,
+				"retry_at", saga.NextAttemptAt,
+				"error", err,
+			)
+
+			if err := o.Sagas.Save(ctx, saga); err != nil {
+				return saga, err
+			}
+			return saga, nil
+		}
+
+		if err := o.Sagas.Save(ctx, saga); err != nil {
+			return saga, err
+		}
+	}
+
+	if saga.State == models.CheckoutCompleted {
+		o.clearCart(ctx, saga)
+		logger.Log.Infow("✅ Checkout completed", "checkout_id", saga.ID, "order_id", saga.OrderID.Hex())
+	} else {
+		logger.Log.Infow("Checkout failed", "checkout_id", saga.ID, "reason", saga.FailureReason)
+	}
+
+	return saga, nil
+}
+
+// Resume periodically runs sagas that are due for a retry, including those
+// left unfinished by a previous process, until ctx is cancelled
+func (o *Orchestrator) Resume(ctx context.Context) {
+	ticker := time.NewTicker(o.pollInterval())
+	defer ticker.Stop()
+
+	for {
+		o.resumeDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *Orchestrator) resumeDue(ctx context.Context) {
+	sagas, err := o.Sagas.FindDue(ctx, time.Now(), o.batchSize())
+	if err != nil {
+		logger.Log.Errorw("Failed to load due checkout sagas", "error", err)
+		return
+	}
+
+	for _, saga := range sagas {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if _, err := o.Run(ctx, saga); err != nil {
+			if errors.Is(err, repositories.ErrSagaConflict) {
+				// Another orchestrator is already running it
+				continue
+			}
+			logger.Log.Errorw("Failed to resume checkout saga", "checkout_id", saga.ID, "error", err)
+		}
+	}
+}
+
+// nextStep returns the action that moves saga out of its current state
+func (o *Orchestrator) nextStep(saga *models.CheckoutSaga) step {
+	switch saga.State {
+	case models.CheckoutStarted:
+		return o.reserveStock
+	case models.CheckoutStockReserved:
+		return o.authorizePayment
+	case models.CheckoutPaymentAuthorized:
+		return o.createOrder
+	case models.CheckoutOrderCreated:
+		return o.completeOrder
+	default:
+		return o.compensate
+	}
+}
+
+func (o *Orchestrator) reserveStock(ctx context.Context, saga *models.CheckoutSaga) error {
+	if err := o.Inventory.Reserve(ctx, saga.ReservationID, saga.Lines); err != nil {
+		return err
+	}
+	saga.State = models.CheckoutStockReserved
+	return nil
+}
+
+func (o *Orchestrator) authorizePayment(ctx context.Context, saga *models.CheckoutSaga) error {
+	paymentID, err := o.Payments.Authorize(ctx, saga.ID, saga.UserID, saga.OrderID.Hex(), saga.PaymentMethod, saga.Total)
+	if err != nil {
+		return err
+	}
+	saga.PaymentID = paymentID
+	saga.State = models.CheckoutPaymentAuthorized
+	return nil
+}
+
+// createOrder extends the reservation and inserts the order under the ID
+// fixed at saga creation. A duplicate key means an earlier attempt already
+// inserted it.
+func (o *Orchestrator) createOrder(ctx context.Context, saga *models.CheckoutSaga) error {
+	if err := o.Inventory.Extend(ctx, saga.ReservationID, o.commitHold()); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	order := &models.Order{
+		ID:        saga.OrderID,
+		UserID:    saga.UserID,
+		Lines:     saga.Lines,
+		Total:     saga.Total,
+		Status:    models.OrderStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if _, err := o.Orders.Create(ctx, order); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	saga.State = models.CheckoutOrderCreated
+	return nil
+}
+
+// completeOrder commits the reservation and captures the payment. Both calls
+// are idempotent, so the step is simply re-run when either fails. A capture
+// the provider declines can't be retried; the order then stays pending and
+// unpaid for someone to follow up. A commit rejected for good means the
+// reservation expired and its stock went back on sale, so the order is
+// compensated instead of being fulfilled from stock that may be gone.
+func (o *Orchestrator) completeOrder(ctx context.Context, saga *models.CheckoutSaga) error {
+	if err := o.Inventory.Commit(ctx, saga.ReservationID, saga.Lines); err != nil {
+		if retryable(err) {
+			return err
+		}
+		logger.Log.Errorw("❌ Stock reservation lost after the order was created, cancelling the order",
+			"checkout_id", saga.ID,
+			"order_id", saga.OrderID.Hex(),
+			"reservation_id", saga.ReservationID,
+			"error", err,
+		)
+		startCompensation(saga, "the reserved stock is no longer available")
+		return nil
+	}
+
+	if err := o.Payments.Capture(ctx, saga.ID+":capture", saga.PaymentID); err != nil {
+		if retryable(err) {
+			return err
+		}
+		logger.Log.Errorw("❌ Payment capture rejected, order left unpaid",
+			"checkout_id", saga.ID,
+			"order_id", saga.OrderID.Hex(),
+			"payment_id", saga.PaymentID,
+			"error", err,
+		)
+	}
+
+	saga.State = models.CheckoutCompleted
+	return nil
+}
+
+// compensate undoes the next outstanding step. CompensationsDone is saved
+// after each one, so a resumed saga doesn't repeat finished compensations.
+func (o *Orchestrator) compensate(ctx context.Context, saga *models.CheckoutSaga) error {
+	compensations := o.compensationsFor(saga.FailedAt)
+
+	if saga.CompensationsDone < len(compensations) {
+		if err := compensations[saga.CompensationsDone](ctx, saga); err != nil {
+			return err
+		}
+		saga.CompensationsDone++
+	}
+
+	if saga.CompensationsDone >= len(compensations) {
+		saga.State = models.CheckoutFailed
+	}
+	return nil
+}
+
+// compensationsFor lists, newest first, the undo actions for a saga that
+// failed in state failedAt. The step that failed is undone as well, since it
+// may have taken effect before timing out.
+func (o *Orchestrator) compensationsFor(failedAt string) []step {
+	switch failedAt {
+	case models.CheckoutStarted:
+		return []step{o.releaseStock}
+	case models.CheckoutStockReserved:
+		return []step{o.voidPayment, o.releaseStock}
+	case models.CheckoutPaymentAuthorized, models.CheckoutOrderCreated:
+		return []step{o.cancelOrder, o.voidPayment, o.releaseStock}
+	default:
+		return nil
+	}
+}
+
+func (o *Orchestrator) releaseStock(ctx context.Context, saga *models.CheckoutSaga) error {
+	return ignoreNotFound(o.Inventory.Release(ctx, saga.ReservationID, saga.Lines))
+}
+
+// voidPayment voids the checkout's authorization. Without a payment ID the
+// authorization may still have gone through with its answer lost, so it is
+// repeated with the same key first: payment_service answers with the
+// existing payment, or with the decline, without holding the amount twice.
+func (o *Orchestrator) voidPayment(ctx context.Context, saga *models.CheckoutSaga) error {
+	if saga.PaymentID == "" {
+		paymentID, err := o.Payments.Authorize(ctx, saga.ID, saga.UserID, saga.OrderID.Hex(), saga.PaymentMethod, saga.Total)
+		switch {
+		case err == nil:
+			saga.PaymentID = paymentID
+		case retryable(err):
+			return err
+		default:
+			// Declined, so nothing is held
+			return nil
+		}
+	}
+	return ignoreNotFound(o.Payments.Void(ctx, saga.ID+":void", saga.PaymentID))
+}
+
+func (o *Orchestrator) cancelOrder(ctx context.Context, saga *models.CheckoutSaga) error {
+	_, err := o.Orders.UpdateStatus(ctx, saga.OrderID, models.OrderStatusPending, models.OrderStatusCancelled)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	return err
+}
+
+func (o *Orchestrator) clearCart(ctx context.Context, saga *models.CheckoutSaga) {
+	if o.Carts == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, o.stepTimeout())
+	defer cancel()
+
+	if err := o.Carts.Clear(ctx, saga.UserID); err != nil {
+		logger.Log.Warnw("⚠️ Failed to clear cart after checkout", "checkout_id", saga.ID, "user_id", saga.UserID, "error", err)
+	}
+}
+
+// pastPivot reports whether the order exists, after which the saga only moves
+// forward unless its reservation is lost
+func pastPivot(saga *models.CheckoutSaga) bool {
+	return saga.State == models.CheckoutOrderCreated || saga.State == models.CheckoutCompleted
+}
+
+func startCompensation(saga *models.CheckoutSaga, reason string) {
+	saga.FailedAt = saga.State
+	saga.FailureReason = reason
+	saga.State = models.CheckoutCompensating
+	saga.CompensationsDone = 0
+	saga.Attempts = 0
+	saga.NextAttemptAt = time.Now()
+}
+
+// ignoreNotFound treats undoing something that doesn't exist as done
+func ignoreNotFound(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	return err
+}
+
+// retryDelay is an exponential backoff capped at maxRetryDelay
+func retryDelay(attempts int) time.Duration {
+	delay := minRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+func (o *Orchestrator) stepTimeout() time.Duration {
+	if o.StepTimeout > 0 {
+		return o.StepTimeout
+	}
+	return defaultStepTimeout
+}
+
+func (o *Orchestrator) sagaTimeout() time.Duration {
+	if o.SagaTimeout > 0 {
+		return o.SagaTimeout
+	}
+	return defaultSagaTimeout
+}
+
+func (o *Orchestrator) commitHold() time.Duration {
+	if o.CommitHold > 0 {
+		return o.CommitHold
+	}
+	return defaultCommitHold
+}
+
+func (o *Orchestrator) pollInterval() time.Duration {
+	if o.PollInterval > 0 {
+		return o.PollInterval
+	}
+	return defaultPollInterval
+}
+
+func (o *Orchestrator) batchSize() int64 {
+	if o.BatchSize > 0 {
+		return o.BatchSize
+	}
+	return defaultBatchSize
+}
@@ -0,0 +1,543 @@
+package saga
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/order_service/logger"
+	"github.com/tird4d/go-microservices/order_service/models"
+	"github.com/tird4d/go-microservices/order_service/repositories"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger(true)
+
+	os.Exit(m.Run())
+}
+
+// failures pops the next scripted error for a call, nil once exhausted
+type failures []error
+
+func (f *failures) next() error {
+	if len(*f) == 0 {
+		return nil
+	}
+	err := (*f)[0]
+	*f = (*f)[1:]
+	return err
+}
+
+type fakeInventory struct {
+	mu                                   sync.Mutex
+	reserveErrs, extendErrs, commitErrs  failures
+	reserved, released, commits, extends int
+	extendedBy                           time.Duration
+}
+
+func (f *fakeInventory) Reserve(ctx context.Context, reservationID string, lines []models.OrderLine) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.reserveErrs.next(); err != nil {
+		return err
+	}
+	f.reserved++
+	return nil
+}
+
+func (f *fakeInventory) Extend(ctx context.Context, reservationID string, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.extendErrs.next(); err != nil {
+		return err
+	}
+	f.extends++
+	f.extendedBy = ttl
+	return nil
+}
+
+func (f *fakeInventory) Release(ctx context.Context, reservationID string, lines []models.OrderLine) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released++
+	return nil
+}
+
+func (f *fakeInventory) Commit(ctx context.Context, reservationID string, lines []models.OrderLine) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.commitErrs.next(); err != nil {
+		return err
+	}
+	f.commits++
+	return nil
+}
+
+// fakePayments answers a repeated authorization key like payment_service:
+// with the payment it made or the decline it gave the first time
+type fakePayments struct {
+	authorizeErrs, captureErrs failures
+	// lostResponses authorizations hold the amount but time out
+	lostResponses int
+	held          map[string]string
+	declined      map[string]error
+	captured      []string
+	voided        []string
+	captureKeys   []string
+}
+
+func (f *fakePayments) Authorize(ctx context.Context, key, userID, orderID, paymentMethod string, amount money.Money) (string, error) {
+	if err, ok := f.declined[key]; ok {
+		return "", err
+	}
+	if paymentID, ok := f.held[key]; ok {
+		return paymentID, nil
+	}
+	if err := f.authorizeErrs.next(); err != nil {
+		if !retryable(err) {
+			f.declined[key] = err
+		}
+		return "", err
+	}
+
+	f.held[key] = "pay-" + key
+	if f.lostResponses > 0 {
+		f.lostResponses--
+		return "", status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	}
+	return f.held[key], nil
+}
+
+func (f *fakePayments) Capture(ctx context.Context, key, paymentID string) error {
+	f.captureKeys = append(f.captureKeys, key)
+	if err := f.captureErrs.next(); err != nil {
+		return err
+	}
+	f.captured = append(f.captured, paymentID)
+	return nil
+}
+
+func (f *fakePayments) Void(ctx context.Context, key, paymentID string) error {
+	f.voided = append(f.voided, paymentID)
+	return nil
+}
+
+type fakeCarts struct{ cleared []string }
+
+func (f *fakeCarts) Clear(ctx context.Context, userID string) error {
+	f.cleared = append(f.cleared, userID)
+	return nil
+}
+
+// fakeOrders is the part of OrderRepository the orchestrator uses
+type fakeOrders struct {
+	repositories.OrderRepository
+	createErrs failures
+	orders     map[primitive.ObjectID]*models.Order
+}
+
+func (f *fakeOrders) Create(ctx context.Context, order *models.Order) (*models.Order, error) {
+	if err := f.createErrs.next(); err != nil {
+		return nil, err
+	}
+	if _, ok := f.orders[order.ID]; ok {
+		return nil, mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key"}}}
+	}
+	f.orders[order.ID] = order
+	return order, nil
+}
+
+func (f *fakeOrders) UpdateStatus(ctx context.Context, oid primitive.ObjectID, fromStatus, toStatus string) (*models.Order, error) {
+	order, ok := f.orders[oid]
+	if !ok || order.Status != fromStatus {
+		return nil, mongo.ErrNoDocuments
+	}
+	order.Status = toStatus
+	return order, nil
+}
+
+type fixture struct {
+	orchestrator *Orchestrator
+	sagas        *repositories.MemoryCheckoutSagaRepository
+	inventory    *fakeInventory
+	payments     *fakePayments
+	orders       *fakeOrders
+	carts        *fakeCarts
+}
+
+func newFixture() *fixture {
+	f := &fixture{
+		sagas:     repositories.NewMemoryCheckoutSagaRepository(),
+		inventory: &fakeInventory{},
+		payments:  &fakePayments{held: make(map[string]string), declined: make(map[string]error)},
+		orders:    &fakeOrders{orders: make(map[primitive.ObjectID]*models.Order)},
+		carts:     &fakeCarts{},
+	}
+	f.orchestrator = &Orchestrator{
+		Sagas:       f.sagas,
+		Orders:      f.orders,
+		Inventory:   f.inventory,
+		Payments:    f.payments,
+		Carts:       f.carts,
+		StepTimeout: time.Second,
+	}
+	return f
+}
+
+const testCard = "4242424242424242"
+
+var testLines = []models.OrderLine{
+	{ProductID: "p1", ProductName: "Laptop", UnitPrice: money.New(1000, "EUR"), Quantity: 1, LineTotal: money.New(1000, "EUR")},
+	{ProductID: "p2", ProductName: "Mouse", UnitPrice: money.New(25, "EUR"), Quantity: 2, LineTotal: money.New(50, "EUR")},
+}
+
+// makeDue lets a scheduled retry run right away
+func (f *fixture) makeDue(t *testing.T, id string) {
+	saga, err := f.sagas.FindByID(context.Background(), id)
+	require.NoError(t, err)
+	saga.NextAttemptAt = time.Now().Add(-time.Second)
+	require.NoError(t, f.sagas.Save(context.Background(), saga))
+}
+
+func TestCheckout_HappyPath(t *testing.T) {
+	f := newFixture()
+
+	saga, err := f.orchestrator.Start(context.Background(), "user-1", testCard, testLines)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutCompleted, saga.State)
+	assert.Equal(t, money.New(1050, "EUR"), saga.Total)
+	assert.Equal(t, "pay-"+saga.ID, saga.PaymentID)
+	assert.Equal(t, 1, f.inventory.reserved)
+	assert.Equal(t, 1, f.inventory.extends)
+	assert.Equal(t, defaultCommitHold, f.inventory.extendedBy, "the reservation is held for the commit retries")
+	assert.Equal(t, 1, f.inventory.commits)
+	assert.Equal(t, []string{saga.PaymentID}, f.payments.captured)
+	assert.Equal(t, []string{"user-1"}, f.carts.cleared)
+
+	order := f.orders.orders[saga.OrderID]
+	require.NotNil(t, order)
+	assert.Equal(t, models.OrderStatusPending, order.Status)
+	assert.Equal(t, money.New(1050, "EUR"), order.Total)
+
+	stored, err := f.sagas.FindByID(context.Background(), saga.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutCompleted, stored.State, "final state should be persisted")
+}
+
+func TestCheckout_OutOfStockFailsWithoutSideEffects(t *testing.T) {
+	f := newFixture()
+	f.inventory.reserveErrs = failures{status.Error(codes.FailedPrecondition, "insufficient stock for product p1")}
+
+	saga, err := f.orchestrator.Start(context.Background(), "user-1", testCard, testLines)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutFailed, saga.State)
+	assert.Equal(t, "insufficient stock for product p1", saga.FailureReason)
+	assert.Equal(t, 1, f.inventory.released, "a failed reservation is released in case it partly went through")
+	assert.Empty(t, f.payments.voided)
+	assert.Empty(t, f.orders.orders)
+	assert.Empty(t, f.carts.cleared, "the cart is kept when checkout fails")
+}
+
+func TestCheckout_PaymentDeclinedReleasesStock(t *testing.T) {
+	f := newFixture()
+	f.payments.authorizeErrs = failures{status.Error(codes.FailedPrecondition, "card declined")}
+
+	saga, err := f.orchestrator.Start(context.Background(), "user-1", testCard, testLines)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutFailed, saga.State)
+	assert.Equal(t, models.CheckoutStockReserved, saga.FailedAt)
+	assert.Equal(t, "card declined", saga.FailureReason)
+	assert.Equal(t, 1, f.inventory.released)
+	assert.Empty(t, f.payments.voided, "a declined payment holds nothing")
+	assert.Empty(t, f.orders.orders)
+}
+
+func TestCheckout_LostAuthorizationIsVoided(t *testing.T) {
+	f := newFixture()
+	f.payments.lostResponses = 1
+	ctx := context.Background()
+
+	saga, err := f.orchestrator.Start(ctx, "user-1", testCard, testLines)
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutStockReserved, saga.State)
+	assert.Empty(t, saga.PaymentID)
+
+	// The checkout times out before the retry, with the amount still held
+	stored, err := f.sagas.FindByID(ctx, saga.ID)
+	require.NoError(t, err)
+	stored.Deadline = time.Now().Add(-time.Second)
+	stored.NextAttemptAt = time.Now().Add(-time.Second)
+	require.NoError(t, f.sagas.Save(ctx, stored))
+
+	f.orchestrator.resumeDue(ctx)
+
+	stored, err = f.sagas.FindByID(ctx, saga.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutFailed, stored.State)
+	assert.Equal(t, []string{"pay-" + saga.ID}, f.payments.voided)
+	assert.Equal(t, 1, f.inventory.released)
+}
+
+func TestCheckout_OrderFailureVoidsPaymentAndReleasesStock(t *testing.T) {
+	f := newFixture()
+	f.orders.createErrs = failures{status.Error(codes.InvalidArgument, "invalid order")}
+
+	saga, err := f.orchestrator.Start(context.Background(), "user-1", testCard, testLines)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutFailed, saga.State)
+	assert.Equal(t, []string{"pay-" + saga.ID}, f.payments.voided)
+	assert.Equal(t, 1, f.inventory.released)
+	assert.Equal(t, 0, f.inventory.commits)
+}
+
+func TestCheckout_TransientFailureIsRetriedByResume(t *testing.T) {
+	f := newFixture()
+	f.inventory.reserveErrs = failures{status.Error(codes.Unavailable, "product service down")}
+	ctx := context.Background()
+
+	saga, err := f.orchestrator.Start(ctx, "user-1", testCard, testLines)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutStarted, saga.State, "saga should wait for a retry")
+	assert.Equal(t, 1, saga.Attempts)
+	assert.True(t, saga.NextAttemptAt.After(time.Now()))
+
+	f.makeDue(t, saga.ID)
+	f.orchestrator.resumeDue(ctx)
+
+	stored, err := f.sagas.FindByID(ctx, saga.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutCompleted, stored.State)
+	assert.Equal(t, 0, stored.Attempts)
+}
+
+func TestCheckout_RepeatedCheckoutReturnsTheOneInFlight(t *testing.T) {
+	f := newFixture()
+	f.inventory.reserveErrs = failures{status.Error(codes.Unavailable, "product service down")}
+	ctx := context.Background()
+
+	first, err := f.orchestrator.Start(ctx, "user-1", testCard, testLines)
+	require.NoError(t, err)
+	require.Equal(t, models.CheckoutStarted, first.State)
+
+	second, err := f.orchestrator.Start(ctx, "user-1", testCard, testLines)
+
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID, "a double submit must not start a second saga")
+	assert.Empty(t, f.payments.held)
+
+	f.makeDue(t, first.ID)
+	f.orchestrator.resumeDue(ctx)
+
+	third, err := f.orchestrator.Start(ctx, "user-1", testCard, testLines)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, third.ID, "a finished checkout doesn't block the next one")
+	assert.Equal(t, models.CheckoutCompleted, third.State)
+}
+
+func TestCheckout_ResumesAfterRestart(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+
+	// A previous process authorized the payment, inserted the order and then
+	// died before recording the order_created transition
+	now := time.Now()
+	saga := &models.CheckoutSaga{
+		ID:            "checkout-1",
+		UserID:        "user-1",
+		Lines:         testLines,
+		Total:         money.New(1050, "EUR"),
+		State:         models.CheckoutPaymentAuthorized,
+		ReservationID: "checkout-1",
+		PaymentID:     "pay-checkout-1",
+		OrderID:       primitive.NewObjectID(),
+		NextAttemptAt: now.Add(-time.Second),
+		Deadline:      now.Add(time.Minute),
+		CreatedAt:     now,
+	}
+	require.NoError(t, f.sagas.Create(ctx, saga))
+	f.orders.orders[saga.OrderID] = &models.Order{ID: saga.OrderID, Status: models.OrderStatusPending}
+
+	f.orchestrator.resumeDue(ctx)
+
+	stored, err := f.sagas.FindByID(ctx, saga.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutCompleted, stored.State)
+	assert.Len(t, f.orders.orders, 1, "re-running the step must not create a second order")
+	assert.Equal(t, 1, f.inventory.commits)
+}
+
+func TestCheckout_InFlightSagaIsNotResumed(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, f.sagas.Create(ctx, &models.CheckoutSaga{
+		ID:            "checkout-1",
+		State:         models.CheckoutStarted,
+		NextAttemptAt: now.Add(10 * time.Second), // leased by a running step
+		Deadline:      now.Add(time.Minute),
+	}))
+
+	f.orchestrator.resumeDue(ctx)
+
+	assert.Equal(t, 0, f.inventory.reserved)
+}
+
+func TestCheckout_TimeoutCompensates(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, f.sagas.Create(ctx, &models.CheckoutSaga{
+		ID:            "checkout-1",
+		UserID:        "user-1",
+		Lines:         testLines,
+		State:         models.CheckoutStockReserved,
+		ReservationID: "checkout-1",
+		Attempts:      6,
+		NextAttemptAt: now.Add(-time.Second),
+		Deadline:      now.Add(-time.Second),
+	}))
+
+	f.orchestrator.resumeDue(ctx)
+
+	stored, err := f.sagas.FindByID(ctx, "checkout-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutFailed, stored.State)
+	assert.Equal(t, "checkout timed out", stored.FailureReason)
+	assert.Equal(t, 1, f.inventory.released)
+}
+
+func TestCheckout_CommitIsRetriedPastTheDeadline(t *testing.T) {
+	f := newFixture()
+	f.inventory.commitErrs = failures{status.Error(codes.Unavailable, "product service down")}
+	ctx := context.Background()
+
+	saga, err := f.orchestrator.Start(ctx, "user-1", testCard, testLines)
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutOrderCreated, saga.State, "the order exists, so the saga can't be rolled back")
+
+	stored, err := f.sagas.FindByID(ctx, saga.ID)
+	require.NoError(t, err)
+	stored.Deadline = time.Now().Add(-time.Second)
+	stored.NextAttemptAt = time.Now().Add(-time.Second)
+	require.NoError(t, f.sagas.Save(ctx, stored))
+
+	f.orchestrator.resumeDue(ctx)
+
+	stored, err = f.sagas.FindByID(ctx, saga.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutCompleted, stored.State)
+	assert.Equal(t, 0, f.inventory.released)
+}
+
+func TestCheckout_ExpiredReservationCancelsTheOrder(t *testing.T) {
+	f := newFixture()
+	f.inventory.commitErrs = failures{status.Error(codes.FailedPrecondition, "reservation is expired")}
+
+	saga, err := f.orchestrator.Start(context.Background(), "user-1", testCard, testLines)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutFailed, saga.State)
+	assert.Equal(t, models.CheckoutOrderCreated, saga.FailedAt)
+	assert.Equal(t, "the reserved stock is no longer available", saga.FailureReason)
+	assert.Equal(t, models.OrderStatusCancelled, f.orders.orders[saga.OrderID].Status)
+	assert.Equal(t, []string{"pay-" + saga.ID}, f.payments.voided)
+	assert.Empty(t, f.payments.captured, "nothing is charged for stock that may be sold again")
+	assert.Empty(t, f.carts.cleared)
+}
+
+func TestCheckout_ReservationExpiredBeforeTheOrderCompensates(t *testing.T) {
+	f := newFixture()
+	f.inventory.extendErrs = failures{status.Error(codes.FailedPrecondition, "reservation is no longer open")}
+
+	saga, err := f.orchestrator.Start(context.Background(), "user-1", testCard, testLines)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutFailed, saga.State)
+	assert.Equal(t, models.CheckoutPaymentAuthorized, saga.FailedAt)
+	assert.Empty(t, f.orders.orders, "no order is created for an expired reservation")
+	assert.Equal(t, []string{"pay-" + saga.ID}, f.payments.voided)
+}
+
+func TestCheckout_CaptureIsRetriedWithTheSameKey(t *testing.T) {
+	f := newFixture()
+	f.payments.captureErrs = failures{status.Error(codes.Unavailable, "payment service down")}
+	ctx := context.Background()
+
+	saga, err := f.orchestrator.Start(ctx, "user-1", testCard, testLines)
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutOrderCreated, saga.State)
+
+	f.makeDue(t, saga.ID)
+	f.orchestrator.resumeDue(ctx)
+
+	stored, err := f.sagas.FindByID(ctx, saga.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutCompleted, stored.State)
+	assert.Equal(t, []string{saga.ID + ":capture", saga.ID + ":capture"}, f.payments.captureKeys)
+	assert.Equal(t, []string{saga.PaymentID}, f.payments.captured)
+}
+
+func TestCheckout_RejectedCaptureStillCompletes(t *testing.T) {
+	f := newFixture()
+	f.payments.captureErrs = failures{status.Error(codes.FailedPrecondition, "capture declined: capture_declined")}
+
+	saga, err := f.orchestrator.Start(context.Background(), "user-1", testCard, testLines)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckoutCompleted, saga.State)
+	assert.Empty(t, f.payments.captured)
+	assert.Empty(t, f.payments.voided, "the order exists, so the payment isn't rolled back")
+	assert.Equal(t, models.OrderStatusPending, f.orders.orders[saga.OrderID].Status)
+}
+
+func TestCheckout_ConcurrentResumeRunsStepOnce(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, f.sagas.Create(ctx, &models.CheckoutSaga{
+		ID:            "checkout-1",
+		UserID:        "user-1",
+		Lines:         testLines,
+		State:         models.CheckoutStarted,
+		ReservationID: "checkout-1",
+		OrderID:       primitive.NewObjectID(),
+		NextAttemptAt: now.Add(-time.Second),
+		Deadline:      now.Add(time.Minute),
+	}))
+
+	// Both orchestrators read the same version; only one can claim it
+	first, err := f.sagas.FindByID(ctx, "checkout-1")
+	require.NoError(t, err)
+	second, err := f.sagas.FindByID(ctx, "checkout-1")
+	require.NoError(t, err)
+
+	_, err = f.orchestrator.Run(ctx, first)
+	require.NoError(t, err)
+	_, err = f.orchestrator.Run(ctx, second)
+	assert.ErrorIs(t, err, repositories.ErrSagaConflict)
+
+	assert.Equal(t, 1, f.inventory.reserved)
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Second, retryDelay(1))
+	assert.Equal(t, 4*time.Second, retryDelay(3))
+	assert.Equal(t, maxRetryDelay, retryDelay(20))
+}
@@ -0,0 +1,66 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tird4d/go-microservices/order_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Inventory holds stock for a checkout until the order exists. All methods
+// may be retried with the same reservationID, so they must be idempotent,
+// and Release of a reservation that was never made must be a no-op. Extend
+// keeps the stock held for at least ttl from now; it and Commit fail with a
+// non-retryable error once the reservation expired.
+type Inventory interface {
+	Reserve(ctx context.Context, reservationID string, lines []models.OrderLine) error
+	Extend(ctx context.Context, reservationID string, ttl time.Duration) error
+	Release(ctx context.Context, reservationID string, lines []models.OrderLine) error
+	Commit(ctx context.Context, reservationID string, lines []models.OrderLine) error
+}
+
+// Payments authorizes the checkout total, captures it once the order exists
+// and voids the authorization when the checkout is rolled back. Every call
+// carries an idempotency key, so a retried step doesn't charge twice.
+// Authorize repeated with a key returns the payment, or the decline, of the
+// first call; compensation relies on that to find authorizations whose
+// answer was lost.
+type Payments interface {
+	Authorize(ctx context.Context, key, userID, orderID, paymentMethod string, amount money.Money) (paymentID string, err error)
+	Capture(ctx context.Context, key, paymentID string) error
+	Void(ctx context.Context, key, paymentID string) error
+}
+
+// Carts empties the user's cart once their checkout completed
+type Carts interface {
+	Clear(ctx context.Context, userID string) error
+}
+
+// retryable reports whether a failed step may succeed if tried again. Errors
+// that aren't gRPC statuses (timeouts, Mongo errors) are treated as transient;
+// business rejections such as insufficient stock or a declined payment are not.
+func retryable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.Canceled,
+		codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// failureReason is the message stored on a failed saga and shown to the shopper
+func failureReason(err error) string {
+	if st, ok := status.FromError(err); ok {
+		return st.Message()
+	}
+	return err.Error()
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	cartpb "github.com/tird4d/go-microservices/cart_service/proto"
+	"github.com/tird4d/go-microservices/order_service/logger"
+	"github.com/tird4d/go-microservices/order_service/models"
+	"github.com/tird4d/go-microservices/order_service/repositories"
+	"github.com/tird4d/go-microservices/order_service/saga"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Checkout snapshots the user's cart and runs it through the checkout saga,
+// charging paymentMethod. The returned saga may still be in progress if a
+// step is being retried.
+func Checkout(ctx context.Context, orchestrator *saga.Orchestrator, cartClient cartpb.CartServiceClient, userID, paymentMethod string) (*models.CheckoutSaga, error) {
+	if userID == "" {
+		return nil, status.Error(codes.Unauthenticated, "user is required")
+	}
+	if paymentMethod == "" {
+		return nil, status.Error(codes.InvalidArgument, "payment method is required")
+	}
+
+	cart, err := cartClient.GetCart(ctx, &cartpb.GetCartRequest{UserId: userID})
+	if err != nil {
+		logger.Log.Errorw("Failed to fetch cart", "user_id", userID, "error", err)
+		return nil, status.Error(codes.Unavailable, "cannot connect to cart service")
+	}
+
+	if len(cart.GetItems()) == 0 {
+		return nil, status.Error(codes.FailedPrecondition, "cart is empty")
+	}
+
+	lines := make([]models.OrderLine, 0, len(cart.GetItems()))
+	for _, item := range cart.GetItems() {
+		if !item.GetAvailable() {
+			return nil, status.Errorf(codes.FailedPrecondition, "product %s is not available in the requested quantity", item.GetProductId())
+		}
+
+		lines = append(lines, models.OrderLine{
+			ProductID:   item.GetProductId(),
+			ProductName: item.GetProductName(),
+			UnitPrice:   money.New(item.GetUnitPrice().GetAmount(), item.GetUnitPrice().GetCurrency()),
+			Quantity:    item.GetQuantity(),
+			LineTotal:   money.New(item.GetLineTotal().GetAmount(), item.GetLineTotal().GetCurrency()),
+			SKU:         item.GetSku(),
+		})
+	}
+	if _, err := models.LinesTotal(lines); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "cart has items priced in more than one currency")
+	}
+
+	checkout, err := orchestrator.Start(ctx, userID, paymentMethod, lines)
+	if err != nil {
+		logger.Log.Errorw("Failed to run checkout saga", "user_id", userID, "error", err)
+		if checkout != nil {
+			// The saga is persisted; the recovery loop will finish it
+			return checkout, nil
+		}
+		return nil, status.Error(codes.Internal, "failed to start checkout")
+	}
+
+	return checkout, nil
+}
+
+// GetCheckout returns a checkout owned by the user. Other users' checkouts
+// are reported as not found.
+func GetCheckout(ctx context.Context, repo repositories.CheckoutSagaRepository, id, userID string) (*models.CheckoutSaga, error) {
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "checkout ID is required")
+	}
+
+	checkout, err := repo.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, status.Error(codes.NotFound, "checkout not found")
+		}
+		logger.Log.Errorw("Failed to find checkout", "id", id, "error", err)
+		return nil, status.Error(codes.Internal, "failed to retrieve checkout")
+	}
+
+	if checkout.UserID != userID {
+		return nil, status.Error(codes.NotFound, "checkout not found")
+	}
+
+	return checkout, nil
+}
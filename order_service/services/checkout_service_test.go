@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	cartpb "github.com/tird4d/go-microservices/cart_service/proto"
+	"github.com/tird4d/go-microservices/order_service/mocks"
+	"github.com/tird4d/go-microservices/order_service/models"
+	"github.com/tird4d/go-microservices/order_service/repositories"
+	"github.com/tird4d/go-microservices/order_service/saga"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// --- CHECKOUT TESTS ---
+
+func TestCheckout_EmptyCart(t *testing.T) {
+	ctx := context.Background()
+	mockCarts := new(mocks.CartClientMock)
+
+	mockCarts.On("GetCart", mock.Anything, &cartpb.GetCartRequest{UserId: "user-1"}).Return(&cartpb.Cart{}, nil)
+
+	_, err := Checkout(ctx, &saga.Orchestrator{}, mockCarts, "user-1", "4242424242424242")
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestCheckout_UnavailableItem(t *testing.T) {
+	ctx := context.Background()
+	mockCarts := new(mocks.CartClientMock)
+
+	mockCarts.On("GetCart", mock.Anything, mock.Anything).Return(&cartpb.Cart{Items: []*cartpb.CartItem{
+		{ProductId: "p1", Quantity: 1, Available: true},
+		{ProductId: "p2", Quantity: 5, Available: false},
+	}}, nil)
+
+	_, err := Checkout(ctx, &saga.Orchestrator{}, mockCarts, "user-1", "4242424242424242")
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, err.Error(), "p2")
+}
+
+func TestCheckout_MixedCurrencies(t *testing.T) {
+	ctx := context.Background()
+	mockCarts := new(mocks.CartClientMock)
+
+	mockCarts.On("GetCart", mock.Anything, mock.Anything).Return(&cartpb.Cart{Items: []*cartpb.CartItem{
+		{ProductId: "p1", Quantity: 1, Available: true, LineTotal: &cartpb.Money{Amount: 1000, Currency: "EUR"}},
+		{ProductId: "p2", Quantity: 1, Available: true, LineTotal: &cartpb.Money{Amount: 2500, Currency: "USD"}},
+	}}, nil)
+
+	_, err := Checkout(ctx, &saga.Orchestrator{}, mockCarts, "user-1", "4242424242424242")
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestCheckout_CartServiceDown(t *testing.T) {
+	ctx := context.Background()
+	mockCarts := new(mocks.CartClientMock)
+
+	mockCarts.On("GetCart", mock.Anything, mock.Anything).Return(nil, status.Error(codes.Unavailable, "connection refused"))
+
+	_, err := Checkout(ctx, &saga.Orchestrator{}, mockCarts, "user-1", "4242424242424242")
+
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestCheckout_RequiresUser(t *testing.T) {
+	_, err := Checkout(context.Background(), &saga.Orchestrator{}, new(mocks.CartClientMock), "", "4242424242424242")
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestCheckout_RequiresPaymentMethod(t *testing.T) {
+	mockCarts := new(mocks.CartClientMock)
+
+	_, err := Checkout(context.Background(), &saga.Orchestrator{}, mockCarts, "user-1", "")
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	mockCarts.AssertNotCalled(t, "GetCart", mock.Anything, mock.Anything)
+}
+
+// --- GET CHECKOUT TESTS ---
+
+func TestGetCheckout_OtherUsersCheckoutIsNotFound(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryCheckoutSagaRepository()
+	require.NoError(t, repo.Create(ctx, &models.CheckoutSaga{ID: "checkout-1", UserID: "user-1"}))
+
+	checkout, err := GetCheckout(ctx, repo, "checkout-1", "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "checkout-1", checkout.ID)
+
+	_, err = GetCheckout(ctx, repo, "checkout-1", "user-2")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = GetCheckout(ctx, repo, "missing", "user-1")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tird4d/go-microservices/order_service/logger"
+	"github.com/tird4d/go-microservices/order_service/models"
+	"github.com/tird4d/go-microservices/order_service/repositories"
+	"github.com/tird4d/go-microservices/product_service/money"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OrderItem is a product and quantity requested by the customer
+type OrderItem struct {
+	ProductID string
+	Quantity  int32
+}
+
+// CreateOrder validates the requested items against product_service and stores
+// a pending order with a price snapshot of every line
+func CreateOrder(ctx context.Context, repo repositories.OrderRepository, productClient productpb.ProductServiceClient, userID string, items []OrderItem) (*models.Order, error) {
+	if userID == "" {
+		return nil, status.Error(codes.Unauthenticated, "user is required")
+	}
+
+	items, err := mergeItems(items)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]models.OrderLine, 0, len(items))
+
+	for _, item := range items {
+		product, err := productClient.GetProduct(ctx, &productpb.GetProductRequest{Id: item.ProductID})
+		if err != nil {
+			switch status.Code(err) {
+			case codes.NotFound, codes.InvalidArgument:
+				return nil, status.Errorf(codes.InvalidArgument, "product %s not found", item.ProductID)
+			default:
+				logger.Log.Errorw("Failed to fetch product", "product_id", item.ProductID, "error", err)
+				return nil, status.Error(codes.Unavailable, "cannot connect to product service")
+			}
+		}
+
+		if product.GetStock() < item.Quantity {
+			return nil, status.Errorf(codes.FailedPrecondition, "insufficient stock for product %s", item.ProductID)
+		}
+
+		unitPrice := money.New(product.GetPrice().GetAmount(), product.GetPrice().GetCurrency())
+		lines = append(lines, models.OrderLine{
+			ProductID:   product.GetId(),
+			ProductName: product.GetName(),
+			UnitPrice:   unitPrice,
+			Quantity:    item.Quantity,
+			LineTotal:   unitPrice.Mul(int64(item.Quantity)),
+		})
+	}
+
+	total, err := models.LinesTotal(lines)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "products of one order must be priced in the same currency")
+	}
+
+	now := time.Now()
+	order := &models.Order{
+		UserID:    userID,
+		Lines:     lines,
+		Total:     total,
+		Status:    models.OrderStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	createdOrder, err := repo.Create(ctx, order)
+	if err != nil {
+		logger.Log.Errorw("Insert order failed", "error", err)
+		return nil, status.Error(codes.Internal, "failed to create order")
+	}
+
+	logger.Log.Infow("Order created successfully",
+		"id", createdOrder.ID.Hex(),
+		"user_id", userID,
+		"total", total,
+	)
+
+	return createdOrder, nil
+}
+
+// GetOrder retrieves an order by ID. Orders owned by another user are reported
+// as not found so their existence isn't leaked.
+func GetOrder(ctx context.Context, repo repositories.OrderRepository, id, userID string) (*models.Order, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		logger.Log.Errorw("Failed to convert string to ObjectID", "error", err)
+		return nil, status.Error(codes.InvalidArgument, "invalid order ID format")
+	}
+
+	order, err := repo.FindByID(ctx, oid)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, status.Error(codes.NotFound, "order not found")
+		}
+		logger.Log.Errorw("Failed to find order by ID", "error", err)
+		return nil, status.Error(codes.Internal, "failed to retrieve order")
+	}
+
+	if order.UserID != userID {
+		return nil, status.Error(codes.NotFound, "order not found")
+	}
+
+	return order, nil
+}
+
+// ListOrdersForUser retrieves a user's orders with pagination
+func ListOrdersForUser(ctx context.Context, repo repositories.OrderRepository, userID string, page, pageSize int32) ([]*models.Order, int64, error) {
+	if userID == "" {
+		return nil, 0, status.Error(codes.Unauthenticated, "user is required")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	skip := int64((page - 1) * pageSize)
+
+	orders, err := repo.FindByUser(ctx, userID, skip, int64(pageSize))
+	if err != nil {
+		logger.Log.Errorw("Failed to list orders", "error", err, "user_id", userID)
+		return nil, 0, status.Error(codes.Internal, "failed to list orders")
+	}
+
+	total, err := repo.CountByUser(ctx, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to count orders", "error", err, "user_id", userID)
+		return nil, 0, status.Error(codes.Internal, "failed to count orders")
+	}
+
+	return orders, total, nil
+}
+
+// CancelOrder cancels a pending order owned by the user
+func CancelOrder(ctx context.Context, repo repositories.OrderRepository, id, userID string) (*models.Order, error) {
+	order, err := GetOrder(ctx, repo, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Status != models.OrderStatusPending {
+		return nil, status.Errorf(codes.FailedPrecondition, "order is %s and can no longer be cancelled", order.Status)
+	}
+
+	cancelled, err := repo.UpdateStatus(ctx, order.ID, models.OrderStatusPending, models.OrderStatusCancelled)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// Status changed between the read and the update
+			return nil, status.Error(codes.FailedPrecondition, "order can no longer be cancelled")
+		}
+		logger.Log.Errorw("Failed to cancel order", "error", err)
+		return nil, status.Error(codes.Internal, "failed to cancel order")
+	}
+
+	logger.Log.Infow("Order cancelled", "id", id, "user_id", userID)
+
+	return cancelled, nil
+}
+
+// mergeItems validates the requested items and folds duplicate products into one line
+func mergeItems(items []OrderItem) ([]OrderItem, error) {
+	if len(items) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "order must contain at least one line")
+	}
+
+	merged := make([]OrderItem, 0, len(items))
+	index := make(map[string]int, len(items))
+
+	for _, item := range items {
+		if item.ProductID == "" {
+			return nil, status.Error(codes.InvalidArgument, "product_id is required")
+		}
+		if item.Quantity <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "quantity for product %s must be positive", item.ProductID)
+		}
+
+		if i, ok := index[item.ProductID]; ok {
+			merged[i].Quantity += item.Quantity
+			continue
+		}
+		index[item.ProductID] = len(merged)
+		merged = append(merged, item)
+	}
+
+	return merged, nil
+}
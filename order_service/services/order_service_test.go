@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tird4d/go-microservices/order_service/logger"
+	"github.com/tird4d/go-microservices/order_service/mocks"
+	"github.com/tird4d/go-microservices/order_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger(true)
+
+	os.Exit(m.Run())
+}
+
+// --- CREATE ORDER TESTS ---
+
+func TestCreateOrder_Success(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.OrderRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p1"}).
+		Return(&productpb.Product{Id: "p1", Name: "Laptop", Price: &productpb.Money{Amount: 1000, Currency: "EUR"}, Stock: 5}, nil)
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p2"}).
+		Return(&productpb.Product{Id: "p2", Name: "Mouse", Price: &productpb.Money{Amount: 25, Currency: "EUR"}, Stock: 50}, nil)
+
+	mockRepo.On("Create", mock.Anything, mock.MatchedBy(func(o *models.Order) bool {
+		return o.UserID == "user-1" && len(o.Lines) == 2 && o.Status == models.OrderStatusPending
+	})).Return(func(ctx context.Context, o *models.Order) *models.Order {
+		o.ID = primitive.NewObjectID()
+		return o
+	}, nil)
+
+	order, err := CreateOrder(ctx, mockRepo, mockProducts, "user-1", []OrderItem{
+		{ProductID: "p1", Quantity: 1},
+		{ProductID: "p2", Quantity: 2},
+		{ProductID: "p1", Quantity: 1},
+	})
+
+	mockRepo.AssertExpectations(t)
+	mockProducts.AssertNumberOfCalls(t, "GetProduct", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), order.Lines[0].Quantity, "duplicate product lines should be merged")
+	assert.Equal(t, money.New(2000, "EUR"), order.Lines[0].LineTotal)
+	assert.Equal(t, money.New(2050, "EUR"), order.Total)
+}
+
+func TestCreateOrder_MixedCurrencies(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.OrderRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p1"}).
+		Return(&productpb.Product{Id: "p1", Name: "Laptop", Price: &productpb.Money{Amount: 1000, Currency: "EUR"}, Stock: 5}, nil)
+	mockProducts.On("GetProduct", mock.Anything, &productpb.GetProductRequest{Id: "p2"}).
+		Return(&productpb.Product{Id: "p2", Name: "Mouse", Price: &productpb.Money{Amount: 25, Currency: "USD"}, Stock: 50}, nil)
+
+	_, err := CreateOrder(ctx, mockRepo, mockProducts, "user-1", []OrderItem{
+		{ProductID: "p1", Quantity: 1},
+		{ProductID: "p2", Quantity: 1},
+	})
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestCreateOrder_RequiresUser(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := CreateOrder(ctx, new(mocks.OrderRepositoryMock), new(mocks.ProductClientMock), "", []OrderItem{{ProductID: "p1", Quantity: 1}})
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestCreateOrder_InvalidQuantity(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := CreateOrder(ctx, new(mocks.OrderRepositoryMock), new(mocks.ProductClientMock), "user-1", []OrderItem{{ProductID: "p1", Quantity: 0}})
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestCreateOrder_UnknownProduct(t *testing.T) {
+	ctx := context.Background()
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).
+		Return(nil, status.Error(codes.NotFound, "product not found"))
+
+	_, err := CreateOrder(ctx, new(mocks.OrderRepositoryMock), mockProducts, "user-1", []OrderItem{{ProductID: "p1", Quantity: 1}})
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestCreateOrder_InsufficientStock(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.OrderRepositoryMock)
+	mockProducts := new(mocks.ProductClientMock)
+
+	mockProducts.On("GetProduct", mock.Anything, mock.Anything).
+		Return(&productpb.Product{Id: "p1", Name: "Laptop", Price: &productpb.Money{Amount: 1000, Currency: "EUR"}, Stock: 1}, nil)
+
+	_, err := CreateOrder(ctx, mockRepo, mockProducts, "user-1", []OrderItem{{ProductID: "p1", Quantity: 2}})
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+// --- GET ORDER TESTS ---
+
+func TestGetOrder_OtherUsersOrderIsNotFound(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.OrderRepositoryMock)
+	id := primitive.NewObjectID()
+
+	mockRepo.On("FindByID", ctx, id).Return(&models.Order{ID: id, UserID: "someone-else"}, nil)
+
+	result, err := GetOrder(ctx, mockRepo, id.Hex(), "user-1")
+
+	assert.Nil(t, result)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGetOrder_InvalidID(t *testing.T) {
+	_, err := GetOrder(context.Background(), new(mocks.OrderRepositoryMock), "not-an-id", "user-1")
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// --- LIST ORDERS TESTS ---
+
+func TestListOrdersForUser_Pagination(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.OrderRepositoryMock)
+
+	orders := []*models.Order{{ID: primitive.NewObjectID(), UserID: "user-1"}}
+	mockRepo.On("FindByUser", ctx, "user-1", int64(10), int64(10)).Return(orders, nil)
+	mockRepo.On("CountByUser", ctx, "user-1").Return(int64(11), nil)
+
+	result, total, err := ListOrdersForUser(ctx, mockRepo, "user-1", 2, 10)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, int64(11), total)
+}
+
+// --- CANCEL ORDER TESTS ---
+
+func TestCancelOrder_Success(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.OrderRepositoryMock)
+	id := primitive.NewObjectID()
+
+	mockRepo.On("FindByID", ctx, id).Return(&models.Order{ID: id, UserID: "user-1", Status: models.OrderStatusPending}, nil)
+	mockRepo.On("UpdateStatus", ctx, id, models.OrderStatusPending, models.OrderStatusCancelled).
+		Return(&models.Order{ID: id, UserID: "user-1", Status: models.OrderStatusCancelled}, nil)
+
+	result, err := CancelOrder(ctx, mockRepo, id.Hex(), "user-1")
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusCancelled, result.Status)
+}
+
+func TestCancelOrder_NotPending(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.OrderRepositoryMock)
+	id := primitive.NewObjectID()
+
+	mockRepo.On("FindByID", ctx, id).Return(&models.Order{ID: id, UserID: "user-1", Status: models.OrderStatusCancelled}, nil)
+
+	_, err := CancelOrder(ctx, mockRepo, id.Hex(), "user-1")
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	mockRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCancelOrder_ConcurrentStatusChange(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.OrderRepositoryMock)
+	id := primitive.NewObjectID()
+
+	mockRepo.On("FindByID", ctx, id).Return(&models.Order{ID: id, UserID: "user-1", Status: models.OrderStatusPending}, nil)
+	mockRepo.On("UpdateStatus", ctx, id, models.OrderStatusPending, models.OrderStatusCancelled).Return(nil, mongo.ErrNoDocuments)
+
+	_, err := CancelOrder(ctx, mockRepo, id.Hex(), "user-1")
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
@@ -0,0 +1,99 @@
+// Package pagination issues and checks the signed page tokens with which
+// list RPCs resume keyset pagination. Every service listing pages shares it,
+// so they all read PAGE_TOKEN_SECRET the same way.
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrInvalidToken is returned for page tokens that were tampered with,
+	// signed with another secret or issued for a different list
+	ErrInvalidToken = errors.New("invalid page token")
+	// ErrMissingSecret means PAGE_TOKEN_SECRET isn't set, so no token can
+	// be signed or checked
+	ErrMissingSecret = errors.New("PAGE_TOKEN_SECRET is not set")
+)
+
+// Cursor is the keyset position a page token resumes after: the sort
+// key and _id of the last item of the previous page. Scope names the list
+// it was issued for so it can't be replayed against another one.
+type Cursor struct {
+	Scope   string `json:"s"`
+	SortKey string `json:"k,omitempty"`
+	ID      string `json:"id"`
+}
+
+// CheckSecret returns ErrMissingSecret when PAGE_TOKEN_SECRET isn't set.
+// Services call it at startup, so a missing secret stops the deploy instead
+// of breaking pagination. Every replica must share the secret, or a token
+// issued by one is rejected by the others.
+func CheckSecret() error {
+	_, err := pageTokenSecret()
+	return err
+}
+
+func pageTokenSecret() ([]byte, error) {
+	secret := os.Getenv("PAGE_TOKEN_SECRET")
+	if secret == "" {
+		return nil, ErrMissingSecret
+	}
+	return []byte(secret), nil
+}
+
+// EncodeToken returns an opaque, signed token for cursor
+func EncodeToken(cursor Cursor) (string, error) {
+	secret, err := pageTokenSecret()
+	if err != nil {
+		return "", err
+	}
+	payload, _ := json.Marshal(cursor)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// DecodeToken verifies token and returns its cursor, which must have
+// been issued for scope
+func DecodeToken(token, scope string) (*Cursor, error) {
+	secret, err := pageTokenSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrInvalidToken
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(payload, &cursor); err != nil || cursor.Scope != scope {
+		return nil, ErrInvalidToken
+	}
+
+	return &cursor, nil
+}
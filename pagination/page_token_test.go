@@ -0,0 +1,66 @@
+package pagination
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageToken_RoundTrip(t *testing.T) {
+	t.Setenv("PAGE_TOKEN_SECRET", "test-secret")
+	cursor := Cursor{Scope: "users", ID: "64b7f0c2e4b0a1a2b3c4d5e6"}
+
+	token, err := EncodeToken(cursor)
+	require.NoError(t, err)
+
+	decoded, err := DecodeToken(token, "users")
+
+	require.NoError(t, err)
+	assert.Equal(t, cursor, *decoded)
+}
+
+func TestPageToken_RejectsTamperedTokens(t *testing.T) {
+	t.Setenv("PAGE_TOKEN_SECRET", "test-secret")
+	token, err := EncodeToken(Cursor{Scope: "users", ID: "a"})
+	require.NoError(t, err)
+	payload, sig, _ := strings.Cut(token, ".")
+	forged, err := EncodeToken(Cursor{Scope: "users", ID: "b"})
+	require.NoError(t, err)
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	for name, bad := range map[string]string{
+		"empty":           "",
+		"no signature":    payload,
+		"swapped payload": forgedPayload + "." + sig,
+		"not base64":      "!!." + sig,
+	} {
+		_, err := DecodeToken(bad, "users")
+		assert.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+
+	t.Setenv("PAGE_TOKEN_SECRET", "rotated")
+	_, err = DecodeToken(token, "users")
+	assert.ErrorIs(t, err, ErrInvalidToken, "other secret")
+}
+
+func TestPageToken_RejectsOtherScope(t *testing.T) {
+	t.Setenv("PAGE_TOKEN_SECRET", "test-secret")
+	token, err := EncodeToken(Cursor{Scope: "products", ID: "a"})
+	require.NoError(t, err)
+
+	_, err = DecodeToken(token, "users")
+
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestPageToken_RequiresSecret(t *testing.T) {
+	t.Setenv("PAGE_TOKEN_SECRET", "")
+
+	assert.ErrorIs(t, CheckSecret(), ErrMissingSecret)
+	_, err := EncodeToken(Cursor{Scope: "users", ID: "a"})
+	assert.ErrorIs(t, err, ErrMissingSecret)
+	_, err = DecodeToken("payload.signature", "users")
+	assert.ErrorIs(t, err, ErrMissingSecret)
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tird4d/go-microservices/payment_service/provider"
+)
+
+// NewPaymentProvider builds the provider named by PAYMENT_PROVIDER. Only
+// "fake" exists so far; it's the default. FAKE_PAYMENT_CARDS adds or
+// overrides fake test cards ("4000000000000002=card_declined,...").
+func NewPaymentProvider() (provider.PaymentProvider, error) {
+	name := os.Getenv("PAYMENT_PROVIDER")
+	if name == "" {
+		name = "fake"
+	}
+
+	switch name {
+	case "fake":
+		cards, err := provider.ParseFakeCards(os.Getenv("FAKE_PAYMENT_CARDS"))
+		if err != nil {
+			return nil, err
+		}
+		return provider.NewFakeProvider(cards), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/tird4d/go-microservices/payment_service/logger"
+	"github.com/tird4d/go-microservices/payment_service/models"
+	paymentpb "github.com/tird4d/go-microservices/payment_service/proto"
+	"github.com/tird4d/go-microservices/payment_service/provider"
+	"github.com/tird4d/go-microservices/payment_service/repositories"
+	"github.com/tird4d/go-microservices/payment_service/services"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Server struct {
+	paymentpb.UnimplementedPaymentServiceServer
+	Repo     repositories.PaymentRepository
+	Provider provider.PaymentProvider
+}
+
+// Authorize holds the amount on the payment method
+func (s *Server) Authorize(ctx context.Context, req *paymentpb.AuthorizeRequest) (*paymentpb.Payment, error) {
+	logger.Log.Infow("Authorizing payment",
+		"user_id", req.GetUserId(),
+		"order_id", req.GetOrderId(),
+		"amount", fromMoneyRequest(req.GetAmount()).String(),
+	)
+
+	payment, err := services.Authorize(ctx, s.Repo, s.Provider,
+		req.GetIdempotencyKey(),
+		req.GetUserId(),
+		req.GetOrderId(),
+		req.GetPaymentMethod(),
+		fromMoneyRequest(req.GetAmount()),
+	)
+	if err != nil {
+		logger.Log.Errorw("Failed to authorize payment", "error", err)
+		return nil, err
+	}
+
+	return toPaymentResponse(payment), nil
+}
+
+// Capture charges an authorized payment
+func (s *Server) Capture(ctx context.Context, req *paymentpb.CaptureRequest) (*paymentpb.Payment, error) {
+	logger.Log.Infow("Capturing payment", "payment_id", req.GetPaymentId(), "amount", fromMoneyRequest(req.GetAmount()).String())
+
+	payment, err := services.Capture(ctx, s.Repo, s.Provider, req.GetIdempotencyKey(), req.GetPaymentId(), fromMoneyRequest(req.GetAmount()))
+	if err != nil {
+		logger.Log.Errorw("Failed to capture payment", "error", err)
+		return nil, err
+	}
+
+	return toPaymentResponse(payment), nil
+}
+
+// Refund returns captured money
+func (s *Server) Refund(ctx context.Context, req *paymentpb.RefundRequest) (*paymentpb.Payment, error) {
+	logger.Log.Infow("Refunding payment",
+		"payment_id", req.GetPaymentId(),
+		"amount", fromMoneyRequest(req.GetAmount()).String(),
+		"reason", req.GetReason(),
+	)
+
+	payment, err := services.Refund(ctx, s.Repo, s.Provider, req.GetIdempotencyKey(), req.GetPaymentId(), fromMoneyRequest(req.GetAmount()), req.GetReason())
+	if err != nil {
+		logger.Log.Errorw("Failed to refund payment", "error", err)
+		return nil, err
+	}
+
+	return toPaymentResponse(payment), nil
+}
+
+// Void cancels an authorization that wasn't captured
+func (s *Server) Void(ctx context.Context, req *paymentpb.VoidRequest) (*paymentpb.Payment, error) {
+	logger.Log.Infow("Voiding payment", "payment_id", req.GetPaymentId())
+
+	payment, err := services.Void(ctx, s.Repo, s.Provider, req.GetIdempotencyKey(), req.GetPaymentId())
+	if err != nil {
+		logger.Log.Errorw("Failed to void payment", "error", err)
+		return nil, err
+	}
+
+	return toPaymentResponse(payment), nil
+}
+
+// GetPayment returns the current state of a payment
+func (s *Server) GetPayment(ctx context.Context, req *paymentpb.GetPaymentRequest) (*paymentpb.Payment, error) {
+	payment, err := services.GetPayment(ctx, s.Repo, req.GetPaymentId())
+	if err != nil {
+		return nil, err
+	}
+
+	return toPaymentResponse(payment), nil
+}
+
+func toPaymentResponse(payment *models.Payment) *paymentpb.Payment {
+	return &paymentpb.Payment{
+		Id:             payment.ID.Hex(),
+		UserId:         payment.UserID,
+		OrderId:        payment.OrderID,
+		Amount:         toMoneyResponse(payment.Amount),
+		CapturedAmount: toMoneyResponse(payment.CapturedAmount),
+		RefundedAmount: toMoneyResponse(payment.RefundedAmount),
+		Status:         payment.Status,
+		Provider:       payment.Provider,
+		DeclineCode:    payment.DeclineCode,
+		CreatedAt:      timestamppb.New(payment.CreatedAt),
+		UpdatedAt:      timestamppb.New(payment.UpdatedAt),
+	}
+}
+
+func toMoneyResponse(m money.Money) *paymentpb.Money {
+	return &paymentpb.Money{Amount: m.Amount, Currency: m.Currency}
+}
+
+// fromMoneyRequest reads an amount; an unset one is zero
+func fromMoneyRequest(m *paymentpb.Money) money.Money {
+	return money.New(m.GetAmount(), m.GetCurrency())
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tird4d/go-microservices/payment_service/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IdempotencyKey remembers which payment a request changed. It's stored in
+// the same transaction as the change, so a key is either unused or points at
+// the finished result. Key is scoped by operation ("capture:<key>"), and
+// Fingerprint, a hash of the request arguments, detects a key being reused
+// for a different request.
+type IdempotencyKey struct {
+	Key         string             `bson:"_id"`
+	Operation   string             `bson:"operation"`
+	Fingerprint string             `bson:"fingerprint"`
+	PaymentID   primitive.ObjectID `bson:"payment_id"`
+	CreatedAt   time.Time          `bson:"created_at"`
+}
+
+func IdempotencyKeyCollection() *mongo.Collection {
+	return config.DB.Collection("payment_idempotency_keys")
+}
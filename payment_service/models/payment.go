@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tird4d/go-microservices/payment_service/config"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Payment statuses. An authorization is either declined right away or
+// authorized; an authorized payment is voided or captured, and a captured
+// one can be refunded in one or more parts.
+const (
+	PaymentAuthorized        = "authorized"
+	PaymentDeclined          = "declined"
+	PaymentVoided            = "voided"
+	PaymentCaptured          = "captured"
+	PaymentPartiallyRefunded = "partially_refunded"
+	PaymentRefunded          = "refunded"
+)
+
+// Operations that change a payment. They name idempotency key scopes and
+// the transitions in a payment's history.
+const (
+	OperationAuthorize = "authorize"
+	OperationCapture   = "capture"
+	OperationRefund    = "refund"
+	OperationVoid      = "void"
+)
+
+// Payment is one authorization. Captured and refunded amounts are in the
+// currency of the authorized amount.
+type Payment struct {
+	ID                primitive.ObjectID `bson:"_id" json:"id"`
+	UserID            string             `bson:"user_id" json:"user_id"`
+	OrderID           string             `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	Amount            money.Money        `bson:"amount" json:"amount"`
+	CapturedAmount    money.Money        `bson:"captured_amount" json:"captured_amount"`
+	RefundedAmount    money.Money        `bson:"refunded_amount" json:"refunded_amount"`
+	Status            string             `bson:"status" json:"status"`
+	Provider          string             `bson:"provider" json:"provider"`
+	ProviderReference string             `bson:"provider_reference,omitempty" json:"-"`
+	DeclineCode       string             `bson:"decline_code,omitempty" json:"decline_code,omitempty"`
+	// Transitions is the payment's history, oldest first
+	Transitions []PaymentTransition `bson:"transitions" json:"transitions"`
+	// Version is bumped on every change; updates are conditional on it
+	Version   int64     `bson:"version" json:"version"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// PaymentTransition records one status change and the request behind it
+type PaymentTransition struct {
+	Operation      string      `bson:"operation" json:"operation"`
+	From           string      `bson:"from,omitempty" json:"from,omitempty"`
+	To             string      `bson:"to" json:"to"`
+	Amount         money.Money `bson:"amount" json:"amount"`
+	IdempotencyKey string      `bson:"idempotency_key" json:"idempotency_key"`
+	Reason         string      `bson:"reason,omitempty" json:"reason,omitempty"`
+	At             time.Time   `bson:"at" json:"at"`
+}
+
+// Transition moves the payment to status and appends the change to its history
+func (p *Payment) Transition(operation, status, key, reason string, amount money.Money, now time.Time) {
+	p.Transitions = append(p.Transitions, PaymentTransition{
+		Operation:      operation,
+		From:           p.Status,
+		To:             status,
+		Amount:         amount,
+		IdempotencyKey: key,
+		Reason:         reason,
+		At:             now,
+	})
+	p.Status = status
+	p.UpdatedAt = now
+}
+
+func PaymentCollection() *mongo.Collection {
+	return config.DB.Collection("payments")
+}
@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/tird4d/go-microservices/product_service/money"
+)
+
+// Outcomes the fake provider can be configured with per card number
+const (
+	OutcomeApprove = "approve"
+	// OutcomeProcessingError fails every call with a transient error
+	OutcomeProcessingError = "processing_error"
+	// OutcomeCaptureDeclined and OutcomeRefundDeclined authorize fine and
+	// decline the later step
+	OutcomeCaptureDeclined = CodeCaptureDeclined
+	OutcomeRefundDeclined  = CodeRefundDeclined
+	OutcomeCardDeclined    = CodeCardDeclined
+	OutcomeInsufficient    = CodeInsufficientFunds
+	OutcomeExpiredCard     = CodeExpiredCard
+)
+
+// DefaultFakeCards are the test cards every FakeProvider knows. Any other
+// card number is approved.
+var DefaultFakeCards = map[string]string{
+	"4242424242424242": OutcomeApprove,
+	"4000000000000002": OutcomeCardDeclined,
+	"4000000000009995": OutcomeInsufficient,
+	"4000000000000069": OutcomeExpiredCard,
+	"4000000000000119": OutcomeProcessingError,
+	"4000000000000341": OutcomeCaptureDeclined,
+	"4000000000005126": OutcomeRefundDeclined,
+}
+
+// ErrProcessing is the transient error returned for OutcomeProcessingError cards
+var ErrProcessing = errors.New("fake provider: processing error")
+
+// FakeProvider is a deterministic provider for local setups and tests. The
+// outcome of every call depends only on the card number used to authorize,
+// and references are derived from the idempotency key, so repeating a call
+// gives the same answer.
+type FakeProvider struct {
+	cards map[string]string
+
+	mu sync.Mutex
+	// methods remembers the card behind each reference. References the fake
+	// doesn't know (e.g. after a restart) behave like an approving card.
+	methods map[string]string
+}
+
+// NewFakeProvider returns a fake that knows DefaultFakeCards plus cards,
+// which take precedence
+func NewFakeProvider(cards map[string]string) *FakeProvider {
+	merged := make(map[string]string, len(DefaultFakeCards)+len(cards))
+	for number, outcome := range DefaultFakeCards {
+		merged[number] = outcome
+	}
+	for number, outcome := range cards {
+		merged[number] = outcome
+	}
+	return &FakeProvider{cards: merged, methods: make(map[string]string)}
+}
+
+// ParseFakeCards reads "number=outcome" pairs separated by commas, the
+// format of the FAKE_PAYMENT_CARDS setting
+func ParseFakeCards(spec string) (map[string]string, error) {
+	cards := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		number, outcome, ok := strings.Cut(pair, "=")
+		if !ok || number == "" || !knownOutcome(outcome) {
+			return nil, fmt.Errorf("invalid fake card %q", pair)
+		}
+		cards[strings.TrimSpace(number)] = strings.TrimSpace(outcome)
+	}
+	return cards, nil
+}
+
+func knownOutcome(outcome string) bool {
+	switch strings.TrimSpace(outcome) {
+	case OutcomeApprove, OutcomeProcessingError, OutcomeCaptureDeclined, OutcomeRefundDeclined,
+		OutcomeCardDeclined, OutcomeInsufficient, OutcomeExpiredCard:
+		return true
+	}
+	return false
+}
+
+func (p *FakeProvider) Name() string { return "fake" }
+
+func (p *FakeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (*Authorization, error) {
+	outcome := p.outcome(req.PaymentMethod)
+
+	switch outcome {
+	case OutcomeProcessingError:
+		return nil, ErrProcessing
+	case OutcomeCardDeclined, OutcomeInsufficient, OutcomeExpiredCard:
+		return nil, &DeclineError{Code: outcome}
+	}
+
+	reference := fakeReference(req.IdempotencyKey)
+
+	p.mu.Lock()
+	p.methods[reference] = req.PaymentMethod
+	p.mu.Unlock()
+
+	return &Authorization{Reference: reference}, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, key, reference string, amount money.Money) error {
+	switch p.outcomeFor(reference) {
+	case OutcomeProcessingError:
+		return ErrProcessing
+	case OutcomeCaptureDeclined:
+		return &DeclineError{Code: CodeCaptureDeclined}
+	}
+	return nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, key, reference string, amount money.Money) error {
+	switch p.outcomeFor(reference) {
+	case OutcomeProcessingError:
+		return ErrProcessing
+	case OutcomeRefundDeclined:
+		return &DeclineError{Code: CodeRefundDeclined}
+	}
+	return nil
+}
+
+func (p *FakeProvider) Void(ctx context.Context, key, reference string) error {
+	if p.outcomeFor(reference) == OutcomeProcessingError {
+		return ErrProcessing
+	}
+	return nil
+}
+
+func (p *FakeProvider) outcome(method string) string {
+	if outcome, ok := p.cards[method]; ok {
+		return outcome
+	}
+	return OutcomeApprove
+}
+
+func (p *FakeProvider) outcomeFor(reference string) string {
+	p.mu.Lock()
+	method, ok := p.methods[reference]
+	p.mu.Unlock()
+
+	if !ok {
+		return OutcomeApprove
+	}
+	return p.outcome(method)
+}
+
+func fakeReference(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "fake_" + hex.EncodeToString(sum[:12])
+}
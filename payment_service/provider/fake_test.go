@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/product_service/money"
+)
+
+func TestFakeProvider_OutcomesByCard(t *testing.T) {
+	p := NewFakeProvider(nil)
+	ctx := context.Background()
+
+	auth, err := p.Authorize(ctx, AuthorizeRequest{IdempotencyKey: "k1", PaymentMethod: "4242424242424242", Amount: money.New(1000, "EUR")})
+	require.NoError(t, err)
+	assert.NoError(t, p.Capture(ctx, "c1", auth.Reference, money.New(1000, "EUR")))
+
+	_, err = p.Authorize(ctx, AuthorizeRequest{IdempotencyKey: "k2", PaymentMethod: "4000000000009995", Amount: money.New(1000, "EUR")})
+	code, declined := DeclineCode(err)
+	assert.True(t, declined)
+	assert.Equal(t, CodeInsufficientFunds, code)
+
+	_, err = p.Authorize(ctx, AuthorizeRequest{IdempotencyKey: "k3", PaymentMethod: "4000000000000119", Amount: money.New(1000, "EUR")})
+	assert.True(t, errors.Is(err, ErrProcessing))
+	_, declined = DeclineCode(err)
+	assert.False(t, declined)
+
+	auth, err = p.Authorize(ctx, AuthorizeRequest{IdempotencyKey: "k4", PaymentMethod: "4000000000000341", Amount: money.New(1000, "EUR")})
+	require.NoError(t, err)
+	code, _ = DeclineCode(p.Capture(ctx, "c4", auth.Reference, money.New(1000, "EUR")))
+	assert.Equal(t, CodeCaptureDeclined, code)
+}
+
+func TestFakeProvider_ReferenceIsDeterministic(t *testing.T) {
+	ctx := context.Background()
+	req := AuthorizeRequest{IdempotencyKey: "k1", PaymentMethod: "4242424242424242", Amount: money.New(1000, "EUR")}
+
+	first, err := NewFakeProvider(nil).Authorize(ctx, req)
+	require.NoError(t, err)
+	second, err := NewFakeProvider(nil).Authorize(ctx, req)
+	require.NoError(t, err)
+
+	assert.Equal(t, first.Reference, second.Reference)
+}
+
+func TestFakeProvider_ConfiguredCardsOverrideDefaults(t *testing.T) {
+	cards, err := ParseFakeCards(" 4242424242424242=expired_card, 5555555555554444=refund_declined ")
+	require.NoError(t, err)
+
+	p := NewFakeProvider(cards)
+	_, err = p.Authorize(context.Background(), AuthorizeRequest{IdempotencyKey: "k1", PaymentMethod: "4242424242424242", Amount: money.New(100, "EUR")})
+
+	code, _ := DeclineCode(err)
+	assert.Equal(t, CodeExpiredCard, code)
+	assert.Equal(t, OutcomeRefundDeclined, cards["5555555555554444"])
+}
+
+func TestParseFakeCards_Invalid(t *testing.T) {
+	for _, spec := range []string{"4242", "4242=maybe", "=approve"} {
+		_, err := ParseFakeCards(spec)
+		assert.Error(t, err, spec)
+	}
+
+	cards, err := ParseFakeCards("")
+	assert.NoError(t, err)
+	assert.Empty(t, cards)
+}
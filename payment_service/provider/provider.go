@@ -0,0 +1,63 @@
+// Package provider hides the payment provider behind PaymentProvider, so the
+// service logic doesn't depend on a particular payment gateway.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tird4d/go-microservices/product_service/money"
+)
+
+// PaymentProvider talks to the payment gateway. Every call carries the
+// idempotency key of the request that caused it; providers must pass it on,
+// so a call retried after a timeout doesn't charge twice.
+//
+// A rejection by the provider (declined card, failed capture) is returned as
+// a *DeclineError. Any other error is treated as transient.
+type PaymentProvider interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Authorization, error)
+	Capture(ctx context.Context, key, reference string, amount money.Money) error
+	Refund(ctx context.Context, key, reference string, amount money.Money) error
+	Void(ctx context.Context, key, reference string) error
+}
+
+type AuthorizeRequest struct {
+	IdempotencyKey string
+	PaymentMethod  string
+	Amount         money.Money
+}
+
+// Authorization is the provider's handle on an approved authorization
+type Authorization struct {
+	Reference string
+}
+
+// Decline codes shared by all providers
+const (
+	CodeCardDeclined      = "card_declined"
+	CodeInsufficientFunds = "insufficient_funds"
+	CodeExpiredCard       = "expired_card"
+	CodeCaptureDeclined   = "capture_declined"
+	CodeRefundDeclined    = "refund_declined"
+)
+
+// DeclineError is a final answer from the provider; retrying won't change it
+type DeclineError struct {
+	Code string
+}
+
+func (e *DeclineError) Error() string {
+	return fmt.Sprintf("payment declined: %s", e.Code)
+}
+
+// DeclineCode returns the code of a *DeclineError in err's chain
+func DeclineCode(err error) (string, bool) {
+	var decline *DeclineError
+	if errors.As(err, &decline) {
+		return decline.Code, true
+	}
+	return "", false
+}
@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tird4d/go-microservices/events/outbox"
+	"github.com/tird4d/go-microservices/payment_service/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MemoryPaymentRepository is a mutex-guarded in-memory PaymentRepository for
+// tests and local runs without Mongo. Outbox events are kept in order and
+// can be read with Events.
+type MemoryPaymentRepository struct {
+	mu       sync.Mutex
+	payments map[primitive.ObjectID]models.Payment
+	keys     map[string]models.IdempotencyKey
+	events   []outbox.Message
+}
+
+func NewMemoryPaymentRepository() *MemoryPaymentRepository {
+	return &MemoryPaymentRepository{
+		payments: make(map[primitive.ObjectID]models.Payment),
+		keys:     make(map[string]models.IdempotencyKey),
+	}
+}
+
+// FindByID returns mongo.ErrNoDocuments for unknown payments, like the Mongo implementation
+func (r *MemoryPaymentRepository) FindByID(ctx context.Context, oid primitive.ObjectID) (*models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment, ok := r.payments[oid]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	found := copyPayment(&payment)
+	return &found, nil
+}
+
+func (r *MemoryPaymentRepository) FindIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.keys[key]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &record, nil
+}
+
+func (r *MemoryPaymentRepository) Create(ctx context.Context, payment *models.Payment, key *models.IdempotencyKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.keys[key.Key]; ok {
+		return ErrIdempotencyKeyExists
+	}
+
+	r.keys[key.Key] = *key
+	r.payments[payment.ID] = copyPayment(payment)
+	return nil
+}
+
+func (r *MemoryPaymentRepository) Update(ctx context.Context, payment *models.Payment, key *models.IdempotencyKey, event *outbox.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.keys[key.Key]; ok {
+		return ErrIdempotencyKeyExists
+	}
+	stored, ok := r.payments[payment.ID]
+	if !ok || stored.Version != payment.Version {
+		return ErrPaymentConflict
+	}
+
+	payment.Version++
+	r.keys[key.Key] = *key
+	r.payments[payment.ID] = copyPayment(payment)
+	if event != nil {
+		r.events = append(r.events, *event)
+	}
+	return nil
+}
+
+// Events returns the outbox messages written so far, oldest first
+func (r *MemoryPaymentRepository) Events() []outbox.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]outbox.Message(nil), r.events...)
+}
+
+// copyPayment detaches the stored value from the caller's slice
+func copyPayment(payment *models.Payment) models.Payment {
+	c := *payment
+	c.Transitions = append([]models.PaymentTransition(nil), payment.Transitions...)
+	return c
+}
@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/payment_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MigrateFloatAmounts converts payments whose amounts are stored as numbers
+// in major units, as they were before amounts had a currency, into Money in
+// the default currency. Converted payments no longer match, which makes it
+// safe to run on every start.
+func (r *MongoPaymentRepository) MigrateFloatAmounts(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	filter := bson.M{"amount": bson.M{"$type": bson.A{"double", "int", "long", "decimal"}}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"amount":          toMoney("$amount"),
+		"captured_amount": toMoney("$captured_amount"),
+		"refunded_amount": toMoney("$refunded_amount"),
+		"transitions": bson.M{"$map": bson.M{
+			"input": "$transitions",
+			"as":    "transition",
+			"in": bson.M{"$mergeObjects": bson.A{"$$transition", bson.M{
+				"amount": toMoney("$$transition.amount"),
+			}}},
+		}},
+	}}}}
+
+	result, err := models.PaymentCollection().UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// toMoney is the aggregation expression turning the number at field into
+// Money in the default currency, rounded to the nearest minor unit. A missing
+// field becomes zero.
+func toMoney(field string) bson.M {
+	scale := money.Scale(money.DefaultCurrency)
+	return bson.M{
+		"amount":   bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{bson.M{"$ifNull": bson.A{field, 0}}, scale}}, 0}}},
+		"currency": money.DefaultCurrency,
+	}
+}
@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/events/outbox"
+	"github.com/tird4d/go-microservices/payment_service/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// idempotencyKeyRetention is how long a key protects against repeats
+const idempotencyKeyRetention = 7 * 24 * time.Hour
+
+type MongoPaymentRepository struct{}
+
+// EnsureIndexes creates the TTL index that forgets old idempotency keys and
+// the index used to look payments up by order
+func (r *MongoPaymentRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := models.IdempotencyKeyCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(idempotencyKeyRetention.Seconds())),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = models.PaymentCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "order_id", Value: 1}},
+	})
+	return err
+}
+
+func (r *MongoPaymentRepository) FindByID(ctx context.Context, oid primitive.ObjectID) (*models.Payment, error) {
+	payment := &models.Payment{}
+
+	if err := models.PaymentCollection().FindOne(ctx, bson.M{"_id": oid}).Decode(payment); err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+func (r *MongoPaymentRepository) FindIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyKey, error) {
+	record := &models.IdempotencyKey{}
+
+	if err := models.IdempotencyKeyCollection().FindOne(ctx, bson.M{"_id": key}).Decode(record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (r *MongoPaymentRepository) Create(ctx context.Context, payment *models.Payment, key *models.IdempotencyKey) error {
+	_, err := withTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if err := insertKey(sc, key); err != nil {
+			return nil, err
+		}
+
+		_, err := models.PaymentCollection().InsertOne(sc, payment)
+		return nil, err
+	})
+	return err
+}
+
+func (r *MongoPaymentRepository) Update(ctx context.Context, payment *models.Payment, key *models.IdempotencyKey, event *outbox.Message) error {
+	expected := payment.Version
+
+	_, err := withTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if err := insertKey(sc, key); err != nil {
+			return nil, err
+		}
+
+		next := *payment
+		next.Version = expected + 1
+		result, err := models.PaymentCollection().ReplaceOne(sc, bson.M{"_id": payment.ID, "version": expected}, &next)
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrPaymentConflict
+		}
+
+		if event != nil {
+			if _, err := models.OutboxCollection().InsertOne(sc, event); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	payment.Version = expected + 1
+	return nil
+}
+
+func insertKey(sc mongo.SessionContext, key *models.IdempotencyKey) error {
+	_, err := models.IdempotencyKeyCollection().InsertOne(sc, key)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrIdempotencyKeyExists
+	}
+	return err
+}
+
+// withTransaction runs fn in a MongoDB transaction. Transactions need MongoDB
+// to run as a replica set.
+func withTransaction(ctx context.Context, fn func(sc mongo.SessionContext) (interface{}, error)) (interface{}, error) {
+	session, err := models.PaymentCollection().Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	return session.WithTransaction(ctx, fn)
+}
@@ -0,0 +1,30 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tird4d/go-microservices/events/outbox"
+	"github.com/tird4d/go-microservices/payment_service/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrIdempotencyKeyExists means another request already used the key;
+	// nothing was written
+	ErrIdempotencyKeyExists = errors.New("idempotency key already used")
+	// ErrPaymentConflict means the payment changed since it was read
+	ErrPaymentConflict = errors.New("payment was modified concurrently")
+)
+
+// PaymentRepository stores payments together with the idempotency key of
+// the request that changed them and, where there is one, the outbox event
+// describing the change. All writes of one call happen atomically.
+type PaymentRepository interface {
+	FindByID(ctx context.Context, oid primitive.ObjectID) (*models.Payment, error)
+	FindIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyKey, error)
+	Create(ctx context.Context, payment *models.Payment, key *models.IdempotencyKey) error
+	// Update saves payment if its stored version still equals payment.Version
+	// and bumps the version. event may be nil.
+	Update(ctx context.Context, payment *models.Payment, key *models.IdempotencyKey, event *outbox.Message) error
+}
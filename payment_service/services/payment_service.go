@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tird4d/go-microservices/events"
+	"github.com/tird4d/go-microservices/events/outbox"
+	"github.com/tird4d/go-microservices/payment_service/logger"
+	"github.com/tird4d/go-microservices/payment_service/models"
+	"github.com/tird4d/go-microservices/payment_service/provider"
+	"github.com/tird4d/go-microservices/payment_service/repositories"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// Authorize holds amount on paymentMethod. A declined authorization is
+// stored like an approved one and reported as FailedPrecondition, also when
+// the request is repeated with the same key.
+func Authorize(ctx context.Context, repo repositories.PaymentRepository, p provider.PaymentProvider, key, userID, orderID, paymentMethod string, amount money.Money) (*models.Payment, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	if userID == "" {
+		return nil, status.Error(codes.InvalidArgument, "user ID is required")
+	}
+	if paymentMethod == "" {
+		return nil, status.Error(codes.InvalidArgument, "payment method is required")
+	}
+	amount.Currency = money.NormalizeCurrency(amount.Currency)
+	if err := money.ValidateCurrency(amount.Currency); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "amount: %v", err)
+	}
+	if amount.Amount <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "amount must be positive")
+	}
+
+	record := newKey(models.OperationAuthorize, key, userID, orderID, paymentMethod, amount.String())
+	if payment, found, err := replay(ctx, repo, record); err != nil || found {
+		return authorizeResult(payment, err)
+	}
+
+	auth, err := p.Authorize(ctx, provider.AuthorizeRequest{
+		IdempotencyKey: key,
+		PaymentMethod:  paymentMethod,
+		Amount:         amount,
+	})
+
+	now := time.Now()
+	payment := &models.Payment{
+		ID:             primitive.NewObjectID(),
+		UserID:         userID,
+		OrderID:        orderID,
+		Amount:         amount,
+		CapturedAmount: money.Zero(amount.Currency),
+		RefundedAmount: money.Zero(amount.Currency),
+		Provider:       p.Name(),
+		CreatedAt:      now,
+	}
+
+	if code, declined := provider.DeclineCode(err); declined {
+		payment.DeclineCode = code
+		payment.Transition(models.OperationAuthorize, models.PaymentDeclined, key, "", amount, now)
+	} else if err != nil {
+		logger.Log.Errorw("Payment provider failed to authorize", "provider", p.Name(), "error", err)
+		return nil, status.Error(codes.Unavailable, "payment provider unavailable")
+	} else {
+		payment.ProviderReference = auth.Reference
+		payment.Transition(models.OperationAuthorize, models.PaymentAuthorized, key, "", amount, now)
+	}
+
+	record.PaymentID = payment.ID
+	if err := repo.Create(ctx, payment, record); err != nil {
+		if errors.Is(err, repositories.ErrIdempotencyKeyExists) {
+			// A concurrent request with the same key won the race
+			payment, _, err := replay(ctx, repo, record)
+			return authorizeResult(payment, err)
+		}
+		logger.Log.Errorw("Failed to save payment", "user_id", userID, "error", err)
+		return nil, status.Error(codes.Internal, "failed to save payment")
+	}
+
+	logger.Log.Infow("💳 Payment authorization finished",
+		"payment_id", payment.ID.Hex(),
+		"user_id", userID,
+		"amount", amount.String(),
+		"status", payment.Status,
+	)
+
+	return authorizeResult(payment, nil)
+}
+
+func authorizeResult(payment *models.Payment, err error) (*models.Payment, error) {
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status == models.PaymentDeclined {
+		return nil, status.Errorf(codes.FailedPrecondition, "payment declined: %s", payment.DeclineCode)
+	}
+	return payment, nil
+}
+
+// Capture charges an authorized payment. amount 0 captures the full
+// authorized amount; capturing less releases the rest.
+func Capture(ctx context.Context, repo repositories.PaymentRepository, p provider.PaymentProvider, key, paymentID string, amount money.Money) (*models.Payment, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	amount.Currency = money.NormalizeCurrency(amount.Currency)
+	if amount.Amount < 0 {
+		return nil, status.Error(codes.InvalidArgument, "amount must not be negative")
+	}
+
+	record := newKey(models.OperationCapture, key, paymentID, amount.String())
+	if payment, found, err := replay(ctx, repo, record); err != nil || found {
+		return payment, err
+	}
+
+	payment, err := loadPayment(ctx, repo, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != models.PaymentAuthorized {
+		return nil, status.Errorf(codes.FailedPrecondition, "payment is %s", payment.Status)
+	}
+	if amount.IsZero() {
+		amount = payment.Amount
+	}
+	if err := checkCurrency(payment, amount); err != nil {
+		return nil, err
+	}
+	if amount.Amount > payment.Amount.Amount {
+		return nil, status.Error(codes.InvalidArgument, "capture amount exceeds the authorized amount")
+	}
+
+	if err := p.Capture(ctx, key, payment.ProviderReference, amount); err != nil {
+		return nil, providerError("capture", payment, err)
+	}
+
+	payment.CapturedAmount = amount
+	payment.Transition(models.OperationCapture, models.PaymentCaptured, key, "", amount, time.Now())
+
+	event, err := outbox.NewMessage(ctx, events.PaymentExchange, events.PaymentCapturedEvent{
+		PaymentID:      payment.ID.Hex(),
+		OrderID:        payment.OrderID,
+		UserID:         payment.UserID,
+		CapturedAmount: eventMoney(amount),
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to build payment event")
+	}
+
+	return saveTransition(ctx, repo, payment, record, event)
+}
+
+// Refund returns captured money. amount 0 refunds everything that hasn't
+// been refunded yet.
+func Refund(ctx context.Context, repo repositories.PaymentRepository, p provider.PaymentProvider, key, paymentID string, amount money.Money, reason string) (*models.Payment, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	amount.Currency = money.NormalizeCurrency(amount.Currency)
+	if amount.Amount < 0 {
+		return nil, status.Error(codes.InvalidArgument, "amount must not be negative")
+	}
+
+	record := newKey(models.OperationRefund, key, paymentID, amount.String(), reason)
+	if payment, found, err := replay(ctx, repo, record); err != nil || found {
+		return payment, err
+	}
+
+	payment, err := loadPayment(ctx, repo, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != models.PaymentCaptured && payment.Status != models.PaymentPartiallyRefunded {
+		return nil, status.Errorf(codes.FailedPrecondition, "payment is %s", payment.Status)
+	}
+
+	currency := payment.Amount.Currency
+	refundable := money.New(payment.CapturedAmount.Amount-payment.RefundedAmount.Amount, currency)
+	if amount.IsZero() {
+		amount = refundable
+	}
+	if err := checkCurrency(payment, amount); err != nil {
+		return nil, err
+	}
+	if amount.Amount > refundable.Amount {
+		return nil, status.Errorf(codes.InvalidArgument, "refund amount exceeds the refundable %s", refundable)
+	}
+
+	if err := p.Refund(ctx, key, payment.ProviderReference, amount); err != nil {
+		return nil, providerError("refund", payment, err)
+	}
+
+	payment.RefundedAmount = money.New(payment.RefundedAmount.Amount+amount.Amount, currency)
+	fullyRefunded := payment.RefundedAmount.Amount >= payment.CapturedAmount.Amount
+	next := models.PaymentPartiallyRefunded
+	if fullyRefunded {
+		next = models.PaymentRefunded
+	}
+	payment.Transition(models.OperationRefund, next, key, reason, amount, time.Now())
+
+	event, err := outbox.NewMessage(ctx, events.PaymentExchange, events.PaymentRefundedEvent{
+		PaymentID:      payment.ID.Hex(),
+		OrderID:        payment.OrderID,
+		UserID:         payment.UserID,
+		Amount:         eventMoney(amount),
+		RefundedAmount: eventMoney(payment.RefundedAmount),
+		FullyRefunded:  fullyRefunded,
+		Reason:         reason,
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to build payment event")
+	}
+
+	return saveTransition(ctx, repo, payment, record, event)
+}
+
+// Void cancels an authorization. Voiding a payment that was declined or is
+// already voided changes nothing; a captured payment has to be refunded instead.
+func Void(ctx context.Context, repo repositories.PaymentRepository, p provider.PaymentProvider, key, paymentID string) (*models.Payment, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	record := newKey(models.OperationVoid, key, paymentID)
+	if payment, found, err := replay(ctx, repo, record); err != nil || found {
+		return payment, err
+	}
+
+	payment, err := loadPayment(ctx, repo, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	switch payment.Status {
+	case models.PaymentVoided, models.PaymentDeclined:
+		return payment, nil
+	case models.PaymentAuthorized:
+	default:
+		return nil, status.Errorf(codes.FailedPrecondition, "payment is %s", payment.Status)
+	}
+
+	if err := p.Void(ctx, key, payment.ProviderReference); err != nil {
+		return nil, providerError("void", payment, err)
+	}
+
+	payment.Transition(models.OperationVoid, models.PaymentVoided, key, "", payment.Amount, time.Now())
+
+	return saveTransition(ctx, repo, payment, record, nil)
+}
+
+func GetPayment(ctx context.Context, repo repositories.PaymentRepository, paymentID string) (*models.Payment, error) {
+	return loadPayment(ctx, repo, paymentID)
+}
+
+func loadPayment(ctx context.Context, repo repositories.PaymentRepository, paymentID string) (*models.Payment, error) {
+	oid, err := primitive.ObjectIDFromHex(paymentID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid payment ID format")
+	}
+
+	payment, err := repo.FindByID(ctx, oid)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, status.Error(codes.NotFound, "payment not found")
+		}
+		logger.Log.Errorw("Failed to load payment", "payment_id", paymentID, "error", err)
+		return nil, status.Error(codes.Internal, "failed to load payment")
+	}
+
+	return payment, nil
+}
+
+// saveTransition stores a changed payment with the request's key and event
+func saveTransition(ctx context.Context, repo repositories.PaymentRepository, payment *models.Payment, record *models.IdempotencyKey, event *outbox.Message) (*models.Payment, error) {
+	record.PaymentID = payment.ID
+
+	err := repo.Update(ctx, payment, record, event)
+	switch {
+	case err == nil:
+		logger.Log.Infow("💳 Payment updated",
+			"payment_id", payment.ID.Hex(),
+			"operation", record.Operation,
+			"status", payment.Status,
+		)
+		return payment, nil
+	case errors.Is(err, repositories.ErrIdempotencyKeyExists):
+		payment, _, err := replay(ctx, repo, record)
+		return payment, err
+	case errors.Is(err, repositories.ErrPaymentConflict):
+		return nil, status.Error(codes.Aborted, "payment was changed by another request, retry")
+	default:
+		logger.Log.Errorw("Failed to save payment", "payment_id", payment.ID.Hex(), "error", err)
+		return nil, status.Error(codes.Internal, "failed to save payment")
+	}
+}
+
+// replay looks up a request's idempotency key. When the key was used before
+// it returns the payment that request produced; the caller returns it as is.
+func replay(ctx context.Context, repo repositories.PaymentRepository, record *models.IdempotencyKey) (*models.Payment, bool, error) {
+	existing, err := repo.FindIdempotencyKey(ctx, record.Key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, false, nil
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to look up idempotency key", "error", err)
+		return nil, false, status.Error(codes.Internal, "failed to look up idempotency key")
+	}
+	if existing.Fingerprint != record.Fingerprint {
+		return nil, true, status.Error(codes.InvalidArgument, "idempotency key was already used for a different request")
+	}
+
+	payment, err := loadPayment(ctx, repo, existing.PaymentID.Hex())
+	if err != nil {
+		return nil, true, err
+	}
+	return payment, true, nil
+}
+
+// providerError maps a failed provider call to a status. Declines are final;
+// anything else may work when retried with the same key.
+func providerError(operation string, payment *models.Payment, err error) error {
+	if code, declined := provider.DeclineCode(err); declined {
+		return status.Errorf(codes.FailedPrecondition, "%s declined: %s", operation, code)
+	}
+	logger.Log.Errorw("Payment provider call failed",
+		"operation", operation,
+		"payment_id", payment.ID.Hex(),
+		"error", err,
+	)
+	return status.Error(codes.Unavailable, "payment provider unavailable")
+}
+
+func validateKey(key string) error {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return status.Error(codes.InvalidArgument, "idempotency key is required and must be at most 255 characters")
+	}
+	return nil
+}
+
+// newKey builds the idempotency record for operation. args are the request
+// arguments that must match when the key is used again.
+func newKey(operation, key string, args ...string) *models.IdempotencyKey {
+	sum := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return &models.IdempotencyKey{
+		Key:         operation + ":" + key,
+		Operation:   operation,
+		Fingerprint: hex.EncodeToString(sum[:]),
+		CreatedAt:   time.Now(),
+	}
+}
+
+// checkCurrency rejects a capture or refund amount that isn't in the
+// currency of the authorization
+func checkCurrency(payment *models.Payment, amount money.Money) error {
+	if amount.Currency != payment.Amount.Currency {
+		return status.Errorf(codes.InvalidArgument, "amount must be in %s, the currency of the payment", payment.Amount.Currency)
+	}
+	return nil
+}
+
+func eventMoney(m money.Money) events.Money {
+	return events.Money{Amount: m.Amount, Currency: m.Currency}
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/events"
+	"github.com/tird4d/go-microservices/events/outbox"
+	"github.com/tird4d/go-microservices/payment_service/logger"
+	"github.com/tird4d/go-microservices/payment_service/models"
+	"github.com/tird4d/go-microservices/payment_service/provider"
+	"github.com/tird4d/go-microservices/payment_service/repositories"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	approveCard        = "4242424242424242"
+	declineCard        = "4000000000000002"
+	processingCard     = "4000000000000119"
+	captureDeclineCard = "4000000000000341"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger(true)
+
+	os.Exit(m.Run())
+}
+
+// countingProvider wraps the fake provider and counts calls, to check that
+// repeated requests don't reach the provider again
+type countingProvider struct {
+	*provider.FakeProvider
+	authorizations int
+	captures       int
+}
+
+func (p *countingProvider) Authorize(ctx context.Context, req provider.AuthorizeRequest) (*provider.Authorization, error) {
+	p.authorizations++
+	return p.FakeProvider.Authorize(ctx, req)
+}
+
+func (p *countingProvider) Capture(ctx context.Context, key, reference string, amount money.Money) error {
+	p.captures++
+	return p.FakeProvider.Capture(ctx, key, reference, amount)
+}
+
+func setup() (*repositories.MemoryPaymentRepository, *countingProvider) {
+	return repositories.NewMemoryPaymentRepository(), &countingProvider{FakeProvider: provider.NewFakeProvider(nil)}
+}
+
+func eur(cents int64) money.Money {
+	return money.New(cents, "EUR")
+}
+
+func authorized(t *testing.T, repo repositories.PaymentRepository, p provider.PaymentProvider, amount money.Money) *models.Payment {
+	t.Helper()
+	payment, err := Authorize(context.Background(), repo, p, "auth-1", "u1", "o1", approveCard, amount)
+	require.NoError(t, err)
+	return payment
+}
+
+// --- AUTHORIZE TESTS ---
+
+func TestAuthorize_Success(t *testing.T) {
+	repo, p := setup()
+
+	payment, err := Authorize(context.Background(), repo, p, "auth-1", "u1", "o1", approveCard, money.New(2501, "eur"))
+
+	require.NoError(t, err)
+	assert.Equal(t, models.PaymentAuthorized, payment.Status)
+	assert.Equal(t, eur(2501), payment.Amount)
+	assert.Equal(t, eur(0), payment.CapturedAmount)
+	assert.Equal(t, "fake", payment.Provider)
+	assert.NotEmpty(t, payment.ProviderReference)
+	require.Len(t, payment.Transitions, 1)
+	assert.Equal(t, models.OperationAuthorize, payment.Transitions[0].Operation)
+}
+
+func TestAuthorize_SameKeyReturnsSamePayment(t *testing.T) {
+	repo, p := setup()
+	ctx := context.Background()
+
+	first, err := Authorize(ctx, repo, p, "auth-1", "u1", "o1", approveCard, eur(1000))
+	require.NoError(t, err)
+	second, err := Authorize(ctx, repo, p, "auth-1", "u1", "o1", approveCard, eur(1000))
+	require.NoError(t, err)
+
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, 1, p.authorizations)
+}
+
+func TestAuthorize_KeyReusedForDifferentRequest(t *testing.T) {
+	repo, p := setup()
+	ctx := context.Background()
+
+	_, err := Authorize(ctx, repo, p, "auth-1", "u1", "o1", approveCard, eur(1000))
+	require.NoError(t, err)
+
+	_, err = Authorize(ctx, repo, p, "auth-1", "u1", "o1", approveCard, eur(2000))
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, 1, p.authorizations)
+}
+
+func TestAuthorize_DeclineIsStoredAndReplayed(t *testing.T) {
+	repo, p := setup()
+	ctx := context.Background()
+
+	_, err := Authorize(ctx, repo, p, "auth-1", "u1", "o1", declineCard, eur(1000))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, err.Error(), provider.CodeCardDeclined)
+
+	_, err = Authorize(ctx, repo, p, "auth-1", "u1", "o1", declineCard, eur(1000))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, 1, p.authorizations)
+}
+
+func TestAuthorize_ProcessingErrorIsRetryable(t *testing.T) {
+	repo, p := setup()
+
+	_, err := Authorize(context.Background(), repo, p, "auth-1", "u1", "o1", processingCard, eur(1000))
+
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	// Nothing stored, so the same key can be tried again
+	_, err = repo.FindIdempotencyKey(context.Background(), "authorize:auth-1")
+	assert.Error(t, err)
+}
+
+func TestAuthorize_InvalidInput(t *testing.T) {
+	repo, p := setup()
+	ctx := context.Background()
+
+	_, err := Authorize(ctx, repo, p, "", "u1", "o1", approveCard, eur(1000))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = Authorize(ctx, repo, p, "k", "u1", "o1", "", eur(1000))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = Authorize(ctx, repo, p, "k", "u1", "o1", approveCard, eur(0))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = Authorize(ctx, repo, p, "k", "u1", "o1", approveCard, money.New(1000, "ABC"))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// --- CAPTURE TESTS ---
+
+func TestCapture_FullAmountPublishesEvent(t *testing.T) {
+	repo, p := setup()
+	ctx := context.Background()
+	payment := authorized(t, repo, p, eur(4000))
+
+	captured, err := Capture(ctx, repo, p, "cap-1", payment.ID.Hex(), money.Money{})
+
+	require.NoError(t, err)
+	assert.Equal(t, models.PaymentCaptured, captured.Status)
+	assert.Equal(t, eur(4000), captured.CapturedAmount)
+
+	messages := repo.Events()
+	require.Len(t, messages, 1)
+	assert.Equal(t, events.PaymentCaptured, messages[0].EventType)
+
+	env, err := events.Decode(messages[0].Payload)
+	require.NoError(t, err)
+	event, err := events.DecodePayload[events.PaymentCapturedEvent](env)
+	require.NoError(t, err)
+	assert.Equal(t, "o1", event.OrderID)
+	assert.Equal(t, events.Money{Amount: 4000, Currency: "EUR"}, event.CapturedAmount)
+}
+
+func TestCapture_RetryWithSameKeyDoesNotCaptureTwice(t *testing.T) {
+	repo, p := setup()
+	ctx := context.Background()
+	payment := authorized(t, repo, p, eur(4000))
+
+	_, err := Capture(ctx, repo, p, "cap-1", payment.ID.Hex(), money.Money{})
+	require.NoError(t, err)
+	again, err := Capture(ctx, repo, p, "cap-1", payment.ID.Hex(), money.Money{})
+
+	require.NoError(t, err)
+	assert.Equal(t, models.PaymentCaptured, again.Status)
+	assert.Equal(t, 1, p.captures)
+	assert.Len(t, repo.Events(), 1)
+}
+
+func TestCapture_NewKeyOnCapturedPaymentFails(t *testing.T) {
+	repo, p := setup()
+	ctx := context.Background()
+	payment := authorized(t, repo, p, eur(4000))
+
+	_, err := Capture(ctx, repo, p, "cap-1", payment.ID.Hex(), money.Money{})
+	require.NoError(t, err)
+	_, err = Capture(ctx, repo, p, "cap-2", payment.ID.Hex(), money.Money{})
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestCapture_MoreThanAuthorized(t *testing.T) {
+	repo, p := setup()
+	payment := authorized(t, repo, p, eur(4000))
+
+	_, err := Capture(context.Background(), repo, p, "cap-1", payment.ID.Hex(), eur(4100))
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestCapture_OtherCurrency(t *testing.T) {
+	repo, p := setup()
+	payment := authorized(t, repo, p, eur(4000))
+
+	_, err := Capture(context.Background(), repo, p, "cap-1", payment.ID.Hex(), money.New(4000, "USD"))
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, 0, p.captures)
+}
+
+func TestCapture_DeclinedByProvider(t *testing.T) {
+	repo, p := setup()
+	ctx := context.Background()
+	payment, err := Authorize(ctx, repo, p, "auth-1", "u1", "o1", captureDeclineCard, eur(1000))
+	require.NoError(t, err)
+
+	_, err = Capture(ctx, repo, p, "cap-1", payment.ID.Hex(), money.Money{})
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	stored, _ := repo.FindByID(ctx, payment.ID)
+	assert.Equal(t, models.PaymentAuthorized, stored.Status)
+	assert.Empty(t, repo.Events())
+}
+
+func TestCapture_UnknownPayment(t *testing.T) {
+	repo, p := setup()
+
+	_, err := Capture(context.Background(), repo, p, "cap-1", "507f1f77bcf86cd799439011", money.Money{})
+
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// --- REFUND TESTS ---
+
+func TestRefund_PartialThenRest(t *testing.T) {
+	repo, p := setup()
+	ctx := context.Background()
+	payment := authorized(t, repo, p, eur(4000))
+	_, err := Capture(ctx, repo, p, "cap-1", payment.ID.Hex(), money.Money{})
+	require.NoError(t, err)
+
+	partial, err := Refund(ctx, repo, p, "ref-1", payment.ID.Hex(), eur(1500), "damaged")
+	require.NoError(t, err)
+	assert.Equal(t, models.PaymentPartiallyRefunded, partial.Status)
+	assert.Equal(t, eur(1500), partial.RefundedAmount)
+
+	rest, err := Refund(ctx, repo, p, "ref-2", payment.ID.Hex(), money.Money{}, "returned")
+	require.NoError(t, err)
+	assert.Equal(t, models.PaymentRefunded, rest.Status)
+	assert.Equal(t, eur(4000), rest.RefundedAmount)
+
+	messages := repo.Events()
+	require.Len(t, messages, 3)
+	env, err := events.Decode(messages[2].Payload)
+	require.NoError(t, err)
+	event, err := events.DecodePayload[events.PaymentRefundedEvent](env)
+	require.NoError(t, err)
+	assert.True(t, event.FullyRefunded)
+	assert.Equal(t, events.Money{Amount: 2500, Currency: "EUR"}, event.Amount)
+}
+
+func TestRefund_MoreThanRefundable(t *testing.T) {
+	repo, p := setup()
+	ctx := context.Background()
+	payment := authorized(t, repo, p, eur(4000))
+	_, err := Capture(ctx, repo, p, "cap-1", payment.ID.Hex(), eur(3000))
+	require.NoError(t, err)
+
+	_, err = Refund(ctx, repo, p, "ref-1", payment.ID.Hex(), eur(3100), "")
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRefund_NotCaptured(t *testing.T) {
+	repo, p := setup()
+	payment := authorized(t, repo, p, eur(4000))
+
+	_, err := Refund(context.Background(), repo, p, "ref-1", payment.ID.Hex(), money.Money{}, "")
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+// --- VOID TESTS ---
+
+func TestVoid_AuthorizedPayment(t *testing.T) {
+	repo, p := setup()
+	ctx := context.Background()
+	payment := authorized(t, repo, p, eur(4000))
+
+	voided, err := Void(ctx, repo, p, "void-1", payment.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, models.PaymentVoided, voided.Status)
+
+	// Voiding again, even with another key, changes nothing
+	again, err := Void(ctx, repo, p, "void-2", payment.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, voided.Version, again.Version)
+	assert.Empty(t, repo.Events())
+}
+
+func TestVoid_CapturedPaymentFails(t *testing.T) {
+	repo, p := setup()
+	ctx := context.Background()
+	payment := authorized(t, repo, p, eur(4000))
+	_, err := Capture(ctx, repo, p, "cap-1", payment.ID.Hex(), money.Money{})
+	require.NoError(t, err)
+
+	_, err = Void(ctx, repo, p, "void-1", payment.ID.Hex())
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+// --- CONCURRENCY ---
+
+type conflictingRepo struct {
+	*repositories.MemoryPaymentRepository
+}
+
+func (r conflictingRepo) Update(ctx context.Context, payment *models.Payment, key *models.IdempotencyKey, event *outbox.Message) error {
+	return repositories.ErrPaymentConflict
+}
+
+func TestCapture_ConcurrentChangeIsAborted(t *testing.T) {
+	repo, p := setup()
+	payment := authorized(t, repo, p, eur(4000))
+
+	_, err := Capture(context.Background(), conflictingRepo{repo}, p, "cap-1", payment.ID.Hex(), money.Money{})
+
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.False(t, errors.Is(err, repositories.ErrPaymentConflict))
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/tird4d/go-microservices/product_service/logger"
+	"github.com/tird4d/go-microservices/product_service/models"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"github.com/tird4d/go-microservices/product_service/repositories"
+	"github.com/tird4d/go-microservices/product_service/services"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// CreateCategory adds a category to the tree
+func (s *Server) CreateCategory(ctx context.Context, req *productpb.CreateCategoryRequest) (*productpb.Category, error) {
+	logger.Log.Infow("Creating category", "slug", req.GetSlug(), "parent_id", req.GetParentId())
+
+	repo := &repositories.MongoProductRepository{}
+
+	category, err := services.CreateCategory(ctx, repo, req.GetSlug(), req.GetName(), req.GetParentId())
+	if err != nil {
+		logger.Log.Errorw("Failed to create category", "error", err)
+		return nil, err
+	}
+
+	return toCategoryResponse(&models.CategoryNode{Category: category}), nil
+}
+
+// GetCategory returns a category with its product count
+func (s *Server) GetCategory(ctx context.Context, req *productpb.GetCategoryRequest) (*productpb.Category, error) {
+	repo := &repositories.MongoProductRepository{}
+
+	node, err := services.GetCategory(ctx, repo, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	return toCategoryResponse(node), nil
+}
+
+// ListCategories returns all categories with their product counts
+func (s *Server) ListCategories(ctx context.Context, req *productpb.ListCategoriesRequest) (*productpb.ListCategoriesResponse, error) {
+	repo := &repositories.MongoProductRepository{}
+
+	nodes, err := services.ListCategories(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &productpb.ListCategoriesResponse{Categories: make([]*productpb.Category, len(nodes))}
+	for i, node := range nodes {
+		res.Categories[i] = toCategoryResponse(node)
+	}
+	return res, nil
+}
+
+// GetCategoryTree returns the categories nested below their parents
+func (s *Server) GetCategoryTree(ctx context.Context, req *productpb.GetCategoryTreeRequest) (*productpb.GetCategoryTreeResponse, error) {
+	repo := &repositories.MongoProductRepository{}
+
+	roots, err := services.GetCategoryTree(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &productpb.GetCategoryTreeResponse{Roots: toCategoryNodes(roots)}, nil
+}
+
+// UpdateCategory renames or moves a category
+func (s *Server) UpdateCategory(ctx context.Context, req *productpb.UpdateCategoryRequest) (*productpb.Category, error) {
+	logger.Log.Infow("Updating category", "id", req.GetId(), "update_mask", req.GetUpdateMask().GetPaths())
+
+	repo := &repositories.MongoProductRepository{}
+
+	changes := &models.Category{Slug: req.GetSlug(), Name: req.GetName()}
+	category, err := services.UpdateCategory(ctx, repo, req.GetId(), changes, req.GetParentId(), req.GetUpdateMask().GetPaths())
+	if err != nil {
+		logger.Log.Errorw("Failed to update category", "error", err)
+		return nil, err
+	}
+
+	return toCategoryResponse(&models.CategoryNode{Category: category}), nil
+}
+
+// DeleteCategory removes an empty category
+func (s *Server) DeleteCategory(ctx context.Context, req *productpb.DeleteCategoryRequest) (*productpb.DeleteCategoryResponse, error) {
+	logger.Log.Infow("Deleting category", "id", req.GetId())
+
+	repo := &repositories.MongoProductRepository{}
+
+	if err := services.DeleteCategory(ctx, repo, req.GetId()); err != nil {
+		logger.Log.Errorw("Failed to delete category", "error", err)
+		return nil, err
+	}
+
+	return &productpb.DeleteCategoryResponse{
+		Success: true,
+		Message: "Category deleted successfully",
+	}, nil
+}
+
+// MergeCategories folds one category into another
+func (s *Server) MergeCategories(ctx context.Context, req *productpb.MergeCategoriesRequest) (*productpb.Category, error) {
+	logger.Log.Infow("Merging categories", "source_id", req.GetSourceId(), "target_id", req.GetTargetId())
+
+	repo := &repositories.MongoProductRepository{}
+
+	if _, err := services.MergeCategories(ctx, repo, req.GetSourceId(), req.GetTargetId()); err != nil {
+		logger.Log.Errorw("Failed to merge categories", "error", err)
+		return nil, err
+	}
+
+	// Answer with the target's product count after the merge
+	node, err := services.GetCategory(ctx, repo, req.GetTargetId())
+	if err != nil {
+		return nil, err
+	}
+	return toCategoryResponse(node), nil
+}
+
+func toCategoryNodes(nodes []*models.CategoryNode) []*productpb.CategoryNode {
+	res := make([]*productpb.CategoryNode, len(nodes))
+	for i, node := range nodes {
+		res[i] = &productpb.CategoryNode{
+			Category:          toCategoryResponse(node),
+			TotalProductCount: node.TotalProductCount,
+			Children:          toCategoryNodes(node.Children),
+		}
+	}
+	return res
+}
+
+func toCategoryResponse(node *models.CategoryNode) *productpb.Category {
+	res := &productpb.Category{
+		Id:           node.ID.Hex(),
+		Slug:         node.Slug,
+		Name:         node.Name,
+		ProductCount: node.ProductCount,
+		CreatedAt:    timestamppb.New(node.CreatedAt),
+		UpdatedAt:    timestamppb.New(node.UpdatedAt),
+	}
+	if node.ParentID != nil {
+		res.ParentId = node.ParentID.Hex()
+	}
+	return res
+}
@@ -4,8 +4,11 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/tird4d/go-microservices/product_service/logger"
+	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
 	productpb "github.com/tird4d/go-microservices/product_service/proto"
 	"github.com/tird4d/go-microservices/product_service/repositories"
 	"github.com/tird4d/go-microservices/product_service/services"
@@ -23,7 +26,7 @@ var mockProductList = []*productpb.Product{
 		Id:          "1",
 		Name:        "Laptop Pro 15",
 		Description: "High-performance laptop with 16GB RAM and 512GB SSD",
-		Price:       1299.99,
+		Price:       &productpb.Money{Amount: 129999, Currency: "EUR"},
 		Category:    "electronics",
 		Stock:       25,
 		ImageUrl:    "https://example.com/laptop.jpg",
@@ -34,7 +37,7 @@ var mockProductList = []*productpb.Product{
 		Id:          "2",
 		Name:        "Wireless Mouse",
 		Description: "Ergonomic wireless mouse with 6 buttons",
-		Price:       29.99,
+		Price:       &productpb.Money{Amount: 2999, Currency: "EUR"},
 		Category:    "electronics",
 		Stock:       150,
 		ImageUrl:    "https://example.com/mouse.jpg",
@@ -45,7 +48,7 @@ var mockProductList = []*productpb.Product{
 		Id:          "3",
 		Name:        "Programming Book",
 		Description: "Learn Go programming from scratch",
-		Price:       45.00,
+		Price:       &productpb.Money{Amount: 4500, Currency: "EUR"},
 		Category:    "books",
 		Stock:       80,
 		ImageUrl:    "https://example.com/book.jpg",
@@ -65,7 +68,7 @@ func init() {
 func (s *Server) CreateProduct(ctx context.Context, req *productpb.CreateProductRequest) (*productpb.Product, error) {
 	logger.Log.Infow("Creating new product",
 		"name", req.Name,
-		"price", req.Price,
+		"price", req.GetPrice().String(),
 		"category", req.Category,
 	)
 
@@ -79,7 +82,7 @@ func (s *Server) CreateProduct(ctx context.Context, req *productpb.CreateProduct
 		req.GetDescription(),
 		req.GetCategory(),
 		req.GetImageUrl(),
-		req.GetPrice(),
+		fromMoneyRequest(req.GetPrice()),
 		req.GetStock(),
 	)
 	if err != nil {
@@ -92,12 +95,13 @@ func (s *Server) CreateProduct(ctx context.Context, req *productpb.CreateProduct
 		Id:          product.ID.Hex(),
 		Name:        product.Name,
 		Description: product.Description,
-		Price:       product.Price,
+		Price:       toMoneyResponse(product.Price),
 		Category:    product.Category,
 		Stock:       product.Stock,
 		ImageUrl:    product.ImageURL,
 		CreatedAt:   timestamppb.New(product.CreatedAt),
 		UpdatedAt:   timestamppb.New(product.UpdatedAt),
+		Version:     product.Version,
 	}
 
 	logger.Log.Infow("Product created successfully",
@@ -125,12 +129,13 @@ func (s *Server) GetProduct(ctx context.Context, req *productpb.GetProductReques
 		Id:          product.ID.Hex(),
 		Name:        product.Name,
 		Description: product.Description,
-		Price:       product.Price,
+		Price:       toMoneyResponse(product.Price),
 		Category:    product.Category,
 		Stock:       product.Stock,
 		ImageUrl:    product.ImageURL,
 		CreatedAt:   timestamppb.New(product.CreatedAt),
 		UpdatedAt:   timestamppb.New(product.UpdatedAt),
+		Version:     product.Version,
 	}
 
 	logger.Log.Infow("Product retrieved successfully", "id", product.ID)
@@ -144,17 +149,15 @@ func (s *Server) UpdateProduct(ctx context.Context, req *productpb.UpdateProduct
 	repo := &repositories.MongoProductRepository{}
 
 	// Call service layer to update product
-	product, err := services.UpdateProduct(
-		ctx,
-		repo,
-		req.GetId(),
-		req.GetName(),
-		req.GetDescription(),
-		req.GetCategory(),
-		req.GetImageUrl(),
-		req.GetPrice(),
-		req.GetStock(),
-	)
+	changes := &models.Product{
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+		Price:       fromMoneyRequest(req.GetPrice()),
+		Category:    req.GetCategory(),
+		ImageURL:    req.GetImageUrl(),
+	}
+
+	product, err := services.UpdateProduct(ctx, repo, req.GetId(), changes, req.GetUpdateMask().GetPaths(), req.GetExpectedVersion())
 	if err != nil {
 		logger.Log.Errorw("Failed to update product", "error", err)
 		return nil, err
@@ -165,12 +168,13 @@ func (s *Server) UpdateProduct(ctx context.Context, req *productpb.UpdateProduct
 		Id:          product.ID.Hex(),
 		Name:        product.Name,
 		Description: product.Description,
-		Price:       product.Price,
+		Price:       toMoneyResponse(product.Price),
 		Category:    product.Category,
 		Stock:       product.Stock,
 		ImageUrl:    product.ImageURL,
 		CreatedAt:   timestamppb.New(product.CreatedAt),
 		UpdatedAt:   timestamppb.New(product.UpdatedAt),
+		Version:     product.Version,
 	}
 
 	logger.Log.Infow("Product updated successfully",
@@ -188,7 +192,7 @@ func (s *Server) DeleteProduct(ctx context.Context, req *productpb.DeleteProduct
 	repo := &repositories.MongoProductRepository{}
 
 	// Call service layer to delete product
-	err := services.DeleteProduct(ctx, repo, req.GetId())
+	err := services.DeleteProduct(ctx, repo, req.GetId(), req.GetExpectedVersion())
 	if err != nil {
 		logger.Log.Errorw("Failed to delete product", "error", err)
 		// Return structured error response
@@ -206,6 +210,75 @@ func (s *Server) DeleteProduct(ctx context.Context, req *productpb.DeleteProduct
 	}, nil
 }
 
+// SearchProducts searches products by free text, filters and sort order
+func (s *Server) SearchProducts(ctx context.Context, req *productpb.SearchProductsRequest) (*productpb.SearchProductsResponse, error) {
+	logger.Log.Infow("Searching products",
+		"query", req.GetQuery(),
+		"categories", req.GetCategories(),
+		"sort", req.GetSort(),
+		"page", req.GetPage(),
+	)
+
+	repo := &repositories.MongoProductRepository{}
+
+	search := &models.ProductSearch{
+		Query:       req.GetQuery(),
+		Categories:  req.GetCategories(),
+		Currency:    req.GetCurrency(),
+		MinPrice:    fromOptionalMoney(req.GetMinPrice()),
+		MaxPrice:    fromOptionalMoney(req.GetMaxPrice()),
+		InStockOnly: req.GetInStockOnly(),
+		Sort:        req.GetSort(),
+	}
+
+	result, err := services.SearchProducts(ctx, repo, search, req.GetPage(), req.GetPageSize())
+	if err != nil {
+		logger.Log.Errorw("Failed to search products", "error", err)
+		return nil, err
+	}
+
+	productResponses := make([]*productpb.Product, len(result.Products))
+	for i, product := range result.Products {
+		productResponses[i] = &productpb.Product{
+			Id:          product.ID.Hex(),
+			Name:        product.Name,
+			Description: product.Description,
+			Price:       toMoneyResponse(product.Price),
+			Category:    product.Category,
+			Stock:       product.Stock,
+			ImageUrl:    product.ImageURL,
+			CreatedAt:   timestamppb.New(product.CreatedAt),
+			UpdatedAt:   timestamppb.New(product.UpdatedAt),
+			Version:     product.Version,
+		}
+	}
+
+	categoryFacets := make([]*productpb.CategoryFacet, len(result.CategoryFacets))
+	for i, facet := range result.CategoryFacets {
+		categoryFacets[i] = &productpb.CategoryFacet{Category: facet.Category, Count: facet.Count}
+	}
+
+	priceFacets := make([]*productpb.PriceFacet, len(result.PriceFacets))
+	for i, facet := range result.PriceFacets {
+		priceFacets[i] = &productpb.PriceFacet{Min: toMoneyResponse(facet.Min), Count: facet.Count}
+		if facet.Max != nil {
+			priceFacets[i].Max = toMoneyResponse(*facet.Max)
+		}
+	}
+
+	// The service applied its pagination defaults to Skip and Limit
+	pageSize := int32(search.Limit)
+
+	return &productpb.SearchProductsResponse{
+		Products:       productResponses,
+		Total:          int32(result.Total),
+		Page:           int32(search.Skip)/pageSize + 1,
+		PageSize:       pageSize,
+		CategoryFacets: categoryFacets,
+		PriceFacets:    priceFacets,
+	}, nil
+}
+
 // ListProducts lists all products with pagination
 // PAGINATION: skip = (page-1) × pageSize is calculated in service layer
 func (s *Server) ListProducts(ctx context.Context, req *productpb.ListProductsRequest) (*productpb.ListProductsResponse, error) {
@@ -217,7 +290,7 @@ func (s *Server) ListProducts(ctx context.Context, req *productpb.ListProductsRe
 	repo := &repositories.MongoProductRepository{}
 
 	// Service layer handles pagination logic and database calls
-	products, total, err := services.ListProducts(ctx, repo, req.GetPage(), req.GetPageSize())
+	products, total, nextPageToken, err := services.ListProducts(ctx, repo, req.GetPage(), req.GetPageSize(), req.GetPageToken())
 	if err != nil {
 		logger.Log.Errorw("Failed to list products", "error", err)
 		return nil, err
@@ -230,12 +303,13 @@ func (s *Server) ListProducts(ctx context.Context, req *productpb.ListProductsRe
 			Id:          product.ID.Hex(),
 			Name:        product.Name,
 			Description: product.Description,
-			Price:       product.Price,
+			Price:       toMoneyResponse(product.Price),
 			Category:    product.Category,
 			Stock:       product.Stock,
 			ImageUrl:    product.ImageURL,
 			CreatedAt:   timestamppb.New(product.CreatedAt),
 			UpdatedAt:   timestamppb.New(product.UpdatedAt),
+			Version:     product.Version,
 		}
 	}
 
@@ -255,10 +329,11 @@ func (s *Server) ListProducts(ctx context.Context, req *productpb.ListProductsRe
 	)
 
 	return &productpb.ListProductsResponse{
-		Products: productResponses,
-		Total:    int32(total),
-		Page:     page,
-		PageSize: pageSize,
+		Products:      productResponses,
+		Total:         int32(total),
+		Page:          page,
+		PageSize:      pageSize,
+		NextPageToken: nextPageToken,
 	}, nil
 }
 
@@ -274,12 +349,13 @@ func (s *Server) GetProductsByCategory(ctx context.Context, req *productpb.GetPr
 	repo := &repositories.MongoProductRepository{}
 
 	// Service layer handles category filter + pagination
-	products, total, err := services.GetProductsByCategory(
+	products, total, nextPageToken, err := services.GetProductsByCategory(
 		ctx,
 		repo,
 		req.GetCategory(),
 		req.GetPage(),
 		req.GetPageSize(),
+		req.GetPageToken(),
 	)
 	if err != nil {
 		logger.Log.Errorw("Failed to get products by category", "error", err)
@@ -293,12 +369,13 @@ func (s *Server) GetProductsByCategory(ctx context.Context, req *productpb.GetPr
 			Id:          product.ID.Hex(),
 			Name:        product.Name,
 			Description: product.Description,
-			Price:       product.Price,
+			Price:       toMoneyResponse(product.Price),
 			Category:    product.Category,
 			Stock:       product.Stock,
 			ImageUrl:    product.ImageURL,
 			CreatedAt:   timestamppb.New(product.CreatedAt),
 			UpdatedAt:   timestamppb.New(product.UpdatedAt),
+			Version:     product.Version,
 		}
 	}
 
@@ -319,9 +396,149 @@ func (s *Server) GetProductsByCategory(ctx context.Context, req *productpb.GetPr
 	)
 
 	return &productpb.ListProductsResponse{
-		Products: productResponses,
-		Total:    int32(total),
-		Page:     page,
-		PageSize: pageSize,
+		Products:      productResponses,
+		Total:         int32(total),
+		Page:          page,
+		PageSize:      pageSize,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+// ReserveStock holds stock for every line of the request, or for none
+func (s *Server) ReserveStock(ctx context.Context, req *productpb.ReserveStockRequest) (*productpb.StockReservation, error) {
+	logger.Log.Infow("Reserving stock",
+		"reservation_id", req.GetReservationId(),
+		"lines", len(req.GetLines()),
+	)
+
+	repo := &repositories.MongoProductRepository{}
+
+	lines := make([]services.StockLine, len(req.GetLines()))
+	for i, line := range req.GetLines() {
+		lines[i] = services.StockLine{ProductID: line.GetProductId(), SKU: line.GetSku(), Quantity: line.GetQuantity()}
+	}
+	ttl := time.Duration(req.GetTtlSeconds()) * time.Second
+
+	reservation, err := services.ReserveStock(ctx, repo, req.GetReservationId(), lines, ttl)
+	if err != nil {
+		logger.Log.Errorw("Failed to reserve stock", "error", err)
+		return nil, err
+	}
+
+	return toStockReservationResponse(reservation), nil
+}
+
+// ReleaseReservation gives a reservation's stock back
+func (s *Server) ReleaseReservation(ctx context.Context, req *productpb.ReleaseReservationRequest) (*productpb.StockReservation, error) {
+	logger.Log.Infow("Releasing stock reservation", "reservation_id", req.GetReservationId())
+
+	repo := &repositories.MongoProductRepository{}
+
+	reservation, err := services.ReleaseReservation(ctx, repo, req.GetReservationId())
+	if err != nil {
+		logger.Log.Errorw("Failed to release reservation", "error", err)
+		return nil, err
+	}
+
+	return toStockReservationResponse(reservation), nil
+}
+
+// CommitReservation makes a reservation's stock change final
+func (s *Server) CommitReservation(ctx context.Context, req *productpb.CommitReservationRequest) (*productpb.StockReservation, error) {
+	logger.Log.Infow("Committing stock reservation", "reservation_id", req.GetReservationId())
+
+	repo := &repositories.MongoProductRepository{}
+
+	reservation, err := services.CommitReservation(ctx, repo, req.GetReservationId())
+	if err != nil {
+		logger.Log.Errorw("Failed to commit reservation", "error", err)
+		return nil, err
+	}
+
+	return toStockReservationResponse(reservation), nil
+}
+
+// ExtendReservation holds an open reservation's stock for longer
+func (s *Server) ExtendReservation(ctx context.Context, req *productpb.ExtendReservationRequest) (*productpb.StockReservation, error) {
+	logger.Log.Infow("Extending stock reservation", "reservation_id", req.GetReservationId(), "ttl_seconds", req.GetTtlSeconds())
+
+	repo := &repositories.MongoProductRepository{}
+
+	ttl := time.Duration(req.GetTtlSeconds()) * time.Second
+	reservation, err := services.ExtendReservation(ctx, repo, req.GetReservationId(), ttl)
+	if err != nil {
+		logger.Log.Errorw("Failed to extend reservation", "error", err)
+		return nil, err
+	}
+
+	return toStockReservationResponse(reservation), nil
+}
+
+// AdjustStock adds a positive or negative delta to a product's or a
+// variant's stock
+func (s *Server) AdjustStock(ctx context.Context, req *productpb.AdjustStockRequest) (*productpb.Product, error) {
+	logger.Log.Infow("Adjusting stock",
+		"id", req.GetProductId(),
+		"sku", req.GetSku(),
+		"delta", req.GetDelta(),
+		"reason", req.GetReason(),
+	)
+
+	repo := &repositories.MongoProductRepository{}
+
+	product, err := services.AdjustStock(ctx, repo, req.GetProductId(), req.GetSku(), req.GetDelta(), req.GetReason())
+	if err != nil {
+		logger.Log.Errorw("Failed to adjust stock", "error", err)
+		return nil, err
+	}
+
+	return &productpb.Product{
+		Id:          product.ID.Hex(),
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       toMoneyResponse(product.Price),
+		Category:    product.Category,
+		Stock:       product.Stock,
+		ImageUrl:    product.ImageURL,
+		CreatedAt:   timestamppb.New(product.CreatedAt),
+		UpdatedAt:   timestamppb.New(product.UpdatedAt),
+		Version:     product.Version,
 	}, nil
 }
+
+func toStockReservationResponse(reservation *models.StockReservation) *productpb.StockReservation {
+	lines := make([]*productpb.StockReservationLine, len(reservation.Lines))
+	for i, line := range reservation.Lines {
+		lines[i] = &productpb.StockReservationLine{
+			ProductId: line.ProductID.Hex(),
+			Sku:       line.SKU,
+			Quantity:  line.Quantity,
+		}
+	}
+
+	return &productpb.StockReservation{
+		ReservationId: reservation.ID,
+		Lines:         lines,
+		Status:        reservation.Status,
+		ExpiresAt:     timestamppb.New(reservation.ExpiresAt),
+		CreatedAt:     timestamppb.New(reservation.CreatedAt),
+		UpdatedAt:     timestamppb.New(reservation.UpdatedAt),
+	}
+}
+
+func toMoneyResponse(m money.Money) *productpb.Money {
+	return &productpb.Money{Amount: m.Amount, Currency: m.Currency}
+}
+
+func fromMoneyRequest(m *productpb.Money) money.Money {
+	return money.New(m.GetAmount(), m.GetCurrency())
+}
+
+// fromOptionalMoney keeps an unset price unset
+func fromOptionalMoney(m *productpb.Money) *money.Money {
+	if m == nil {
+		return nil
+	}
+	value := fromMoneyRequest(m)
+	return &value
+}
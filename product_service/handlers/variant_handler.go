@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/tird4d/go-microservices/product_service/logger"
+	"github.com/tird4d/go-microservices/product_service/models"
+	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"github.com/tird4d/go-microservices/product_service/repositories"
+	"github.com/tird4d/go-microservices/product_service/services"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// CreateVariant adds a variant with its own SKU to a product
+func (s *Server) CreateVariant(ctx context.Context, req *productpb.CreateVariantRequest) (*productpb.Variant, error) {
+	logger.Log.Infow("Creating variant", "product_id", req.GetProductId(), "sku", req.GetSku())
+
+	repo := &repositories.MongoProductRepository{}
+
+	variant, err := services.CreateVariant(ctx, repo, req.GetProductId(), &models.Variant{
+		SKU:        req.GetSku(),
+		Attributes: req.GetAttributes(),
+		Price:      fromOptionalMoney(req.GetPrice()),
+		Stock:      req.GetStock(),
+		ImageURL:   req.GetImageUrl(),
+	})
+	if err != nil {
+		logger.Log.Errorw("Failed to create variant", "error", err)
+		return nil, err
+	}
+
+	return toVariantResponse(variant), nil
+}
+
+// GetVariant finds a variant by ID or SKU
+func (s *Server) GetVariant(ctx context.Context, req *productpb.GetVariantRequest) (*productpb.Variant, error) {
+	repo := &repositories.MongoProductRepository{}
+
+	variant, err := services.GetVariant(ctx, repo, req.GetId(), req.GetSku())
+	if err != nil {
+		return nil, err
+	}
+
+	return toVariantResponse(variant), nil
+}
+
+// ListVariants returns all variants of a product
+func (s *Server) ListVariants(ctx context.Context, req *productpb.ListVariantsRequest) (*productpb.ListVariantsResponse, error) {
+	repo := &repositories.MongoProductRepository{}
+
+	variants, err := services.ListVariants(ctx, repo, req.GetProductId())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &productpb.ListVariantsResponse{Variants: make([]*productpb.Variant, len(variants))}
+	for i, variant := range variants {
+		res.Variants[i] = toVariantResponse(variant)
+	}
+	return res, nil
+}
+
+// UpdateVariant changes the fields named in the request's update mask
+func (s *Server) UpdateVariant(ctx context.Context, req *productpb.UpdateVariantRequest) (*productpb.Variant, error) {
+	logger.Log.Infow("Updating variant", "id", req.GetId(), "paths", req.GetUpdateMask().GetPaths())
+
+	repo := &repositories.MongoProductRepository{}
+
+	variant, err := services.UpdateVariant(ctx, repo, req.GetId(), &models.Variant{
+		SKU:        req.GetSku(),
+		Attributes: req.GetAttributes(),
+		Price:      fromOptionalMoney(req.GetPrice()),
+		ImageURL:   req.GetImageUrl(),
+	}, req.GetUpdateMask().GetPaths())
+	if err != nil {
+		logger.Log.Errorw("Failed to update variant", "error", err)
+		return nil, err
+	}
+
+	return toVariantResponse(variant), nil
+}
+
+// DeleteVariant removes a variant
+func (s *Server) DeleteVariant(ctx context.Context, req *productpb.DeleteVariantRequest) (*productpb.DeleteVariantResponse, error) {
+	logger.Log.Infow("Deleting variant", "id", req.GetId())
+
+	repo := &repositories.MongoProductRepository{}
+
+	if err := services.DeleteVariant(ctx, repo, req.GetId()); err != nil {
+		logger.Log.Errorw("Failed to delete variant", "error", err)
+		return nil, err
+	}
+
+	return &productpb.DeleteVariantResponse{
+		Success: true,
+		Message: "Variant deleted successfully",
+	}, nil
+}
+
+func toVariantResponse(variant *models.Variant) *productpb.Variant {
+	res := &productpb.Variant{
+		Id:         variant.ID.Hex(),
+		ProductId:  variant.ProductID.Hex(),
+		Sku:        variant.SKU,
+		Attributes: variant.Attributes,
+		Stock:      variant.Stock,
+		ImageUrl:   variant.ImageURL,
+		CreatedAt:  timestamppb.New(variant.CreatedAt),
+		UpdatedAt:  timestamppb.New(variant.UpdatedAt),
+	}
+	if variant.Price != nil {
+		res.Price = toMoneyResponse(*variant.Price)
+	}
+	return res
+}
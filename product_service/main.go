@@ -5,15 +5,20 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tird4d/go-microservices/pagination"
 	"github.com/tird4d/go-microservices/product_service/config"
 	"github.com/tird4d/go-microservices/product_service/handlers"
 	"github.com/tird4d/go-microservices/product_service/interceptors"
 	"github.com/tird4d/go-microservices/product_service/logger"
 	"github.com/tird4d/go-microservices/product_service/metrics"
+	"github.com/tird4d/go-microservices/product_service/money"
 	productpb "github.com/tird4d/go-microservices/product_service/proto"
+	"github.com/tird4d/go-microservices/product_service/repositories"
+	"github.com/tird4d/go-microservices/product_service/services"
 	"github.com/tird4d/go-microservices/product_service/tracing"
 
 	"google.golang.org/grpc"
@@ -39,6 +44,12 @@ func main() {
 		logger.Log.Infow("⚠️ Error loading .env file", "error", err)
 	}
 
+	// Page tokens are signed, so refuse to start without the shared secret
+	if err := pagination.CheckSecret(); err != nil {
+		logger.Log.Errorw("❌ Invalid configuration", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize Jaeger tracing
 	jaegerEndpoint := os.Getenv("JAEGER_ENDPOINT")
 	if jaegerEndpoint == "" {
@@ -53,6 +64,27 @@ func main() {
 
 	_, err = config.ConnectDB()
 
+	// Search needs the text index; the reaper and ledger have their own
+	productRepo := &repositories.MongoProductRepository{}
+	if err := productRepo.EnsureIndexes(context.Background()); err != nil {
+		logger.Log.Errorw("❌ Failed to create product indexes", "error", err)
+	}
+	if migrated, err := productRepo.MigrateFloatPrices(context.Background()); err != nil {
+		logger.Log.Errorw("❌ Failed to migrate prices to minor units", "error", err)
+	} else if migrated > 0 {
+		logger.Log.Infow("Migrated prices to minor units", "documents", migrated, "currency", money.DefaultCurrency)
+	}
+	if migrated, err := productRepo.MigrateMissingVersions(context.Background()); err != nil {
+		logger.Log.Errorw("❌ Failed to backfill product versions", "error", err)
+	} else if migrated > 0 {
+		logger.Log.Infow("Backfilled product versions", "documents", migrated)
+	}
+
+	// Release stock held by reservations nobody committed or released in time
+	reaperCtx, stopReaper := context.WithCancel(context.Background())
+	defer stopReaper()
+	go services.RunReservationReaper(reaperCtx, productRepo, time.Minute)
+
 	lis, err := net.Listen("tcp", ":50053")
 	if err != nil {
 		logger.Log.Errorw("❌ Failed to listen", "error", err)
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tird4d/go-microservices/product_service/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Category is a node of the category tree. Products refer to their category
+// by slug, so the slug is unique and renaming it moves the products along.
+type Category struct {
+	ID   primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Slug string             `bson:"slug" json:"slug"`
+	Name string             `bson:"name" json:"name"`
+	// ParentID is nil for top-level categories
+	ParentID  *primitive.ObjectID `bson:"parent_id" json:"parent_id,omitempty"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// CategoryNode is a category with its product counts and subcategories.
+// ProductCount counts the products directly in the category,
+// TotalProductCount also those anywhere below it.
+type CategoryNode struct {
+	*Category
+	ProductCount      int64
+	TotalProductCount int64
+	Children          []*CategoryNode
+}
+
+func CategoryCollection() *mongo.Collection {
+	return config.DB.Collection("categories")
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/tird4d/go-microservices/product_service/config"
+	"github.com/tird4d/go-microservices/product_service/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -12,12 +13,22 @@ type Product struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Name        string             `bson:"name" json:"name"`
 	Description string             `bson:"description" json:"description"`
-	Price       float64            `bson:"price" json:"price"`
+	Price       money.Money        `bson:"price" json:"price"`
 	Category    string             `bson:"category" json:"category"`
 	Stock       int32              `bson:"stock" json:"stock"`
 	ImageURL    string             `bson:"image_url" json:"image_url"`
 	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+	// Version is incremented on every update so concurrent edits can be
+	// detected. Products created before versioning start at 0.
+	Version int64 `bson:"version" json:"version"`
+}
+
+// ProductPosition is where a keyset page resumes: right after the product
+// with this creation time and ID, in (created_at, _id) order
+type ProductPosition struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
 }
 
 func ProductCollection() *mongo.Collection {
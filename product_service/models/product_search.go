@@ -0,0 +1,55 @@
+package models
+
+import "github.com/tird4d/go-microservices/product_service/money"
+
+// Product search sort orders
+const (
+	SortRelevance     = "relevance"
+	SortPriceAsc      = "price_asc"
+	SortPriceDesc     = "price_desc"
+	SortCreatedAtDesc = "created_at_desc"
+	SortCreatedAtAsc  = "created_at_asc"
+)
+
+// PriceBucketBoundaries are the lower bounds of the price facet buckets in
+// major units of the search currency. The last bucket has no upper bound.
+var PriceBucketBoundaries = []int64{0, 25, 50, 100, 250, 500, 1000}
+
+// ProductSearch filters and orders a product search. Query is matched
+// against the text index over name and description. Prices are compared
+// within Currency only: a price filter and the price facets skip products
+// in other currencies. A nil MinPrice or MaxPrice means no bound.
+type ProductSearch struct {
+	Query       string
+	Categories  []string
+	Currency    string
+	MinPrice    *money.Money
+	MaxPrice    *money.Money
+	InStockOnly bool
+	Sort        string
+	Skip        int64
+	Limit       int64
+}
+
+// ProductSearchResult is one page of matches with facet counts over all of
+// them. Each facet ignores its own filter, so picking a category still
+// shows how many matches the other categories have.
+type ProductSearchResult struct {
+	Products       []*Product
+	Total          int64
+	CategoryFacets []CategoryFacet
+	PriceFacets    []PriceFacet
+}
+
+type CategoryFacet struct {
+	Category string `bson:"_id"`
+	Count    int64  `bson:"count"`
+}
+
+// PriceFacet counts matches priced from Min up to, not including, Max.
+// Max is nil for the last bucket.
+type PriceFacet struct {
+	Min   money.Money
+	Max   *money.Money
+	Count int64
+}
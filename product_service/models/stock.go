@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tird4d/go-microservices/product_service/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Reservation statuses. A reservation takes the stock when it's created;
+// committing keeps it taken, releasing or expiring gives it back.
+const (
+	ReservationReserved  = "reserved"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired"
+)
+
+// Stock movement kinds recorded in the ledger
+const (
+	MovementReserve = "reserve"
+	MovementRelease = "release"
+	MovementExpire  = "expire"
+	MovementAdjust  = "adjust"
+)
+
+// StockReservation holds stock for a caller-chosen ID (e.g. a checkout) until
+// it's committed, released, or ExpiresAt passes. SettledAt is set when it
+// leaves the reserved status; a TTL index removes settled records later.
+type StockReservation struct {
+	ID        string            `bson:"_id" json:"id"`
+	Lines     []ReservationLine `bson:"lines" json:"lines"`
+	Status    string            `bson:"status" json:"status"`
+	ExpiresAt time.Time         `bson:"expires_at" json:"expires_at"`
+	SettledAt *time.Time        `bson:"settled_at,omitempty" json:"settled_at,omitempty"`
+	CreatedAt time.Time         `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time         `bson:"updated_at" json:"updated_at"`
+}
+
+// ReservationLine takes stock from a product, or from one of its variants
+// when SKU is set
+type ReservationLine struct {
+	ProductID primitive.ObjectID `bson:"product_id" json:"product_id"`
+	SKU       string             `bson:"sku,omitempty" json:"sku,omitempty"`
+	Quantity  int32              `bson:"quantity" json:"quantity"`
+}
+
+// StockMovement is one entry of the stock ledger. Every change to a
+// product's stock made through reservations or AdjustStock writes one,
+// in the same transaction as the change.
+type StockMovement struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ProductID     primitive.ObjectID `bson:"product_id" json:"product_id"`
+	SKU           string             `bson:"sku,omitempty" json:"sku,omitempty"`
+	Kind          string             `bson:"kind" json:"kind"`
+	Delta         int32              `bson:"delta" json:"delta"`
+	Reason        string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	ReservationID string             `bson:"reservation_id,omitempty" json:"reservation_id,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+}
+
+func StockReservationCollection() *mongo.Collection {
+	return config.DB.Collection("stock_reservations")
+}
+
+func StockMovementCollection() *mongo.Collection {
+	return config.DB.Collection("stock_movements")
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tird4d/go-microservices/product_service/config"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Variant is one purchasable version of a product, such as a size or color.
+// SKUs are unique across all products. Stock of a product with variants is
+// kept per variant; the product's own stock only applies to orders without a SKU.
+type Variant struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ProductID  primitive.ObjectID `bson:"product_id" json:"product_id"`
+	SKU        string             `bson:"sku" json:"sku"`
+	Attributes map[string]string  `bson:"attributes,omitempty" json:"attributes,omitempty"`
+	// Price overrides the product's price and is in the product's currency;
+	// nil means the variant sells at the product price
+	Price     *money.Money `bson:"price,omitempty" json:"price,omitempty"`
+	Stock     int32        `bson:"stock" json:"stock"`
+	ImageURL  string       `bson:"image_url" json:"image_url"`
+	CreatedAt time.Time    `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time    `bson:"updated_at" json:"updated_at"`
+}
+
+// EffectivePrice is what the variant sells for given its product's price
+func (v *Variant) EffectivePrice(productPrice money.Money) money.Money {
+	if v.Price != nil {
+		return *v.Price
+	}
+	return productPrice
+}
+
+func VariantCollection() *mongo.Collection {
+	return config.DB.Collection("product_variants")
+}
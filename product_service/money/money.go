@@ -0,0 +1,177 @@
+// Package money represents amounts as integer minor units (cents for EUR)
+// with an ISO 4217 currency code, so prices and totals add up exactly
+// instead of collecting floating point rounding errors.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of prices stored before they had one
+const DefaultCurrency = "EUR"
+
+var (
+	// ErrUnknownCurrency means the code isn't a supported ISO 4217 currency
+	ErrUnknownCurrency = errors.New("unknown currency")
+	// ErrCurrencyMismatch means amounts in different currencies were combined
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	// ErrInvalidAmount means a decimal string couldn't be read as an amount
+	ErrInvalidAmount = errors.New("invalid amount")
+)
+
+// minorUnits is the number of decimal places of each supported currency
+var minorUnits = map[string]int{
+	"AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2, "CZK": 2,
+	"DKK": 2, "EUR": 2, "GBP": 2, "HKD": 2, "HUF": 2, "INR": 2, "JPY": 0,
+	"KRW": 0, "KWD": 3, "MXN": 2, "NOK": 2, "NZD": 2, "PLN": 2, "SEK": 2,
+	"SGD": 2, "TRY": 2, "USD": 2, "ZAR": 2,
+}
+
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// Money is an amount in the minor unit of its currency
+type Money struct {
+	Amount   int64  `bson:"amount" json:"amount"`
+	Currency string `bson:"currency" json:"currency"`
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Zero is nothing in currency, the starting point of a sum
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// ValidateCurrency checks that code is a supported ISO 4217 code. Codes are
+// upper case; callers normalize user input first.
+func ValidateCurrency(code string) error {
+	if _, ok := minorUnits[code]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownCurrency, code)
+	}
+	return nil
+}
+
+// Scale is the number of minor units in one major unit of currency, e.g.
+// 100 cents in a euro
+func Scale(currency string) int64 {
+	scale := int64(1)
+	for i := 0; i < minorUnits[currency]; i++ {
+		scale *= 10
+	}
+	return scale
+}
+
+// NormalizeCurrency trims and upper-cases a currency code from user input
+func NormalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// FromMajor converts an amount in major units, as prices were stored before
+// this package existed, rounding to the nearest minor unit
+func FromMajor(value float64, currency string) (Money, error) {
+	if err := ValidateCurrency(currency); err != nil {
+		return Money{}, err
+	}
+	scaled := math.Round(value * math.Pow10(minorUnits[currency]))
+	if math.IsNaN(scaled) || math.Abs(scaled) > math.MaxInt64/2 {
+		return Money{}, fmt.Errorf("%w: %v", ErrInvalidAmount, value)
+	}
+	return Money{Amount: int64(scaled), Currency: currency}, nil
+}
+
+// Parse reads a decimal string such as "12.5" or "-3.99" as an amount in
+// currency. More decimal places than the currency has are an error rather
+// than silently rounded.
+func Parse(value, currency string) (Money, error) {
+	if err := ValidateCurrency(currency); err != nil {
+		return Money{}, err
+	}
+	value = strings.TrimSpace(value)
+	if !decimalPattern.MatchString(value) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+
+	digits := minorUnits[currency]
+	whole, fraction, _ := strings.Cut(value, ".")
+	if len(fraction) > digits {
+		return Money{}, fmt.Errorf("%w: %s has at most %d decimal places", ErrInvalidAmount, currency, digits)
+	}
+	fraction += strings.Repeat("0", digits-len(fraction))
+
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Decimal formats the amount with the currency's decimal places, e.g. "12.50"
+func (m Money) Decimal() string {
+	digits := minorUnits[m.Currency]
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign = "-"
+	}
+	s := strconv.FormatUint(absUint(amount), 10)
+	if digits == 0 {
+		return sign + s
+	}
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+// String is the decimal amount followed by the currency, e.g. "12.50 EUR"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// Major is the amount in major units, for systems that still take floats.
+// Don't do arithmetic on the result.
+func (m Money) Major() float64 {
+	return float64(m.Amount) / math.Pow10(minorUnits[m.Currency])
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Add returns m plus other. Amounts in different currencies can't be added.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Mul returns m times quantity, e.g. a unit price times the quantity ordered
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// Sum adds amounts, all of which have to be in currency
+func Sum(currency string, amounts ...Money) (Money, error) {
+	total := Zero(currency)
+	for _, amount := range amounts {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+func absUint(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
@@ -0,0 +1,91 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		value    string
+		currency string
+		want     int64
+	}{
+		{"12.34", "EUR", 1234},
+		{"12.5", "EUR", 1250},
+		{"12", "EUR", 1200},
+		{" 0.07 ", "USD", 7},
+		{"-3.99", "EUR", -399},
+		{"1500", "JPY", 1500},
+		{"1.234", "KWD", 1234},
+	}
+	for _, tc := range cases {
+		m, err := Parse(tc.value, tc.currency)
+		require.NoError(t, err, tc.value)
+		assert.Equal(t, New(tc.want, tc.currency), m, tc.value)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, value := range []string{"", "abc", "1,50", "1.", ".5", "1.234", "1e3", "99999999999999999999"} {
+		_, err := Parse(value, "EUR")
+		assert.ErrorIs(t, err, ErrInvalidAmount, value)
+	}
+
+	_, err := Parse("1.5", "JPY")
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	_, err = Parse("1.50", "XXX")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
+
+func TestDecimal(t *testing.T) {
+	assert.Equal(t, "12.34", New(1234, "EUR").Decimal())
+	assert.Equal(t, "0.05", New(5, "EUR").Decimal())
+	assert.Equal(t, "0.00", Zero("EUR").Decimal())
+	assert.Equal(t, "-0.50", New(-50, "EUR").Decimal())
+	assert.Equal(t, "1500", New(1500, "JPY").Decimal())
+	assert.Equal(t, "0.001", New(1, "BHD").Decimal())
+	assert.Equal(t, "-92233720368547758.08", New(math.MinInt64, "EUR").Decimal())
+	assert.Equal(t, "12.34 EUR", New(1234, "EUR").String())
+}
+
+func TestFromMajor_RoundsToMinorUnits(t *testing.T) {
+	// 0.1 + 0.2 is 0.30000000000000004 as a float
+	m, err := FromMajor(0.1+0.2, "EUR")
+	require.NoError(t, err)
+	assert.Equal(t, New(30, "EUR"), m)
+
+	m, err = FromMajor(1299.99, "USD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(129999), m.Amount)
+
+	_, err = FromMajor(math.NaN(), "EUR")
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+}
+
+func TestArithmetic(t *testing.T) {
+	total, err := Sum("EUR", New(1999, "EUR").Mul(3), New(1, "EUR"))
+	require.NoError(t, err)
+	assert.Equal(t, New(5998, "EUR"), total)
+	assert.Equal(t, 59.98, total.Major())
+
+	_, err = New(100, "EUR").Add(New(100, "USD"))
+	assert.True(t, errors.Is(err, ErrCurrencyMismatch))
+
+	_, err = Sum("EUR", New(100, "USD"))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+}
+
+func TestValidateCurrency(t *testing.T) {
+	assert.NoError(t, ValidateCurrency("EUR"))
+	assert.ErrorIs(t, ValidateCurrency("eur"), ErrUnknownCurrency)
+	assert.ErrorIs(t, ValidateCurrency(""), ErrUnknownCurrency)
+	assert.Equal(t, "EUR", NormalizeCurrency(" eur "))
+	assert.Equal(t, int64(100), Scale("EUR"))
+	assert.Equal(t, int64(1), Scale("JPY"))
+}
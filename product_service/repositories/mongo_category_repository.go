@@ -0,0 +1,220 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/product_service/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ensureCategoryIndexes makes slugs unique and finds subcategories without
+// a collection scan
+func ensureCategoryIndexes(ctx context.Context) error {
+	_, err := models.CategoryCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "parent_id", Value: 1}}},
+	})
+	return err
+}
+
+func (r *MongoProductRepository) CreateCategory(ctx context.Context, category *models.Category) (*models.Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	category.CreatedAt = now
+	category.UpdatedAt = now
+
+	result, err := models.CategoryCollection().InsertOne(ctx, category)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateSlug
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	category.ID = result.InsertedID.(primitive.ObjectID)
+	return category, nil
+}
+
+func (r *MongoProductRepository) FindCategory(ctx context.Context, oid primitive.ObjectID) (*models.Category, error) {
+	return findCategory(ctx, bson.M{"_id": oid})
+}
+
+func (r *MongoProductRepository) FindCategoryBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	return findCategory(ctx, bson.M{"slug": slug})
+}
+
+// FindCategories returns every category ordered by name. Category trees are
+// small enough to be loaded whole.
+func (r *MongoProductRepository) FindCategories(ctx context.Context) ([]*models.Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := models.CategoryCollection().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	categories := []*models.Category{}
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+// CountProductsPerCategory returns the number of products per category slug
+func (r *MongoProductRepository) CountProductsPerCategory(ctx context.Context) (map[string]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$category", "count": bson.M{"$sum": 1}}}},
+	}
+	cursor, err := models.ProductCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Category string `bson:"_id"`
+		Count    int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Category] = row.Count
+	}
+	return counts, nil
+}
+
+// UpdateCategory applies updates and returns the category as it is
+// afterwards. A new slug is applied to the category's products in the same
+// transaction.
+func (r *MongoProductRepository) UpdateCategory(ctx context.Context, oid primitive.ObjectID, updates map[string]any) (*models.Category, error) {
+	result, err := withTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		updates["updated_at"] = time.Now()
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+		before := &models.Category{}
+		err := models.CategoryCollection().FindOneAndUpdate(sc, bson.M{"_id": oid}, bson.M{"$set": updates}, opts).Decode(before)
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrDuplicateSlug
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if slug, ok := updates["slug"].(string); ok && slug != before.Slug {
+			if err := reassignProducts(sc, before.Slug, slug); err != nil {
+				return nil, err
+			}
+		}
+
+		return findCategory(sc, bson.M{"_id": oid})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*models.Category), nil
+}
+
+// DeleteCategory removes a category that has neither products nor
+// subcategories; otherwise it fails with ErrCategoryInUse
+func (r *MongoProductRepository) DeleteCategory(ctx context.Context, oid primitive.ObjectID) error {
+	_, err := withTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		category, err := findCategory(sc, bson.M{"_id": oid})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := requireUnused(sc, category); err != nil {
+			return nil, err
+		}
+
+		_, err = models.CategoryCollection().DeleteOne(sc, bson.M{"_id": oid})
+		return nil, err
+	})
+	return err
+}
+
+// MergeCategory moves the products and subcategories of source into target
+// and deletes source, all in one transaction. It returns target.
+func (r *MongoProductRepository) MergeCategory(ctx context.Context, sourceID, targetID primitive.ObjectID) (*models.Category, error) {
+	result, err := withTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		source, err := findCategory(sc, bson.M{"_id": sourceID})
+		if err != nil {
+			return nil, err
+		}
+		target, err := findCategory(sc, bson.M{"_id": targetID})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := reassignProducts(sc, source.Slug, target.Slug); err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		_, err = models.CategoryCollection().UpdateMany(sc,
+			bson.M{"parent_id": sourceID},
+			bson.M{"$set": bson.M{"parent_id": targetID, "updated_at": now}})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := models.CategoryCollection().DeleteOne(sc, bson.M{"_id": sourceID}); err != nil {
+			return nil, err
+		}
+		return target, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*models.Category), nil
+}
+
+// reassignProducts moves every product in the category from to the category
+// to, bumping their versions like any other product update
+func reassignProducts(ctx context.Context, from, to string) error {
+	_, err := models.ProductCollection().UpdateMany(ctx,
+		bson.M{"category": from},
+		bson.M{"$set": bson.M{"category": to, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}})
+	return err
+}
+
+func requireUnused(ctx context.Context, category *models.Category) error {
+	children, err := models.CategoryCollection().CountDocuments(ctx, bson.M{"parent_id": category.ID})
+	if err != nil {
+		return err
+	}
+	products, err := models.ProductCollection().CountDocuments(ctx, bson.M{"category": category.Slug})
+	if err != nil {
+		return err
+	}
+	if children > 0 || products > 0 {
+		return ErrCategoryInUse
+	}
+	return nil
+}
+
+func findCategory(ctx context.Context, filter bson.M) (*models.Category, error) {
+	category := &models.Category{}
+	if err := models.CategoryCollection().FindOne(ctx, filter).Decode(category); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
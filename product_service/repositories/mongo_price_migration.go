@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// numericTypes are the BSON types of prices stored as plain numbers in
+// major units, as they were before prices had a currency
+var numericTypes = bson.A{"double", "int", "long", "decimal"}
+
+// MigrateFloatPrices converts prices stored as numbers into Money in the
+// default currency, rounding to the nearest cent with halves away from zero.
+// Variants priced at 0 sold at the product price, so their price is removed.
+// Converted documents no longer match, which makes it safe to run on every
+// start.
+func (r *MongoProductRepository) MigrateFloatPrices(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	products, err := models.ProductCollection().UpdateMany(ctx,
+		bson.M{"price": bson.M{"$type": numericTypes}}, priceToMoney("$price"))
+	if err != nil {
+		return 0, err
+	}
+
+	variants, err := models.VariantCollection().UpdateMany(ctx,
+		bson.M{"price": bson.M{"$gt": 0, "$type": numericTypes}}, priceToMoney("$price"))
+	if err != nil {
+		return 0, err
+	}
+
+	inherited, err := models.VariantCollection().UpdateMany(ctx,
+		bson.M{"price": bson.M{"$type": numericTypes}}, bson.M{"$unset": bson.M{"price": ""}})
+	if err != nil {
+		return 0, err
+	}
+
+	return products.ModifiedCount + variants.ModifiedCount + inherited.ModifiedCount, nil
+}
+
+// priceToMoney is an update pipeline replacing the number at field with
+// Money in the default currency
+func priceToMoney(field string) mongo.Pipeline {
+	scale := money.Scale(money.DefaultCurrency)
+	return mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"price": bson.M{
+			"amount":   bson.M{"$toLong": roundHalfAwayFromZero(bson.M{"$multiply": bson.A{field, scale}})},
+			"currency": money.DefaultCurrency,
+		},
+	}}}}
+}
+
+// roundHalfAwayFromZero is the aggregation expression rounding the number
+// expr evaluates to like math.Round, and so like money.FromMajor: halves
+// round away from zero. $round would round them to even instead.
+func roundHalfAwayFromZero(expr interface{}) bson.M {
+	return bson.M{"$let": bson.M{
+		"vars": bson.M{"value": expr},
+		"in": bson.M{"$cond": bson.A{
+			bson.M{"$gte": bson.A{"$$value", 0}},
+			bson.M{"$floor": bson.M{"$add": bson.A{"$$value", 0.5}}},
+			bson.M{"$ceil": bson.M{"$subtract": bson.A{"$$value", 0.5}}},
+		}},
+	}}
+}
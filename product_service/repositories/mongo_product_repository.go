@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/tird4d/go-microservices/product_service/models"
@@ -13,6 +14,10 @@ import (
 
 type MongoProductRepository struct{}
 
+// productPageSort orders product listings so offset and keyset pages agree;
+// _id breaks ties between products created in the same millisecond
+var productPageSort = bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+
 // Create inserts a new product and returns the created product with ID
 func (r *MongoProductRepository) Create(product *models.Product) (*models.Product, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -21,6 +26,7 @@ func (r *MongoProductRepository) Create(product *models.Product) (*models.Produc
 	// Set timestamps
 	product.CreatedAt = time.Now()
 	product.UpdatedAt = time.Now()
+	product.Version = 1
 
 	result, err := models.ProductCollection().InsertOne(ctx, product)
 	if err != nil {
@@ -50,6 +56,7 @@ func (r *MongoProductRepository) FindAll(ctx context.Context, skip, pageSize int
 	defer cancel()
 
 	findOptions := options.Find().
+		SetSort(productPageSort).
 		SetSkip(skip).
 		SetLimit(pageSize)
 
@@ -77,6 +84,7 @@ func (r *MongoProductRepository) FindByCategory(ctx context.Context, category st
 
 	filter := bson.M{"category": category}
 	findOptions := options.Find().
+		SetSort(productPageSort).
 		SetSkip(skip).
 		SetLimit(pageSize)
 
@@ -97,6 +105,40 @@ func (r *MongoProductRepository) FindByCategory(ctx context.Context, category st
 	return products, nil
 }
 
+// FindAfter retrieves the page of products following a keyset position
+func (r *MongoProductRepository) FindAfter(ctx context.Context, category string, after *models.ProductPosition, limit int64) ([]*models.Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if category != "" {
+		filter["category"] = category
+	}
+	if after != nil {
+		filter["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$gt": after.CreatedAt}},
+			bson.M{"created_at": after.CreatedAt, "_id": bson.M{"$gt": after.ID}},
+		}
+	}
+
+	findOptions := options.Find().
+		SetSort(productPageSort).
+		SetLimit(limit)
+
+	cursor, err := models.ProductCollection().Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var products []*models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
 // Count returns total number of products
 func (r *MongoProductRepository) Count(ctx context.Context) (int64, error) {
 	return models.ProductCollection().CountDocuments(ctx, bson.M{})
@@ -108,19 +150,22 @@ func (r *MongoProductRepository) CountByCategory(ctx context.Context, category s
 	return models.ProductCollection().CountDocuments(ctx, filter)
 }
 
-// Update updates a product and returns the updated product
-func (r *MongoProductRepository) Update(ctx context.Context, oid primitive.ObjectID, updates map[string]any) (*models.Product, error) {
+// Update updates a product, bumps its version and returns the updated product
+func (r *MongoProductRepository) Update(ctx context.Context, oid primitive.ObjectID, expectedVersion int64, updates map[string]any) (*models.Product, error) {
 	// Add updated_at timestamp
 	updates["updated_at"] = time.Now()
 
-	filter := bson.M{"_id": oid}
-	updateFields := bson.M{"$set": updates}
+	filter := versionFilter(oid, expectedVersion)
+	updateFields := bson.M{"$set": updates, "$inc": bson.M{"version": 1}}
 
 	// Use FindOneAndUpdate to return the updated document
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
 	product := &models.Product{}
 	err := models.ProductCollection().FindOneAndUpdate(ctx, filter, updateFields, opts).Decode(product)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, r.missOrMismatch(ctx, oid, expectedVersion)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -128,19 +173,49 @@ func (r *MongoProductRepository) Update(ctx context.Context, oid primitive.Objec
 	return product, nil
 }
 
-// Delete removes a product by ID
-func (r *MongoProductRepository) Delete(ctx context.Context, oid primitive.ObjectID) error {
+// Delete removes a product by ID together with its variants
+func (r *MongoProductRepository) Delete(ctx context.Context, oid primitive.ObjectID, expectedVersion int64) error {
+	_, err := withTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		filter := versionFilter(oid, expectedVersion)
+		result, err := models.ProductCollection().DeleteOne(sc, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.DeletedCount == 0 {
+			return nil, r.missOrMismatch(sc, oid, expectedVersion)
+		}
+
+		_, err = models.VariantCollection().DeleteMany(sc, bson.M{"product_id": oid})
+		return nil, err
+	})
+	return err
+}
+
+// versionFilter matches the product, and only at expectedVersion unless it's 0
+func versionFilter(oid primitive.ObjectID, expectedVersion int64) bson.M {
 	filter := bson.M{"_id": oid}
-	result, err := models.ProductCollection().DeleteOne(ctx, filter)
-	if err != nil {
-		return err
+	if expectedVersion > 0 {
+		filter["version"] = expectedVersion
 	}
+	return filter
+}
 
-	if result.DeletedCount == 0 {
+// missOrMismatch tells apart why a versioned write matched nothing:
+// ErrVersionMismatch when the product still exists, mongo.ErrNoDocuments otherwise
+func (r *MongoProductRepository) missOrMismatch(ctx context.Context, oid primitive.ObjectID, expectedVersion int64) error {
+	if expectedVersion == 0 {
 		return mongo.ErrNoDocuments
 	}
 
-	return nil
+	count, err := models.ProductCollection().CountDocuments(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVersionMismatch
+	}
+	return mongo.ErrNoDocuments
 }
 
 // 	if err := models.UserCollection().FindOne(ctx, bson.M{"email": email}).Decode(user); err != nil {
@@ -0,0 +1,192 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// productTextIndex backs free-text search; a match in the name counts more
+// than one in the description
+var productTextIndex = mongo.IndexModel{
+	Keys: bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}},
+	Options: options.Index().
+		SetName("product_text").
+		SetWeights(bson.D{{Key: "name", Value: 10}, {Key: "description", Value: 1}}),
+}
+
+// ensureProductIndexes creates the text index, the index used to filter
+// and sort by category and price, and the ones backing paged listings
+func ensureProductIndexes(ctx context.Context) error {
+	_, err := models.ProductCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		productTextIndex,
+		{Keys: bson.D{{Key: "category", Value: 1}, {Key: "price.currency", Value: 1}, {Key: "price.amount", Value: 1}}},
+		{Keys: productPageSort},
+		{Keys: bson.D{{Key: "category", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+	})
+	return err
+}
+
+// Search runs the search in one aggregation: the query and stock filters
+// narrow the products first, then a $facet computes the page, the total and
+// both facets from them. Price buckets only count products in the search
+// currency, since amounts in different currencies can't be compared.
+func (r *MongoProductRepository) Search(ctx context.Context, search *models.ProductSearch) (*models.ProductSearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	base := bson.M{}
+	if search.Query != "" {
+		// $text has to be in the first stage
+		base["$text"] = bson.M{"$search": search.Query}
+	}
+	if search.InStockOnly {
+		base["stock"] = bson.M{"$gt": 0}
+	}
+
+	categoryFilter := bson.M{}
+	if len(search.Categories) > 0 {
+		categoryFilter["category"] = bson.M{"$in": search.Categories}
+	}
+	priceFilter := bson.M{}
+	if search.MinPrice != nil || search.MaxPrice != nil {
+		amount := bson.M{}
+		if search.MinPrice != nil {
+			amount["$gte"] = search.MinPrice.Amount
+		}
+		if search.MaxPrice != nil {
+			amount["$lte"] = search.MaxPrice.Amount
+		}
+		priceFilter["price.currency"] = search.Currency
+		priceFilter["price.amount"] = amount
+	}
+	bothFilters := bson.M{}
+	for k, v := range categoryFilter {
+		bothFilters[k] = v
+	}
+	for k, v := range priceFilter {
+		bothFilters[k] = v
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: base}},
+		{{Key: "$facet", Value: bson.M{
+			"products": bson.A{
+				bson.M{"$match": bothFilters},
+				bson.M{"$sort": searchSort(search.Sort)},
+				bson.M{"$skip": search.Skip},
+				bson.M{"$limit": search.Limit},
+			},
+			"total": bson.A{
+				bson.M{"$match": bothFilters},
+				bson.M{"$count": "count"},
+			},
+			"categories": bson.A{
+				bson.M{"$match": priceFilter},
+				bson.M{"$group": bson.M{"_id": "$category", "count": bson.M{"$sum": 1}}},
+				bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+			},
+			"prices": bson.A{
+				bson.M{"$match": categoryFilter},
+				bson.M{"$match": bson.M{"price.currency": search.Currency}},
+				bson.M{"$bucket": bson.M{
+					"groupBy":    "$price.amount",
+					"boundaries": priceBucketBoundaries(search.Currency),
+					// Everything from the last boundary up lands in the open-ended bucket
+					"default": lastPriceBucket(search.Currency),
+					"output":  bson.M{"count": bson.M{"$sum": 1}},
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+		}}},
+	}
+
+	cursor, err := models.ProductCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var facets []struct {
+		Products   []*models.Product       `bson:"products"`
+		Total      []struct{ Count int64 } `bson:"total"`
+		Categories []models.CategoryFacet  `bson:"categories"`
+		Prices     []struct {
+			Min   int64 `bson:"_id"`
+			Count int64 `bson:"count"`
+		} `bson:"prices"`
+	}
+	if err := cursor.All(ctx, &facets); err != nil {
+		return nil, err
+	}
+
+	result := &models.ProductSearchResult{}
+	if len(facets) == 0 {
+		return result, nil
+	}
+
+	result.Products = facets[0].Products
+	if len(facets[0].Total) > 0 {
+		result.Total = facets[0].Total[0].Count
+	}
+	result.CategoryFacets = facets[0].Categories
+	for _, bucket := range facets[0].Prices {
+		result.PriceFacets = append(result.PriceFacets, models.PriceFacet{
+			Min:   money.New(bucket.Min, search.Currency),
+			Max:   priceBucketMax(bucket.Min, search.Currency),
+			Count: bucket.Count,
+		})
+	}
+
+	return result, nil
+}
+
+// searchSort maps a sort order to its $sort stage. _id breaks ties so pages
+// don't overlap.
+func searchSort(sort string) bson.D {
+	switch sort {
+	case models.SortRelevance:
+		return bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "_id", Value: 1}}
+	case models.SortPriceAsc:
+		return bson.D{{Key: "price.currency", Value: 1}, {Key: "price.amount", Value: 1}, {Key: "_id", Value: 1}}
+	case models.SortPriceDesc:
+		return bson.D{{Key: "price.currency", Value: 1}, {Key: "price.amount", Value: -1}, {Key: "_id", Value: 1}}
+	case models.SortCreatedAtAsc:
+		return bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+	default:
+		return bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: 1}}
+	}
+}
+
+// priceBucketBoundaries lists the boundaries for $bucket in minor units of
+// currency. Its last bucket ends at the last boundary; prices from there up
+// fall into the default bucket.
+func priceBucketBoundaries(currency string) bson.A {
+	boundaries := bson.A{}
+	for _, b := range models.PriceBucketBoundaries {
+		boundaries = append(boundaries, b*money.Scale(currency))
+	}
+	return boundaries
+}
+
+func lastPriceBucket(currency string) int64 {
+	return models.PriceBucketBoundaries[len(models.PriceBucketBoundaries)-1] * money.Scale(currency)
+}
+
+// priceBucketMax is the exclusive upper bound of the bucket starting at min,
+// nil for the last one
+func priceBucketMax(min int64, currency string) *money.Money {
+	scale := money.Scale(currency)
+	for i, b := range models.PriceBucketBoundaries[:len(models.PriceBucketBoundaries)-1] {
+		if b*scale == min {
+			max := money.New(models.PriceBucketBoundaries[i+1]*scale, currency)
+			return &max
+		}
+	}
+	return nil
+}
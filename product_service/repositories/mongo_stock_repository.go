@@ -0,0 +1,321 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tird4d/go-microservices/product_service/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// settledReservationTTL is how long committed, released and expired
+// reservations are kept before Mongo's TTL monitor removes them
+const settledReservationTTL = 30 * 24 * time.Hour
+
+// EnsureIndexes creates the product text and filter indexes used by Search,
+// the unique SKU and category slug indexes, the indexes used by the
+// reservation reaper, the TTL index on settled reservations and the ledger's
+// per-product index
+func (r *MongoProductRepository) EnsureIndexes(ctx context.Context) error {
+	if err := ensureProductIndexes(ctx); err != nil {
+		return err
+	}
+	if err := ensureVariantIndexes(ctx); err != nil {
+		return err
+	}
+	if err := ensureCategoryIndexes(ctx); err != nil {
+		return err
+	}
+
+	_, err := models.StockReservationCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "settled_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(settledReservationTTL.Seconds())),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = models.StockMovementCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "product_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
+
+// ReserveStock takes the stock of every line and stores the reservation in
+// one transaction. If any line lacks stock nothing is taken.
+func (r *MongoProductRepository) ReserveStock(ctx context.Context, reservation *models.StockReservation) (*models.StockReservation, error) {
+	_, err := withTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if _, err := models.StockReservationCollection().InsertOne(sc, reservation); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, ErrReservationExists
+			}
+			return nil, err
+		}
+
+		for _, line := range reservation.Lines {
+			if err := changeStock(sc, line.ProductID, line.SKU, -line.Quantity, reservation.CreatedAt); err != nil {
+				return nil, err
+			}
+			if err := recordMovement(sc, models.StockMovement{
+				ProductID:     line.ProductID,
+				SKU:           line.SKU,
+				Kind:          models.MovementReserve,
+				Delta:         -line.Quantity,
+				ReservationID: reservation.ID,
+				CreatedAt:     reservation.CreatedAt,
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// ReleaseReservation gives the reserved stock back and moves the reservation
+// to toStatus (released or expired). Products and variants deleted in the
+// meantime are skipped.
+func (r *MongoProductRepository) ReleaseReservation(ctx context.Context, id string, toStatus string) (*models.StockReservation, error) {
+	kind := models.MovementRelease
+	if toStatus == models.ReservationExpired {
+		kind = models.MovementExpire
+	}
+
+	result, err := withTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		now := time.Now()
+		reservation, err := settleReservation(sc, id, toStatus, now)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range reservation.Lines {
+			err := changeStock(sc, line.ProductID, line.SKU, line.Quantity, now)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := recordMovement(sc, models.StockMovement{
+				ProductID:     line.ProductID,
+				SKU:           line.SKU,
+				Kind:          kind,
+				Delta:         line.Quantity,
+				ReservationID: reservation.ID,
+				CreatedAt:     now,
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		return reservation, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*models.StockReservation), nil
+}
+
+// CommitReservation makes a reservation final. The stock was already taken
+// when reserving, so only the status changes.
+func (r *MongoProductRepository) CommitReservation(ctx context.Context, id string) (*models.StockReservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return settleReservation(ctx, id, models.ReservationCommitted, time.Now())
+}
+
+// ExtendReservation pushes the expiry of an open reservation out to
+// expiresAt. A reservation past its expiry can't be extended even if the
+// reaper hasn't released it yet.
+func (r *MongoProductRepository) ExtendReservation(ctx context.Context, id string, expiresAt time.Time) (*models.StockReservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"_id": id, "status": models.ReservationReserved, "expires_at": bson.M{"$gt": now}}
+	update := bson.M{"$max": bson.M{"expires_at": expiresAt}, "$set": bson.M{"updated_at": now}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	reservation := &models.StockReservation{}
+	err := models.StockReservationCollection().FindOneAndUpdate(ctx, filter, update, opts).Decode(reservation)
+	if err == nil {
+		return reservation, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	return nil, closedOrMissing(ctx, id)
+}
+
+func (r *MongoProductRepository) FindReservation(ctx context.Context, id string) (*models.StockReservation, error) {
+	reservation := &models.StockReservation{}
+
+	if err := models.StockReservationCollection().FindOne(ctx, bson.M{"_id": id}).Decode(reservation); err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// FindExpiredReservations returns open reservations whose hold has run out
+func (r *MongoProductRepository) FindExpiredReservations(ctx context.Context, now time.Time, limit int64) ([]*models.StockReservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"status": models.ReservationReserved, "expires_at": bson.M{"$lte": now}}
+	opts := options.Find().SetSort(bson.D{{Key: "expires_at", Value: 1}}).SetLimit(limit)
+
+	cursor, err := models.StockReservationCollection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var reservations []*models.StockReservation
+	if err := cursor.All(ctx, &reservations); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// AdjustStock adds delta (which may be negative) to a product's stock, or
+// to its variant's when sku is set. A negative delta larger than the current
+// stock fails with ErrInsufficientStock.
+func (r *MongoProductRepository) AdjustStock(ctx context.Context, oid primitive.ObjectID, sku string, delta int32, reason string) (*models.Product, error) {
+	result, err := withTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		now := time.Now()
+		if err := changeStock(sc, oid, sku, delta, now); err != nil {
+			return nil, err
+		}
+		if err := recordMovement(sc, models.StockMovement{
+			ProductID: oid,
+			SKU:       sku,
+			Kind:      models.MovementAdjust,
+			Delta:     delta,
+			Reason:    reason,
+			CreatedAt: now,
+		}); err != nil {
+			return nil, err
+		}
+
+		product := &models.Product{}
+		if err := models.ProductCollection().FindOne(sc, bson.M{"_id": oid}).Decode(product); err != nil {
+			return nil, err
+		}
+		return product, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*models.Product), nil
+}
+
+// changeStock applies delta to a product's stock, or to its variant's when
+// sku is set, only if the stock doesn't go below zero. The condition is part
+// of the filter, so concurrent changes can't oversell.
+func changeStock(ctx context.Context, oid primitive.ObjectID, sku string, delta int32, now time.Time) error {
+	collection, filter, name := models.ProductCollection(), bson.M{"_id": oid}, "product "+oid.Hex()
+	if sku != "" {
+		// A SKU only counts for the product it belongs to
+		collection, filter, name = models.VariantCollection(), bson.M{"sku": sku, "product_id": oid}, "sku "+sku
+	}
+
+	match := bson.M{}
+	for key, value := range filter {
+		match[key] = value
+	}
+	if delta < 0 {
+		match["stock"] = bson.M{"$gte": -delta}
+	}
+	update := bson.M{
+		"$inc": bson.M{"stock": delta},
+		"$set": bson.M{"updated_at": now},
+	}
+
+	result, err := collection.UpdateOne(ctx, match, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// Tell a missing product or variant apart from one without enough stock
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%s: %w", name, mongo.ErrNoDocuments)
+	}
+	return fmt.Errorf("%s: %w", name, ErrInsufficientStock)
+}
+
+// settleReservation moves an open reservation to toStatus. A reservation that
+// exists but isn't open any more yields ErrReservationClosed. Expiring also
+// requires the expiry to have passed, so a reservation extended after the
+// reaper listed it is kept.
+func settleReservation(ctx context.Context, id, toStatus string, now time.Time) (*models.StockReservation, error) {
+	filter := bson.M{"_id": id, "status": models.ReservationReserved}
+	if toStatus == models.ReservationExpired {
+		filter["expires_at"] = bson.M{"$lte": now}
+	}
+	update := bson.M{"$set": bson.M{"status": toStatus, "settled_at": now, "updated_at": now}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	reservation := &models.StockReservation{}
+	err := models.StockReservationCollection().FindOneAndUpdate(ctx, filter, update, opts).Decode(reservation)
+	if err == nil {
+		return reservation, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	return nil, closedOrMissing(ctx, id)
+}
+
+// closedOrMissing explains why a conditional update of reservation id
+// matched nothing: mongo.ErrNoDocuments if it doesn't exist, otherwise
+// ErrReservationClosed
+func closedOrMissing(ctx context.Context, id string) error {
+	count, err := models.StockReservationCollection().CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return ErrReservationClosed
+}
+
+func recordMovement(ctx context.Context, movement models.StockMovement) error {
+	_, err := models.StockMovementCollection().InsertOne(ctx, movement)
+	return err
+}
+
+func withTransaction(ctx context.Context, fn func(sc mongo.SessionContext) (interface{}, error)) (interface{}, error) {
+	session, err := models.ProductCollection().Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	return session.WithTransaction(ctx, fn)
+}
@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/product_service/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ensureVariantIndexes makes SKUs unique and lists a product's variants
+// without a collection scan
+func ensureVariantIndexes(ctx context.Context) error {
+	_, err := models.VariantCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "sku", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "product_id", Value: 1}, {Key: "created_at", Value: 1}}},
+	})
+	return err
+}
+
+// CreateVariant stores a variant of an existing product
+func (r *MongoProductRepository) CreateVariant(ctx context.Context, variant *models.Variant) (*models.Variant, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	count, err := models.ProductCollection().CountDocuments(ctx, bson.M{"_id": variant.ProductID})
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	now := time.Now()
+	variant.CreatedAt = now
+	variant.UpdatedAt = now
+
+	result, err := models.VariantCollection().InsertOne(ctx, variant)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateSKU
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	variant.ID = result.InsertedID.(primitive.ObjectID)
+	return variant, nil
+}
+
+func (r *MongoProductRepository) FindVariant(ctx context.Context, oid primitive.ObjectID) (*models.Variant, error) {
+	return findVariant(ctx, bson.M{"_id": oid})
+}
+
+func (r *MongoProductRepository) FindVariantBySKU(ctx context.Context, sku string) (*models.Variant, error) {
+	return findVariant(ctx, bson.M{"sku": sku})
+}
+
+// FindVariants returns a product's variants in the order they were created
+func (r *MongoProductRepository) FindVariants(ctx context.Context, productID primitive.ObjectID) ([]*models.Variant, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := models.VariantCollection().Find(ctx, bson.M{"product_id": productID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	variants := []*models.Variant{}
+	if err := cursor.All(ctx, &variants); err != nil {
+		return nil, err
+	}
+
+	return variants, nil
+}
+
+// UpdateVariant applies updates and returns the variant as it is afterwards
+func (r *MongoProductRepository) UpdateVariant(ctx context.Context, oid primitive.ObjectID, updates map[string]any) (*models.Variant, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	updates["updated_at"] = time.Now()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	variant := &models.Variant{}
+	err := models.VariantCollection().FindOneAndUpdate(ctx, bson.M{"_id": oid}, bson.M{"$set": updates}, opts).Decode(variant)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateSKU
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return variant, nil
+}
+
+func (r *MongoProductRepository) DeleteVariant(ctx context.Context, oid primitive.ObjectID) error {
+	result, err := models.VariantCollection().DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func findVariant(ctx context.Context, filter bson.M) (*models.Variant, error) {
+	variant := &models.Variant{}
+	if err := models.VariantCollection().FindOne(ctx, filter).Decode(variant); err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
@@ -0,0 +1,26 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/product_service/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MigrateMissingVersions gives products stored before they had a version
+// version 1. Otherwise they would be served with ETag "0", and version 0
+// means "no If-Match", so a client's conditional write would silently become
+// unconditional. Backfilled products no longer match, which makes it safe to
+// run on every start.
+func (r *MongoProductRepository) MigrateMissingVersions(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	result, err := models.ProductCollection().UpdateMany(ctx,
+		bson.M{"version": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"version": 1}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
@@ -2,6 +2,8 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/tird4d/go-microservices/product_service/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,8 +15,70 @@ type ProductRepository interface {
 	FindByID(ctx context.Context, oid primitive.ObjectID) (*models.Product, error)
 	FindAll(ctx context.Context, skip, pageSize int64) ([]*models.Product, error)
 	FindByCategory(ctx context.Context, category string, skip, pageSize int64) ([]*models.Product, error)
+	// FindAfter returns up to limit products after the given position in
+	// (created_at, _id) order, restricted to category unless it's empty.
+	// A nil position starts from the first product.
+	FindAfter(ctx context.Context, category string, after *models.ProductPosition, limit int64) ([]*models.Product, error)
 	Count(ctx context.Context) (int64, error)
 	CountByCategory(ctx context.Context, category string) (int64, error)
-	Update(ctx context.Context, oid primitive.ObjectID, updates map[string]any) (*models.Product, error)
-	Delete(ctx context.Context, oid primitive.ObjectID) error
+	// Update and Delete only apply while the product is at expectedVersion,
+	// returning ErrVersionMismatch otherwise. An expectedVersion of 0 skips the check.
+	Update(ctx context.Context, oid primitive.ObjectID, expectedVersion int64, updates map[string]any) (*models.Product, error)
+	Delete(ctx context.Context, oid primitive.ObjectID, expectedVersion int64) error
+	// Search finds products matching search and counts the matches per
+	// category and price bucket. A query needs the text index.
+	Search(ctx context.Context, search *models.ProductSearch) (*models.ProductSearchResult, error)
+
+	// Stock reservations and adjustments. Each stock change is conditional on
+	// enough stock being left and is recorded in the stock movement ledger.
+	ReserveStock(ctx context.Context, reservation *models.StockReservation) (*models.StockReservation, error)
+	ReleaseReservation(ctx context.Context, id string, toStatus string) (*models.StockReservation, error)
+	CommitReservation(ctx context.Context, id string) (*models.StockReservation, error)
+	// ExtendReservation moves the expiry of a reservation that is open and
+	// not yet expired to expiresAt, unless it already expires later
+	ExtendReservation(ctx context.Context, id string, expiresAt time.Time) (*models.StockReservation, error)
+	FindReservation(ctx context.Context, id string) (*models.StockReservation, error)
+	FindExpiredReservations(ctx context.Context, now time.Time, limit int64) ([]*models.StockReservation, error)
+	AdjustStock(ctx context.Context, oid primitive.ObjectID, sku string, delta int32, reason string) (*models.Product, error)
+
+	// Variants. CreateVariant fails with mongo.ErrNoDocuments for an unknown
+	// product; CreateVariant and UpdateVariant fail with ErrDuplicateSKU when
+	// another variant has the SKU.
+	CreateVariant(ctx context.Context, variant *models.Variant) (*models.Variant, error)
+	FindVariant(ctx context.Context, oid primitive.ObjectID) (*models.Variant, error)
+	FindVariantBySKU(ctx context.Context, sku string) (*models.Variant, error)
+	FindVariants(ctx context.Context, productID primitive.ObjectID) ([]*models.Variant, error)
+	UpdateVariant(ctx context.Context, oid primitive.ObjectID, updates map[string]any) (*models.Variant, error)
+	DeleteVariant(ctx context.Context, oid primitive.ObjectID) error
+
+	// Categories. Products refer to categories by slug. CreateCategory and
+	// UpdateCategory fail with ErrDuplicateSlug when another category has the
+	// slug; DeleteCategory fails with ErrCategoryInUse while the category has
+	// products or subcategories.
+	CreateCategory(ctx context.Context, category *models.Category) (*models.Category, error)
+	FindCategory(ctx context.Context, oid primitive.ObjectID) (*models.Category, error)
+	FindCategoryBySlug(ctx context.Context, slug string) (*models.Category, error)
+	FindCategories(ctx context.Context) ([]*models.Category, error)
+	CountProductsPerCategory(ctx context.Context) (map[string]int64, error)
+	UpdateCategory(ctx context.Context, oid primitive.ObjectID, updates map[string]any) (*models.Category, error)
+	DeleteCategory(ctx context.Context, oid primitive.ObjectID) error
+	MergeCategory(ctx context.Context, sourceID, targetID primitive.ObjectID) (*models.Category, error)
 }
+
+var (
+	// ErrInsufficientStock means a product doesn't have the stock a reservation
+	// or negative adjustment asked for; nothing was changed
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrReservationExists is returned by ReserveStock when the ID is taken
+	ErrReservationExists = errors.New("reservation already exists")
+	// ErrReservationClosed means the reservation is no longer in the reserved status
+	ErrReservationClosed = errors.New("reservation is no longer open")
+	// ErrVersionMismatch means the product changed since the caller read it
+	ErrVersionMismatch = errors.New("product version mismatch")
+	// ErrDuplicateSKU means another variant already uses the SKU
+	ErrDuplicateSKU = errors.New("sku already exists")
+	// ErrDuplicateSlug means another category already uses the slug
+	ErrDuplicateSlug = errors.New("category slug already exists")
+	// ErrCategoryInUse means a category still has products or subcategories
+	ErrCategoryInUse = errors.New("category has products or subcategories")
+)
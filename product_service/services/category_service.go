@@ -0,0 +1,309 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/tird4d/go-microservices/product_service/logger"
+	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxSlugLength = 64
+
+// slugPattern allows lowercase words of letters and digits joined by hyphens
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// CreateCategory adds a category under parentID, or at the top level when
+// parentID is empty
+func CreateCategory(ctx context.Context, repo repositories.ProductRepository, slug, name, parentID string) (*models.Category, error) {
+	category := &models.Category{Slug: normalizeSlug(slug), Name: strings.TrimSpace(name)}
+	if err := validateSlug(category.Slug); err != nil {
+		return nil, err
+	}
+	if category.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if parentID != "" {
+		parent, err := findParent(ctx, repo, parentID)
+		if err != nil {
+			return nil, err
+		}
+		category.ParentID = &parent.ID
+	}
+
+	created, err := repo.CreateCategory(ctx, category)
+	if err != nil {
+		return nil, categoryError(err, "failed to create category")
+	}
+
+	logger.Log.Infow("Category created successfully", "id", created.ID.Hex(), "slug", created.Slug)
+	return created, nil
+}
+
+// GetCategory returns a category with the number of products directly in it
+func GetCategory(ctx context.Context, repo repositories.ProductRepository, id string) (*models.CategoryNode, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid category ID format")
+	}
+
+	category, err := repo.FindCategory(ctx, oid)
+	if err != nil {
+		return nil, categoryError(err, "failed to retrieve category")
+	}
+
+	count, err := repo.CountByCategory(ctx, category.Slug)
+	if err != nil {
+		logger.Log.Errorw("Failed to count products of category", "slug", category.Slug, "error", err)
+		return nil, status.Error(codes.Internal, "failed to retrieve category")
+	}
+
+	return &models.CategoryNode{Category: category, ProductCount: count}, nil
+}
+
+// ListCategories returns every category ordered by name, with product counts
+func ListCategories(ctx context.Context, repo repositories.ProductRepository) ([]*models.CategoryNode, error) {
+	nodes, _, err := loadCategoryTree(ctx, repo)
+	return nodes, err
+}
+
+// GetCategoryTree returns the top-level categories with their subcategories
+// nested below them, each level ordered by name
+func GetCategoryTree(ctx context.Context, repo repositories.ProductRepository) ([]*models.CategoryNode, error) {
+	_, roots, err := loadCategoryTree(ctx, repo)
+	return roots, err
+}
+
+// loadCategoryTree loads all categories and product counts and links them
+// into a tree. It returns every node ordered by name and the roots.
+func loadCategoryTree(ctx context.Context, repo repositories.ProductRepository) ([]*models.CategoryNode, []*models.CategoryNode, error) {
+	categories, err := repo.FindCategories(ctx)
+	if err != nil {
+		logger.Log.Errorw("Failed to list categories", "error", err)
+		return nil, nil, status.Error(codes.Internal, "failed to list categories")
+	}
+	counts, err := repo.CountProductsPerCategory(ctx)
+	if err != nil {
+		logger.Log.Errorw("Failed to count products per category", "error", err)
+		return nil, nil, status.Error(codes.Internal, "failed to list categories")
+	}
+
+	nodes := make([]*models.CategoryNode, len(categories))
+	byID := make(map[primitive.ObjectID]*models.CategoryNode, len(categories))
+	for i, category := range categories {
+		nodes[i] = &models.CategoryNode{Category: category, ProductCount: counts[category.Slug]}
+		byID[category.ID] = nodes[i]
+	}
+
+	var roots []*models.CategoryNode
+	for _, node := range nodes {
+		var parent *models.CategoryNode
+		if node.ParentID != nil {
+			parent = byID[*node.ParentID]
+		}
+		if parent == nil {
+			// A category whose parent is gone is shown at the top level
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	for _, root := range roots {
+		sumProductCounts(root)
+	}
+	return nodes, roots, nil
+}
+
+func sumProductCounts(node *models.CategoryNode) int64 {
+	node.TotalProductCount = node.ProductCount
+	for _, child := range node.Children {
+		node.TotalProductCount += sumProductCounts(child)
+	}
+	return node.TotalProductCount
+}
+
+// UpdateCategory changes the fields named in paths: slug, name and
+// parent_id. Changing the slug moves the category's products along; setting
+// parent_id moves the category and everything below it, and an empty
+// parent_id makes it a top-level category.
+func UpdateCategory(ctx context.Context, repo repositories.ProductRepository, id string, changes *models.Category, parentID string, paths []string) (*models.Category, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid category ID format")
+	}
+	if len(paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no fields to update")
+	}
+
+	updates := make(map[string]any, len(paths))
+	for _, path := range paths {
+		switch path {
+		case "slug":
+			slug := normalizeSlug(changes.Slug)
+			if err := validateSlug(slug); err != nil {
+				return nil, err
+			}
+			updates["slug"] = slug
+		case "name":
+			name := strings.TrimSpace(changes.Name)
+			if name == "" {
+				return nil, status.Error(codes.InvalidArgument, "name cannot be empty")
+			}
+			updates["name"] = name
+		case "parent_id":
+			if parentID == "" {
+				updates["parent_id"] = nil
+				continue
+			}
+			parent, err := findParent(ctx, repo, parentID)
+			if err != nil {
+				return nil, err
+			}
+			if err := requireNotBelow(ctx, repo, parent.ID, oid); err != nil {
+				return nil, err
+			}
+			updates["parent_id"] = parent.ID
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unknown update path %q", path)
+		}
+	}
+
+	category, err := repo.UpdateCategory(ctx, oid, updates)
+	if err != nil {
+		return nil, categoryError(err, "failed to update category")
+	}
+
+	logger.Log.Infow("Category updated successfully", "id", id, "slug", category.Slug, "fields", paths)
+	return category, nil
+}
+
+// DeleteCategory removes an empty category. Categories with products or
+// subcategories have to be merged into another one instead.
+func DeleteCategory(ctx context.Context, repo repositories.ProductRepository, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid category ID format")
+	}
+
+	if err := repo.DeleteCategory(ctx, oid); err != nil {
+		return categoryError(err, "failed to delete category")
+	}
+
+	logger.Log.Infow("Category deleted successfully", "id", id)
+	return nil
+}
+
+// MergeCategories moves the products and subcategories of source into
+// target and deletes source. Target can't be source or lie below it, since
+// source's subcategories would then end up below themselves.
+func MergeCategories(ctx context.Context, repo repositories.ProductRepository, sourceID, targetID string) (*models.Category, error) {
+	source, err := primitive.ObjectIDFromHex(sourceID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid source category ID format")
+	}
+	target, err := primitive.ObjectIDFromHex(targetID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid target category ID format")
+	}
+
+	if err := requireNotBelow(ctx, repo, target, source); err != nil {
+		return nil, err
+	}
+
+	merged, err := repo.MergeCategory(ctx, source, target)
+	if err != nil {
+		return nil, categoryError(err, "failed to merge categories")
+	}
+
+	logger.Log.Infow("Categories merged successfully", "source", sourceID, "target", targetID, "slug", merged.Slug)
+	return merged, nil
+}
+
+// requireCategory checks that slug names an existing category, so products
+// can't be filed under a misspelt one
+func requireCategory(ctx context.Context, repo repositories.ProductRepository, slug string) error {
+	_, err := repo.FindCategoryBySlug(ctx, slug)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return status.Errorf(codes.InvalidArgument, "unknown category %q", slug)
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to look up category", "slug", slug, "error", err)
+		return status.Error(codes.Internal, "failed to look up category")
+	}
+	return nil
+}
+
+func findParent(ctx context.Context, repo repositories.ProductRepository, parentID string) (*models.Category, error) {
+	oid, err := primitive.ObjectIDFromHex(parentID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid parent ID format")
+	}
+
+	parent, err := repo.FindCategory(ctx, oid)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, status.Error(codes.InvalidArgument, "parent category not found")
+	}
+	if err != nil {
+		return nil, categoryError(err, "failed to look up parent category")
+	}
+	return parent, nil
+}
+
+// requireNotBelow fails unless target lies outside the subtree of category,
+// walking up from target towards the root
+func requireNotBelow(ctx context.Context, repo repositories.ProductRepository, target, category primitive.ObjectID) error {
+	for id, depth := &target, 0; id != nil; depth++ {
+		if *id == category {
+			return status.Error(codes.InvalidArgument, "a category can't be moved or merged into itself or its subcategories")
+		}
+		// A cycle left by some earlier bug would otherwise loop forever
+		if depth > 100 {
+			return status.Error(codes.FailedPrecondition, "category tree is too deep")
+		}
+
+		current, err := repo.FindCategory(ctx, *id)
+		if err != nil {
+			return categoryError(err, "failed to look up category")
+		}
+		id = current.ParentID
+	}
+	return nil
+}
+
+func normalizeSlug(slug string) string {
+	return strings.ToLower(strings.TrimSpace(slug))
+}
+
+func validateSlug(slug string) error {
+	if slug == "" || len(slug) > maxSlugLength {
+		return status.Error(codes.InvalidArgument, "slug is required and must be at most 64 characters")
+	}
+	if !slugPattern.MatchString(slug) {
+		return status.Error(codes.InvalidArgument, "slug may only contain lowercase letters, digits and single hyphens")
+	}
+	return nil
+}
+
+// categoryError maps repository errors to gRPC status errors
+func categoryError(err error, message string) error {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return status.Error(codes.NotFound, "category not found")
+	case errors.Is(err, repositories.ErrDuplicateSlug):
+		return status.Error(codes.AlreadyExists, "category slug already exists")
+	case errors.Is(err, repositories.ErrCategoryInUse):
+		return status.Error(codes.FailedPrecondition, "category still has products or subcategories; merge it into another category instead")
+	default:
+		logger.Log.Errorw("Category operation failed", "operation", message, "error", err)
+		return status.Error(codes.Internal, message)
+	}
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// categoryChain returns clothing > shirts > t-shirts, registered with the mock
+func categoryChain(mockRepo *MockProductRepository) (clothing, shirts, tshirts *models.Category) {
+	clothing = &models.Category{ID: primitive.NewObjectID(), Slug: "clothing", Name: "Clothing"}
+	shirts = &models.Category{ID: primitive.NewObjectID(), Slug: "shirts", Name: "Shirts", ParentID: &clothing.ID}
+	tshirts = &models.Category{ID: primitive.NewObjectID(), Slug: "t-shirts", Name: "T-Shirts", ParentID: &shirts.ID}
+	for _, category := range []*models.Category{clothing, shirts, tshirts} {
+		mockRepo.On("FindCategory", mock.Anything, category.ID).Return(category, nil).Maybe()
+	}
+	return clothing, shirts, tshirts
+}
+
+func TestCreateCategory_UnderParent(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	clothing, _, _ := categoryChain(mockRepo)
+
+	mockRepo.On("CreateCategory", ctx, mock.MatchedBy(func(c *models.Category) bool {
+		return c.Slug == "hats" && c.Name == "Hats" && *c.ParentID == clothing.ID
+	})).Return(&models.Category{ID: primitive.NewObjectID(), Slug: "hats"}, nil)
+
+	category, err := CreateCategory(ctx, mockRepo, " Hats ", "Hats", clothing.ID.Hex())
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, "hats", category.Slug)
+}
+
+func TestCreateCategory_InvalidInput(t *testing.T) {
+	ctx := context.Background()
+
+	cases := map[string]struct{ slug, name, parentID string }{
+		"missing slug":     {"", "Hats", ""},
+		"slug with space":  {"winter hats", "Hats", ""},
+		"double hyphen":    {"winter--hats", "Hats", ""},
+		"missing name":     {"hats", " ", ""},
+		"bad parent id":    {"hats", "Hats", "nope"},
+		"unknown parent":   {"hats", "Hats", primitive.NewObjectID().Hex()},
+		"slug with symbol": {"hats&caps", "Hats", ""},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(MockProductRepository)
+			mockRepo.On("FindCategory", ctx, mock.Anything).Return(nil, mongo.ErrNoDocuments)
+
+			_, err := CreateCategory(ctx, mockRepo, tc.slug, tc.name, tc.parentID)
+
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			mockRepo.AssertNotCalled(t, "CreateCategory", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestCreateCategory_DuplicateSlug(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("CreateCategory", ctx, mock.Anything).Return(nil, repositories.ErrDuplicateSlug)
+
+	_, err := CreateCategory(ctx, mockRepo, "hats", "Hats", "")
+
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestGetCategoryTree_NestsAndSumsCounts(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	clothing, shirts, tshirts := categoryChain(mockRepo)
+	books := &models.Category{ID: primitive.NewObjectID(), Slug: "books", Name: "Books"}
+	mockRepo.On("FindCategories", ctx).Return([]*models.Category{books, clothing, shirts, tshirts}, nil)
+	mockRepo.On("CountProductsPerCategory", ctx).Return(map[string]int64{"books": 4, "shirts": 2, "t-shirts": 5, "phantom": 9}, nil)
+
+	roots, err := GetCategoryTree(ctx, mockRepo)
+
+	require.NoError(t, err)
+	require.Len(t, roots, 2)
+	assert.Equal(t, "books", roots[0].Slug)
+	assert.Equal(t, int64(4), roots[0].TotalProductCount)
+
+	assert.Equal(t, "clothing", roots[1].Slug)
+	assert.Equal(t, int64(0), roots[1].ProductCount)
+	assert.Equal(t, int64(7), roots[1].TotalProductCount)
+	require.Len(t, roots[1].Children, 1)
+	assert.Equal(t, int64(2), roots[1].Children[0].ProductCount)
+	assert.Equal(t, int64(7), roots[1].Children[0].TotalProductCount)
+	require.Len(t, roots[1].Children[0].Children, 1)
+	assert.Equal(t, "t-shirts", roots[1].Children[0].Children[0].Slug)
+}
+
+func TestListCategories_IncludesCounts(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	clothing, shirts, _ := categoryChain(mockRepo)
+	mockRepo.On("FindCategories", ctx).Return([]*models.Category{clothing, shirts}, nil)
+	mockRepo.On("CountProductsPerCategory", ctx).Return(map[string]int64{"shirts": 3}, nil)
+
+	categories, err := ListCategories(ctx, mockRepo)
+
+	require.NoError(t, err)
+	require.Len(t, categories, 2)
+	assert.Equal(t, int64(0), categories[0].ProductCount)
+	assert.Equal(t, int64(3), categories[0].TotalProductCount)
+	assert.Equal(t, int64(3), categories[1].ProductCount)
+}
+
+func TestUpdateCategory_Move(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	clothing, _, tshirts := categoryChain(mockRepo)
+
+	mockRepo.On("UpdateCategory", ctx, tshirts.ID, map[string]any{"parent_id": clothing.ID}).
+		Return(&models.Category{ID: tshirts.ID, Slug: "t-shirts", ParentID: &clothing.ID}, nil)
+
+	category, err := UpdateCategory(ctx, mockRepo, tshirts.ID.Hex(), &models.Category{}, clothing.ID.Hex(), []string{"parent_id"})
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, clothing.ID, *category.ParentID)
+}
+
+func TestUpdateCategory_MoveToTopLevel(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	shirts := primitive.NewObjectID()
+
+	mockRepo.On("UpdateCategory", ctx, shirts, map[string]any{"parent_id": nil}).Return(&models.Category{ID: shirts}, nil)
+
+	_, err := UpdateCategory(ctx, mockRepo, shirts.Hex(), &models.Category{}, "", []string{"parent_id"})
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+}
+
+func TestUpdateCategory_CannotMoveBelowItself(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	clothing, _, tshirts := categoryChain(mockRepo)
+
+	for _, parent := range []*models.Category{clothing, tshirts} {
+		_, err := UpdateCategory(ctx, mockRepo, clothing.ID.Hex(), &models.Category{}, parent.ID.Hex(), []string{"parent_id"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	mockRepo.AssertNotCalled(t, "UpdateCategory", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpdateCategory_NormalizesSlug(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	id := primitive.NewObjectID()
+
+	mockRepo.On("UpdateCategory", ctx, id, map[string]any{"slug": "tees"}).Return(&models.Category{ID: id, Slug: "tees"}, nil)
+
+	_, err := UpdateCategory(ctx, mockRepo, id.Hex(), &models.Category{Slug: " Tees"}, "", []string{"slug"})
+	assert.NoError(t, err)
+
+	_, err = UpdateCategory(ctx, mockRepo, id.Hex(), &models.Category{}, "", []string{"products"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestDeleteCategory_InUse(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	id := primitive.NewObjectID()
+
+	mockRepo.On("DeleteCategory", ctx, id).Return(repositories.ErrCategoryInUse)
+
+	err := DeleteCategory(ctx, mockRepo, id.Hex())
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestMergeCategories_Success(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	clothing, _, tshirts := categoryChain(mockRepo)
+
+	mockRepo.On("MergeCategory", ctx, tshirts.ID, clothing.ID).Return(clothing, nil)
+
+	merged, err := MergeCategories(ctx, mockRepo, tshirts.ID.Hex(), clothing.ID.Hex())
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, "clothing", merged.Slug)
+}
+
+func TestMergeCategories_IntoOwnSubtree(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	clothing, _, tshirts := categoryChain(mockRepo)
+
+	_, err := MergeCategories(ctx, mockRepo, clothing.ID.Hex(), tshirts.ID.Hex())
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = MergeCategories(ctx, mockRepo, clothing.ID.Hex(), clothing.ID.Hex())
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	mockRepo.AssertNotCalled(t, "MergeCategory", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpdateProduct_UnknownCategory(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	id := primitive.NewObjectID()
+
+	mockRepo.On("FindCategoryBySlug", ctx, "elektronics").Return(nil, mongo.ErrNoDocuments)
+
+	_, err := UpdateProduct(ctx, mockRepo, id.Hex(), &models.Product{Category: "Elektronics"}, []string{"category"}, 0)
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
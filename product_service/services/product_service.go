@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/tird4d/go-microservices/pagination"
 	"github.com/tird4d/go-microservices/product_service/logger"
 	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
 	"github.com/tird4d/go-microservices/product_service/repositories"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -15,7 +18,18 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-func CreateProduct(ctx context.Context, repo repositories.ProductRepository, name, description, category, imageUrl string, price float64, stock int32) (*models.Product, error) {
+// CreateProduct stores a new product. The category is the slug of an
+// existing category and the price needs a supported currency.
+func CreateProduct(ctx context.Context, repo repositories.ProductRepository, name, description, category, imageUrl string, price money.Money, stock int32) (*models.Product, error) {
+	price, err := validatePrice(price)
+	if err != nil {
+		return nil, err
+	}
+
+	category = normalizeSlug(category)
+	if err := requireCategory(ctx, repo, category); err != nil {
+		return nil, err
+	}
 
 	product := models.Product{
 		Name:        name,
@@ -65,9 +79,13 @@ func GetProductByID(ctx context.Context, repo repositories.ProductRepository, id
 	return product, nil
 }
 
-// UpdateProduct updates an existing product
+// UpdateProduct changes the fields of an existing product named in paths,
+// taking their new values from changes. Without paths, every non-zero field
+// of changes is updated, so older callers can't zero fields they didn't send.
+// A non-zero expectedVersion makes the update fail with Aborted if the
+// product has been changed since the caller read it.
 // NOTE: UpdatedAt timestamp is set automatically in repository layer
-func UpdateProduct(ctx context.Context, repo repositories.ProductRepository, id, name, description, category, imageUrl string, price float64, stock int32) (*models.Product, error) {
+func UpdateProduct(ctx context.Context, repo repositories.ProductRepository, id string, changes *models.Product, paths []string, expectedVersion int64) (*models.Product, error) {
 	// Convert string ID to ObjectID
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -75,24 +93,34 @@ func UpdateProduct(ctx context.Context, repo repositories.ProductRepository, id,
 		return nil, status.Error(codes.InvalidArgument, "invalid product ID format")
 	}
 
-	// Build update map with only the fields to update
-	// Repository pattern: updates map is database-agnostic
-	updates := map[string]any{
-		"name":        name,
-		"description": description,
-		"price":       price,
-		"category":    category,
-		"stock":       stock,
-		"image_url":   imageUrl,
-		// updated_at is set automatically by repository
+	if len(paths) == 0 {
+		paths = populatedProductFields(changes)
+	}
+
+	updates, err := productUpdates(changes, paths)
+	if err != nil {
+		return nil, err
+	}
+	if category, ok := updates["category"].(string); ok {
+		if err := requireCategory(ctx, repo, category); err != nil {
+			return nil, err
+		}
+	}
+	if price, ok := updates["price"].(money.Money); ok {
+		if err := requireVariantCurrency(ctx, repo, oid, price.Currency); err != nil {
+			return nil, err
+		}
 	}
 
 	// Repository handles the database update
-	updatedProduct, err := repo.Update(ctx, oid, updates)
+	updatedProduct, err := repo.Update(ctx, oid, expectedVersion, updates)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, status.Error(codes.NotFound, "product not found")
 		}
+		if errors.Is(err, repositories.ErrVersionMismatch) {
+			return nil, status.Error(codes.Aborted, "product was changed by someone else")
+		}
 		logger.Log.Errorw("Failed to update product", "error", err)
 		return nil, status.Error(codes.Internal, "failed to update product")
 	}
@@ -100,13 +128,106 @@ func UpdateProduct(ctx context.Context, repo repositories.ProductRepository, id,
 	logger.Log.Infow("Product updated successfully",
 		"id", updatedProduct.ID.Hex(),
 		"name", updatedProduct.Name,
+		"fields", paths,
 	)
 
 	return updatedProduct, nil
 }
 
-// DeleteProduct removes a product from the database
-func DeleteProduct(ctx context.Context, repo repositories.ProductRepository, id string) error {
+// productUpdates validates each field mask path and builds the
+// database-agnostic updates map the repository applies
+func productUpdates(changes *models.Product, paths []string) (map[string]any, error) {
+	if len(paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no fields to update")
+	}
+
+	updates := make(map[string]any, len(paths))
+	for _, path := range paths {
+		switch path {
+		case "name":
+			if strings.TrimSpace(changes.Name) == "" {
+				return nil, status.Error(codes.InvalidArgument, "name cannot be empty")
+			}
+			updates["name"] = changes.Name
+		case "description":
+			updates["description"] = changes.Description
+		case "price":
+			price, err := validatePrice(changes.Price)
+			if err != nil {
+				return nil, err
+			}
+			updates["price"] = price
+		case "category":
+			category := normalizeSlug(changes.Category)
+			if category == "" {
+				return nil, status.Error(codes.InvalidArgument, "category cannot be empty")
+			}
+			updates["category"] = category
+		case "image_url":
+			updates["image_url"] = changes.ImageURL
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unknown update path %q", path)
+		}
+	}
+
+	return updates, nil
+}
+
+// populatedProductFields is the implied field mask of a request without one
+func populatedProductFields(changes *models.Product) []string {
+	var paths []string
+	if changes.Name != "" {
+		paths = append(paths, "name")
+	}
+	if changes.Description != "" {
+		paths = append(paths, "description")
+	}
+	if changes.Price != (money.Money{}) {
+		paths = append(paths, "price")
+	}
+	if changes.Category != "" {
+		paths = append(paths, "category")
+	}
+	if changes.ImageURL != "" {
+		paths = append(paths, "image_url")
+	}
+	return paths
+}
+
+// validatePrice normalizes the currency code of a product price and checks
+// that the currency is supported and the amount positive
+func validatePrice(price money.Money) (money.Money, error) {
+	price.Currency = money.NormalizeCurrency(price.Currency)
+	if err := money.ValidateCurrency(price.Currency); err != nil {
+		return money.Money{}, status.Errorf(codes.InvalidArgument, "price: %v", err)
+	}
+	if price.Amount <= 0 {
+		return money.Money{}, status.Error(codes.InvalidArgument, "price must be positive")
+	}
+	return price, nil
+}
+
+// requireVariantCurrency keeps a product and its variant price overrides in
+// one currency: the product's currency can only change once no variant
+// overrides its price in the old one.
+func requireVariantCurrency(ctx context.Context, repo repositories.ProductRepository, productID primitive.ObjectID, currency string) error {
+	variants, err := repo.FindVariants(ctx, productID)
+	if err != nil {
+		logger.Log.Errorw("Failed to list variants", "product_id", productID.Hex(), "error", err)
+		return status.Error(codes.Internal, "failed to update product")
+	}
+	for _, variant := range variants {
+		if variant.Price != nil && variant.Price.Currency != currency {
+			return status.Errorf(codes.FailedPrecondition,
+				"variant %s is priced in %s; change or remove its price before changing the product currency", variant.SKU, variant.Price.Currency)
+		}
+	}
+	return nil
+}
+
+// DeleteProduct removes a product from the database. expectedVersion works
+// like UpdateProduct's.
+func DeleteProduct(ctx context.Context, repo repositories.ProductRepository, id string, expectedVersion int64) error {
 	// Convert string ID to ObjectID
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -115,11 +236,14 @@ func DeleteProduct(ctx context.Context, repo repositories.ProductRepository, id
 	}
 
 	// Delete from database
-	err = repo.Delete(ctx, oid)
+	err = repo.Delete(ctx, oid, expectedVersion)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return status.Error(codes.NotFound, "product not found")
 		}
+		if errors.Is(err, repositories.ErrVersionMismatch) {
+			return status.Error(codes.Aborted, "product was changed by someone else")
+		}
 		logger.Log.Errorw("Failed to delete product", "error", err)
 		return status.Error(codes.Internal, "failed to delete product")
 	}
@@ -131,7 +255,10 @@ func DeleteProduct(ctx context.Context, repo repositories.ProductRepository, id
 // ListProducts retrieves all products with pagination
 // PAGINATION PATTERN: skip = (page - 1) × pageSize
 // Example: page=2, pageSize=10 → skip first 10, return next 10
-func ListProducts(ctx context.Context, repo repositories.ProductRepository, page, pageSize int32) ([]*models.Product, int64, error) {
+// A pageToken from a previous page switches to keyset pagination, which
+// ignores page and doesn't skip or repeat products when others are added.
+// The returned token is empty on the last page.
+func ListProducts(ctx context.Context, repo repositories.ProductRepository, page, pageSize int32, pageToken string) ([]*models.Product, int64, string, error) {
 	// Set defaults for pagination
 	if page < 1 {
 		page = 1
@@ -140,37 +267,38 @@ func ListProducts(ctx context.Context, repo repositories.ProductRepository, page
 		pageSize = 10 // Default page size
 	}
 
-	// Calculate skip value: how many documents to skip
-	// Page 1: skip 0, Page 2: skip pageSize, Page 3: skip pageSize*2
-	skip := int64((page - 1) * pageSize)
-	pageSizeInt64 := int64(pageSize)
-
-	// Get products from database
-	products, err := repo.FindAll(ctx, skip, pageSizeInt64)
+	products, hasMore, err := findProductPage(ctx, repo, "", page, pageSize, pageToken)
 	if err != nil {
-		logger.Log.Errorw("Failed to list products", "error", err)
-		return nil, 0, status.Error(codes.Internal, "failed to list products")
+		return nil, 0, "", err
 	}
 
 	// Get total count for pagination metadata
 	total, err := repo.Count(ctx)
 	if err != nil {
 		logger.Log.Errorw("Failed to count products", "error", err)
-		return nil, 0, status.Error(codes.Internal, "failed to count products")
+		return nil, 0, "", status.Error(codes.Internal, "failed to count products")
+	}
+	if pageToken == "" {
+		hasMore = int64(page-1)*int64(pageSize)+int64(len(products)) < total
 	}
 
 	logger.Log.Infow("Products listed successfully",
 		"total", total,
 		"returned", len(products),
 		"page", page,
+		"keyset", pageToken != "",
 	)
 
-	return products, total, nil
+	nextPageToken, err := nextProductPageToken(productPageScope(""), products, hasMore)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return products, total, nextPageToken, nil
 }
 
 // GetProductsByCategory retrieves products filtered by category with pagination
 // SAME PAGINATION PATTERN as ListProducts, but with category filter
-func GetProductsByCategory(ctx context.Context, repo repositories.ProductRepository, category string, page, pageSize int32) ([]*models.Product, int64, error) {
+func GetProductsByCategory(ctx context.Context, repo repositories.ProductRepository, category string, page, pageSize int32, pageToken string) ([]*models.Product, int64, string, error) {
 	// Set defaults
 	if page < 1 {
 		page = 1
@@ -179,22 +307,19 @@ func GetProductsByCategory(ctx context.Context, repo repositories.ProductReposit
 		pageSize = 10
 	}
 
-	// Calculate skip for pagination - convert int32 to int64 for MongoDB driver
-	skip := int64((page - 1) * pageSize)
-	pageSizeInt64 := int64(pageSize)
-
-	// Get filtered products
-	products, err := repo.FindByCategory(ctx, category, skip, pageSizeInt64)
+	products, hasMore, err := findProductPage(ctx, repo, category, page, pageSize, pageToken)
 	if err != nil {
-		logger.Log.Errorw("Failed to get products by category", "error", err, "category", category)
-		return nil, 0, status.Error(codes.Internal, "failed to get products by category")
+		return nil, 0, "", err
 	}
 
 	// Get total count for this category
 	total, err := repo.CountByCategory(ctx, category)
 	if err != nil {
 		logger.Log.Errorw("Failed to count products by category", "error", err, "category", category)
-		return nil, 0, status.Error(codes.Internal, "failed to count products")
+		return nil, 0, "", status.Error(codes.Internal, "failed to count products")
+	}
+	if pageToken == "" {
+		hasMore = int64(page-1)*int64(pageSize)+int64(len(products)) < total
 	}
 
 	logger.Log.Infow("Products by category retrieved successfully",
@@ -202,7 +327,101 @@ func GetProductsByCategory(ctx context.Context, repo repositories.ProductReposit
 		"total", total,
 		"returned", len(products),
 		"page", page,
+		"keyset", pageToken != "",
 	)
 
-	return products, total, nil
+	nextPageToken, err := nextProductPageToken(productPageScope(category), products, hasMore)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return products, total, nextPageToken, nil
+}
+
+// findProductPage loads one page of products, by offset without a pageToken
+// and after the token's position with one. Keyset pages read one product
+// more than they return to know whether another page follows; offset pages
+// leave that to the caller, which has the total.
+func findProductPage(ctx context.Context, repo repositories.ProductRepository, category string, page, pageSize int32, pageToken string) ([]*models.Product, bool, error) {
+	if pageToken == "" {
+		// Calculate skip value: how many documents to skip
+		// Page 1: skip 0, Page 2: skip pageSize, Page 3: skip pageSize*2
+		skip := int64(page-1) * int64(pageSize)
+
+		var products []*models.Product
+		var err error
+		if category == "" {
+			products, err = repo.FindAll(ctx, skip, int64(pageSize))
+		} else {
+			products, err = repo.FindByCategory(ctx, category, skip, int64(pageSize))
+		}
+		if err != nil {
+			logger.Log.Errorw("Failed to list products", "error", err, "category", category)
+			return nil, false, status.Error(codes.Internal, "failed to list products")
+		}
+		return products, false, nil
+	}
+
+	after, err := decodeProductPageToken(pageToken, productPageScope(category))
+	if err != nil {
+		return nil, false, err
+	}
+
+	products, err := repo.FindAfter(ctx, category, after, int64(pageSize)+1)
+	if err != nil {
+		logger.Log.Errorw("Failed to list products", "error", err, "category", category)
+		return nil, false, status.Error(codes.Internal, "failed to list products")
+	}
+
+	if len(products) > int(pageSize) {
+		return products[:pageSize], true, nil
+	}
+	return products, false, nil
+}
+
+// productPageScope ties a page token to the listing it came from, so a token
+// for one category can't be used to page through another
+func productPageScope(category string) string {
+	if category == "" {
+		return "products"
+	}
+	return "products:category:" + category
+}
+
+// decodeProductPageToken returns the position a page token resumes after
+func decodeProductPageToken(pageToken, scope string) (*models.ProductPosition, error) {
+	cursor, err := pagination.DecodeToken(pageToken, scope)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, cursor.SortKey)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+	oid, err := primitive.ObjectIDFromHex(cursor.ID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+
+	return &models.ProductPosition{CreatedAt: createdAt, ID: oid}, nil
+}
+
+// nextProductPageToken returns the token for the page after products, or ""
+// when there is none
+func nextProductPageToken(scope string, products []*models.Product, hasMore bool) (string, error) {
+	if !hasMore || len(products) == 0 {
+		return "", nil
+	}
+
+	last := products[len(products)-1]
+	token, err := pagination.EncodeToken(pagination.Cursor{
+		Scope:   scope,
+		SortKey: last.CreatedAt.UTC().Format(time.RFC3339Nano),
+		ID:      last.ID.Hex(),
+	})
+	if err != nil {
+		logger.Log.Errorw("Failed to encode page token", "error", err)
+		return "", status.Error(codes.Internal, "failed to encode page token")
+	}
+	return token, nil
 }
@@ -5,14 +5,19 @@ import (
 	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/tird4d/go-microservices/product_service/logger"
 	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"github.com/tird4d/go-microservices/product_service/repositories"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestMain(m *testing.M) {
@@ -23,6 +28,11 @@ func TestMain(m *testing.M) {
 		logger.Log.Info("Error loading .env file")
 	}
 
+	// Page tokens are signed with PAGE_TOKEN_SECRET (fallback when .env is absent, e.g. in CI)
+	if os.Getenv("PAGE_TOKEN_SECRET") == "" {
+		os.Setenv("PAGE_TOKEN_SECRET", "test-page-token-secret")
+	}
+
 	os.Exit(m.Run())
 }
 
@@ -47,19 +57,27 @@ func (m *MockProductRepository) FindByID(ctx context.Context, id primitive.Objec
 	return args.Get(0).(*models.Product), args.Error(1)
 }
 
-func (m *MockProductRepository) Update(ctx context.Context, id primitive.ObjectID, updates map[string]any) (*models.Product, error) {
-	args := m.Called(ctx, id, updates)
+func (m *MockProductRepository) Update(ctx context.Context, id primitive.ObjectID, expectedVersion int64, updates map[string]any) (*models.Product, error) {
+	args := m.Called(ctx, id, expectedVersion, updates)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Product), args.Error(1)
 }
 
-func (m *MockProductRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
-	args := m.Called(ctx, id)
+func (m *MockProductRepository) Delete(ctx context.Context, id primitive.ObjectID, expectedVersion int64) error {
+	args := m.Called(ctx, id, expectedVersion)
 	return args.Error(0)
 }
 
+func (m *MockProductRepository) Search(ctx context.Context, search *models.ProductSearch) (*models.ProductSearchResult, error) {
+	args := m.Called(ctx, search)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ProductSearchResult), args.Error(1)
+}
+
 func (m *MockProductRepository) FindAll(ctx context.Context, skip, limit int64) ([]*models.Product, error) {
 	args := m.Called(ctx, skip, limit)
 	if args.Get(0) == nil {
@@ -76,6 +94,14 @@ func (m *MockProductRepository) FindByCategory(ctx context.Context, category str
 	return args.Get(0).([]*models.Product), args.Error(1)
 }
 
+func (m *MockProductRepository) FindAfter(ctx context.Context, category string, after *models.ProductPosition, limit int64) ([]*models.Product, error) {
+	args := m.Called(ctx, category, after, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Product), args.Error(1)
+}
+
 func (m *MockProductRepository) Count(ctx context.Context) (int64, error) {
 	args := m.Called(ctx)
 	return args.Get(0).(int64), args.Error(1)
@@ -86,8 +112,174 @@ func (m *MockProductRepository) CountByCategory(ctx context.Context, category st
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *MockProductRepository) ReserveStock(ctx context.Context, reservation *models.StockReservation) (*models.StockReservation, error) {
+	args := m.Called(ctx, reservation)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.StockReservation), args.Error(1)
+}
+
+func (m *MockProductRepository) ReleaseReservation(ctx context.Context, id string, toStatus string) (*models.StockReservation, error) {
+	args := m.Called(ctx, id, toStatus)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.StockReservation), args.Error(1)
+}
+
+func (m *MockProductRepository) CommitReservation(ctx context.Context, id string) (*models.StockReservation, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.StockReservation), args.Error(1)
+}
+
+func (m *MockProductRepository) ExtendReservation(ctx context.Context, id string, expiresAt time.Time) (*models.StockReservation, error) {
+	args := m.Called(ctx, id, expiresAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.StockReservation), args.Error(1)
+}
+
+func (m *MockProductRepository) FindReservation(ctx context.Context, id string) (*models.StockReservation, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.StockReservation), args.Error(1)
+}
+
+func (m *MockProductRepository) FindExpiredReservations(ctx context.Context, now time.Time, limit int64) ([]*models.StockReservation, error) {
+	args := m.Called(ctx, now, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.StockReservation), args.Error(1)
+}
+
+func (m *MockProductRepository) AdjustStock(ctx context.Context, id primitive.ObjectID, sku string, delta int32, reason string) (*models.Product, error) {
+	args := m.Called(ctx, id, sku, delta, reason)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Product), args.Error(1)
+}
+
+func (m *MockProductRepository) CreateVariant(ctx context.Context, variant *models.Variant) (*models.Variant, error) {
+	args := m.Called(ctx, variant)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Variant), args.Error(1)
+}
+
+func (m *MockProductRepository) FindVariant(ctx context.Context, id primitive.ObjectID) (*models.Variant, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Variant), args.Error(1)
+}
+
+func (m *MockProductRepository) FindVariantBySKU(ctx context.Context, sku string) (*models.Variant, error) {
+	args := m.Called(ctx, sku)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Variant), args.Error(1)
+}
+
+func (m *MockProductRepository) FindVariants(ctx context.Context, productID primitive.ObjectID) ([]*models.Variant, error) {
+	args := m.Called(ctx, productID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Variant), args.Error(1)
+}
+
+func (m *MockProductRepository) UpdateVariant(ctx context.Context, id primitive.ObjectID, updates map[string]any) (*models.Variant, error) {
+	args := m.Called(ctx, id, updates)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Variant), args.Error(1)
+}
+
+func (m *MockProductRepository) DeleteVariant(ctx context.Context, id primitive.ObjectID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockProductRepository) CreateCategory(ctx context.Context, category *models.Category) (*models.Category, error) {
+	args := m.Called(ctx, category)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Category), args.Error(1)
+}
+
+func (m *MockProductRepository) FindCategory(ctx context.Context, id primitive.ObjectID) (*models.Category, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Category), args.Error(1)
+}
+
+func (m *MockProductRepository) FindCategoryBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	args := m.Called(ctx, slug)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Category), args.Error(1)
+}
+
+func (m *MockProductRepository) FindCategories(ctx context.Context) ([]*models.Category, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Category), args.Error(1)
+}
+
+func (m *MockProductRepository) CountProductsPerCategory(ctx context.Context) (map[string]int64, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+
+func (m *MockProductRepository) UpdateCategory(ctx context.Context, id primitive.ObjectID, updates map[string]any) (*models.Category, error) {
+	args := m.Called(ctx, id, updates)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Category), args.Error(1)
+}
+
+func (m *MockProductRepository) DeleteCategory(ctx context.Context, id primitive.ObjectID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockProductRepository) MergeCategory(ctx context.Context, sourceID, targetID primitive.ObjectID) (*models.Category, error) {
+	args := m.Called(ctx, sourceID, targetID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Category), args.Error(1)
+}
+
 // --- CREATE PRODUCT TESTS ---
 
+func eur(amount int64) money.Money {
+	return money.New(amount, "EUR")
+}
+
 func TestCreateProduct_Success(t *testing.T) {
 	ctx := context.Background()
 	mockRepo := new(MockProductRepository)
@@ -96,17 +288,18 @@ func TestCreateProduct_Success(t *testing.T) {
 		ID:          primitive.NewObjectID(),
 		Name:        "Test Laptop",
 		Description: "High-performance laptop",
-		Price:       1299.99,
+		Price:       eur(129999),
 		Category:    "electronics",
 		Stock:       10,
 		ImageURL:    "https://example.com/laptop.jpg",
 	}
 
+	mockRepo.On("FindCategoryBySlug", ctx, "electronics").Return(&models.Category{Slug: "electronics"}, nil)
 	mockRepo.On("Create", mock.MatchedBy(func(p *models.Product) bool {
-		return p.Name == "Test Laptop" && p.Price == 1299.99
+		return p.Name == "Test Laptop" && p.Price == eur(129999)
 	})).Return(product, nil)
 
-	result, err := CreateProduct(ctx, mockRepo, "Test Laptop", "High-performance laptop", "electronics", "https://example.com/laptop.jpg", 1299.99, 10)
+	result, err := CreateProduct(ctx, mockRepo, "Test Laptop", "High-performance laptop", "electronics", "https://example.com/laptop.jpg", eur(129999), 10)
 
 	mockRepo.AssertExpectations(t)
 	assert.NoError(t, err)
@@ -119,15 +312,48 @@ func TestCreateProduct_Error(t *testing.T) {
 	ctx := context.Background()
 	mockRepo := new(MockProductRepository)
 
+	mockRepo.On("FindCategoryBySlug", ctx, "electronics").Return(&models.Category{Slug: "electronics"}, nil)
 	mockRepo.On("Create", mock.Anything).Return(nil, errors.New("database error"))
 
-	result, err := CreateProduct(ctx, mockRepo, "Test Laptop", "High-performance laptop", "electronics", "https://example.com/laptop.jpg", 1299.99, 10)
+	result, err := CreateProduct(ctx, mockRepo, "Test Laptop", "High-performance laptop", "electronics", "https://example.com/laptop.jpg", eur(129999), 10)
 
 	mockRepo.AssertExpectations(t)
 	assert.Error(t, err)
 	assert.Nil(t, result)
 }
 
+func TestCreateProduct_NormalizesCurrency(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("FindCategoryBySlug", ctx, "books").Return(&models.Category{Slug: "books"}, nil)
+	mockRepo.On("Create", mock.MatchedBy(func(p *models.Product) bool {
+		return p.Price == money.New(4500, "GBP")
+	})).Return(&models.Product{Name: "Book"}, nil)
+
+	_, err := CreateProduct(ctx, mockRepo, "Book", "", "books", "", money.New(4500, " gbp"), 1)
+	assert.NoError(t, err)
+
+	_, err = CreateProduct(ctx, mockRepo, "Book", "", "books", "", money.New(4500, "XYZ"), 1)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = CreateProduct(ctx, mockRepo, "Book", "", "books", "", money.New(-1, "GBP"), 1)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	mockRepo.AssertNumberOfCalls(t, "Create", 1)
+}
+
+func TestCreateProduct_UnknownCategory(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("FindCategoryBySlug", ctx, "electronic").Return(nil, mongo.ErrNoDocuments)
+
+	_, err := CreateProduct(ctx, mockRepo, "Test Laptop", "", " Electronic ", "", eur(129999), 10)
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
 // --- GET PRODUCT BY ID TESTS ---
 
 func TestGetProductByID_Success(t *testing.T) {
@@ -138,7 +364,7 @@ func TestGetProductByID_Success(t *testing.T) {
 	product := &models.Product{
 		ID:       id,
 		Name:     "Test Laptop",
-		Price:    1299.99,
+		Price:    eur(129999),
 		Stock:    10,
 		Category: "electronics",
 	}
@@ -201,22 +427,32 @@ func TestUpdateProduct_Success(t *testing.T) {
 	updatedProduct := &models.Product{
 		ID:       id,
 		Name:     "Updated Laptop",
-		Price:    1399.99,
+		Price:    eur(139999),
 		Stock:    15,
 		Category: "electronics",
 	}
 
-	mockRepo.On("Update", ctx, id, mock.MatchedBy(func(updates map[string]any) bool {
-		return updates["name"] == "Updated Laptop" && updates["price"] == 1399.99
+	mockRepo.On("FindCategoryBySlug", ctx, "electronics").Return(&models.Category{Slug: "electronics"}, nil)
+	mockRepo.On("FindVariants", ctx, id).Return([]*models.Variant{}, nil)
+	mockRepo.On("Update", ctx, id, int64(0), mock.MatchedBy(func(updates map[string]any) bool {
+		return updates["name"] == "Updated Laptop" && updates["price"] == eur(139999)
 	})).Return(updatedProduct, nil)
 
-	result, err := UpdateProduct(ctx, mockRepo, id.Hex(), "Updated Laptop", "High-performance laptop", "electronics", "https://example.com/laptop.jpg", 1399.99, 15)
+	changes := &models.Product{
+		Name:        "Updated Laptop",
+		Description: "High-performance laptop",
+		Category:    "electronics",
+		ImageURL:    "https://example.com/laptop.jpg",
+		Price:       eur(139999),
+		Stock:       15,
+	}
+	result, err := UpdateProduct(ctx, mockRepo, id.Hex(), changes, nil, 0)
 
 	mockRepo.AssertExpectations(t)
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, "Updated Laptop", result.Name)
-	assert.Equal(t, 1399.99, result.Price)
+	assert.Equal(t, eur(139999), result.Price)
 }
 
 func TestUpdateProduct_NotFound(t *testing.T) {
@@ -224,9 +460,9 @@ func TestUpdateProduct_NotFound(t *testing.T) {
 	mockRepo := new(MockProductRepository)
 
 	id := primitive.NewObjectID()
-	mockRepo.On("Update", ctx, id, mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	mockRepo.On("Update", ctx, id, int64(0), mock.Anything).Return(nil, mongo.ErrNoDocuments)
 
-	result, err := UpdateProduct(ctx, mockRepo, id.Hex(), "Updated Laptop", "Description", "electronics", "url", 1399.99, 15)
+	result, err := UpdateProduct(ctx, mockRepo, id.Hex(), &models.Product{Name: "Updated Laptop"}, []string{"name"}, 0)
 
 	mockRepo.AssertExpectations(t)
 	assert.Error(t, err)
@@ -237,12 +473,104 @@ func TestUpdateProduct_InvalidIDFormat(t *testing.T) {
 	ctx := context.Background()
 	mockRepo := new(MockProductRepository)
 
-	result, err := UpdateProduct(ctx, mockRepo, "invalid-id", "Updated Laptop", "Description", "electronics", "url", 1399.99, 15)
+	result, err := UpdateProduct(ctx, mockRepo, "invalid-id", &models.Product{Name: "Updated Laptop"}, []string{"name"}, 0)
 
 	assert.Error(t, err)
 	assert.Nil(t, result)
 }
 
+func TestUpdateProduct_OnlyMaskedFieldsAreSet(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("FindVariants", ctx, id).Return([]*models.Variant{}, nil)
+	mockRepo.On("Update", ctx, id, int64(0), map[string]any{"price": eur(1999), "description": ""}).
+		Return(&models.Product{ID: id, Name: "Laptop", Price: eur(1999)}, nil)
+
+	// Name is set on the request but not in the mask, so it must be left alone
+	changes := &models.Product{Name: "Ignored", Price: eur(1999)}
+	result, err := UpdateProduct(ctx, mockRepo, id.Hex(), changes, []string{"price", "description"}, 0)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, "Laptop", result.Name)
+}
+
+func TestUpdateProduct_WithoutMaskSkipsZeroFields(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("FindVariants", ctx, id).Return([]*models.Variant{}, nil)
+	mockRepo.On("Update", ctx, id, int64(0), map[string]any{"price": eur(1999)}).
+		Return(&models.Product{ID: id, Name: "Laptop", Price: eur(1999)}, nil)
+
+	_, err := UpdateProduct(ctx, mockRepo, id.Hex(), &models.Product{Price: eur(1999)}, nil, 0)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+}
+
+func TestUpdateProduct_InvalidPaths(t *testing.T) {
+	ctx := context.Background()
+	id := primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name    string
+		changes *models.Product
+		paths   []string
+	}{
+		{"unknown path", &models.Product{}, []string{"created_at"}},
+		{"empty name", &models.Product{}, []string{"name"}},
+		{"empty category", &models.Product{Category: "  "}, []string{"category"}},
+		{"zero price", &models.Product{Price: eur(0)}, []string{"price"}},
+		{"price without currency", &models.Product{Price: money.Money{Amount: 1999}}, []string{"price"}},
+		{"unknown currency", &models.Product{Price: money.New(1999, "ABC")}, []string{"price"}},
+		{"stock", &models.Product{Stock: 5}, []string{"stock"}},
+		{"nothing to update", &models.Product{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockProductRepository)
+
+			_, err := UpdateProduct(ctx, mockRepo, id, tt.changes, tt.paths, 0)
+
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestUpdateProduct_VersionMismatchIsAborted(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("FindVariants", ctx, id).Return([]*models.Variant{}, nil)
+	mockRepo.On("Update", ctx, id, int64(3), map[string]any{"price": eur(1999)}).Return(nil, repositories.ErrVersionMismatch)
+
+	_, err := UpdateProduct(ctx, mockRepo, id.Hex(), &models.Product{Price: eur(1999)}, []string{"price"}, 3)
+
+	mockRepo.AssertExpectations(t)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+}
+
+func TestUpdateProduct_CurrencyChangeWithVariantPrices(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	id := primitive.NewObjectID()
+	override := eur(2499)
+	mockRepo.On("FindVariants", ctx, id).Return([]*models.Variant{{SKU: "SHIRT-XL", Price: &override}}, nil)
+
+	_, err := UpdateProduct(ctx, mockRepo, id.Hex(), &models.Product{Price: money.New(1999, "usd")}, []string{"price"}, 0)
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 // --- DELETE PRODUCT TESTS ---
 
 func TestDeleteProduct_Success(t *testing.T) {
@@ -250,9 +578,9 @@ func TestDeleteProduct_Success(t *testing.T) {
 	mockRepo := new(MockProductRepository)
 
 	id := primitive.NewObjectID()
-	mockRepo.On("Delete", ctx, id).Return(nil)
+	mockRepo.On("Delete", ctx, id, int64(0)).Return(nil)
 
-	err := DeleteProduct(ctx, mockRepo, id.Hex())
+	err := DeleteProduct(ctx, mockRepo, id.Hex(), 0)
 
 	mockRepo.AssertExpectations(t)
 	assert.NoError(t, err)
@@ -263,9 +591,9 @@ func TestDeleteProduct_NotFound(t *testing.T) {
 	mockRepo := new(MockProductRepository)
 
 	id := primitive.NewObjectID()
-	mockRepo.On("Delete", ctx, id).Return(mongo.ErrNoDocuments)
+	mockRepo.On("Delete", ctx, id, int64(0)).Return(mongo.ErrNoDocuments)
 
-	err := DeleteProduct(ctx, mockRepo, id.Hex())
+	err := DeleteProduct(ctx, mockRepo, id.Hex(), 0)
 
 	mockRepo.AssertExpectations(t)
 	assert.Error(t, err)
@@ -275,7 +603,7 @@ func TestDeleteProduct_InvalidIDFormat(t *testing.T) {
 	ctx := context.Background()
 	mockRepo := new(MockProductRepository)
 
-	err := DeleteProduct(ctx, mockRepo, "invalid-id")
+	err := DeleteProduct(ctx, mockRepo, "invalid-id", 0)
 
 	assert.Error(t, err)
 }
@@ -290,19 +618,19 @@ func TestListProducts_Success(t *testing.T) {
 		{
 			ID:    primitive.NewObjectID(),
 			Name:  "Laptop",
-			Price: 1299.99,
+			Price: eur(129999),
 		},
 		{
 			ID:    primitive.NewObjectID(),
 			Name:  "Mouse",
-			Price: 29.99,
+			Price: eur(2999),
 		},
 	}
 
 	mockRepo.On("FindAll", ctx, int64(0), int64(10)).Return(products, nil)
 	mockRepo.On("Count", ctx).Return(int64(2), nil)
 
-	result, total, err := ListProducts(ctx, mockRepo, 1, 10)
+	result, total, _, err := ListProducts(ctx, mockRepo, 1, 10, "")
 
 	mockRepo.AssertExpectations(t)
 	assert.NoError(t, err)
@@ -319,14 +647,14 @@ func TestListProducts_Page2(t *testing.T) {
 		{
 			ID:    primitive.NewObjectID(),
 			Name:  "Item3",
-			Price: 99.99,
+			Price: eur(9999),
 		},
 	}
 
 	mockRepo.On("FindAll", ctx, int64(10), int64(10)).Return(products, nil)
 	mockRepo.On("Count", ctx).Return(int64(11), nil)
 
-	result, total, err := ListProducts(ctx, mockRepo, 2, 10)
+	result, total, _, err := ListProducts(ctx, mockRepo, 2, 10, "")
 
 	mockRepo.AssertExpectations(t)
 	assert.NoError(t, err)
@@ -341,7 +669,7 @@ func TestListProducts_Empty(t *testing.T) {
 	mockRepo.On("FindAll", ctx, int64(0), int64(10)).Return([]*models.Product{}, nil)
 	mockRepo.On("Count", ctx).Return(int64(0), nil)
 
-	result, total, err := ListProducts(ctx, mockRepo, 1, 10)
+	result, total, _, err := ListProducts(ctx, mockRepo, 1, 10, "")
 
 	mockRepo.AssertExpectations(t)
 	assert.NoError(t, err)
@@ -355,7 +683,7 @@ func TestListProducts_DatabaseError(t *testing.T) {
 
 	mockRepo.On("FindAll", ctx, int64(0), int64(10)).Return(nil, errors.New("database error"))
 
-	result, total, err := ListProducts(ctx, mockRepo, 1, 10)
+	result, total, _, err := ListProducts(ctx, mockRepo, 1, 10, "")
 
 	mockRepo.AssertExpectations(t)
 	assert.Error(t, err)
@@ -363,6 +691,56 @@ func TestListProducts_DatabaseError(t *testing.T) {
 	assert.Equal(t, int64(0), total)
 }
 
+func TestListProducts_PageTokenContinuesAfterLastProduct(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 123000000, time.UTC)
+	products := make([]*models.Product, 5)
+	for i := range products {
+		products[i] = &models.Product{ID: primitive.NewObjectID(), Name: "Item", CreatedAt: createdAt}
+	}
+
+	mockRepo.On("FindAll", ctx, int64(0), int64(2)).Return(products[:2], nil)
+	mockRepo.On("Count", ctx).Return(int64(5), nil)
+
+	_, _, token, err := ListProducts(ctx, mockRepo, 1, 2, "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	// Products created in the same millisecond are ordered by ID
+	after := &models.ProductPosition{CreatedAt: createdAt, ID: products[1].ID}
+	mockRepo.On("FindAfter", ctx, "", after, int64(3)).Return(products[2:], nil)
+
+	result, total, token, err := ListProducts(ctx, mockRepo, 7, 2, token)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, products[2:4], result)
+	assert.Equal(t, int64(5), total)
+	assert.NotEmpty(t, token)
+
+	after = &models.ProductPosition{CreatedAt: createdAt, ID: products[3].ID}
+	mockRepo.On("FindAfter", ctx, "", after, int64(3)).Return(products[4:], nil)
+
+	result, _, token, err = ListProducts(ctx, mockRepo, 1, 2, token)
+
+	assert.NoError(t, err)
+	assert.Equal(t, products[4:], result)
+	assert.Empty(t, token, "last page has no next token")
+}
+
+func TestListProducts_InvalidPageToken(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	result, _, _, err := ListProducts(ctx, mockRepo, 1, 10, "not-a-token")
+
+	mockRepo.AssertNotCalled(t, "FindAfter")
+	assert.Nil(t, result)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
 // --- GET PRODUCTS BY CATEGORY TESTS (with pagination) ---
 
 func TestGetProductsByCategory_Success(t *testing.T) {
@@ -375,20 +753,20 @@ func TestGetProductsByCategory_Success(t *testing.T) {
 			ID:       primitive.NewObjectID(),
 			Name:     "Laptop",
 			Category: "electronics",
-			Price:    1299.99,
+			Price:    eur(129999),
 		},
 		{
 			ID:       primitive.NewObjectID(),
 			Name:     "Mouse",
 			Category: "electronics",
-			Price:    29.99,
+			Price:    eur(2999),
 		},
 	}
 
 	mockRepo.On("FindByCategory", ctx, category, int64(0), int64(10)).Return(products, nil)
 	mockRepo.On("CountByCategory", ctx, category).Return(int64(2), nil)
 
-	result, total, err := GetProductsByCategory(ctx, mockRepo, category, 1, 10)
+	result, total, _, err := GetProductsByCategory(ctx, mockRepo, category, 1, 10, "")
 
 	mockRepo.AssertExpectations(t)
 	assert.NoError(t, err)
@@ -406,7 +784,7 @@ func TestGetProductsByCategory_Empty(t *testing.T) {
 	mockRepo.On("FindByCategory", ctx, category, int64(0), int64(10)).Return([]*models.Product{}, nil)
 	mockRepo.On("CountByCategory", ctx, category).Return(int64(0), nil)
 
-	result, total, err := GetProductsByCategory(ctx, mockRepo, category, 1, 10)
+	result, total, _, err := GetProductsByCategory(ctx, mockRepo, category, 1, 10, "")
 
 	mockRepo.AssertExpectations(t)
 	assert.NoError(t, err)
@@ -421,10 +799,28 @@ func TestGetProductsByCategory_DatabaseError(t *testing.T) {
 	category := "electronics"
 	mockRepo.On("FindByCategory", ctx, category, int64(0), int64(10)).Return(nil, errors.New("database error"))
 
-	result, total, err := GetProductsByCategory(ctx, mockRepo, category, 1, 10)
+	result, total, _, err := GetProductsByCategory(ctx, mockRepo, category, 1, 10, "")
 
 	mockRepo.AssertExpectations(t)
 	assert.Error(t, err)
 	assert.Nil(t, result)
 	assert.Equal(t, int64(0), total)
 }
+
+func TestGetProductsByCategory_RejectsTokenFromAnotherCategory(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	products := []*models.Product{{ID: primitive.NewObjectID(), Category: "books", CreatedAt: time.Now()}}
+	mockRepo.On("FindByCategory", ctx, "books", int64(0), int64(1)).Return(products, nil)
+	mockRepo.On("CountByCategory", ctx, "books").Return(int64(3), nil)
+
+	_, _, token, err := GetProductsByCategory(ctx, mockRepo, "books", 1, 1, "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	_, _, _, err = GetProductsByCategory(ctx, mockRepo, "electronics", 1, 1, token)
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	mockRepo.AssertNotCalled(t, "FindAfter")
+}
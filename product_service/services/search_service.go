@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"github.com/tird4d/go-microservices/product_service/logger"
+	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"github.com/tird4d/go-microservices/product_service/repositories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxSearchQueryLength = 200
+	maxSearchCategories  = 20
+)
+
+// SearchProducts validates a search, fills in its defaults and returns one
+// page of matches with facet counts. Without a sort order, searches with a
+// query are ordered by relevance and others by newest first.
+func SearchProducts(ctx context.Context, repo repositories.ProductRepository, search *models.ProductSearch, page, pageSize int32) (*models.ProductSearchResult, error) {
+	search.Query = strings.TrimSpace(search.Query)
+	if len(search.Query) > maxSearchQueryLength {
+		return nil, status.Errorf(codes.InvalidArgument, "query is longer than %d characters", maxSearchQueryLength)
+	}
+
+	categories := make([]string, 0, len(search.Categories))
+	for _, category := range search.Categories {
+		if category = strings.TrimSpace(category); category != "" {
+			categories = append(categories, category)
+		}
+	}
+	if len(categories) > maxSearchCategories {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d categories can be searched", maxSearchCategories)
+	}
+	search.Categories = categories
+
+	if err := searchCurrency(search); err != nil {
+		return nil, err
+	}
+
+	switch search.Sort {
+	case "":
+		search.Sort = models.SortCreatedAtDesc
+		if search.Query != "" {
+			search.Sort = models.SortRelevance
+		}
+	case models.SortRelevance:
+		if search.Query == "" {
+			return nil, status.Error(codes.InvalidArgument, "relevance sort needs a query")
+		}
+	case models.SortPriceAsc, models.SortPriceDesc, models.SortCreatedAtAsc, models.SortCreatedAtDesc:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown sort %q", search.Sort)
+	}
+
+	// Same pagination defaults as ListProducts
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+	search.Skip = int64((page - 1) * pageSize)
+	search.Limit = int64(pageSize)
+
+	result, err := repo.Search(ctx, search)
+	if err != nil {
+		logger.Log.Errorw("Failed to search products", "error", err)
+		return nil, status.Error(codes.Internal, "failed to search products")
+	}
+
+	logger.Log.Infow("Products searched successfully",
+		"query", search.Query,
+		"total", result.Total,
+		"returned", len(result.Products),
+		"page", page,
+	)
+
+	return result, nil
+}
+
+// searchCurrency settles the one currency prices are compared in: that of
+// the price bounds, else the requested one, else the default. Bounds in
+// different currencies can't be compared.
+func searchCurrency(search *models.ProductSearch) error {
+	currency := money.NormalizeCurrency(search.Currency)
+	bounds := []*money.Money{search.MinPrice, search.MaxPrice}
+	for _, bound := range bounds {
+		if bound == nil || bound.Currency == "" {
+			continue
+		}
+		boundCurrency := money.NormalizeCurrency(bound.Currency)
+		if currency != "" && boundCurrency != currency {
+			return status.Error(codes.InvalidArgument, "min_price, max_price and currency must be in one currency")
+		}
+		currency = boundCurrency
+	}
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	if err := money.ValidateCurrency(currency); err != nil {
+		return status.Errorf(codes.InvalidArgument, "currency: %v", err)
+	}
+
+	for _, bound := range bounds {
+		if bound == nil {
+			continue
+		}
+		if bound.Amount < 0 {
+			return status.Error(codes.InvalidArgument, "prices cannot be negative")
+		}
+		bound.Currency = currency
+	}
+	if search.MinPrice != nil && search.MaxPrice != nil && search.MaxPrice.Amount < search.MinPrice.Amount {
+		return status.Error(codes.InvalidArgument, "max_price is below min_price")
+	}
+
+	search.Currency = currency
+	return nil
+}
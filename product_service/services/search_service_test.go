@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSearchProducts_AppliesDefaults(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("Search", ctx, mock.MatchedBy(func(search *models.ProductSearch) bool {
+		return search.Query == "laptop" &&
+			search.Sort == models.SortRelevance &&
+			assert.ObjectsAreEqual([]string{"electronics"}, search.Categories) &&
+			search.Skip == 10 && search.Limit == 10
+	})).Return(&models.ProductSearchResult{Total: 11}, nil)
+
+	search := &models.ProductSearch{Query: "  laptop ", Categories: []string{"electronics", " "}}
+	result, err := SearchProducts(ctx, mockRepo, search, 2, 0)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), result.Total)
+}
+
+func TestSearchProducts_WithoutQuerySortsByNewest(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("Search", ctx, mock.MatchedBy(func(search *models.ProductSearch) bool {
+		return search.Sort == models.SortCreatedAtDesc && search.Skip == 0
+	})).Return(&models.ProductSearchResult{}, nil)
+
+	_, err := SearchProducts(ctx, mockRepo, &models.ProductSearch{InStockOnly: true}, 0, 20)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+}
+
+func TestSearchProducts_SettlesCurrency(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("Search", ctx, mock.Anything).Return(&models.ProductSearchResult{}, nil)
+
+	search := &models.ProductSearch{}
+	_, err := SearchProducts(ctx, mockRepo, search, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, money.DefaultCurrency, search.Currency)
+
+	// A bound without a currency takes the one of the other bound
+	search = &models.ProductSearch{MinPrice: &money.Money{Amount: 1000}, MaxPrice: &money.Money{Amount: 5000, Currency: "usd"}}
+	_, err = SearchProducts(ctx, mockRepo, search, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "USD", search.Currency)
+	assert.Equal(t, money.New(1000, "USD"), *search.MinPrice)
+}
+
+func TestSearchProducts_InvalidSearches(t *testing.T) {
+	tests := []struct {
+		name   string
+		search models.ProductSearch
+	}{
+		{"negative price", models.ProductSearch{MinPrice: &money.Money{Amount: -1}}},
+		{"max below min", models.ProductSearch{MinPrice: &money.Money{Amount: 5000}, MaxPrice: &money.Money{Amount: 1000}}},
+		{"mixed currencies", models.ProductSearch{MinPrice: &money.Money{Amount: 1000, Currency: "EUR"}, MaxPrice: &money.Money{Amount: 5000, Currency: "USD"}}},
+		{"unknown currency", models.ProductSearch{Currency: "ABC"}},
+		{"unknown sort", models.ProductSearch{Sort: "popularity"}},
+		{"relevance without query", models.ProductSearch{Sort: models.SortRelevance}},
+		{"query too long", models.ProductSearch{Query: strings.Repeat("a", maxSearchQueryLength+1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockProductRepository)
+
+			_, err := SearchProducts(context.Background(), mockRepo, &tt.search, 1, 10)
+
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			mockRepo.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestSearchProducts_StoreError(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	mockRepo.On("Search", ctx, mock.Anything).Return(nil, errors.New("text index required"))
+
+	_, err := SearchProducts(ctx, mockRepo, &models.ProductSearch{Query: "laptop"}, 1, 10)
+
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
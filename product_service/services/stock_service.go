@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tird4d/go-microservices/product_service/logger"
+	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultReservationTTL is used when a caller doesn't ask for a TTL
+	DefaultReservationTTL = 15 * time.Minute
+	// MaxReservationTTL caps how long stock can be held without a commit
+	MaxReservationTTL = 24 * time.Hour
+
+	maxReservationIDLength = 128
+	reaperBatchSize        = 100
+)
+
+// StockLine is one product, or one variant of it when SKU is set, and
+// quantity of a reservation request
+type StockLine struct {
+	ProductID string
+	SKU       string
+	Quantity  int32
+}
+
+// ReserveStock takes the stock for all lines or fails without changing
+// anything. Reserving again with the same ID returns the existing reservation
+// while it's still open, so callers can retry safely.
+func ReserveStock(ctx context.Context, repo repositories.ProductRepository, reservationID string, lines []StockLine, ttl time.Duration) (*models.StockReservation, error) {
+	if reservationID == "" || len(reservationID) > maxReservationIDLength {
+		return nil, status.Error(codes.InvalidArgument, "reservation ID is required and must be at most 128 characters")
+	}
+	if len(lines) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one line is required")
+	}
+	if ttl < 0 || ttl > MaxReservationTTL {
+		return nil, status.Errorf(codes.InvalidArgument, "reservation TTL must be at most %s", MaxReservationTTL)
+	}
+	if ttl == 0 {
+		ttl = DefaultReservationTTL
+	}
+
+	// Merge lines of the same product and SKU so each is decremented once
+	type lineKey struct {
+		productID primitive.ObjectID
+		sku       string
+	}
+	var reservationLines []models.ReservationLine
+	index := make(map[lineKey]int)
+	for _, line := range lines {
+		oid, err := primitive.ObjectIDFromHex(line.ProductID)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid product ID format: %q", line.ProductID)
+		}
+		if line.Quantity <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "quantity for product %s must be positive", line.ProductID)
+		}
+		key := lineKey{productID: oid, sku: line.SKU}
+		if i, ok := index[key]; ok {
+			reservationLines[i].Quantity += line.Quantity
+			continue
+		}
+		index[key] = len(reservationLines)
+		reservationLines = append(reservationLines, models.ReservationLine{ProductID: oid, SKU: line.SKU, Quantity: line.Quantity})
+	}
+
+	now := time.Now()
+	reservation := &models.StockReservation{
+		ID:        reservationID,
+		Lines:     reservationLines,
+		Status:    models.ReservationReserved,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	created, err := repo.ReserveStock(ctx, reservation)
+	switch {
+	case err == nil:
+		logger.Log.Infow("📦 Stock reserved", "reservation_id", reservationID, "lines", len(reservationLines))
+		return created, nil
+	case errors.Is(err, repositories.ErrReservationExists):
+		return existingReservation(ctx, repo, reservationID)
+	case errors.Is(err, repositories.ErrInsufficientStock):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, status.Error(codes.NotFound, err.Error())
+	default:
+		logger.Log.Errorw("Failed to reserve stock", "reservation_id", reservationID, "error", err)
+		return nil, status.Error(codes.Internal, "failed to reserve stock")
+	}
+}
+
+// existingReservation answers a retried ReserveStock. Only a still open
+// reservation counts as success; a settled one can't be reused.
+func existingReservation(ctx context.Context, repo repositories.ProductRepository, id string) (*models.StockReservation, error) {
+	reservation, err := repo.FindReservation(ctx, id)
+	if err != nil {
+		logger.Log.Errorw("Failed to load existing reservation", "reservation_id", id, "error", err)
+		return nil, status.Error(codes.Internal, "failed to reserve stock")
+	}
+	if reservation.Status != models.ReservationReserved {
+		return nil, status.Errorf(codes.AlreadyExists, "reservation %s is already %s", id, reservation.Status)
+	}
+	return reservation, nil
+}
+
+// ReleaseReservation gives the reserved stock back. Releasing a reservation
+// that's already released or expired is a no-op; a committed one can't be released.
+func ReleaseReservation(ctx context.Context, repo repositories.ProductRepository, id string) (*models.StockReservation, error) {
+	return settleReservation(ctx, repo, id, models.ReservationReleased,
+		func(id string) (*models.StockReservation, error) {
+			return repo.ReleaseReservation(ctx, id, models.ReservationReleased)
+		},
+		models.ReservationReleased, models.ReservationExpired)
+}
+
+// CommitReservation makes the reservation final. Committing twice is a no-op;
+// a released or expired reservation can't be committed.
+func CommitReservation(ctx context.Context, repo repositories.ProductRepository, id string) (*models.StockReservation, error) {
+	return settleReservation(ctx, repo, id, models.ReservationCommitted,
+		func(id string) (*models.StockReservation, error) {
+			return repo.CommitReservation(ctx, id)
+		},
+		models.ReservationCommitted)
+}
+
+// ExtendReservation holds an open reservation's stock for at least ttl from
+// now. A reservation that expired, even if the reaper hasn't released it
+// yet, or was settled can't be extended.
+func ExtendReservation(ctx context.Context, repo repositories.ProductRepository, id string, ttl time.Duration) (*models.StockReservation, error) {
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "reservation ID is required")
+	}
+	if ttl <= 0 || ttl > MaxReservationTTL {
+		return nil, status.Errorf(codes.InvalidArgument, "reservation TTL must be positive and at most %s", MaxReservationTTL)
+	}
+
+	reservation, err := repo.ExtendReservation(ctx, id, time.Now().Add(ttl))
+	switch {
+	case err == nil:
+		logger.Log.Infow("📦 Reservation extended", "reservation_id", id, "expires_at", reservation.ExpiresAt)
+		return reservation, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, status.Error(codes.NotFound, "reservation not found")
+	case errors.Is(err, repositories.ErrReservationClosed):
+		return nil, status.Error(codes.FailedPrecondition, "reservation is no longer open")
+	default:
+		logger.Log.Errorw("Failed to extend reservation", "reservation_id", id, "error", err)
+		return nil, status.Error(codes.Internal, "failed to extend reservation")
+	}
+}
+
+func settleReservation(ctx context.Context, repo repositories.ProductRepository, id, action string, settle func(string) (*models.StockReservation, error), doneStatuses ...string) (*models.StockReservation, error) {
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "reservation ID is required")
+	}
+
+	reservation, err := settle(id)
+	if err == nil {
+		logger.Log.Infow("📦 Reservation settled", "reservation_id", id, "status", reservation.Status)
+		return reservation, nil
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, status.Error(codes.NotFound, "reservation not found")
+	}
+	if !errors.Is(err, repositories.ErrReservationClosed) {
+		logger.Log.Errorw("Failed to settle reservation", "reservation_id", id, "status", action, "error", err)
+		return nil, status.Error(codes.Internal, "failed to update reservation")
+	}
+
+	reservation, err = repo.FindReservation(ctx, id)
+	if err != nil {
+		logger.Log.Errorw("Failed to load reservation", "reservation_id", id, "error", err)
+		return nil, status.Error(codes.Internal, "failed to update reservation")
+	}
+	for _, done := range doneStatuses {
+		if reservation.Status == done {
+			return reservation, nil
+		}
+	}
+	return nil, status.Errorf(codes.FailedPrecondition, "reservation is %s", reservation.Status)
+}
+
+// AdjustStock adds delta to a product's stock, or to the stock of its variant
+// sku, e.g. for restocking or write-offs. The reason is kept in the stock
+// ledger.
+func AdjustStock(ctx context.Context, repo repositories.ProductRepository, productID, sku string, delta int32, reason string) (*models.Product, error) {
+	oid, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid product ID format")
+	}
+	if delta == 0 {
+		return nil, status.Error(codes.InvalidArgument, "delta must not be zero")
+	}
+	if reason == "" {
+		return nil, status.Error(codes.InvalidArgument, "reason is required")
+	}
+
+	product, err := repo.AdjustStock(ctx, oid, sku, delta, reason)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) && sku != "" {
+			return nil, status.Error(codes.NotFound, "variant not found")
+		}
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, status.Error(codes.NotFound, "product not found")
+		}
+		if errors.Is(err, repositories.ErrInsufficientStock) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		logger.Log.Errorw("Failed to adjust stock", "id", productID, "error", err)
+		return nil, status.Error(codes.Internal, "failed to adjust stock")
+	}
+
+	logger.Log.Infow("📦 Stock adjusted", "id", productID, "sku", sku, "delta", delta, "reason", reason)
+	return product, nil
+}
+
+// ExpireReservations releases open reservations whose TTL has passed and
+// returns how many it expired
+func ExpireReservations(ctx context.Context, repo repositories.ProductRepository, now time.Time) (int, error) {
+	reservations, err := repo.FindExpiredReservations(ctx, now, reaperBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, reservation := range reservations {
+		_, err := repo.ReleaseReservation(ctx, reservation.ID, models.ReservationExpired)
+		if errors.Is(err, repositories.ErrReservationClosed) {
+			// Committed or released since we looked
+			continue
+		}
+		if err != nil {
+			logger.Log.Errorw("Failed to expire reservation", "reservation_id", reservation.ID, "error", err)
+			continue
+		}
+		expired++
+	}
+
+	return expired, nil
+}
+
+// RunReservationReaper expires reservations every interval until ctx is done
+func RunReservationReaper(ctx context.Context, repo repositories.ProductRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := ExpireReservations(ctx, repo, time.Now())
+			if err != nil {
+				logger.Log.Errorw("Reservation reaper failed", "error", err)
+				continue
+			}
+			if expired > 0 {
+				logger.Log.Infow("⏰ Expired stock reservations", "count", expired)
+			}
+		}
+	}
+}
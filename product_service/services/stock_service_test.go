@@ -0,0 +1,337 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// --- RESERVE STOCK TESTS ---
+
+func TestReserveStock_MergesLinesAndAppliesDefaultTTL(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	laptop := primitive.NewObjectID()
+	mouse := primitive.NewObjectID()
+
+	mockRepo.On("ReserveStock", ctx, mock.MatchedBy(func(r *models.StockReservation) bool {
+		ttl := r.ExpiresAt.Sub(r.CreatedAt)
+		return r.ID == "checkout-1" &&
+			r.Status == models.ReservationReserved &&
+			len(r.Lines) == 2 &&
+			r.Lines[0].ProductID == laptop && r.Lines[0].Quantity == 3 &&
+			r.Lines[1].ProductID == mouse && r.Lines[1].Quantity == 1 &&
+			ttl == DefaultReservationTTL
+	})).Return(&models.StockReservation{ID: "checkout-1", Status: models.ReservationReserved}, nil)
+
+	result, err := ReserveStock(ctx, mockRepo, "checkout-1", []StockLine{
+		{ProductID: laptop.Hex(), Quantity: 1},
+		{ProductID: mouse.Hex(), Quantity: 1},
+		{ProductID: laptop.Hex(), Quantity: 2},
+	}, 0)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, "checkout-1", result.ID)
+}
+
+func TestReserveStock_KeepsSKUsApart(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	shirt := primitive.NewObjectID()
+
+	mockRepo.On("ReserveStock", ctx, mock.MatchedBy(func(r *models.StockReservation) bool {
+		return len(r.Lines) == 2 &&
+			r.Lines[0].ProductID == shirt && r.Lines[0].SKU == "SHIRT-M" && r.Lines[0].Quantity == 2 &&
+			r.Lines[1].ProductID == shirt && r.Lines[1].SKU == "SHIRT-L" && r.Lines[1].Quantity == 1
+	})).Return(&models.StockReservation{ID: "checkout-1", Status: models.ReservationReserved}, nil)
+
+	_, err := ReserveStock(ctx, mockRepo, "checkout-1", []StockLine{
+		{ProductID: shirt.Hex(), SKU: "SHIRT-M", Quantity: 1},
+		{ProductID: shirt.Hex(), SKU: "SHIRT-L", Quantity: 1},
+		{ProductID: shirt.Hex(), SKU: "SHIRT-M", Quantity: 1},
+	}, 0)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+}
+
+func TestReserveStock_InvalidInput(t *testing.T) {
+	ctx := context.Background()
+	valid := primitive.NewObjectID().Hex()
+
+	cases := map[string]struct {
+		id    string
+		lines []StockLine
+		ttl   time.Duration
+	}{
+		"missing id":    {"", []StockLine{{ProductID: valid, Quantity: 1}}, 0},
+		"no lines":      {"r1", nil, 0},
+		"bad product":   {"r1", []StockLine{{ProductID: "nope", Quantity: 1}}, 0},
+		"zero quantity": {"r1", []StockLine{{ProductID: valid, Quantity: 0}}, 0},
+		"ttl too long":  {"r1", []StockLine{{ProductID: valid, Quantity: 1}}, MaxReservationTTL + time.Second},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(MockProductRepository)
+
+			result, err := ReserveStock(ctx, mockRepo, tc.id, tc.lines, tc.ttl)
+
+			mockRepo.AssertNotCalled(t, "ReserveStock", mock.Anything, mock.Anything)
+			assert.Nil(t, result)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestReserveStock_InsufficientStock(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("ReserveStock", ctx, mock.Anything).
+		Return(nil, fmt.Errorf("product %s: %w", id.Hex(), repositories.ErrInsufficientStock))
+
+	result, err := ReserveStock(ctx, mockRepo, "r1", []StockLine{{ProductID: id.Hex(), Quantity: 5}}, time.Minute)
+
+	assert.Nil(t, result)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, err.Error(), id.Hex())
+}
+
+func TestReserveStock_RetryReturnsOpenReservation(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	existing := &models.StockReservation{ID: "r1", Status: models.ReservationReserved}
+	mockRepo.On("ReserveStock", ctx, mock.Anything).Return(nil, repositories.ErrReservationExists)
+	mockRepo.On("FindReservation", ctx, "r1").Return(existing, nil)
+
+	result, err := ReserveStock(ctx, mockRepo, "r1", []StockLine{{ProductID: primitive.NewObjectID().Hex(), Quantity: 1}}, 0)
+
+	assert.NoError(t, err)
+	assert.Same(t, existing, result)
+}
+
+func TestReserveStock_RetryOfSettledReservationFails(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("ReserveStock", ctx, mock.Anything).Return(nil, repositories.ErrReservationExists)
+	mockRepo.On("FindReservation", ctx, "r1").Return(&models.StockReservation{ID: "r1", Status: models.ReservationReleased}, nil)
+
+	result, err := ReserveStock(ctx, mockRepo, "r1", []StockLine{{ProductID: primitive.NewObjectID().Hex(), Quantity: 1}}, 0)
+
+	assert.Nil(t, result)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+// --- RELEASE / COMMIT TESTS ---
+
+func TestReleaseReservation_Success(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("ReleaseReservation", ctx, "r1", models.ReservationReleased).
+		Return(&models.StockReservation{ID: "r1", Status: models.ReservationReleased}, nil)
+
+	result, err := ReleaseReservation(ctx, mockRepo, "r1")
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReservationReleased, result.Status)
+}
+
+func TestReleaseReservation_AlreadyExpiredIsNoop(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("ReleaseReservation", ctx, "r1", models.ReservationReleased).Return(nil, repositories.ErrReservationClosed)
+	mockRepo.On("FindReservation", ctx, "r1").Return(&models.StockReservation{ID: "r1", Status: models.ReservationExpired}, nil)
+
+	result, err := ReleaseReservation(ctx, mockRepo, "r1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReservationExpired, result.Status)
+}
+
+func TestReleaseReservation_CommittedFails(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("ReleaseReservation", ctx, "r1", models.ReservationReleased).Return(nil, repositories.ErrReservationClosed)
+	mockRepo.On("FindReservation", ctx, "r1").Return(&models.StockReservation{ID: "r1", Status: models.ReservationCommitted}, nil)
+
+	result, err := ReleaseReservation(ctx, mockRepo, "r1")
+
+	assert.Nil(t, result)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestReleaseReservation_NotFound(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("ReleaseReservation", ctx, "r1", models.ReservationReleased).Return(nil, mongo.ErrNoDocuments)
+
+	_, err := ReleaseReservation(ctx, mockRepo, "r1")
+
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestCommitReservation_TwiceIsNoop(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("CommitReservation", ctx, "r1").Return(nil, repositories.ErrReservationClosed)
+	mockRepo.On("FindReservation", ctx, "r1").Return(&models.StockReservation{ID: "r1", Status: models.ReservationCommitted}, nil)
+
+	result, err := CommitReservation(ctx, mockRepo, "r1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReservationCommitted, result.Status)
+}
+
+func TestCommitReservation_ExpiredFails(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("CommitReservation", ctx, "r1").Return(nil, repositories.ErrReservationClosed)
+	mockRepo.On("FindReservation", ctx, "r1").Return(&models.StockReservation{ID: "r1", Status: models.ReservationExpired}, nil)
+
+	result, err := CommitReservation(ctx, mockRepo, "r1")
+
+	assert.Nil(t, result)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestExtendReservation_Success(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("ExtendReservation", ctx, "r1", mock.MatchedBy(func(expiresAt time.Time) bool {
+		return time.Until(expiresAt) > 23*time.Hour
+	})).Return(&models.StockReservation{ID: "r1", Status: models.ReservationReserved}, nil)
+
+	result, err := ExtendReservation(ctx, mockRepo, "r1", 24*time.Hour)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, "r1", result.ID)
+}
+
+func TestExtendReservation_ExpiredFails(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	mockRepo.On("ExtendReservation", ctx, "r1", mock.Anything).Return(nil, repositories.ErrReservationClosed)
+
+	result, err := ExtendReservation(ctx, mockRepo, "r1", time.Hour)
+
+	assert.Nil(t, result)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestExtendReservation_InvalidTTL(t *testing.T) {
+	for _, ttl := range []time.Duration{0, MaxReservationTTL + time.Second} {
+		_, err := ExtendReservation(context.Background(), new(MockProductRepository), "r1", ttl)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), ttl.String())
+	}
+}
+
+// --- ADJUST STOCK TESTS ---
+
+func TestAdjustStock_Success(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("AdjustStock", ctx, id, "", int32(-2), "damaged").Return(&models.Product{ID: id, Stock: 8}, nil)
+
+	result, err := AdjustStock(ctx, mockRepo, id.Hex(), "", -2, "damaged")
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(8), result.Stock)
+}
+
+func TestAdjustStock_Variant(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("AdjustStock", ctx, id, "SHIRT-M", int32(5), "restock").Return(&models.Product{ID: id}, nil)
+	mockRepo.On("AdjustStock", ctx, id, "SHIRT-XL", int32(5), "restock").Return(nil, fmt.Errorf("sku SHIRT-XL: %w", mongo.ErrNoDocuments))
+
+	_, err := AdjustStock(ctx, mockRepo, id.Hex(), "SHIRT-M", 5, "restock")
+	assert.NoError(t, err)
+
+	_, err = AdjustStock(ctx, mockRepo, id.Hex(), "SHIRT-XL", 5, "restock")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "variant not found", status.Convert(err).Message())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAdjustStock_Validation(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	id := primitive.NewObjectID().Hex()
+
+	_, err := AdjustStock(ctx, mockRepo, "bad", "", 1, "restock")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = AdjustStock(ctx, mockRepo, id, "", 0, "restock")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = AdjustStock(ctx, mockRepo, id, "", 1, "")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	mockRepo.AssertNotCalled(t, "AdjustStock", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAdjustStock_WouldGoNegative(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("AdjustStock", ctx, id, "", int32(-20), "recount").Return(nil, repositories.ErrInsufficientStock)
+
+	_, err := AdjustStock(ctx, mockRepo, id.Hex(), "", -20, "recount")
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+// --- EXPIRY TESTS ---
+
+func TestExpireReservations_SkipsSettledAndCountsExpired(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	now := time.Now()
+
+	mockRepo.On("FindExpiredReservations", ctx, now, int64(reaperBatchSize)).Return([]*models.StockReservation{
+		{ID: "r1"}, {ID: "r2"}, {ID: "r3"},
+	}, nil)
+	mockRepo.On("ReleaseReservation", ctx, "r1", models.ReservationExpired).Return(&models.StockReservation{ID: "r1"}, nil)
+	mockRepo.On("ReleaseReservation", ctx, "r2", models.ReservationExpired).Return(nil, repositories.ErrReservationClosed)
+	mockRepo.On("ReleaseReservation", ctx, "r3", models.ReservationExpired).Return(nil, errors.New("database error"))
+
+	expired, err := ExpireReservations(ctx, mockRepo, now)
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expired)
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/tird4d/go-microservices/product_service/logger"
+	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"github.com/tird4d/go-microservices/product_service/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxSKULength = 64
+
+// CreateVariant adds a variant to a product. The SKU must not be used by
+// any other variant, and a price override must be in the product's currency.
+func CreateVariant(ctx context.Context, repo repositories.ProductRepository, productID string, variant *models.Variant) (*models.Variant, error) {
+	oid, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid product ID format")
+	}
+
+	variant.SKU = strings.TrimSpace(variant.SKU)
+	if err := validateSKU(variant.SKU); err != nil {
+		return nil, err
+	}
+	if variant.Stock < 0 {
+		return nil, status.Error(codes.InvalidArgument, "stock cannot be negative")
+	}
+	if variant.Price != nil {
+		price, err := validateVariantPrice(ctx, repo, oid, *variant.Price)
+		if err != nil {
+			return nil, err
+		}
+		variant.Price = &price
+	}
+	variant.ProductID = oid
+
+	created, err := repo.CreateVariant(ctx, variant)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, status.Error(codes.NotFound, "product not found")
+	}
+	if err != nil {
+		return nil, variantError(err, "failed to create variant")
+	}
+
+	logger.Log.Infow("Variant created successfully", "product_id", productID, "sku", created.SKU)
+	return created, nil
+}
+
+// GetVariant looks a variant up by its ID or, when id is empty, by SKU
+func GetVariant(ctx context.Context, repo repositories.ProductRepository, id, sku string) (*models.Variant, error) {
+	var variant *models.Variant
+	var err error
+	switch {
+	case id != "":
+		oid, convErr := primitive.ObjectIDFromHex(id)
+		if convErr != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid variant ID format")
+		}
+		variant, err = repo.FindVariant(ctx, oid)
+	case sku != "":
+		variant, err = repo.FindVariantBySKU(ctx, sku)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "variant ID or SKU is required")
+	}
+	if err != nil {
+		return nil, variantError(err, "failed to retrieve variant")
+	}
+
+	return variant, nil
+}
+
+// ListVariants returns the variants of a product, oldest first
+func ListVariants(ctx context.Context, repo repositories.ProductRepository, productID string) ([]*models.Variant, error) {
+	oid, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid product ID format")
+	}
+
+	variants, err := repo.FindVariants(ctx, oid)
+	if err != nil {
+		logger.Log.Errorw("Failed to list variants", "product_id", productID, "error", err)
+		return nil, status.Error(codes.Internal, "failed to list variants")
+	}
+
+	return variants, nil
+}
+
+// UpdateVariant applies the fields named by paths from changes, the same
+// way UpdateProduct does. Without paths every non-empty field is applied.
+func UpdateVariant(ctx context.Context, repo repositories.ProductRepository, id string, changes *models.Variant, paths []string) (*models.Variant, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid variant ID format")
+	}
+
+	if len(paths) == 0 {
+		paths = populatedVariantFields(changes)
+	}
+
+	updates, err := variantUpdates(changes, paths)
+	if err != nil {
+		return nil, err
+	}
+	if price, ok := updates["price"].(money.Money); ok {
+		current, err := repo.FindVariant(ctx, oid)
+		if err != nil {
+			return nil, variantError(err, "failed to update variant")
+		}
+		if updates["price"], err = validateVariantPrice(ctx, repo, current.ProductID, price); err != nil {
+			return nil, err
+		}
+	}
+
+	variant, err := repo.UpdateVariant(ctx, oid, updates)
+	if err != nil {
+		return nil, variantError(err, "failed to update variant")
+	}
+
+	logger.Log.Infow("Variant updated successfully", "id", id, "sku", variant.SKU, "fields", paths)
+	return variant, nil
+}
+
+// DeleteVariant removes a variant. Open reservations of its SKU give
+// nothing back when released.
+func DeleteVariant(ctx context.Context, repo repositories.ProductRepository, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid variant ID format")
+	}
+
+	if err := repo.DeleteVariant(ctx, oid); err != nil {
+		return variantError(err, "failed to delete variant")
+	}
+
+	logger.Log.Infow("Variant deleted successfully", "id", id)
+	return nil
+}
+
+// variantUpdates validates each field mask path and builds the updates map
+func variantUpdates(changes *models.Variant, paths []string) (map[string]any, error) {
+	if len(paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no fields to update")
+	}
+
+	updates := make(map[string]any, len(paths))
+	for _, path := range paths {
+		switch path {
+		case "sku":
+			sku := strings.TrimSpace(changes.SKU)
+			if err := validateSKU(sku); err != nil {
+				return nil, err
+			}
+			updates["sku"] = sku
+		case "attributes":
+			updates["attributes"] = changes.Attributes
+		case "price":
+			// Without a price the override is removed
+			if changes.Price == nil {
+				updates["price"] = nil
+				continue
+			}
+			updates["price"] = *changes.Price
+		case "image_url":
+			updates["image_url"] = changes.ImageURL
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unknown update path %q", path)
+		}
+	}
+
+	return updates, nil
+}
+
+// populatedVariantFields is the implied field mask of a request without one
+func populatedVariantFields(changes *models.Variant) []string {
+	var paths []string
+	if changes.SKU != "" {
+		paths = append(paths, "sku")
+	}
+	if len(changes.Attributes) > 0 {
+		paths = append(paths, "attributes")
+	}
+	if changes.Price != nil {
+		paths = append(paths, "price")
+	}
+	if changes.ImageURL != "" {
+		paths = append(paths, "image_url")
+	}
+	return paths
+}
+
+// validateVariantPrice checks a price override: positive and in the
+// currency of the variant's product
+func validateVariantPrice(ctx context.Context, repo repositories.ProductRepository, productID primitive.ObjectID, price money.Money) (money.Money, error) {
+	price, err := validatePrice(price)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	product, err := repo.FindByID(ctx, productID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return money.Money{}, status.Error(codes.NotFound, "product not found")
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to find product of variant", "product_id", productID.Hex(), "error", err)
+		return money.Money{}, status.Error(codes.Internal, "failed to retrieve product")
+	}
+	if price.Currency != product.Price.Currency {
+		return money.Money{}, status.Errorf(codes.InvalidArgument, "price must be in the product's currency %s", product.Price.Currency)
+	}
+	return price, nil
+}
+
+func validateSKU(sku string) error {
+	if sku == "" {
+		return status.Error(codes.InvalidArgument, "sku is required")
+	}
+	if len(sku) > maxSKULength || strings.ContainsAny(sku, " \t\r\n") {
+		return status.Errorf(codes.InvalidArgument, "sku must be at most %d characters without spaces", maxSKULength)
+	}
+	return nil
+}
+
+// variantError maps repository errors of the variant operations to gRPC errors
+func variantError(err error, message string) error {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return status.Error(codes.NotFound, "variant not found")
+	case errors.Is(err, repositories.ErrDuplicateSKU):
+		return status.Error(codes.AlreadyExists, "sku already exists")
+	default:
+		logger.Log.Errorw(message, "error", err)
+		return status.Error(codes.Internal, message)
+	}
+}
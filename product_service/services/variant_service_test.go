@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/tird4d/go-microservices/product_service/models"
+	"github.com/tird4d/go-microservices/product_service/money"
+	"github.com/tird4d/go-microservices/product_service/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCreateVariant_Success(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	productID := primitive.NewObjectID()
+
+	mockRepo.On("CreateVariant", ctx, mock.MatchedBy(func(v *models.Variant) bool {
+		return v.ProductID == productID && v.SKU == "SHIRT-RED-M" && v.Attributes["size"] == "M"
+	})).Return(&models.Variant{ID: primitive.NewObjectID(), ProductID: productID, SKU: "SHIRT-RED-M"}, nil)
+
+	variant, err := CreateVariant(ctx, mockRepo, productID.Hex(), &models.Variant{
+		SKU:        "  SHIRT-RED-M ",
+		Attributes: map[string]string{"size": "M", "color": "red"},
+		Stock:      5,
+	})
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, "SHIRT-RED-M", variant.SKU)
+}
+
+func TestCreateVariant_InvalidInput(t *testing.T) {
+	ctx := context.Background()
+	productID := primitive.NewObjectID().Hex()
+
+	cases := map[string]struct {
+		productID string
+		variant   models.Variant
+	}{
+		"bad product id": {"nope", models.Variant{SKU: "A"}},
+		"missing sku":    {productID, models.Variant{SKU: "  "}},
+		"sku with space": {productID, models.Variant{SKU: "A B"}},
+		"zero price":     {productID, models.Variant{SKU: "A", Price: &money.Money{Currency: "EUR"}}},
+		"negative price": {productID, models.Variant{SKU: "A", Price: &money.Money{Amount: -1, Currency: "EUR"}}},
+		"negative stock": {productID, models.Variant{SKU: "A", Stock: -1}},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(MockProductRepository)
+			_, err := CreateVariant(ctx, mockRepo, tc.productID, &tc.variant)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			mockRepo.AssertNotCalled(t, "CreateVariant")
+		})
+	}
+}
+
+func TestCreateVariant_Errors(t *testing.T) {
+	ctx := context.Background()
+	productID := primitive.NewObjectID().Hex()
+
+	cases := map[string]struct {
+		err  error
+		code codes.Code
+	}{
+		"unknown product": {mongo.ErrNoDocuments, codes.NotFound},
+		"duplicate sku":   {repositories.ErrDuplicateSKU, codes.AlreadyExists},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(MockProductRepository)
+			mockRepo.On("CreateVariant", ctx, mock.Anything).Return(nil, tc.err)
+
+			_, err := CreateVariant(ctx, mockRepo, productID, &models.Variant{SKU: "A"})
+
+			assert.Equal(t, tc.code, status.Code(err))
+		})
+	}
+}
+
+func TestGetVariant_BySKU(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	mockRepo.On("FindVariantBySKU", ctx, "SHIRT-M").Return(&models.Variant{SKU: "SHIRT-M"}, nil)
+
+	variant, err := GetVariant(ctx, mockRepo, "", "SHIRT-M")
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, "SHIRT-M", variant.SKU)
+
+	_, err = GetVariant(ctx, mockRepo, "", "")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestUpdateVariant_AppliesMaskedFields(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	id := primitive.NewObjectID()
+
+	mockRepo.On("UpdateVariant", ctx, id, map[string]any{"price": nil, "image_url": "m.jpg"}).
+		Return(&models.Variant{ID: id, SKU: "A", ImageURL: "m.jpg"}, nil)
+
+	// Clearing the price override needs an explicit mask
+	variant, err := UpdateVariant(ctx, mockRepo, id.Hex(), &models.Variant{SKU: "ignored", ImageURL: "m.jpg"}, []string{"price", "image_url"})
+
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, "m.jpg", variant.ImageURL)
+
+	// Stock only changes through AdjustStock, which keeps the ledger
+	for _, path := range []string{"product_id", "stock"} {
+		_, err = UpdateVariant(ctx, mockRepo, id.Hex(), &models.Variant{Stock: 3}, []string{path})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestVariantPrice_MustMatchProductCurrency(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockProductRepository)
+	productID := primitive.NewObjectID()
+	variantID := primitive.NewObjectID()
+
+	mockRepo.On("FindByID", ctx, productID).Return(&models.Product{ID: productID, Price: eur(1999)}, nil)
+	mockRepo.On("FindVariant", ctx, variantID).Return(&models.Variant{ID: variantID, ProductID: productID}, nil)
+	mockRepo.On("UpdateVariant", ctx, variantID, map[string]any{"price": eur(2499)}).
+		Return(&models.Variant{ID: variantID, Price: &money.Money{Amount: 2499, Currency: "EUR"}}, nil)
+
+	_, err := CreateVariant(ctx, mockRepo, productID.Hex(), &models.Variant{SKU: "A", Price: &money.Money{Amount: 2499, Currency: "USD"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = UpdateVariant(ctx, mockRepo, variantID.Hex(), &models.Variant{Price: &money.Money{Amount: 2499, Currency: "USD"}}, nil)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	variant, err := UpdateVariant(ctx, mockRepo, variantID.Hex(), &models.Variant{Price: &money.Money{Amount: 2499, Currency: "eur"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, eur(2499), *variant.Price)
+	mockRepo.AssertNotCalled(t, "CreateVariant", mock.Anything, mock.Anything)
+}
+
+func TestVariant_EffectivePrice(t *testing.T) {
+	override := eur(2500)
+	assert.Equal(t, eur(2000), (&models.Variant{}).EffectivePrice(eur(2000)))
+	assert.Equal(t, eur(2500), (&models.Variant{Price: &override}).EffectivePrice(eur(2000)))
+}
@@ -30,7 +30,7 @@ func (s *Server) Register(ctx context.Context, req *userpb.RegisterRequest) (*us
 
 	// Register user
 	repo := &repositories.MongoUserRepository{}
-	result, err := services.RegisterUser(ctx, repo, req.GetName(), req.GetEmail(), req.GetPassword(), req.GetRole())
+	result, err := services.RegisterUser(ctx, repo, req.GetName(), req.GetEmail(), req.GetPassword(), req.GetRole(), req.GetLocale())
 	if err != nil {
 		logger.Log.Error("Failed to register user", "error", err)
 		return nil, err
@@ -57,10 +57,12 @@ func (s *Server) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*user
 	}
 
 	return &userpb.UserResponse{
-		Id:    user.ID.Hex(),
-		Name:  user.Name,
-		Email: user.Email,
-		Role:  user.Role,
+		Id:      user.ID.Hex(),
+		Name:    user.Name,
+		Email:   user.Email,
+		Role:    user.Role,
+		Locale:  user.Locale,
+		Version: user.Version,
 	}, nil
 }
 
@@ -95,7 +97,10 @@ func (s *Server) GetAllUsers(ctx context.Context, req *userpb.GetAllUsersRequest
 	}
 
 	repo := &repositories.MongoUserRepository{}
-	users, totalCount, err := services.GetAllUsers(ctx, repo, page, pageSize)
+	users, totalCount, nextPageToken, err := services.GetAllUsers(ctx, repo, page, pageSize, req.GetPageToken())
+	if status.Code(err) == codes.InvalidArgument {
+		return nil, err
+	}
 	if err != nil {
 		logger.Log.Error("Failed to get users", "error", err)
 		return nil, status.Errorf(codes.Internal, "Failed to retrieve users")
@@ -104,17 +109,20 @@ func (s *Server) GetAllUsers(ctx context.Context, req *userpb.GetAllUsersRequest
 	protoUsers := []*userpb.UserResponse{}
 	for _, user := range users {
 		protoUsers = append(protoUsers, &userpb.UserResponse{
-			Id:    user.ID.Hex(),
-			Name:  user.Name,
-			Email: user.Email,
-			Role:  user.Role,
+			Id:      user.ID.Hex(),
+			Name:    user.Name,
+			Email:   user.Email,
+			Role:    user.Role,
+			Locale:  user.Locale,
+			Version: user.Version,
 		})
 	}
 	return &userpb.GetAllUsersResponse{
-		Users:       protoUsers,
-		Total:       totalCount,
-		CurrentPage: req.GetPage(),
-		TotalPages:  int64(math.Ceil(float64(totalCount) / float64(pageSize))),
+		Users:         protoUsers,
+		Total:         totalCount,
+		CurrentPage:   req.GetPage(),
+		TotalPages:    int64(math.Ceil(float64(totalCount) / float64(pageSize))),
+		NextPageToken: nextPageToken,
 	}, nil
 }
 
@@ -142,26 +150,30 @@ func (s *Server) UpdateUser(ctx context.Context, req *userpb.UpdateUserRequest)
 	if req.Role != nil {
 		updates["role"] = req.Role.GetValue()
 	}
+	if req.Locale != nil {
+		updates["locale"] = req.Locale.GetValue()
+	}
 
 	if len(updates) == 0 {
 		return nil, fmt.Errorf("no fields to update")
 	}
 
-	result, err := services.UpdateUser(ctx, repo, oid, updates)
+	user, err := services.UpdateUser(ctx, repo, oid, updates, req.GetExpectedVersion())
 
 	if err != nil {
-		if status.Code(err) == codes.AlreadyExists {
+		switch status.Code(err) {
+		case codes.AlreadyExists:
 			return nil, status.Errorf(codes.AlreadyExists, "Email already exists")
+		case codes.NotFound, codes.Aborted, codes.InvalidArgument:
+			return nil, err
 		}
 		return nil, status.Errorf(codes.Internal, "Failed to update user")
 	}
 
-	if result.MatchedCount == 0 {
-		return nil, status.Error(codes.NotFound, "User not found")
-	}
-
 	return &userpb.UpdateUserResponse{
-		Message: fmt.Sprintf("User updated (%d modified)", result.ModifiedCount),
+		Id:      user.ID.Hex(),
+		Message: "User updated",
+		Version: user.Version,
 	}, nil
 }
 
@@ -177,11 +189,14 @@ func (s *Server) DeleteUser(ctx context.Context, req *userpb.DeleteUserRequest)
 
 	repo := &repositories.MongoUserRepository{}
 
-	result, err := services.DeleteUser(ctx, repo, oid)
+	result, err := services.DeleteUser(ctx, repo, oid, req.GetExpectedVersion())
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			return nil, status.Errorf(codes.NotFound, "User not found")
 		}
+		if status.Code(err) == codes.Aborted {
+			return nil, err
+		}
 		return nil, status.Errorf(codes.Internal, "Failed to delete user")
 	}
 
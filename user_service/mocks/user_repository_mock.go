@@ -4,17 +4,21 @@ import (
 	"context"
 
 	"github.com/stretchr/testify/mock"
+	"github.com/tird4d/go-microservices/events/outbox"
 	"github.com/tird4d/go-microservices/user_service/models"
+	"github.com/tird4d/go-microservices/user_service/repositories"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type UserRepositoryMock struct {
 	mock.Mock
+
+	Outbox []*outbox.Message
 }
 
-func (m *UserRepositoryMock) InsertNewUser(user *models.User) (*mongo.InsertOneResult, error) {
-	args := m.Called(user)
+func (m *UserRepositoryMock) InsertNewUser(ctx context.Context, user *models.User, event *outbox.Message) (*mongo.InsertOneResult, error) {
+	args := m.Called(user, event)
 
 	if result, ok := args.Get(0).(*mongo.InsertOneResult); ok {
 		return result, args.Error(1)
@@ -47,6 +51,15 @@ func (m *UserRepositoryMock) FindUsers(ctx context.Context, skip, pageSize int64
 	return nil, args.Error(1)
 }
 
+func (m *UserRepositoryMock) FindUsersAfter(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]*models.User, error) {
+
+	args := m.Called(ctx, afterID, limit)
+	if users, ok := args.Get(0).([]*models.User); ok {
+		return users, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *UserRepositoryMock) CountUsers(ctx context.Context) (int64, error) {
 
 	args := m.Called(ctx)
@@ -56,17 +69,45 @@ func (m *UserRepositoryMock) CountUsers(ctx context.Context) (int64, error) {
 	return 0, args.Error(1)
 }
 
-func (m *UserRepositoryMock) UpdateUser(ctx context.Context, oid primitive.ObjectID, updates map[string]any) (*mongo.UpdateResult, error) {
-	args := m.Called(ctx, oid, updates)
+// UpdateUser takes an optional third return value: the updated user the
+// event is built from. Built events are collected in Outbox.
+func (m *UserRepositoryMock) UpdateUser(ctx context.Context, oid primitive.ObjectID, expectedVersion int64, updates map[string]any, event repositories.EventBuilder) (*mongo.UpdateResult, error) {
+	args := m.Called(ctx, oid, expectedVersion, updates)
+	if err := m.buildEvent(args, event); err != nil {
+		return nil, err
+	}
 	if result, ok := args.Get(0).(*mongo.UpdateResult); ok {
 		return result, args.Error(1)
 	}
 	return nil, args.Error(1)
 }
-func (m *UserRepositoryMock) DeleteUser(ctx context.Context, oid primitive.ObjectID) (*mongo.DeleteResult, error) {
-	args := m.Called(ctx, oid)
+
+// DeleteUser takes an optional third return value: the deleted user the
+// event is built from. Built events are collected in Outbox.
+func (m *UserRepositoryMock) DeleteUser(ctx context.Context, oid primitive.ObjectID, expectedVersion int64, event repositories.EventBuilder) (*mongo.DeleteResult, error) {
+	args := m.Called(ctx, oid, expectedVersion)
+	if err := m.buildEvent(args, event); err != nil {
+		return nil, err
+	}
 	if result, ok := args.Get(0).(*mongo.DeleteResult); ok {
 		return result, args.Error(1)
 	}
 	return nil, args.Error(1)
 }
+
+func (m *UserRepositoryMock) buildEvent(args mock.Arguments, event repositories.EventBuilder) error {
+	if len(args) < 3 {
+		return nil
+	}
+	user, ok := args.Get(2).(*models.User)
+	if !ok {
+		return nil
+	}
+
+	msg, err := event(user)
+	if err != nil {
+		return err
+	}
+	m.Outbox = append(m.Outbox, msg)
+	return nil
+}
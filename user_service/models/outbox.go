@@ -0,0 +1,12 @@
+package models
+
+import (
+	"github.com/tird4d/go-microservices/user_service/config"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// OutboxCollection holds the outbox messages (see package events/outbox)
+// written together with the changes they describe
+func OutboxCollection() *mongo.Collection {
+	return config.DB.Collection("outbox")
+}
@@ -12,6 +12,11 @@ type User struct {
 	Email    string             `bson:"email" json:"email"`
 	Password string             `bson:"password" json:"-"`
 	Role     string             `bson:"role" json:"role"`
+	// Locale is the preferred language as a BCP 47 tag, empty if unknown
+	Locale string `bson:"locale,omitempty" json:"locale,omitempty"`
+	// Version is incremented on every change and sent with user events so
+	// consumers can drop stale ones
+	Version int64 `bson:"version" json:"version"`
 }
 
 func UserCollection() *mongo.Collection {
@@ -2,8 +2,10 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"github.com/tird4d/go-microservices/events/outbox"
 	"github.com/tird4d/go-microservices/user_service/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,14 +15,30 @@ import (
 
 type MongoUserRepository struct{}
 
-func (r *MongoUserRepository) InsertNewUser(user *models.User) (*mongo.InsertOneResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// InsertNewUser inserts the user and its outbox event atomically, so the event
+// is never lost if the broker is down and never sent for a user that wasn't
+// stored
+func (r *MongoUserRepository) InsertNewUser(ctx context.Context, user *models.User, event *outbox.Message) (*mongo.InsertOneResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
-	result, err := models.UserCollection().InsertOne(ctx, user)
+	result, err := withTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		result, err := models.UserCollection().InsertOne(sc, user)
+		if err != nil {
+			return nil, err
+		}
 
-	defer cancel()
+		if _, err := models.OutboxCollection().InsertOne(sc, event); err != nil {
+			return nil, err
+		}
+
+		return result, nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	return result, err
+	return result.(*mongo.InsertOneResult), nil
 }
 
 func (r *MongoUserRepository) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
@@ -49,6 +67,7 @@ func (r *MongoUserRepository) FindUsers(ctx context.Context, skip, pageSize int6
 	defer cancel()
 
 	findOptions := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
 		SetSkip(int64(skip)).
 		SetLimit(int64(pageSize))
 
@@ -69,20 +88,143 @@ func (r *MongoUserRepository) FindUsers(ctx context.Context, skip, pageSize int6
 	return users, nil
 }
 
+// FindUsersAfter pages through users by _id, so users registering meanwhile
+// can't shift the pages
+func (r *MongoUserRepository) FindUsersAfter(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]*models.User, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if !afterID.IsZero() {
+		filter["_id"] = bson.M{"$gt": afterID}
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := models.UserCollection().Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
 func (r *MongoUserRepository) CountUsers(ctx context.Context) (int64, error) {
 
 	return models.UserCollection().CountDocuments(ctx, bson.M{})
 }
 
-func (r *MongoUserRepository) UpdateUser(ctx context.Context, oid primitive.ObjectID, updates map[string]any) (*mongo.UpdateResult, error) {
+func (r *MongoUserRepository) UpdateUser(ctx context.Context, oid primitive.ObjectID, expectedVersion int64, updates map[string]any, event EventBuilder) (*mongo.UpdateResult, error) {
+	result, err := withTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		user := &models.User{}
+		err := models.UserCollection().FindOneAndUpdate(sc,
+			versionFilter(oid, expectedVersion),
+			bson.M{"$set": updates, "$inc": bson.M{"version": 1}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(user)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if err := versionMismatch(sc, oid, expectedVersion); err != nil {
+				return nil, err
+			}
+			return &mongo.UpdateResult{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
 
-	filter := bson.M{"_id": oid}
-	updateFields := bson.M{"$set": updates}
+		if err := insertEvent(sc, user, event); err != nil {
+			return nil, err
+		}
 
-	return models.UserCollection().UpdateOne(ctx, filter, updateFields)
+		return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*mongo.UpdateResult), nil
 }
 
-func (r *MongoUserRepository) DeleteUser(ctx context.Context, oid primitive.ObjectID) (*mongo.DeleteResult, error) {
+func (r *MongoUserRepository) DeleteUser(ctx context.Context, oid primitive.ObjectID, expectedVersion int64, event EventBuilder) (*mongo.DeleteResult, error) {
+	result, err := withTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		user := &models.User{}
+		err := models.UserCollection().FindOneAndDelete(sc, versionFilter(oid, expectedVersion)).Decode(user)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if err := versionMismatch(sc, oid, expectedVersion); err != nil {
+				return nil, err
+			}
+			return &mongo.DeleteResult{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := insertEvent(sc, user, event); err != nil {
+			return nil, err
+		}
+
+		return &mongo.DeleteResult{DeletedCount: 1}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*mongo.DeleteResult), nil
+}
+
+// versionFilter matches the user, and only at expectedVersion unless it's 0
+func versionFilter(oid primitive.ObjectID, expectedVersion int64) bson.M {
 	filter := bson.M{"_id": oid}
-	return models.UserCollection().DeleteOne(ctx, filter)
+	if expectedVersion > 0 {
+		filter["version"] = expectedVersion
+	}
+	return filter
+}
+
+// versionMismatch returns ErrVersionMismatch when a versioned write matched
+// nothing although the user exists
+func versionMismatch(sc mongo.SessionContext, oid primitive.ObjectID, expectedVersion int64) error {
+	if expectedVersion == 0 {
+		return nil
+	}
+
+	count, err := models.UserCollection().CountDocuments(sc, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// withTransaction runs fn in a MongoDB transaction. Transactions need MongoDB
+// to run as a replica set.
+func withTransaction(ctx context.Context, fn func(sc mongo.SessionContext) (interface{}, error)) (interface{}, error) {
+	session, err := models.UserCollection().Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	return session.WithTransaction(ctx, fn)
+}
+
+func insertEvent(sc mongo.SessionContext, user *models.User, event EventBuilder) error {
+	msg, err := event(user)
+	if err != nil {
+		return err
+	}
+
+	_, err = models.OutboxCollection().InsertOne(sc, msg)
+	return err
 }
@@ -0,0 +1,25 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/tird4d/go-microservices/user_service/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MigrateMissingVersions gives users stored before they had a version
+// version 1, so none is served with ETag "0": version 0 means "no If-Match"
+// and would turn a conditional write into an unconditional one. Backfilled
+// users no longer match, which makes it safe to run on every start.
+func (r *MongoUserRepository) MigrateMissingVersions(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	result, err := models.UserCollection().UpdateMany(ctx,
+		bson.M{"version": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"version": 1}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
@@ -2,18 +2,36 @@ package repositories
 
 import (
 	"context"
+	"errors"
 
+	"github.com/tird4d/go-microservices/events/outbox"
 	"github.com/tird4d/go-microservices/user_service/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// EventBuilder builds the outbox event for a change from the affected user.
+// Update passes the user after the change, Delete the user that was removed.
+type EventBuilder func(user *models.User) (*outbox.Message, error)
+
 type UserRepository interface {
-	InsertNewUser(user *models.User) (*mongo.InsertOneResult, error)
+	// InsertNewUser stores the user and its outbox event in one transaction
+	InsertNewUser(ctx context.Context, user *models.User, event *outbox.Message) (*mongo.InsertOneResult, error)
 	FindUserByEmail(ctx context.Context, email string) (*models.User, error)
 	FindUserByID(ctx context.Context, oid primitive.ObjectID) (*models.User, error)
 	FindUsers(ctx context.Context, skip, pageSize int64) ([]*models.User, error)
+	// FindUsersAfter returns up to limit users with an _id after afterID, in
+	// _id order. A zero afterID starts from the first user.
+	FindUsersAfter(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]*models.User, error)
 	CountUsers(ctx context.Context) (int64, error)
-	UpdateUser(ctx context.Context, oid primitive.ObjectID, update map[string]any) (*mongo.UpdateResult, error)
-	DeleteUser(ctx context.Context, oid primitive.ObjectID) (*mongo.DeleteResult, error)
+	// UpdateUser applies update, increments the user's version and stores the
+	// event in the same transaction. An unknown user gives MatchedCount 0.
+	// A non-zero expectedVersion that doesn't match gives ErrVersionMismatch.
+	UpdateUser(ctx context.Context, oid primitive.ObjectID, expectedVersion int64, update map[string]any, event EventBuilder) (*mongo.UpdateResult, error)
+	// DeleteUser removes the user and stores the event in the same transaction.
+	// An unknown user gives DeletedCount 0; expectedVersion works like UpdateUser's.
+	DeleteUser(ctx context.Context, oid primitive.ObjectID, expectedVersion int64, event EventBuilder) (*mongo.DeleteResult, error)
 }
+
+// ErrVersionMismatch means the user changed since the caller read it
+var ErrVersionMismatch = errors.New("user version mismatch")
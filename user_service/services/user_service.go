@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 
+	"github.com/tird4d/go-microservices/events"
+	"github.com/tird4d/go-microservices/events/outbox"
+	"github.com/tird4d/go-microservices/pagination"
 	"github.com/tird4d/go-microservices/user_service/logger"
 	"github.com/tird4d/go-microservices/user_service/models"
 	"github.com/tird4d/go-microservices/user_service/repositories"
@@ -13,11 +17,17 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/text/language"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-func RegisterUser(ctx context.Context, repo repositories.UserRepository, name, email, password, role string) (*mongo.InsertOneResult, error) {
+func RegisterUser(ctx context.Context, repo repositories.UserRepository, name, email, password, role, locale string) (*mongo.InsertOneResult, error) {
+
+	locale, err := normalizeLocale(locale)
+	if err != nil {
+		return nil, err
+	}
 
 	// Check if the email is already registered
 	existingUser, err := repo.FindUserByEmail(ctx, email)
@@ -43,14 +53,30 @@ func RegisterUser(ctx context.Context, repo repositories.UserRepository, name, e
 		role = "user"
 	}
 
+	// The ID is assigned up front so the event can be written with the user
 	user := models.User{
+		ID:       primitive.NewObjectID(),
 		Name:     name,
 		Email:    email,
 		Password: hashedPassword,
 		Role:     role,
+		Locale:   locale,
+		Version:  1,
 	}
 
-	result, err := repo.InsertNewUser(&user)
+	event, err := outbox.NewMessage(ctx, events.UserExchange, events.UserRegisteredEvent{
+		UserID:      user.ID.Hex(),
+		Email:       user.Email,
+		Name:        user.Name,
+		Locale:      user.Locale,
+		UserVersion: user.Version,
+	})
+	if err != nil {
+		logger.Log.Errorw("Failed to build user registered event", "error", err)
+		return nil, status.Error(codes.Internal, "failed to register user")
+	}
+
+	result, err := repo.InsertNewUser(ctx, &user, event)
 	if err != nil {
 		logger.Log.Errorw("Insert user failed", "error", err)
 		return nil, fmt.Errorf("user insert failed: %w", err)
@@ -94,7 +120,13 @@ func GetUserByID(ctx context.Context, repo repositories.UserRepository, id strin
 	return user, nil
 }
 
-func GetAllUsers(ctx context.Context, repo repositories.UserRepository, page, pageSize int64) ([]*models.User, int64, error) {
+// usersPageScope is the scope of page tokens issued by GetAllUsers
+const usersPageScope = "users"
+
+// GetAllUsers returns a page of users in _id order. Without a pageToken it
+// pages by offset; with one it continues after the last user of the
+// previous page and ignores page. The returned token is empty on the last page.
+func GetAllUsers(ctx context.Context, repo repositories.UserRepository, page, pageSize int64, pageToken string) ([]*models.User, int64, string, error) {
 
 	if page < 1 {
 		page = 1
@@ -103,20 +135,67 @@ func GetAllUsers(ctx context.Context, repo repositories.UserRepository, page, pa
 		pageSize = 10
 	}
 
-	skip := (page - 1) * pageSize
+	var users []*models.User
+	var hasMore bool
+	if pageToken == "" {
+		skip := (page - 1) * pageSize
 
-	users, err := repo.FindUsers(ctx, skip, pageSize)
-	if err != nil {
-		return nil, 0, err
+		var err error
+		users, err = repo.FindUsers(ctx, skip, pageSize)
+		if err != nil {
+			return nil, 0, "", err
+		}
+	} else {
+		cursor, err := pagination.DecodeToken(pageToken, usersPageScope)
+		if err != nil {
+			return nil, 0, "", status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		afterID, err := primitive.ObjectIDFromHex(cursor.ID)
+		if err != nil {
+			return nil, 0, "", status.Error(codes.InvalidArgument, "invalid page token")
+		}
+
+		// One extra user tells whether another page follows
+		users, err = repo.FindUsersAfter(ctx, afterID, pageSize+1)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		if int64(len(users)) > pageSize {
+			users, hasMore = users[:pageSize], true
+		}
 	}
 
 	totalCount, err := repo.CountUsers(ctx)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, "", err
+	}
+	if pageToken == "" {
+		hasMore = (page-1)*pageSize+int64(len(users)) < totalCount
 	}
 
-	return users, totalCount, nil
+	nextPageToken := ""
+	if hasMore && len(users) > 0 {
+		nextPageToken, err = pagination.EncodeToken(pagination.Cursor{Scope: usersPageScope, ID: users[len(users)-1].ID.Hex()})
+		if err != nil {
+			return nil, 0, "", err
+		}
+	}
+
+	return users, totalCount, nextPageToken, nil
+
+}
 
+// normalizeLocale checks that locale is a BCP 47 language tag and returns it
+// in its canonical form; an empty locale stays empty
+func normalizeLocale(locale string) (string, error) {
+	if locale == "" {
+		return "", nil
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, "invalid locale")
+	}
+	return tag.String(), nil
 }
 
 type UpdateUserFields struct {
@@ -125,7 +204,18 @@ type UpdateUserFields struct {
 	Role  *string
 }
 
-func UpdateUser(ctx context.Context, repo repositories.UserRepository, oid primitive.ObjectID, updates map[string]any) (*mongo.UpdateResult, error) {
+// UpdateUser applies updates and returns the user as it is afterwards.
+// A non-zero expectedVersion makes it fail with Aborted if the user has been
+// changed since the caller read it.
+func UpdateUser(ctx context.Context, repo repositories.UserRepository, oid primitive.ObjectID, updates map[string]any, expectedVersion int64) (*models.User, error) {
+
+	if locale, ok := updates["locale"].(string); ok {
+		normalized, err := normalizeLocale(locale)
+		if err != nil {
+			return nil, err
+		}
+		updates["locale"] = normalized
+	}
 
 	if updates["email"] != nil {
 		existingUser, err := repo.FindUserByEmail(ctx, updates["email"].(string))
@@ -139,17 +229,43 @@ func UpdateUser(ctx context.Context, repo repositories.UserRepository, oid primi
 		}
 	}
 
-	result, err := repo.UpdateUser(ctx, oid, updates)
+	changedFields := make([]string, 0, len(updates))
+	for field := range updates {
+		changedFields = append(changedFields, field)
+	}
+	sort.Strings(changedFields)
+
+	var updated *models.User
+	result, err := repo.UpdateUser(ctx, oid, expectedVersion, updates, func(user *models.User) (*outbox.Message, error) {
+		updated = user
+		return outbox.NewMessage(ctx, events.UserExchange, events.UserUpdatedEvent{
+			UserID:        user.ID.Hex(),
+			Email:         user.Email,
+			Name:          user.Name,
+			Role:          user.Role,
+			Locale:        user.Locale,
+			ChangedFields: changedFields,
+			UserVersion:   user.Version,
+		})
+	})
 	if err != nil {
+		if errors.Is(err, repositories.ErrVersionMismatch) {
+			return nil, status.Error(codes.Aborted, "user was changed by someone else")
+		}
 
 		logger.Log.Errorw("Failed to update user", "error", err)
 		return nil, status.Error(codes.Internal, "failed to update user")
 	}
 
-	return result, nil
+	if result.MatchedCount == 0 {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+
+	return updated, nil
 }
 
-func DeleteUser(ctx context.Context, repo repositories.UserRepository, oid primitive.ObjectID) (*mongo.DeleteResult, error) {
+// DeleteUser removes the user; expectedVersion works like UpdateUser's
+func DeleteUser(ctx context.Context, repo repositories.UserRepository, oid primitive.ObjectID, expectedVersion int64) (*mongo.DeleteResult, error) {
 	_, err := repo.FindUserByID(ctx, oid)
 
 	if err != nil {
@@ -160,8 +276,16 @@ func DeleteUser(ctx context.Context, repo repositories.UserRepository, oid primi
 		return nil, err
 	}
 
-	result, err := repo.DeleteUser(ctx, oid)
+	result, err := repo.DeleteUser(ctx, oid, expectedVersion, func(user *models.User) (*outbox.Message, error) {
+		return outbox.NewMessage(ctx, events.UserExchange, events.UserDeletedEvent{
+			UserID:      user.ID.Hex(),
+			UserVersion: user.Version + 1,
+		})
+	})
 	if err != nil {
+		if errors.Is(err, repositories.ErrVersionMismatch) {
+			return nil, status.Error(codes.Aborted, "user was changed by someone else")
+		}
 		logger.Log.Errorw("Failed to delete user", "error", err)
 		return nil, status.Error(codes.Internal, "failed to delete user")
 	}
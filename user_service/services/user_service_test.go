@@ -9,9 +9,12 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/tird4d/go-microservices/events"
+	"github.com/tird4d/go-microservices/events/outbox"
 	"github.com/tird4d/go-microservices/user_service/logger"
 	"github.com/tird4d/go-microservices/user_service/mocks"
 	"github.com/tird4d/go-microservices/user_service/models"
+	"github.com/tird4d/go-microservices/user_service/repositories"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc/codes"
@@ -30,11 +33,26 @@ func TestMain(m *testing.M) {
 	if os.Getenv("JWT_SECRET") == "" {
 		os.Setenv("JWT_SECRET", "test-secret-key-for-ci")
 	}
+	if os.Getenv("PAGE_TOKEN_SECRET") == "" {
+		os.Setenv("PAGE_TOKEN_SECRET", "test-page-token-secret")
+	}
 
 	os.Exit(m.Run())
 
 }
 
+func decodeOutboxPayload[T events.Payload](t *testing.T, msg *outbox.Message) T {
+	t.Helper()
+
+	env, err := events.Decode(msg.Payload)
+	assert.NoError(t, err)
+
+	event, err := events.DecodePayload[T](env)
+	assert.NoError(t, err)
+
+	return event
+}
+
 func TestRegisterUser_Success(t *testing.T) {
 
 	//Context
@@ -55,9 +73,9 @@ func TestRegisterUser_Success(t *testing.T) {
 
 	mockRepo.On("InsertNewUser", mock.MatchedBy(func(u *models.User) bool {
 		return u.Email == "test@test.com" && u.Name == "test"
-	})).Return(&mongo.InsertOneResult{InsertedID: id}, nil)
+	}), mock.Anything).Return(&mongo.InsertOneResult{InsertedID: id}, nil)
 
-	result, err := RegisterUser(ctx, mockRepo, user.Name, user.Email, user.Password, user.Role)
+	result, err := RegisterUser(ctx, mockRepo, user.Name, user.Email, user.Password, user.Role, "")
 
 	mockRepo.AssertExpectations(t)
 	assert.NoError(t, err)
@@ -66,6 +84,45 @@ func TestRegisterUser_Success(t *testing.T) {
 
 }
 
+func TestRegisterUser_WritesOutboxEvent(t *testing.T) {
+
+	ctx := context.Background()
+
+	mockRepo := new(mocks.UserRepositoryMock)
+
+	mockRepo.On("FindUserByEmail", "test@test.com").Return(nil, nil)
+
+	var stored *models.User
+	var message *outbox.Message
+	mockRepo.On("InsertNewUser", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(*models.User)
+		message = args.Get(1).(*outbox.Message)
+	}).Return(&mongo.InsertOneResult{}, nil)
+
+	_, err := RegisterUser(ctx, mockRepo, "test", "test@test.com", "123456", "", "de_at")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "de-AT", stored.Locale)
+	assert.Equal(t, events.UserExchange, message.Exchange)
+	assert.Equal(t, events.UserRegistered, message.EventType)
+	assert.Equal(t, outbox.StatusPending, message.Status)
+
+	event := decodeOutboxPayload[events.UserRegisteredEvent](t, message)
+	assert.Equal(t, stored.ID.Hex(), event.UserID)
+	assert.Equal(t, "test@test.com", event.Email)
+	assert.Equal(t, "de-AT", event.Locale)
+	assert.Equal(t, int64(1), event.UserVersion)
+}
+
+func TestRegisterUser_InvalidLocale(t *testing.T) {
+	mockRepo := new(mocks.UserRepositoryMock)
+
+	_, err := RegisterUser(context.Background(), mockRepo, "test", "test@test.com", "123456", "", "not a locale")
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	mockRepo.AssertNotCalled(t, "InsertNewUser", mock.Anything, mock.Anything)
+}
+
 func TestRegisterUser_UserAlreadyExists(t *testing.T) {
 
 	//Context
@@ -83,7 +140,7 @@ func TestRegisterUser_UserAlreadyExists(t *testing.T) {
 		return true
 	})).Return(&user, nil)
 
-	_, err := RegisterUser(ctx, mockRepo, user.Name, user.Email, user.Password, user.Role)
+	_, err := RegisterUser(ctx, mockRepo, user.Name, user.Email, user.Password, user.Role, "")
 
 	assert.ErrorContains(t, err, "email already registered")
 }
@@ -194,7 +251,7 @@ func TestGetAllUsers(t *testing.T) {
 
 	page := int32(1)
 	pageSize := int32(10)
-	result, totalCount, err := GetAllUsers(ctx, mockRepo, int64(page), int64(pageSize))
+	result, totalCount, _, err := GetAllUsers(ctx, mockRepo, int64(page), int64(pageSize), "")
 	mockRepo.AssertExpectations(t)
 	mockRepo.AssertNumberOfCalls(t, "CountUsers", 1)
 	mockRepo.AssertNumberOfCalls(t, "FindUsers", 1)
@@ -218,7 +275,7 @@ func TestGetAllUsers_EmptyResult(t *testing.T) {
 
 	page := int32(1)
 	pageSize := int32(10)
-	result, totalCount, err := GetAllUsers(ctx, mockRepo, int64(page), int64(pageSize))
+	result, totalCount, _, err := GetAllUsers(ctx, mockRepo, int64(page), int64(pageSize), "")
 	mockRepo.AssertExpectations(t)
 	assert.NoError(t, err)
 	assert.Empty(t, result)
@@ -232,13 +289,50 @@ func TestGetAllUsers_Error(t *testing.T) {
 
 	page := int32(1)
 	pageSize := int32(10)
-	result, totalCount, err := GetAllUsers(ctx, mockRepo, int64(page), int64(pageSize))
+	result, totalCount, _, err := GetAllUsers(ctx, mockRepo, int64(page), int64(pageSize), "")
 	mockRepo.AssertExpectations(t)
 	assert.Error(t, err)
 	assert.Nil(t, result)
 	assert.Equal(t, totalCount, int64(0))
 }
 
+func TestGetAllUsers_PageToken(t *testing.T) {
+	ctx := context.Background()
+
+	mockRepo := new(mocks.UserRepositoryMock)
+	users := []*models.User{
+		{ID: primitive.NewObjectID(), Name: "test1"},
+		{ID: primitive.NewObjectID(), Name: "test2"},
+		{ID: primitive.NewObjectID(), Name: "test3"},
+	}
+	mockRepo.On("CountUsers", mock.Anything).Return(int64(len(users)), nil)
+	mockRepo.On("FindUsers", mock.Anything, int64(0), int64(2)).Return(users[:2], nil)
+	mockRepo.On("FindUsersAfter", mock.Anything, users[1].ID, int64(3)).Return(users[2:], nil)
+
+	_, _, token, err := GetAllUsers(ctx, mockRepo, 1, 2, "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	result, totalCount, token, err := GetAllUsers(ctx, mockRepo, 5, 2, token)
+	mockRepo.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, users[2:], result)
+	assert.Equal(t, int64(3), totalCount)
+	assert.Empty(t, token)
+}
+
+func TestGetAllUsers_InvalidPageToken(t *testing.T) {
+	ctx := context.Background()
+
+	mockRepo := new(mocks.UserRepositoryMock)
+
+	result, _, _, err := GetAllUsers(ctx, mockRepo, 1, 10, "bogus")
+	mockRepo.AssertNotCalled(t, "FindUsersAfter")
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Nil(t, result)
+}
+
 func TestUpdateUser_Success(t *testing.T) {
 	//Context
 	ctx := context.Background()
@@ -254,18 +348,43 @@ func TestUpdateUser_Success(t *testing.T) {
 	}
 	mockRepo.On("FindUserByEmail", mock.Anything).Return(&user, nil)
 
-	mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+	updated := &models.User{ID: id, Name: "updated", Email: "updated@test.com", Role: "user", Version: 2}
+	mockRepo.On("UpdateUser", mock.Anything, mock.Anything, int64(0), mock.Anything).Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil, updated)
 	result, err := UpdateUser(ctx, mockRepo, id, map[string]any{
 		"name":  "updated",
 		"email": "updated@test.com",
 		"role":  "user",
-	})
+	}, 0)
 	mockRepo.AssertExpectations(t)
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
-	assert.Equal(t, int64(1), result.MatchedCount)
-	assert.Equal(t, int64(1), result.ModifiedCount)
+	assert.Equal(t, "updated", result.Name)
+	assert.Equal(t, int64(2), result.Version)
+}
+func TestUpdateUser_WritesUserUpdatedEvent(t *testing.T) {
+	ctx := context.Background()
+
+	mockRepo := new(mocks.UserRepositoryMock)
+	id := primitive.NewObjectID()
+	updated := &models.User{ID: id, Name: "test", Email: "new@test.com", Role: "user", Locale: "fr", Version: 3}
+
+	mockRepo.On("FindUserByEmail", "new@test.com").Return(nil, nil)
+	mockRepo.On("UpdateUser", mock.Anything, id, int64(0), map[string]any{"email": "new@test.com", "locale": "fr"}).Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil, updated)
+
+	_, err := UpdateUser(ctx, mockRepo, id, map[string]any{"email": "new@test.com", "locale": "FR"}, 0)
+
+	assert.NoError(t, err)
+	assert.Len(t, mockRepo.Outbox, 1)
+	assert.Equal(t, events.UserUpdated, mockRepo.Outbox[0].RoutingKey)
+
+	event := decodeOutboxPayload[events.UserUpdatedEvent](t, mockRepo.Outbox[0])
+	assert.Equal(t, id.Hex(), event.UserID)
+	assert.Equal(t, "new@test.com", event.Email)
+	assert.Equal(t, "fr", event.Locale)
+	assert.Equal(t, []string{"email", "locale"}, event.ChangedFields)
+	assert.Equal(t, int64(3), event.UserVersion)
 }
+
 func TestUpdateUser_UserNotFound(t *testing.T) {
 	//Context
 	ctx := context.Background()
@@ -274,16 +393,32 @@ func TestUpdateUser_UserNotFound(t *testing.T) {
 	id := primitive.NewObjectID()
 
 	mockRepo.On("FindUserByEmail", mock.Anything).Return(nil, nil)
-	mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{MatchedCount: 0}, nil)
+	mockRepo.On("UpdateUser", mock.Anything, mock.Anything, int64(0), mock.Anything).Return(&mongo.UpdateResult{MatchedCount: 0}, nil)
 
 	result, err := UpdateUser(ctx, mockRepo, id, map[string]any{
 		"name":  "updated",
 		"email": "updated@test.com",
 		"role":  "user",
-	})
+	}, 0)
 	mockRepo.AssertExpectations(t)
-	assert.Equal(t, int64(0), result.MatchedCount)
-	assert.NoError(t, err)
+	assert.Nil(t, result)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestUpdateUser_VersionMismatchIsAborted(t *testing.T) {
+	ctx := context.Background()
+
+	mockRepo := new(mocks.UserRepositoryMock)
+	id := primitive.NewObjectID()
+
+	mockRepo.On("UpdateUser", mock.Anything, id, int64(4), mock.Anything).Return(nil, repositories.ErrVersionMismatch)
+
+	result, err := UpdateUser(ctx, mockRepo, id, map[string]any{"name": "updated"}, 4)
+
+	mockRepo.AssertExpectations(t)
+	assert.Nil(t, result)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Empty(t, mockRepo.Outbox)
 }
 
 func TestUpdateUser_EmailAlreadyExists(t *testing.T) {
@@ -305,7 +440,7 @@ func TestUpdateUser_EmailAlreadyExists(t *testing.T) {
 		"name":  "updated",
 		"email": "test@test.com",
 		"role":  "user",
-	})
+	}, 0)
 	mockRepo.AssertExpectations(t)
 	assert.Nil(t, result)
 	st, _ := status.FromError(err)
@@ -320,14 +455,35 @@ func TestDeleteUser_Success(t *testing.T) {
 	id := primitive.NewObjectID()
 
 	mockRepo.On("FindUserByID", mock.Anything, mock.Anything).Return(&models.User{ID: id}, nil)
-	mockRepo.On("DeleteUser", mock.Anything, mock.Anything).Return(&mongo.DeleteResult{DeletedCount: 1}, nil)
+	mockRepo.On("DeleteUser", mock.Anything, mock.Anything, int64(0)).Return(&mongo.DeleteResult{DeletedCount: 1}, nil)
 
-	result, err := DeleteUser(ctx, mockRepo, id)
+	result, err := DeleteUser(ctx, mockRepo, id, 0)
 	mockRepo.AssertExpectations(t)
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, int64(1), result.DeletedCount)
 }
+func TestDeleteUser_WritesUserDeletedEvent(t *testing.T) {
+	ctx := context.Background()
+
+	mockRepo := new(mocks.UserRepositoryMock)
+	id := primitive.NewObjectID()
+	user := &models.User{ID: id, Version: 2}
+
+	mockRepo.On("FindUserByID", mock.Anything, id).Return(user, nil)
+	mockRepo.On("DeleteUser", mock.Anything, id, int64(0)).Return(&mongo.DeleteResult{DeletedCount: 1}, nil, user)
+
+	_, err := DeleteUser(ctx, mockRepo, id, 0)
+
+	assert.NoError(t, err)
+	assert.Len(t, mockRepo.Outbox, 1)
+	assert.Equal(t, events.UserDeleted, mockRepo.Outbox[0].RoutingKey)
+
+	event := decodeOutboxPayload[events.UserDeletedEvent](t, mockRepo.Outbox[0])
+	assert.Equal(t, id.Hex(), event.UserID)
+	assert.Equal(t, int64(3), event.UserVersion)
+}
+
 func TestDeleteUser_UserNotFound(t *testing.T) {
 	//Context
 	ctx := context.Background()
@@ -337,7 +493,7 @@ func TestDeleteUser_UserNotFound(t *testing.T) {
 
 	mockRepo.On("FindUserByID", mock.Anything, mock.Anything).Return(nil, mongo.ErrNoDocuments)
 
-	result, err := DeleteUser(ctx, mockRepo, id)
+	result, err := DeleteUser(ctx, mockRepo, id, 0)
 	mockRepo.AssertExpectations(t)
 	assert.Error(t, err)
 	assert.Nil(t, result)
@@ -350,9 +506,9 @@ func TestDeleteUser_Error(t *testing.T) {
 	id := primitive.NewObjectID()
 
 	mockRepo.On("FindUserByID", mock.Anything, mock.Anything).Return(&models.User{ID: id}, nil)
-	mockRepo.On("DeleteUser", mock.Anything, mock.Anything).Return(nil, errors.New("database error"))
+	mockRepo.On("DeleteUser", mock.Anything, mock.Anything, int64(0)).Return(nil, errors.New("database error"))
 
-	result, err := DeleteUser(ctx, mockRepo, id)
+	result, err := DeleteUser(ctx, mockRepo, id, 0)
 	mockRepo.AssertExpectations(t)
 	assert.Error(t, err)
 	assert.Nil(t, result)
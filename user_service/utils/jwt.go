@@ -1,61 +0,0 @@
-package utils
-
-import (
-	"errors"
-	"fmt"
-	"os"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-)
-
-func GenerateJWT(userId primitive.ObjectID, role string) (string, error) {
-	_ = userId
-
-	secret := os.Getenv("JWT_SECRET")
-
-	if secret == "" {
-		return "", errors.New("JWT_SECRET is not set")
-	}
-
-	claims := jwt.MapClaims{
-		"user_id": userId.Hex(),
-		"role":    role,
-		"auth_at": time.Now().Unix(),
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secret))
-
-	fmt.Println(token)
-	return tokenString, err
-
-}
-
-func ValidateJWT(tokenString string) (jwt.MapClaims, error) {
-
-	secret := os.Getenv("JWT_SECRET")
-
-	if secret == "" {
-		return nil, errors.New("JWT_SECRET is not set")
-	}
-
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(secret), nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
-	}
-
-	return nil, errors.New("invalid token")
-}